@@ -0,0 +1,233 @@
+// Package age encrypts data to the X25519 recipients of age
+// (https://age-encryption.org/v1), so that values can be written where
+// plaintext secrets mustn't be and decrypted with the age tool and the
+// matching identities.  Only encryption is implemented, pentagon never holds
+// the identities.
+package age
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// RecipientPrefix is the human-readable part of X25519 recipients.
+	RecipientPrefix = "age"
+
+	// ArmorHeader and ArmorFooter surround ASCII armored files.
+	ArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	ArmorFooter = "-----END AGE ENCRYPTED FILE-----"
+
+	version    = "age-encryption.org/v1"
+	x25519Info = "age-encryption.org/v1/X25519"
+
+	fileKeySize = 16
+	nonceSize   = 16
+	chunkSize   = 64 * 1024
+
+	// columns is the width of the base64 lines of stanza bodies and of
+	// the armor.
+	columns = 64
+)
+
+// b64 encodes the header, which uses unpadded base64.
+var b64 = base64.RawStdEncoding
+
+// Recipient is the X25519 public key of an age identity.
+type Recipient struct {
+	key [32]byte
+}
+
+// ParseRecipient parses an X25519 recipient like "age1...".
+func ParseRecipient(s string) (*Recipient, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q: %s", s, err)
+	}
+	if hrp != RecipientPrefix {
+		return nil, fmt.Errorf("invalid age recipient %q: not an X25519 recipient", s)
+	}
+	key, err := convertBits(data, 5, 8, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q: %s", s, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid age recipient %q: wrong key length", s)
+	}
+
+	r := &Recipient{}
+	copy(r.key[:], key)
+	return r, nil
+}
+
+// wrap returns the stanza of fileKey for the recipient.
+func (r *Recipient) wrap(fileKey []byte, random io.Reader) (string, error) {
+	var ephemeral, share, shared [32]byte
+	if _, err := io.ReadFull(random, ephemeral[:]); err != nil {
+		return "", err
+	}
+	curve25519.ScalarBaseMult(&share, &ephemeral)
+	curve25519.ScalarMult(&shared, &ephemeral, &r.key)
+	if shared == [32]byte{} {
+		return "", fmt.Errorf("recipient is a low order point")
+	}
+
+	salt := make([]byte, 0, 64)
+	salt = append(salt, share[:]...)
+	salt = append(salt, r.key[:]...)
+	wrapKey, err := deriveKey(shared[:], salt, x25519Info)
+	if err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return "", err
+	}
+	body := aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil)
+
+	return fmt.Sprintf("-> X25519 %s\n%s", b64.EncodeToString(share[:]), wrapLines(b64.EncodeToString(body))), nil
+}
+
+// Encrypter encrypts data to a set of recipients.
+type Encrypter struct {
+	recipients []*Recipient
+	random     io.Reader
+}
+
+// NewEncrypter returns an Encrypter for recipients like "age1...".  At least
+// one recipient is required.
+func NewEncrypter(recipients ...string) (*Encrypter, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one age recipient is required")
+	}
+	e := &Encrypter{random: rand.Reader}
+	for _, s := range recipients {
+		r, err := ParseRecipient(s)
+		if err != nil {
+			return nil, err
+		}
+		e.recipients = append(e.recipients, r)
+	}
+	return e, nil
+}
+
+// Encrypt returns plaintext encrypted to every recipient of e, ASCII
+// armored.
+func (e *Encrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	fileKey := make([]byte, fileKeySize)
+	if _, err := io.ReadFull(e.random, fileKey); err != nil {
+		return nil, fmt.Errorf("error generating file key: %s", err)
+	}
+
+	header := &bytes.Buffer{}
+	header.WriteString(version + "\n")
+	for _, r := range e.recipients {
+		stanza, err := r.wrap(fileKey, e.random)
+		if err != nil {
+			return nil, fmt.Errorf("error wrapping file key: %s", err)
+		}
+		header.WriteString(stanza)
+	}
+	header.WriteString("---")
+
+	macKey, err := deriveKey(fileKey, nil, "header")
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header.Bytes())
+	header.WriteString(" " + b64.EncodeToString(mac.Sum(nil)) + "\n")
+
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(e.random, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %s", err)
+	}
+	payloadKey, err := deriveKey(fileKey, nonce, "payload")
+	if err != nil {
+		return nil, err
+	}
+	payload, err := seal(payloadKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	file := append(header.Bytes(), nonce...)
+	return armor(append(file, payload...)), nil
+}
+
+// seal encrypts plaintext with the STREAM construction of age: chunks of
+// chunkSize bytes, each with the chunk counter and a flag set on the last
+// chunk as its nonce.
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(plaintext)+(len(plaintext)/chunkSize+1)*aead.Overhead())
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	for counter := uint64(0); ; counter++ {
+		end := len(plaintext)
+		if end > chunkSize {
+			end = chunkSize
+		}
+		chunk := plaintext[:end]
+		plaintext = plaintext[end:]
+
+		for i := 0; i < 8; i++ {
+			nonce[10-i] = byte(counter >> (8 * uint(i)))
+		}
+		if len(plaintext) == 0 {
+			nonce[11] = 1
+		}
+		sealed = aead.Seal(sealed, nonce, chunk, nil)
+		if len(plaintext) == 0 {
+			return sealed, nil
+		}
+	}
+}
+
+// deriveKey returns the 32 byte HKDF-SHA-256 key of secret.
+func deriveKey(secret, salt []byte, info string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, fmt.Errorf("error deriving %s key: %s", info, err)
+	}
+	return key, nil
+}
+
+// wrapLines splits s in lines of columns characters, the last one being
+// shorter, possibly empty.
+func wrapLines(s string) string {
+	lines := &strings.Builder{}
+	for len(s) >= columns {
+		lines.WriteString(s[:columns] + "\n")
+		s = s[columns:]
+	}
+	lines.WriteString(s + "\n")
+	return lines.String()
+}
+
+// armor returns file encoded in PEM-like ASCII armor.
+func armor(file []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(file)
+	armored := &bytes.Buffer{}
+	armored.WriteString(ArmorHeader + "\n")
+	for len(encoded) > columns {
+		armored.WriteString(encoded[:columns] + "\n")
+		encoded = encoded[columns:]
+	}
+	armored.WriteString(encoded + "\n")
+	armored.WriteString(ArmorFooter + "\n")
+	return armored.Bytes()
+}
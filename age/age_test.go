@@ -0,0 +1,225 @@
+package age
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// testIdentity and testRecipient are a key pair of the age test kit.
+	testIdentity  = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+	testRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+)
+
+// parseIdentity returns the X25519 scalar of an "AGE-SECRET-KEY-1..."
+// identity.
+func parseIdentity(t *testing.T, s string) [32]byte {
+	hrp, data, err := bech32Decode(s)
+	if err != nil || hrp != "age-secret-key-" {
+		t.Fatalf("invalid identity %s: %v", s, err)
+	}
+	key, err := convertBits(data, 5, 8, false)
+	if err != nil || len(key) != 32 {
+		t.Fatalf("invalid identity %s: %v", s, err)
+	}
+	var scalar [32]byte
+	copy(scalar[:], key)
+	return scalar
+}
+
+// decrypt decrypts an armored age file with identity, following the age
+// specification independently of Encrypt.
+func decrypt(armored []byte, identity [32]byte) ([]byte, error) {
+	lines := strings.Split(strings.TrimSuffix(string(armored), "\n"), "\n")
+	if len(lines) < 3 || lines[0] != ArmorHeader || lines[len(lines)-1] != ArmorFooter {
+		return nil, fmt.Errorf("invalid armor")
+	}
+	for _, line := range lines[1 : len(lines)-2] {
+		if len(line) != columns {
+			return nil, fmt.Errorf("armor line of %d columns", len(line))
+		}
+	}
+	file, err := base64.StdEncoding.DecodeString(strings.Join(lines[1:len(lines)-1], ""))
+	if err != nil {
+		return nil, err
+	}
+
+	end := bytes.Index(file, []byte("\n--- "))
+	if end < 0 {
+		return nil, fmt.Errorf("no header MAC")
+	}
+	header := file[:end+len("\n---")]
+	rest := file[end+len("\n--- "):]
+	newline := bytes.IndexByte(rest, '\n')
+	mac, err := b64.DecodeString(string(rest[:newline]))
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[newline+1:]
+
+	headerLines := strings.Split(string(header), "\n")
+	if headerLines[0] != version {
+		return nil, fmt.Errorf("unexpected version %q", headerLines[0])
+	}
+
+	var public [32]byte
+	curve25519.ScalarBaseMult(&public, &identity)
+	var fileKey []byte
+	for i := 1; i < len(headerLines)-1; i++ {
+		args := strings.Split(headerLines[i], " ")
+		if len(args) != 3 || args[0] != "->" || args[1] != "X25519" {
+			return nil, fmt.Errorf("unexpected stanza %q", headerLines[i])
+		}
+		body := ""
+		for i++; ; i++ {
+			body += headerLines[i]
+			if len(headerLines[i]) < columns {
+				break
+			}
+		}
+
+		share, err := b64.DecodeString(args[2])
+		if err != nil || len(share) != 32 {
+			return nil, fmt.Errorf("invalid share %q", args[2])
+		}
+		wrapped, err := b64.DecodeString(body)
+		if err != nil {
+			return nil, err
+		}
+
+		var theirs, shared [32]byte
+		copy(theirs[:], share)
+		curve25519.ScalarMult(&shared, &identity, &theirs)
+		wrapKey, err := deriveKey(shared[:], append(share, public[:]...), x25519Info)
+		if err != nil {
+			return nil, err
+		}
+		aead, _ := chacha20poly1305.New(wrapKey)
+		key, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), wrapped, nil)
+		if err == nil {
+			fileKey = key
+		}
+	}
+	if fileKey == nil {
+		return nil, fmt.Errorf("no stanza for the identity")
+	}
+
+	macKey, _ := deriveKey(fileKey, nil, "header")
+	expected := hmac.New(sha256.New, macKey)
+	expected.Write(header)
+	if !hmac.Equal(mac, expected.Sum(nil)) {
+		return nil, fmt.Errorf("invalid header MAC")
+	}
+
+	payloadKey, _ := deriveKey(fileKey, rest[:nonceSize], "payload")
+	aead, _ := chacha20poly1305.New(payloadKey)
+	rest = rest[nonceSize:]
+	plaintext := []byte{}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	for counter := byte(0); ; counter++ {
+		size := chunkSize + aead.Overhead()
+		if len(rest) < size {
+			size = len(rest)
+		}
+		nonce[10] = counter
+		if size == len(rest) {
+			nonce[11] = 1
+		}
+		chunk, err := aead.Open(nil, nonce, rest[:size], nil)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %s", counter, err)
+		}
+		plaintext = append(plaintext, chunk...)
+		rest = rest[size:]
+		if len(rest) == 0 {
+			return plaintext, nil
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	identity := parseIdentity(t, testIdentity)
+	other := [32]byte{8}
+	var otherPublic [32]byte
+	curve25519.ScalarBaseMult(&otherPublic, &other)
+	otherRecipient := bech32Encode(t, RecipientPrefix, otherPublic[:])
+
+	e, err := NewEncrypter(otherRecipient, testRecipient)
+	if err != nil {
+		t.Fatalf("unable to create encrypter: %s", err)
+	}
+
+	for _, size := range []int{0, 5, chunkSize, chunkSize + 1, 2*chunkSize + 7} {
+		plaintext := bytes.Repeat([]byte("s"), size)
+		armored, err := e.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("unable to encrypt %d bytes: %s", size, err)
+		}
+		if size > 0 && bytes.Contains(armored, plaintext) {
+			t.Fatalf("%d bytes were left in plaintext", size)
+		}
+
+		for name, key := range map[string][32]byte{"test": identity, "other": other} {
+			decrypted, err := decrypt(armored, key)
+			if err != nil {
+				t.Fatalf("unable to decrypt %d bytes with the %s identity: %s", size, name, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("%d bytes didn't round-trip with the %s identity", size, name)
+			}
+		}
+	}
+
+	if _, err := decrypt(mustEncrypt(t, e, []byte("secret")), [32]byte{16}); err == nil {
+		t.Fatal("a file shouldn't be decrypted by other identities")
+	}
+
+	if bytes.Equal(mustEncrypt(t, e, []byte("secret")), mustEncrypt(t, e, []byte("secret"))) {
+		t.Fatal("encrypting the same plaintext twice should use different keys")
+	}
+}
+
+func mustEncrypt(t *testing.T, e *Encrypter, plaintext []byte) []byte {
+	armored, err := e.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("unable to encrypt: %s", err)
+	}
+	return armored
+}
+
+func TestParseRecipient(t *testing.T) {
+	r, err := ParseRecipient(testRecipient)
+	if err != nil {
+		t.Fatalf("unable to parse %s: %s", testRecipient, err)
+	}
+	identity := parseIdentity(t, testIdentity)
+	var public [32]byte
+	curve25519.ScalarBaseMult(&public, &identity)
+	if r.key != public {
+		t.Fatalf("recipient doesn't match the identity: %x", r.key)
+	}
+
+	for _, invalid := range []string{
+		"",
+		testIdentity,
+		strings.ToUpper(testRecipient[:10]) + testRecipient[10:],
+		testRecipient[:len(testRecipient)-1] + "q",
+		bech32Encode(t, RecipientPrefix, public[:31]),
+	} {
+		if _, err := ParseRecipient(invalid); err == nil {
+			t.Errorf("%q should be refused", invalid)
+		}
+	}
+
+	if _, err := NewEncrypter(); err == nil {
+		t.Error("an encrypter without recipients should be refused")
+	}
+}
@@ -0,0 +1,102 @@
+package age
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bech32Charset maps the 5-bit groups of bech32 strings to characters.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Generator is the generator of the bech32 checksum.
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// bech32Polymod returns the checksum of values.
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range bech32Generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand returns the values of hrp that the checksum covers.
+func bech32HRPExpand(hrp string) []byte {
+	values := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	return values
+}
+
+// bech32Decode returns the human-readable part and the data of the bech32
+// string s, checking its checksum.  Unlike BIP 173, strings aren't limited
+// to 90 characters.
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("mixed case")
+	}
+	s = strings.ToLower(s)
+
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, fmt.Errorf("invalid separator position")
+	}
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("invalid character in human-readable part")
+		}
+	}
+
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", s[i])
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid checksum")
+	}
+	return hrp, values[:len(values)-6], nil
+}
+
+// convertBits regroups the from-bit groups of data into to-bit groups.
+// Without pad, leftover bits must be zero and fewer than from.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<to - 1
+	out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	for _, v := range data {
+		if uint32(v)>>from != 0 {
+			return nil, fmt.Errorf("invalid %d-bit group %d", from, v)
+		}
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return out, nil
+}
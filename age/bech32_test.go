@@ -0,0 +1,61 @@
+package age
+
+import (
+	"strings"
+	"testing"
+)
+
+// bech32Encode returns the bech32 string of data with the human-readable
+// part hrp.
+func bech32Encode(t *testing.T, hrp string, data []byte) string {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		t.Fatalf("unable to convert %x: %s", data, err)
+	}
+	checksum := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	for i := 0; i < 6; i++ {
+		values = append(values, byte(checksum>>uint(5*(5-i))&31))
+	}
+
+	encoded := &strings.Builder{}
+	encoded.WriteString(hrp + "1")
+	for _, v := range values {
+		encoded.WriteByte(bech32Charset[v])
+	}
+	return encoded.String()
+}
+
+func TestBech32Decode(t *testing.T) {
+	// test vectors of BIP 173.
+	for _, valid := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+	} {
+		if _, _, err := bech32Decode(valid); err != nil {
+			t.Errorf("%s should be valid: %s", valid, err)
+		}
+	}
+	for _, invalid := range []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"a12UEL5L",
+	} {
+		if _, _, err := bech32Decode(invalid); err == nil {
+			t.Errorf("%s should be invalid", invalid)
+		}
+	}
+
+	data := []byte("pentagon")
+	hrp, values, err := bech32Decode(bech32Encode(t, "test", data))
+	if err != nil {
+		t.Fatalf("unable to decode: %s", err)
+	}
+	decoded, err := convertBits(values, 5, 8, false)
+	if err != nil || hrp != "test" || string(decoded) != string(data) {
+		t.Fatalf("unexpected round-trip: %s %q %v", hrp, decoded, err)
+	}
+}
@@ -0,0 +1,259 @@
+package pentagon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AuditKey is the key of the audit log in the data of the ConfigMap written
+// by a ConfigMapAuditor.
+const AuditKey = "audit.jsonl"
+
+// AuditEntry records a change to a secret.  It lists the keys that changed
+// but never their values.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Secret    string    `json:"secret"`
+	VaultPath string    `json:"vaultPath,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Created   bool      `json:"created,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Added     []string  `json:"added,omitempty"`
+	Removed   []string  `json:"removed,omitempty"`
+	Modified  []string  `json:"modified,omitempty"`
+}
+
+// Auditor records the changes made by a pass.
+type Auditor interface {
+	Audit(ctx context.Context, entries []AuditEntry) error
+}
+
+// WithAuditor adds auditor to the auditors recording the secrets that are
+// written or deleted.  The changes are recorded once per call to Reflect,
+// Sync or Rollback, and failing to record them is logged without failing
+// the pass.
+func WithAuditor(auditor Auditor) Option {
+	return func(r *Reflector) {
+		r.auditors = append(r.auditors, auditor)
+	}
+}
+
+// auditChange records the change from current, nil for a new secret, to
+// newSecret.  Changes that don't touch the data aren't recorded.
+func (r *Reflector) auditChange(mapping Mapping, current, newSecret *v1.Secret) {
+	if len(r.auditors) == 0 {
+		return
+	}
+
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		Namespace: r.k8sNamespace,
+		Secret:    newSecret.Name,
+		VaultPath: mapping.VaultPath,
+		Version:   newSecret.Annotations[VersionAnnotation],
+	}
+	if current == nil {
+		entry.Created = true
+		entry.Added = sortedKeys(newSecret.Data)
+	} else {
+		for _, key := range sortedKeys(newSecret.Data) {
+			old, ok := current.Data[key]
+			switch {
+			case !ok:
+				entry.Added = append(entry.Added, key)
+			case !bytes.Equal(old, newSecret.Data[key]):
+				entry.Modified = append(entry.Modified, key)
+			}
+		}
+		for _, key := range sortedKeys(current.Data) {
+			if _, ok := newSecret.Data[key]; !ok {
+				entry.Removed = append(entry.Removed, key)
+			}
+		}
+		if len(entry.Added)+len(entry.Modified)+len(entry.Removed) == 0 {
+			return
+		}
+	}
+	r.addAuditEntry(entry)
+}
+
+// auditDelete records the deletion of secret.
+func (r *Reflector) auditDelete(secret *v1.Secret) {
+	if len(r.auditors) == 0 {
+		return
+	}
+	r.addAuditEntry(AuditEntry{
+		Time:      time.Now().UTC(),
+		Namespace: r.k8sNamespace,
+		Secret:    secret.Name,
+		VaultPath: secret.Annotations[PathAnnotation],
+		Deleted:   true,
+		Removed:   sortedKeys(secret.Data),
+	})
+}
+
+// addAuditEntry adds entry to the ones recorded by the next flushAudit.
+func (r *Reflector) addAuditEntry(entry AuditEntry) {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	r.auditEntries = append(r.auditEntries, entry)
+}
+
+// flushAudit hands the changes recorded since the last flush to the
+// auditors, sorted by namespace and secret name.
+func (r *Reflector) flushAudit(ctx context.Context) {
+	r.auditMu.Lock()
+	entries := r.auditEntries
+	r.auditEntries = nil
+	r.auditMu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Namespace != entries[j].Namespace {
+			return entries[i].Namespace < entries[j].Namespace
+		}
+		return entries[i].Secret < entries[j].Secret
+	})
+
+	for _, auditor := range r.auditors {
+		if err := auditor.Audit(ctx, entries); err != nil {
+			log.Printf("error recording audit entries: %s", err)
+		}
+	}
+}
+
+// marshalAudit returns entries as JSON lines.
+func marshalAudit(entries []AuditEntry) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// FileAuditor appends audit entries to a file as JSON lines.
+type FileAuditor struct {
+	path string
+}
+
+// NewFileAuditor returns a FileAuditor appending to the file at path,
+// which is created if needed.
+func NewFileAuditor(path string) *FileAuditor {
+	return &FileAuditor{path: path}
+}
+
+// Audit appends entries to the file.
+func (a *FileAuditor) Audit(ctx context.Context, entries []AuditEntry) error {
+	lines, err := marshalAudit(entries)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %s", err)
+	}
+	if _, err := f.Write(lines); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing audit log: %s", err)
+	}
+	return f.Close()
+}
+
+// ConfigMapAuditor appends audit entries as JSON lines to the AuditKey of
+// a ConfigMap, dropping the oldest ones to keep it under a maximum size.
+type ConfigMapAuditor struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	maxSize   int
+}
+
+// NewConfigMapAuditor returns a ConfigMapAuditor writing to the ConfigMap
+// named name in namespace, which is created if needed.  The audit log is
+// kept under maxSize bytes.
+func NewConfigMapAuditor(
+	client kubernetes.Interface,
+	namespace string,
+	name string,
+	maxSize int,
+) *ConfigMapAuditor {
+	return &ConfigMapAuditor{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		maxSize:   maxSize,
+	}
+}
+
+// Audit appends entries to the ConfigMap.
+func (a *ConfigMapAuditor) Audit(ctx context.Context, entries []AuditEntry) error {
+	lines, err := marshalAudit(entries)
+	if err != nil {
+		return err
+	}
+
+	configMaps := a.client.CoreV1().ConfigMaps(a.namespace)
+	cm, err := configMaps.Get(a.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      a.name,
+				Namespace: a.namespace,
+			},
+			Data: map[string]string{
+				AuditKey: string(trimAudit(lines, a.maxSize)),
+			},
+		}
+		_, err = configMaps.Create(cm)
+		if err != nil {
+			return fmt.Errorf("error creating audit ConfigMap: %s", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting audit ConfigMap: %s", err)
+	}
+
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	audit := append([]byte(cm.Data[AuditKey]), lines...)
+	cm.Data[AuditKey] = string(trimAudit(audit, a.maxSize))
+	_, err = configMaps.Update(cm)
+	if err != nil {
+		return fmt.Errorf("error updating audit ConfigMap: %s", err)
+	}
+	return nil
+}
+
+// trimAudit drops the oldest lines of audit until it's at most maxSize
+// bytes long.
+func trimAudit(audit []byte, maxSize int) []byte {
+	for len(audit) > maxSize {
+		i := bytes.IndexByte(audit, '\n')
+		if i < 0 {
+			return nil
+		}
+		audit = audit[i+1:]
+	}
+	return audit
+}
@@ -0,0 +1,159 @@
+package pentagon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+type recordingAuditor struct {
+	passes [][]AuditEntry
+}
+
+func (a *recordingAuditor) Audit(ctx context.Context, entries []AuditEntry) error {
+	a.passes = append(a.passes, entries)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"a": "1",
+			"b": "2",
+		})
+
+		auditor := &recordingAuditor{}
+		r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test", WithAuditor(auditor))
+
+		mappings := []Mapping{
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "foo",
+				VaultEngineType: engineType,
+			},
+		}
+		reflect := func() {
+			if err := r.Reflect(context.Background(), mappings); err != nil {
+				t.Fatalf("reflect didn't work: %s", err)
+			}
+		}
+
+		reflect()
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"b": "3",
+			"c": "4",
+		})
+		reflect()
+
+		// unchanged secrets aren't recorded.
+		reflect()
+
+		mappings = nil
+		reflect()
+
+		expected := []string{
+			`created foo added [a b]`,
+			`changed foo added [c] removed [a] modified [b]`,
+			`deleted foo removed [b c]`,
+		}
+		if len(auditor.passes) != len(expected) {
+			t.Fatalf("expected %d audited passes, got %d: %v", len(expected), len(auditor.passes), auditor.passes)
+		}
+		for i, entries := range auditor.passes {
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 entry in pass %d, got %v", i, entries)
+			}
+			e := entries[0]
+			action := "changed"
+			if e.Created {
+				action = "created"
+			} else if e.Deleted {
+				action = "deleted"
+			}
+			summary := fmt.Sprintf("%s %s", action, e.Secret)
+			for _, keys := range []struct {
+				name string
+				keys []string
+			}{{"added", e.Added}, {"removed", e.Removed}, {"modified", e.Modified}} {
+				if len(keys.keys) > 0 {
+					summary += fmt.Sprintf(" %s %v", keys.name, keys.keys)
+				}
+			}
+			if summary != expected[i] {
+				t.Errorf("expected %q, got %q", expected[i], summary)
+			}
+			if e.Namespace != DefaultNamespace || e.VaultPath != "secrets/data/foo" {
+				t.Errorf("unexpected entry: %+v", e)
+			}
+		}
+	})
+}
+
+func TestFileAuditor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pentagon-audit")
+	if err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	auditor := NewFileAuditor(path)
+	for _, name := range []string{"foo", "bar"} {
+		err := auditor.Audit(context.Background(), []AuditEntry{{Secret: name, Added: []string{"key"}}})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read audit log: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", contents)
+	}
+	entry := AuditEntry{}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry.Secret != "bar" {
+		t.Errorf("unexpected last line %q: %v", lines[1], err)
+	}
+}
+
+func TestConfigMapAuditor(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	entry := AuditEntry{Namespace: DefaultNamespace, Secret: "foo", Modified: []string{"key"}}
+	line, err := marshalAudit([]AuditEntry{entry})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// room for two entries only.
+	auditor := NewConfigMapAuditor(k8sClient, DefaultNamespace, "audit", 2*len(line))
+	for i := 0; i < 3; i++ {
+		if err := auditor.Audit(context.Background(), []AuditEntry{entry}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	cm, err := k8sClient.CoreV1().ConfigMaps(DefaultNamespace).Get("audit", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("audit ConfigMap should be there: %s", err)
+	}
+	if cm.Data[AuditKey] != string(line)+string(line) {
+		t.Errorf("expected the two latest entries, got %q", cm.Data[AuditKey])
+	}
+}
@@ -0,0 +1,125 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupSuffix is appended to the name of a secret to name its backup.
+const BackupSuffix = "-previous"
+
+// BackupLabelKey labels backups with the label value of the reflector that
+// made them.  Backups don't have the LabelKey label so that they are never
+// mistaken for reflected secrets.
+const BackupLabelKey = "pentagon-backup"
+
+// BackupOfAnnotation is the annotation naming the secret a backup was taken
+// of.
+const BackupOfAnnotation = "pentagon.vimeo.com/backup-of"
+
+// WithBackups makes the reflector copy the data of a secret to a secret
+// named after it with BackupSuffix before changing its data, so that a bad
+// rotation can be rolled back quickly.
+func WithBackups() Option {
+	return func(r *Reflector) {
+		r.backups = true
+	}
+}
+
+// backupSecret copies current, including the annotations recording where
+// its data came from, to its backup secret.
+func (r *Reflector) backupSecret(ctx context.Context, current *v1.Secret) error {
+	backup := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      current.Name + BackupSuffix,
+			Namespace: r.k8sNamespace,
+			Labels: map[string]string{
+				BackupLabelKey: r.labelValue,
+			},
+			Annotations: map[string]string{
+				BackupOfAnnotation: current.Name,
+			},
+			OwnerReferences: current.OwnerReferences,
+		},
+		Data: current.Data,
+		Type: current.Type,
+	}
+	for key, value := range r.labels {
+		backup.Labels[key] = value
+	}
+	for _, annotation := range []string{PathAnnotation, VersionAnnotation} {
+		if value, ok := current.Annotations[annotation]; ok {
+			backup.Annotations[annotation] = value
+		}
+	}
+
+	release, err := r.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	secrets := r.secrets()
+	existing, err := secrets.Get(backup.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = secrets.Create(backup)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.checkBackupOwner(existing, current.Name); err != nil {
+		return err
+	}
+	_, err = secrets.Update(backup)
+	return err
+}
+
+// checkBackupOwner returns an error unless secret is the reflector's backup
+// of the secret named name.
+func (r *Reflector) checkBackupOwner(secret *v1.Secret, name string) error {
+	if secret.Labels[BackupLabelKey] != r.labelValue ||
+		secret.Annotations[BackupOfAnnotation] != name {
+		return fmt.Errorf(
+			"secret %s exists and is not a backup of %s made by pentagon",
+			secret.Name,
+			name,
+		)
+	}
+	return nil
+}
+
+// deleteBackup deletes the backup of the secret named name, if any.  A
+// secret with the backup's name that the reflector didn't make is left
+// alone.
+func (r *Reflector) deleteBackup(ctx context.Context, name string) error {
+	release, err := r.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	secrets := r.secrets()
+	backup, err := secrets.Get(name+BackupSuffix, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.checkBackupOwner(backup, name); err != nil {
+		log.Printf("not deleting backup: %s", err)
+		return nil
+	}
+
+	err = secrets.Delete(backup.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
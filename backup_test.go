@@ -0,0 +1,86 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestBackups(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"foo": "bar",
+		})
+
+		r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test", WithBackups())
+
+		mappings := []Mapping{
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "foo",
+				VaultEngineType: engineType,
+			},
+		}
+		err := r.Reflect(context.Background(), mappings)
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+
+		// creating a secret has nothing to back up.
+		_, err = secrets.Get("foo"+BackupSuffix, metav1.GetOptions{})
+		if !errors.IsNotFound(err) {
+			t.Fatalf("backup shouldn't exist yet: %v", err)
+		}
+
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"foo": "baz",
+		})
+		err = r.Reflect(context.Background(), mappings)
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		backup, err := secrets.Get("foo"+BackupSuffix, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("backup should be there: %s", err)
+		}
+		if string(backup.Data["foo"]) != "bar" {
+			t.Fatalf("backup should hold the previous data: %s", backup.Data["foo"])
+		}
+		if backup.Labels[BackupLabelKey] != "test" || backup.Labels[LabelKey] != "" {
+			t.Fatalf("unexpected backup labels: %+v", backup.Labels)
+		}
+		if backup.Annotations[BackupOfAnnotation] != "foo" {
+			t.Fatalf("unexpected backup annotations: %+v", backup.Annotations)
+		}
+
+		s, err := secrets.Get("foo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("foo should be there: %s", err)
+		}
+		if string(s.Data["foo"]) != "baz" {
+			t.Fatalf("foo should have been updated: %s", s.Data["foo"])
+		}
+
+		// reconciling the secret away removes its backup too.
+		err = r.Reflect(context.Background(), []Mapping{})
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+		_, err = secrets.Get("foo"+BackupSuffix, metav1.GetOptions{})
+		if !errors.IsNotFound(err) {
+			t.Fatalf("backup should have been deleted: %v", err)
+		}
+	})
+}
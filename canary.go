@@ -0,0 +1,162 @@
+package pentagon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CanaryAnnotation records the hash of the settings of a mapping with a
+	// canary that a secret was written with, on both its canary secret and,
+	// once promoted, its secret.
+	CanaryAnnotation = "pentagon.vimeo.com/canary"
+
+	// CanaryPassesAnnotation records the number of passes a canary secret
+	// was written in.
+	CanaryPassesAnnotation = "pentagon.vimeo.com/canary-passes"
+)
+
+// DefaultCanarySuffix is the default suffix of the names of canary
+// secrets.
+const DefaultCanarySuffix = "-canary"
+
+// CanaryConfig makes a mapping write its secret under another name for a
+// number of passes before writing it under its own, so that new mappings
+// or changes to them can be tried against real vault data without
+// affecting the workloads using the secret.
+type CanaryConfig struct {
+	// Passes is the number of passes the canary secret is written in
+	// before the secret is.  Zero (the default) disables the canary.
+	Passes int `yaml:"passes"`
+
+	// Suffix is appended to the secret name to name the canary secret.
+	// Default "-canary".
+	Suffix string `yaml:"suffix"`
+}
+
+// CanaryName returns the name of the canary secret of mapping.
+func (m Mapping) CanaryName() string {
+	suffix := m.Canary.Suffix
+	if suffix == "" {
+		suffix = DefaultCanarySuffix
+	}
+	return m.SecretName + suffix
+}
+
+// canaryHash returns a hash of the settings of mapping that determine the
+// data of its secret, so that changing them starts a new canary.
+func canaryHash(mapping Mapping) string {
+	settings, _ := json.Marshal(struct {
+		VaultPath       string
+		VaultEngineType string
+		Source          string
+		Data            []DataOverride
+		TransformExec   []string
+		RequiredKeys    []string
+		Validation      []ValueRule `json:",omitempty"`
+		Type            string      `json:",omitempty"`
+		Strict          bool
+	}{
+		VaultPath:       mapping.VaultPath,
+		VaultEngineType: string(mapping.VaultEngineType),
+		Source:          mapping.Source,
+		Data:            mapping.Data,
+		TransformExec:   mapping.TransformExec,
+		RequiredKeys:    mapping.RequiredKeys,
+		Validation:      mapping.Validation,
+		Type:            string(mapping.Type),
+		Strict:          mapping.Strict,
+	})
+	sum := sha256.Sum256(settings)
+	return hex.EncodeToString(sum[:8])
+}
+
+// canaryPass is how a mapping with a canary is reflected in a pass.
+type canaryPass struct {
+	hash string
+
+	// passes is the number of passes the canary secret will have been
+	// written in, if the canary is running.
+	running bool
+	passes  int
+
+	// promote is set when the secret is written for the first time since
+	// the canary ran, after which the canary secret is deleted.
+	promote bool
+}
+
+// settled returns true if the secret is written as usual.
+func (c *canaryPass) settled() bool {
+	return c == nil || (!c.running && !c.promote)
+}
+
+// canaryFor returns the mapping to reflect in place of mapping in the pass,
+// which is renamed to its canary secret while its canary runs, and how its
+// canary is reflected, or nil if it has none.
+func canaryFor(p *pass, mapping Mapping) (Mapping, *canaryPass) {
+	if mapping.Canary.Passes <= 0 {
+		return mapping, nil
+	}
+
+	c := &canaryPass{hash: canaryHash(mapping)}
+	if secret := p.existing[mapping.SecretName]; secret != nil &&
+		secret.Annotations[CanaryAnnotation] == c.hash {
+		return mapping, c
+	}
+
+	passes := 0
+	if canary := p.existing[mapping.CanaryName()]; canary != nil &&
+		canary.Annotations[CanaryAnnotation] == c.hash {
+		passes, _ = strconv.Atoi(canary.Annotations[CanaryPassesAnnotation])
+	}
+	if passes >= mapping.Canary.Passes {
+		c.promote = true
+		return mapping, c
+	}
+
+	c.running = true
+	c.passes = passes + 1
+	canary := mapping
+	canary.SecretName = mapping.CanaryName()
+	return canary, c
+}
+
+// annotate records the canary in the annotations of secret.
+func (c *canaryPass) annotate(secret *v1.Secret) {
+	if c == nil {
+		return
+	}
+	secret.Annotations[CanaryAnnotation] = c.hash
+	if c.running {
+		secret.Annotations[CanaryPassesAnnotation] = strconv.Itoa(c.passes)
+	}
+}
+
+// promoted deletes the canary secret of mapping once its secret was
+// written.
+func (r *Reflector) promoted(ctx context.Context, p *pass, mapping Mapping) error {
+	release, err := r.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	name := mapping.CanaryName()
+	err = r.secrets().Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if canary := p.existing[name]; canary != nil && err == nil {
+		r.auditDelete(canary)
+	}
+	log.Printf("promoted canary secret %s to %s", name, mapping.SecretName)
+	return nil
+}
@@ -0,0 +1,105 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestCanary(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{"foo": "bar"})
+	vaultClient.Write("secrets/other", map[string]interface{}{"foo": "baz"})
+
+	secrets := NewFakeSecrets()
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(secrets),
+		WithLabel("test"),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	mapping := Mapping{
+		VaultPath:       "secrets/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+		Canary:          CanaryConfig{Passes: 2},
+	}
+	reflect := func() {
+		if err := r.Reflect(context.Background(), []Mapping{mapping}); err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := secrets.Get(name, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			t.Fatalf("unable to get %s: %s", name, err)
+		}
+		return err == nil
+	}
+
+	// the canary secret is written in two passes, and isn't reconciled.
+	for pass := 1; pass <= 2; pass++ {
+		reflect()
+		if !exists("foo-canary") || exists("foo") {
+			t.Fatalf("only the canary secret should exist after pass %d", pass)
+		}
+	}
+	canary, _ := secrets.Get("foo-canary", metav1.GetOptions{})
+	if canary.Annotations[CanaryPassesAnnotation] != "2" {
+		t.Errorf("expected 2 canary passes, got %q", canary.Annotations[CanaryPassesAnnotation])
+	}
+
+	// the third pass promotes it.
+	reflect()
+	if exists("foo-canary") || !exists("foo") {
+		t.Fatal("the canary secret should have been promoted")
+	}
+
+	// later passes write the secret as usual.
+	reflect()
+	if exists("foo-canary") || !exists("foo") {
+		t.Fatal("the secret should still be written as usual")
+	}
+
+	// changing the mapping starts a new canary, leaving the secret alone.
+	mapping.VaultPath = "secrets/other"
+	reflect()
+	if !exists("foo-canary") {
+		t.Fatal("a changed mapping should start a new canary")
+	}
+	secret, _ := secrets.Get("foo", metav1.GetOptions{})
+	if string(secret.Data["foo"]) != "bar" {
+		t.Errorf("the secret shouldn't change during the canary, got %s", secret.Data["foo"])
+	}
+	canary, _ = secrets.Get("foo-canary", metav1.GetOptions{})
+	if string(canary.Data["foo"]) != "baz" {
+		t.Errorf("the canary secret should have the new data, got %s", canary.Data["foo"])
+	}
+}
+
+func TestValidateCanary(t *testing.T) {
+	c := &Config{
+		Mappings: []Mapping{
+			{VaultPath: "foo", SecretName: "foo", Canary: CanaryConfig{Passes: 1}},
+			{VaultPath: "bar", SecretName: "foo-canary"},
+		},
+	}
+	if err := c.Validate(); err == nil {
+		t.Error("a mapped canary name should have been invalid")
+	}
+
+	c.Mappings = c.Mappings[:1]
+	c.Mappings[0].Canary.Suffix = "_Canary"
+	if err := c.Validate(); err == nil {
+		t.Error("an invalid canary name should have been invalid")
+	}
+}
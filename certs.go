@@ -0,0 +1,152 @@
+package pentagon
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"log"
+	"strings"
+	"time"
+)
+
+// certificateExpiry returns the earliest expiry of the PEM encoded
+// certificates in the values of data, or false if none of them has any.
+func certificateExpiry(data map[string][]byte) (time.Time, bool) {
+	var earliest time.Time
+	found := false
+	for _, value := range data {
+		rest := value
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			if !found || cert.NotAfter.Before(earliest) {
+				earliest = cert.NotAfter
+				found = true
+			}
+		}
+	}
+	return earliest, found
+}
+
+// renewalDue returns true if the certificates in data, the data of the
+// secret of mapping, expire within the RenewBefore of mapping at now.
+func renewalDue(mapping Mapping, data map[string][]byte, now time.Time) bool {
+	if mapping.RenewBefore <= 0 {
+		return false
+	}
+	expiry, ok := certificateExpiry(data)
+	return ok && expiry.Sub(now) < mapping.RenewBefore
+}
+
+// recordCertificates records the earliest expiry of the certificates in
+// data, the data of the secret named name, in the certificate expiry
+// metric.  Mappings sharing a label report the earliest expiry of all of
+// their certificates.
+func (r *Reflector) recordCertificates(name string, data map[string][]byte) {
+	expiry, ok := certificateExpiry(data)
+
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+
+	label := r.metricLabelLocked(name)
+	if previous, had := r.certLabels[name]; had && previous != label {
+		// the label of the mapping changed, e.g. it entered the top
+		// failures.
+		delete(r.certLabels, name)
+		r.setCertificateGaugeLocked(previous)
+	}
+	if ok {
+		r.certExpiry[name] = expiry
+		r.certLabels[name] = label
+	} else {
+		delete(r.certExpiry, name)
+		delete(r.certLabels, name)
+	}
+	r.setCertificateGaugeLocked(label)
+}
+
+// setCertificateGaugeLocked sets the certificate expiry metric of label to
+// the earliest expiry of the mappings with that label.  r.metricsMu must be
+// held.
+func (r *Reflector) setCertificateGaugeLocked(label string) {
+	var earliest time.Time
+	found := false
+	for name, l := range r.certLabels {
+		if l != label {
+			continue
+		}
+		if expiry := r.certExpiry[name]; !found || expiry.Before(earliest) {
+			earliest = expiry
+			found = true
+		}
+	}
+	if !found {
+		certificateExpiryGauge.DeleteLabelValues(label)
+		return
+	}
+	certificateExpiryGauge.WithLabelValues(label).Set(float64(earliest.Unix()))
+}
+
+// RenewCertificates checks the certificates of the secrets of mappings
+// with a RenewBefore every interval until ctx is done, and reflects the
+// mappings whose certificates expire within it without waiting for the
+// next pass.  Mappings of other shards or groups are ignored.
+func (r *Reflector) RenewCertificates(
+	ctx context.Context,
+	mappings []Mapping,
+	interval time.Duration,
+) {
+	renewable := []Mapping{}
+	for _, m := range r.selectedMappings(mappings) {
+		if m.RenewBefore > 0 {
+			renewable = append(renewable, m)
+		}
+	}
+	if len(renewable) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		existing, err := r.existingSecrets()
+		if err != nil {
+			log.Printf("error checking certificates: %s", err)
+			continue
+		}
+
+		now := time.Now()
+		due := []Mapping{}
+		names := []string{}
+		for _, m := range renewable {
+			if secret, ok := existing[m.SecretName]; ok && renewalDue(m, secret.Data, now) {
+				due = append(due, m)
+				names = append(names, m.SecretName)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		log.Printf("certificates of %s expire soon, renewing them", strings.Join(names, ", "))
+		if err := r.Sync(ctx, due); err != nil {
+			log.Printf("error renewing certificates: %s", err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package pentagon
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// certificate returns a new PEM encoded self-signed certificate expiring at
+// notAfter.
+func certificate(t *testing.T, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	soon := time.Now().Add(time.Hour).Truncate(time.Second)
+	later := soon.Add(24 * time.Hour)
+
+	// the earliest certificate of a chain counts.
+	chain := append(certificate(t, later), certificate(t, soon)...)
+	expiry, ok := certificateExpiry(map[string][]byte{
+		"tls.crt":  chain,
+		"password": []byte("hunter2"),
+	})
+	if !ok || !expiry.Equal(soon) {
+		t.Fatalf("expected %s, got %s (%t)", soon, expiry, ok)
+	}
+
+	if _, ok := certificateExpiry(map[string][]byte{"password": []byte("hunter2")}); ok {
+		t.Fatal("data without certificates shouldn't have an expiry")
+	}
+
+	mapping := Mapping{RenewBefore: 2 * time.Hour}
+	data := map[string][]byte{"tls.crt": chain}
+	if !renewalDue(mapping, data, time.Now()) {
+		t.Error("renewal should be due within renewBefore")
+	}
+	mapping.RenewBefore = 0
+	if renewalDue(mapping, data, time.Now()) {
+		t.Error("renewal shouldn't be due without renewBefore")
+	}
+}
+
+func TestRenewCertificates(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	soon := time.Now().Add(time.Hour).Truncate(time.Second)
+	vaultClient.Write("secrets/data/tls", map[string]interface{}{
+		"tls.crt": string(certificate(t, soon)),
+	})
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test", WithVersionCheck())
+	mappings := []Mapping{{
+		VaultPath:       "secrets/data/tls",
+		SecretName:      "tls",
+		VaultEngineType: vault.EngineTypeKeyValueV2,
+		RenewBefore:     2 * time.Hour,
+	}}
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if v := testutil.ToFloat64(certificateExpiryGauge.WithLabelValues("tls")); v != float64(soon.Unix()) {
+		t.Fatalf("expected the expiry metric to be %d, got %v", soon.Unix(), v)
+	}
+
+	// replace the certificate without a new version, which the version
+	// check alone would skip.
+	later := soon.Add(24 * time.Hour)
+	renewed := certificate(t, later)
+	secret, _ := vaultClient.Read("secrets/data/tls")
+	secret.Data["data"] = map[string]interface{}{"tls.crt": string(renewed)}
+
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("tls should be there: %s", err)
+	}
+	if string(s.Data["tls.crt"]) != string(renewed) {
+		t.Fatal("the certificate expiring within renewBefore should have been read again")
+	}
+	if v := testutil.ToFloat64(certificateExpiryGauge.WithLabelValues("tls")); v != float64(later.Unix()) {
+		t.Fatalf("expected the expiry metric to be %d, got %v", later.Unix(), v)
+	}
+}
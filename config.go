@@ -2,9 +2,16 @@ package pentagon
 
 import (
 	"fmt"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/hashicorp/vault/api"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/vimeo/pentagon/age"
 	"github.com/vimeo/pentagon/vault"
 )
 
@@ -15,21 +22,134 @@ const DefaultNamespace = "default"
 // created by pentagon.
 const DefaultLabelValue = "default"
 
+// DefaultGCPAudience is the default template of the audience of GCP
+// identity tokens used to log in to vault.
+const DefaultGCPAudience = "{{.Host}}/vault/{{.Role}}"
+
 // Config describes the configuration for vaultofsecrets
 type Config struct {
+	// APIVersion is the version of the configuration schema.  Older
+	// configurations are upgraded by MigrateConfig when loaded, and it
+	// defaults to ConfigAPIVersion.
+	APIVersion string `yaml:"apiVersion"`
+
 	// VaultURL is the URL used to connect to vault.
 	Vault VaultConfig `yaml:"vault"`
 
+	// Sources are other vault servers that mappings can read from by name.
+	// Only their connection and authentication settings are used.
+	Sources map[string]VaultConfig `yaml:"sources"`
+
+	// OnePassword are 1Password Connect servers that mappings can read
+	// items from by name, like Sources.
+	OnePassword map[string]OnePasswordConfig `yaml:"onePassword"`
+
+	// Etcd are etcd clusters that mappings can read keys from by name,
+	// like Sources.
+	Etcd map[string]EtcdConfig `yaml:"etcd"`
+
+	// Conjur are CyberArk Conjur servers that mappings can read variables
+	// from by name, like Sources.
+	Conjur map[string]ConjurConfig `yaml:"conjur"`
+
+	// TLS hardens the TLS connections of the vault client, the metrics
+	// listener and the webhook.
+	TLS TLSConfig `yaml:"tls"`
+
+	// Kubernetes is the kubernetes client configuration.
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+
+	// Shards splits the mappings between this many replicas, each reflecting
+	// a disjoint subset.  A replica's shard index is taken from the
+	// PENTAGON_SHARD_INDEX environment variable or its StatefulSet ordinal.
+	// Zero or one (the default) disables sharding.
+	Shards int `yaml:"shards"`
+
+	// LeaderElection configures leader election between replicas.
+	LeaderElection LeaderElectionConfig `yaml:"leaderElection"`
+
+	// Controller configures reflecting mappings from per-mapping queues.
+	Controller ControllerConfig `yaml:"controller"`
+
+	// Webhook configures the admission webhook injecting secrets into pods.
+	Webhook WebhookConfig `yaml:"webhook"`
+
+	// Recreate configures the re-creation of deleted secrets.
+	Recreate RecreateConfig `yaml:"recreate"`
+
+	// Sink configures where secrets are written, k8s secrets by default.
+	Sink SinkConfig `yaml:"sink"`
+
+	// Audit records the keys of the secrets changed by every pass.
+	Audit AuditConfig `yaml:"audit"`
+
+	// State persists the state of every mapping across restarts.
+	State StateConfig `yaml:"state"`
+
+	// Metrics bounds the cardinality of the per-mapping metrics.
+	Metrics MetricsConfig `yaml:"metrics"`
+
+	// SecretNames derives the secret names of mappings that don't set one.
+	SecretNames SecretNamesConfig `yaml:"secretNames"`
+
+	// OwnerReferences makes the secrets pentagon writes owned by an anchor
+	// object, so that deleting it garbage collects them.
+	OwnerReferences OwnerReferencesConfig `yaml:"ownerReferences"`
+
 	// Namespace is the k8s namespace that the secrets will be created in.
 	Namespace string `yaml:"namespace"`
 
+	// NamespaceScoped restricts pentagon to Namespace, so that it only
+	// needs a Role there rather than a ClusterRole.  Mappings and trust
+	// bundles can't target other namespaces, and neither operator mode nor
+	// discovery can be used.
+	NamespaceScoped bool `yaml:"namespaceScoped"`
+
 	// Label is the value of the `pentagon` label that will be added to all
 	// k8s secrets created by pentagon.
 	Label string `yaml:"label"`
 
+	// Labels are added to all k8s secrets created by pentagon, alongside
+	// the `pentagon` label.  Secrets with any of them set to another value
+	// are never updated or deleted.
+	Labels map[string]string `yaml:"labels"`
+
+	// Instance identifies this pentagon instance in the owner annotation of
+	// the secrets it writes.  Secrets owned by another instance are never
+	// updated or deleted, even if they have the same label.  Defaults to
+	// the label.
+	Instance string `yaml:"instance"`
+
 	// Mappings is a list of mappings.
 	Mappings []Mapping `yaml:"mappings"`
 
+	// Transactions are groups of mappings that rotate together: if any
+	// mapping of one fails, the secrets of the others written in the same
+	// pass are rolled back.
+	Transactions []string `yaml:"transactions"`
+
+	// ReverseMappings is a list of k8s secrets to write to vault after the
+	// mappings have been reflected.
+	ReverseMappings []ReverseMapping `yaml:"reverseMappings"`
+
+	// TrustBundles distribute CA certificates from vault to ConfigMaps
+	// after the mappings have been reflected.
+	TrustBundles []TrustBundle `yaml:"trustBundles"`
+
+	// Discovery also reflects the mappings published in ConfigMaps across
+	// namespaces.  Mappings may be empty in this mode.
+	Discovery DiscoveryConfig `yaml:"discovery"`
+
+	// Operator also reflects the mappings defined by PentagonMapping
+	// resources, each into the resource's own namespace.  Mappings may be
+	// empty in this mode.
+	Operator bool `yaml:"operator"`
+
+	// OperatorVaultPathPrefixes restricts the vault paths of
+	// PentagonMappings like Discovery.VaultPathPrefixes does for
+	// discovered mappings.  Empty (the default) allows any path.
+	OperatorVaultPathPrefixes []string `yaml:"operatorVaultPathPrefixes"`
+
 	// Daemon sets the process to run as a daemon, refreshing secrets periodically
 	Daemon bool `yaml:"daemon"`
 
@@ -37,14 +157,83 @@ type Config struct {
 	// as a daemon
 	RefreshInterval time.Duration `yaml:"refresh"`
 
+	// PassTimeout is the maximum duration of a single pass over all of the
+	// mappings.  When it is exceeded, the remaining mappings are skipped and
+	// the pass fails.  Zero (the default) means no limit.
+	PassTimeout time.Duration `yaml:"passTimeout"`
+
+	// MaxBackoff caps the delay between attempts when running as a daemon.
+	// After a failed pass the delay doubles (starting from RefreshInterval)
+	// until it reaches MaxBackoff, and is reset after the next success.
+	// Default is four times the RefreshInterval.
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+
+	// MaxConsecutiveFailures makes the daemon exit non-zero after this many
+	// passes in a row have failed so that it can be restarted with fresh
+	// connections and credentials.  Zero (the default) means never exit.
+	MaxConsecutiveFailures int `yaml:"maxConsecutiveFailures"`
+
+	// Policies are rules that every secret must follow.  Writes of secrets
+	// violating any of them fail.
+	Policies []Policy `yaml:"policies"`
+
+	// Backups copies the data of a secret to a secret named after it with a
+	// "-previous" suffix before its data changes.
+	Backups bool `yaml:"backups"`
+
+	// DeletionGuard refuses updates that remove most of a secret's data.
+	DeletionGuard DeletionGuardConfig `yaml:"deletionGuard"`
+
+	// Strict rejects vault secrets that have no keys for every mapping rather
+	// than writing an empty k8s secret.
+	Strict bool `yaml:"strict"`
+
+	// OnError controls whether a failed mapping aborts the pass ("abort") or
+	// lets the remaining mappings sync ("continue").  Either way the pass is
+	// reported as failed.  Default "abort".
+	OnError ErrorPolicy `yaml:"onError"`
+
+	// Retries is the number of times a failed mapping is retried within a
+	// pass before it is considered failed.  Default 0.
+	Retries int `yaml:"retries"`
+
+	// RetryBackoff is the delay before the first retry of a failed mapping.
+	// It doubles for each retry after that.  Default 1s.
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+
+	// Workers is the number of mappings that are reflected concurrently,
+	// bounding the concurrent requests made to vault and kubernetes.
+	// Default 1.
+	Workers int `yaml:"workers"`
+
 	// ListenAddress is the address that pentagon will listen on to provide prometheus metrics.
 	// Only in daemon mode. Default ':8888'
 	ListenAddress string `yaml:"listen"`
+
+	// LogLevel is "debug", "info" (the default) or "warn".
+	LogLevel LogLevel `yaml:"logLevel"`
+
+	// LogFile also writes the logs to a rotated file.
+	LogFile LogFileConfig `yaml:"logFile"`
+
+	// LogRequests logs the method, path, status and latency of every
+	// request made to vault and kubernetes, without their payloads.
+	LogRequests bool `yaml:"logRequests"`
+
+	// Admin also serves the /pause and /resume endpoints on ListenAddress,
+	// which pause the mappings of secrets until they are resumed or the
+	// process restarts, and /debug/requests, which toggles LogRequests.
+	// Only in daemon mode.
+	Admin bool `yaml:"admin"`
 }
 
 // SetDefaults sets defaults for the Namespace and Label in case they're
 // not passed in from the configuration file.
 func (c *Config) SetDefaults() {
+	if c.APIVersion == "" {
+		c.APIVersion = ConfigAPIVersion
+	}
+
 	if c.Namespace == "" {
 		c.Namespace = DefaultNamespace
 	}
@@ -53,6 +242,14 @@ func (c *Config) SetDefaults() {
 		c.Label = DefaultLabelValue
 	}
 
+	c.TLS.SetDefaults()
+
+	c.Vault.TokenSecret.setDefaults(c.Namespace)
+	for name, source := range c.Sources {
+		source.TokenSecret.setDefaults(c.Namespace)
+		c.Sources[name] = source
+	}
+
 	// default to engine type key/value v1 for backward compatibility
 	if c.Vault.DefaultEngineType == "" {
 		c.Vault.DefaultEngineType = vault.EngineTypeKeyValueV1
@@ -60,36 +257,638 @@ func (c *Config) SetDefaults() {
 
 	// set all the underlying mapping engine types to their default
 	// if unspecified
-	for _, m := range c.Mappings {
+	for i := range c.Mappings {
+		m := &c.Mappings[i]
+		if c.isFlatSource(m.Source) && m.VaultEngineType == "" {
+			// 1Password items, etcd keys and Conjur variables are read
+			// as flat key/value secrets.
+			m.VaultEngineType = vault.EngineTypeKeyValueV1
+		}
 		if m.VaultEngineType == "" {
 			m.VaultEngineType = c.Vault.DefaultEngineType
 		}
+
+		if m.SecretName == "" && c.SecretNames.FromVaultPath {
+			m.SecretName = c.SecretNames.SecretName(m.VaultPath)
+		}
+
+		if c.Strict {
+			m.Strict = true
+		}
+	}
+
+	for i := range c.ReverseMappings {
+		m := &c.ReverseMappings[i]
+		if m.VaultEngineType == "" {
+			m.VaultEngineType = c.Vault.DefaultEngineType
+		}
+	}
+
+	for i := range c.TrustBundles {
+		b := &c.TrustBundles[i]
+		if b.VaultEngineType == "" {
+			b.VaultEngineType = c.Vault.DefaultEngineType
+		}
+		if len(b.Keys) == 0 {
+			b.Keys = []string{DefaultTrustBundleKey}
+		}
+		if b.ConfigMapKey == "" {
+			b.ConfigMapKey = DefaultTrustBundleKey
+		}
+	}
+
+	if c.LeaderElection.LeaseName == "" {
+		c.LeaderElection.LeaseName = "pentagon-" + c.Label
+	}
+
+	if c.LeaderElection.LeaseDuration == 0 {
+		c.LeaderElection.LeaseDuration = 15 * time.Second
+	}
+
+	if c.LeaderElection.RenewDeadline == 0 {
+		c.LeaderElection.RenewDeadline = 10 * time.Second
+	}
+
+	if c.LeaderElection.RetryPeriod == 0 {
+		c.LeaderElection.RetryPeriod = 2 * time.Second
+	}
+
+	if c.Controller.BaseDelay == 0 {
+		c.Controller.BaseDelay = time.Second
+	}
+
+	if c.Recreate.RateLimit == 0 {
+		c.Recreate.RateLimit = 1
+	}
+
+	if c.Recreate.Burst == 0 {
+		c.Recreate.Burst = 5
+	}
+
+	if c.OnError == "" {
+		c.OnError = ErrorPolicyAbort
+	}
+
+	if c.Sink.Type == "" {
+		c.Sink.Type = SinkTypeSecret
+	}
+
+	if c.Audit.MaxSize == 0 {
+		c.Audit.MaxSize = 512 << 10
+	}
+
+	if c.Metrics.Labels == "" {
+		c.Metrics.Labels = MetricLabelsMapping
+	}
+
+	if c.OwnerReferences.ConfigMap == "" {
+		c.OwnerReferences.ConfigMap = "pentagon-" + c.Label
+	}
+
+	if c.Metrics.TopFailures == 0 {
+		c.Metrics.TopFailures = 10
+	}
+
+	if c.Workers == 0 {
+		c.Workers = 1
+	}
+
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = time.Second
 	}
 
 	if c.RefreshInterval == 0 {
 		c.RefreshInterval = time.Minute * 15
 	}
 
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = c.RefreshInterval * 4
+	}
+
+	if c.Webhook.ListenAddress == "" {
+		c.Webhook.ListenAddress = ":8443"
+	}
+
 	if c.ListenAddress == "" {
 		c.ListenAddress = ":8888"
 	}
+
+	if c.LogLevel == "" {
+		c.LogLevel = LogLevelInfo
+	}
 }
 
 // Validate checks to make sure that the configuration is valid.
 func (c *Config) Validate() error {
-	if c.Mappings == nil {
+	if c.APIVersion != "" && c.APIVersion != ConfigAPIVersion {
+		return fmt.Errorf(
+			"unsupported apiVersion %q, migrate the configuration to %s",
+			c.APIVersion,
+			ConfigAPIVersion,
+		)
+	}
+
+	if c.Mappings == nil && c.ReverseMappings == nil && c.TrustBundles == nil &&
+		!c.Operator && !c.Discovery.Enabled {
 		return fmt.Errorf("no mappings provided")
 	}
 
+	for key, value := range c.Labels {
+		if key == LabelKey {
+			return fmt.Errorf("labels can't set the %s label, use label instead", LabelKey)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %s: %s", key, strings.Join(errs, ", "))
+		}
+	}
+
+	// a vault path can't be both the source and the destination.
+	reflected := map[string]struct{}{}
+	names := map[string]struct{}{}
+	for _, m := range c.Mappings {
+		reflected[m.VaultPath] = struct{}{}
+		if m.SecretName == "" {
+			return fmt.Errorf("the mapping of %s has no secretName", m.VaultPath)
+		}
+		if errs := validation.IsDNS1123Subdomain(m.SecretName); len(errs) > 0 {
+			return fmt.Errorf("invalid secretName %q: %s", m.SecretName, strings.Join(errs, ", "))
+		}
+		if !m.FansOut() {
+			if _, ok := names[m.SecretName]; ok {
+				return fmt.Errorf("secret %s is mapped more than once", m.SecretName)
+			}
+			names[m.SecretName] = struct{}{}
+		}
+		if len(m.TransformExec) > 0 && m.TransformExec[0] == "" {
+			return fmt.Errorf("transformExec of %s has no command", m.SecretName)
+		}
+		if m.MaxAge < 0 {
+			return fmt.Errorf("maxAge of %s can't be negative", m.SecretName)
+		}
+		if m.RenewBefore < 0 {
+			return fmt.Errorf("renewBefore of %s can't be negative", m.SecretName)
+		}
+		if m.Timeout < 0 {
+			return fmt.Errorf("timeout of %s can't be negative", m.SecretName)
+		}
+		if m.Canary.Passes < 0 {
+			return fmt.Errorf("canary passes of %s can't be negative", m.SecretName)
+		}
+		if m.Canary.Passes > 0 {
+			if errs := validation.IsDNS1123Subdomain(m.CanaryName()); len(errs) > 0 {
+				return fmt.Errorf("invalid canary name %q: %s", m.CanaryName(), strings.Join(errs, ", "))
+			}
+		}
+		if m.Source != "" && !c.hasSource(m.Source) {
+			return fmt.Errorf("unknown source %q of %s", m.Source, m.SecretName)
+		}
+		if c.isFlatSource(m.Source) && m.VaultEngineType != vault.EngineTypeKeyValueV1 {
+			return fmt.Errorf(
+				"%s reads from non-vault source %s and must use engine type %q",
+				m.SecretName,
+				m.Source,
+				vault.EngineTypeKeyValueV1,
+			)
+		}
+		for _, o := range m.Data {
+			if err := o.Validate(); err != nil {
+				return fmt.Errorf("invalid data of %s: %s", m.SecretName, err)
+			}
+		}
+		if err := validateSecretType(m.Type); err != nil {
+			return fmt.Errorf("invalid type of %s: %s", m.SecretName, err)
+		}
+		for _, v := range m.Validation {
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("invalid validation of %s: %s", m.SecretName, err)
+			}
+		}
+		if len(m.ExcludeNamespaces) > 0 && !m.AllNamespaces {
+			return fmt.Errorf("excludeNamespaces of %s requires allNamespaces", m.SecretName)
+		}
+		if m.NamespaceSelector != "" {
+			if !m.AllNamespaces {
+				return fmt.Errorf("namespaceSelector of %s requires allNamespaces", m.SecretName)
+			}
+			if _, err := labels.Parse(m.NamespaceSelector); err != nil {
+				return fmt.Errorf("invalid namespaceSelector of %s: %s", m.SecretName, err)
+			}
+		}
+		switch m.DeletionPolicy {
+		case "", DeletionPolicyDelete, DeletionPolicyRetain:
+		default:
+			return fmt.Errorf(
+				"invalid deletionPolicy of %s: %q, must be %q or %q",
+				m.SecretName,
+				m.DeletionPolicy,
+				DeletionPolicyDelete,
+				DeletionPolicyRetain,
+			)
+		}
+		if m.DeletionPolicy != "" && !m.FansOut() {
+			return fmt.Errorf("deletionPolicy of %s requires namespaces or allNamespaces", m.SecretName)
+		}
+		if m.FansOut() && (c.Operator || c.Controller.Enabled) {
+			return fmt.Errorf(
+				"%s can't be reflected into other namespaces in operator or controller mode",
+				m.SecretName,
+			)
+		}
+	}
+	mapped := make(map[string]struct{}, len(c.Mappings))
+	for _, m := range c.Mappings {
+		mapped[m.SecretName] = struct{}{}
+	}
+	for _, m := range c.Mappings {
+		if _, ok := mapped[m.CanaryName()]; ok && m.Canary.Passes > 0 {
+			return fmt.Errorf("canary name %s of %s is mapped", m.CanaryName(), m.SecretName)
+		}
+	}
+	for _, m := range c.Mappings {
+		for _, dep := range m.DependsOn {
+			if _, ok := mapped[dep]; !ok {
+				return fmt.Errorf("%s depends on %s, which isn't mapped", m.SecretName, dep)
+			}
+		}
+	}
+	if err := dependencyCycle(c.Mappings); err != nil {
+		return err
+	}
+
+	for _, m := range c.ReverseMappings {
+		if m.SecretName == "" || m.VaultPath == "" {
+			return fmt.Errorf("reverse mappings need a secretName and a vaultPath")
+		}
+		if _, ok := reflected[m.VaultPath]; ok {
+			return fmt.Errorf(
+				"vault path %s is used by both a mapping and a reverse mapping",
+				m.VaultPath,
+			)
+		}
+	}
+	// the controller doesn't run passes, which reverse mappings run after.
+	if len(c.ReverseMappings) > 0 && c.Controller.Enabled {
+		return fmt.Errorf("reverse mappings can't be used in controller mode")
+	}
+
+	bundles := map[string]struct{}{}
+	for _, b := range c.TrustBundles {
+		if err := b.Validate(); err != nil {
+			return fmt.Errorf("invalid trust bundle: %s", err)
+		}
+		if _, ok := bundles[b.Name]; ok {
+			return fmt.Errorf("trust bundle %s is defined more than once", b.Name)
+		}
+		bundles[b.Name] = struct{}{}
+	}
+	if len(c.TrustBundles) > 0 && c.Controller.Enabled {
+		return fmt.Errorf("trust bundles can't be used in controller mode")
+	}
+
+	if err := c.TLS.Validate(); err != nil {
+		return fmt.Errorf("invalid tls configuration: %s", err)
+	}
+
+	for _, p := range c.Policies {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("invalid policy %s: %s", p.Name, err)
+		}
+	}
+
+	switch c.OnError {
+	case "", ErrorPolicyAbort, ErrorPolicyContinue:
+	default:
+		return fmt.Errorf("unknown onError policy: %q", c.OnError)
+	}
+
+	if _, ok := logLevels[c.LogLevel]; c.LogLevel != "" && !ok {
+		return fmt.Errorf("unknown logLevel: %q", c.LogLevel)
+	}
+
+	if c.LogFile.MaxSize < 0 || c.LogFile.MaxAge < 0 || c.LogFile.MaxBackups < 0 {
+		return fmt.Errorf("logFile maxSize, maxAge and maxBackups must not be negative")
+	}
+
+	// ConfigMaps are limited to 1MiB.
+	if c.Audit.MaxSize < 0 || c.Audit.MaxSize > 1<<20 {
+		return fmt.Errorf("audit maxSize must be between 0 and 1MiB: %d", c.Audit.MaxSize)
+	}
+
+	switch c.Metrics.Labels {
+	case "", MetricLabelsMapping, MetricLabelsAggregate, MetricLabelsTopFailures:
+	default:
+		return fmt.Errorf("unknown metrics labels: %q", c.Metrics.Labels)
+	}
+
+	if c.Metrics.TopFailures < 0 {
+		return fmt.Errorf("metrics topFailures must not be negative: %d", c.Metrics.TopFailures)
+	}
+
+	if c.Workers < 0 {
+		return fmt.Errorf("workers must not be negative: %d", c.Workers)
+	}
+
+	if c.Retries < 0 {
+		return fmt.Errorf("retries must not be negative: %d", c.Retries)
+	}
+
+	if c.Vault.RateLimit < 0 {
+		return fmt.Errorf("vault rateLimit must not be negative: %f", c.Vault.RateLimit)
+	}
+	if c.Vault.ReadConcurrency < 0 {
+		return fmt.Errorf("vault readConcurrency must not be negative: %d", c.Vault.ReadConcurrency)
+	}
+
+	if c.Kubernetes.QPS < 0 || c.Kubernetes.Burst < 0 ||
+		c.Kubernetes.WriteConcurrency < 0 {
+		return fmt.Errorf(
+			"kubernetes qps, burst and writeConcurrency must not be negative",
+		)
+	}
+
+	if c.MaxConsecutiveFailures < 0 {
+		return fmt.Errorf(
+			"maxConsecutiveFailures must not be negative: %d",
+			c.MaxConsecutiveFailures,
+		)
+	}
+
+	if c.LeaderElection.Enabled && !c.Daemon {
+		return fmt.Errorf("leader election requires daemon mode")
+	}
+
+	if c.Controller.Enabled && !c.Daemon {
+		return fmt.Errorf("controller requires daemon mode")
+	}
+
+	if c.Controller.Enabled && c.Operator {
+		return fmt.Errorf("controller and operator modes can't be used together")
+	}
+
+	if c.Discovery.Enabled && (c.Operator || c.Controller.Enabled) {
+		return fmt.Errorf("discovery can't be used in operator or controller mode")
+	}
+
+	if c.NamespaceScoped {
+		if err := c.validateNamespaceScoped(); err != nil {
+			return fmt.Errorf("invalid namespace-scoped configuration: %s", err)
+		}
+	}
+
+	if c.Webhook.Enabled {
+		if !c.Daemon {
+			return fmt.Errorf("webhook requires daemon mode")
+		}
+		if c.Webhook.CertFile == "" || c.Webhook.KeyFile == "" {
+			return fmt.Errorf("webhook requires certFile and keyFile")
+		}
+	}
+
+	if c.Recreate.Enabled && !c.Daemon {
+		return fmt.Errorf("recreating deleted secrets requires daemon mode")
+	}
+
+	if c.Recreate.RateLimit < 0 || c.Recreate.Burst < 0 {
+		return fmt.Errorf(
+			"recreate rateLimit and burst must not be negative: %f, %d",
+			c.Recreate.RateLimit,
+			c.Recreate.Burst,
+		)
+	}
+
+	if c.Admin && !c.Daemon {
+		return fmt.Errorf("admin endpoints require daemon mode")
+	}
+
+	if c.Vault.CAReload < 0 {
+		return fmt.Errorf("vault caReload must not be negative: %s", c.Vault.CAReload)
+	}
+
+	if c.Vault.CAReload > 0 && (c.Vault.TLSConfig == nil || c.Vault.TLSConfig.CACert == "") {
+		return fmt.Errorf("vault caReload requires tls.cacert")
+	}
+
+	if c.Vault.Events && !c.Daemon {
+		return fmt.Errorf("vault events require daemon mode")
+	}
+
+	if c.Vault.HealthInterval < 0 {
+		return fmt.Errorf("vault healthInterval must not be negative: %s", c.Vault.HealthInterval)
+	}
+
+	if c.Vault.HealthInterval > 0 && !c.Daemon {
+		return fmt.Errorf("vault health checks require daemon mode")
+	}
+
+	if _, err := template.New("audience").Parse(c.Vault.GCPAudience); err != nil {
+		return fmt.Errorf("invalid vault gcpAudience: %s", err)
+	}
+
+	_, err := template.New("role").Funcs(template.FuncMap{
+		"claim": func(string) string { return "" },
+	}).Parse(c.Vault.RoleTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid vault roleTemplate: %s", err)
+	}
+
+	if err := c.Vault.validateAuth(); err != nil {
+		return fmt.Errorf("invalid vault configuration: %s", err)
+	}
+
+	if err := c.Vault.Transport.Validate(); err != nil {
+		return fmt.Errorf("invalid vault transport: %s", err)
+	}
+
+	if c.Vault.TokenTTLWarning < 0 {
+		return fmt.Errorf("vault tokenTTLWarning must not be negative: %s", c.Vault.TokenTTLWarning)
+	}
+
+	if len(c.Vault.FailoverURLs) > 0 && c.Vault.HealthInterval == 0 {
+		return fmt.Errorf("vault failoverURLs require healthInterval")
+	}
+
+	for _, u := range c.Vault.FailoverURLs {
+		if u == "" {
+			return fmt.Errorf("vault failoverURLs must not be empty")
+		}
+	}
+
+	for name, source := range c.Sources {
+		if name == "" {
+			return fmt.Errorf("sources must have a name")
+		}
+		if source.URL == "" {
+			return fmt.Errorf("source %s has no url", name)
+		}
+		if len(source.FailoverURLs) > 0 {
+			return fmt.Errorf("source %s can't have failoverURLs", name)
+		}
+		if source.RateLimit < 0 {
+			return fmt.Errorf("rateLimit of source %s must not be negative: %f", name, source.RateLimit)
+		}
+		if source.ReadConcurrency < 0 {
+			return fmt.Errorf("readConcurrency of source %s must not be negative: %d", name, source.ReadConcurrency)
+		}
+		if err := source.validateAuth(); err != nil {
+			return fmt.Errorf("source %s: %s", name, err)
+		}
+		if err := source.Transport.Validate(); err != nil {
+			return fmt.Errorf("invalid transport of source %s: %s", name, err)
+		}
+	}
+
+	for name, source := range c.OnePassword {
+		if name == "" {
+			return fmt.Errorf("1Password sources must have a name")
+		}
+		if _, ok := c.Sources[name]; ok {
+			return fmt.Errorf("1Password source %s has the name of a vault source", name)
+		}
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("invalid 1Password source %s: %s", name, err)
+		}
+	}
+
+	for name, source := range c.Etcd {
+		if name == "" {
+			return fmt.Errorf("etcd sources must have a name")
+		}
+		if _, ok := c.Sources[name]; ok {
+			return fmt.Errorf("etcd source %s has the name of a vault source", name)
+		}
+		if _, ok := c.OnePassword[name]; ok {
+			return fmt.Errorf("etcd source %s has the name of a 1Password source", name)
+		}
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("invalid etcd source %s: %s", name, err)
+		}
+	}
+
+	for name, source := range c.Conjur {
+		if name == "" {
+			return fmt.Errorf("Conjur sources must have a name")
+		}
+		if _, ok := c.Sources[name]; ok {
+			return fmt.Errorf("Conjur source %s has the name of a vault source", name)
+		}
+		if _, ok := c.OnePassword[name]; ok {
+			return fmt.Errorf("Conjur source %s has the name of a 1Password source", name)
+		}
+		if _, ok := c.Etcd[name]; ok {
+			return fmt.Errorf("Conjur source %s has the name of an etcd source", name)
+		}
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("invalid Conjur source %s: %s", name, err)
+		}
+	}
+
+	if c.Shards < 0 {
+		return fmt.Errorf("shards must not be negative: %d", c.Shards)
+	}
+
+	if err := c.validateTransactions(); err != nil {
+		return err
+	}
+
+	if err := c.validateSink(); err != nil {
+		return fmt.Errorf("invalid sink: %s", err)
+	}
+
+	if err := c.DeletionGuard.Validate(); err != nil {
+		return fmt.Errorf("invalid deletionGuard: %s", err)
+	}
+
+	if c.Shards > 1 && c.LeaderElection.Enabled {
+		return fmt.Errorf("sharding and leader election can't be used together")
+	}
+
+	if c.PassTimeout < 0 {
+		return fmt.Errorf("passTimeout must not be negative: %s", c.PassTimeout)
+	}
+
+	if c.MaxBackoff != 0 && c.MaxBackoff < c.RefreshInterval {
+		return fmt.Errorf(
+			"maxBackoff (%s) must not be less than refresh (%s)",
+			c.MaxBackoff,
+			c.RefreshInterval,
+		)
+	}
+
 	return nil
 }
 
+// hasSource returns true if a source of any kind is named name.
+func (c *Config) hasSource(name string) bool {
+	if _, ok := c.Sources[name]; ok {
+		return true
+	}
+	return c.isFlatSource(name)
+}
+
+// isFlatSource returns true if name is a 1Password, etcd or Conjur source,
+// which are read as key/value v1 secrets.
+func (c *Config) isFlatSource(name string) bool {
+	if _, ok := c.OnePassword[name]; ok {
+		return true
+	}
+	if _, ok := c.Etcd[name]; ok {
+		return true
+	}
+	_, ok := c.Conjur[name]
+	return ok
+}
+
+// validateNamespaceScoped checks that nothing in the configuration needs
+// access outside of Namespace.
+func (c *Config) validateNamespaceScoped() error {
+	if c.Operator {
+		return fmt.Errorf("operator mode lists PentagonMappings in every namespace")
+	}
+	if c.Discovery.Enabled {
+		return fmt.Errorf("discovery lists ConfigMaps in every namespace")
+	}
+	for _, m := range c.Mappings {
+		if m.AllNamespaces || !onlyNamespace(m.Namespaces, c.Namespace) {
+			return fmt.Errorf("%s can't be reflected into other namespaces", m.SecretName)
+		}
+	}
+	for _, b := range c.TrustBundles {
+		if b.AllNamespaces || !onlyNamespace(b.Namespaces, c.Namespace) {
+			return fmt.Errorf("trust bundle %s can't target other namespaces", b.Name)
+		}
+		if b.ClusterTrustBundle != "" {
+			return fmt.Errorf("trust bundle %s can't write a ClusterTrustBundle", b.Name)
+		}
+	}
+	return nil
+}
+
+// onlyNamespace returns true if namespaces has no namespace but namespace.
+func onlyNamespace(namespaces []string, namespace string) bool {
+	for _, n := range namespaces {
+		if n != namespace {
+			return false
+		}
+	}
+	return true
+}
+
 // VaultConfig is the vault configuration.
 type VaultConfig struct {
 	// URL is the url to the vault server.
 	URL string `yaml:"url"`
 
-	// AuthType can be "token" or "gcp-default".
+	// FailoverURLs are the urls of other vault servers (e.g. DR clusters)
+	// used, in order, when the one at URL is unreachable or sealed.  The
+	// servers are checked every HealthInterval, and URL is used again as
+	// soon as it is healthy.
+	FailoverURLs []string `yaml:"failoverURLs"`
+
+	// AuthType can be "token", "gcp-default", "kubernetes",
+	// "kubernetes-secret" or "command".
 	AuthType vault.AuthType `yaml:"authType"`
 
 	// DefaultEngineType is the type of secrets engine used because the API
@@ -105,16 +904,503 @@ type VaultConfig struct {
 	// authType, the serviceAccount name is used.
 	Role string `yaml:"role"` // used for non-token auth
 
+	// GCPAudience is the template of the audience of the GCP identity token
+	// used to log in with AuthTypeGCPDefault, which must match the bound
+	// audience of the vault role.  {{.Host}} is replaced by the host of the
+	// vault url and {{.Role}} by the role.  Default DefaultGCPAudience.
+	GCPAudience string `yaml:"gcpAudience"`
+
 	// Token is a vault token and is only considered when AuthType == "token".
 	Token string `yaml:"token"`
 
+	// TokenSecret is the kubernetes secret holding the vault token when
+	// using AuthTypeKubernetesSecret.
+	TokenSecret TokenSecretConfig `yaml:"tokenSecret"`
+
+	// TokenCommand is the command, with its arguments, whose output is the
+	// vault token when using AuthTypeCommand.  It is run on every login,
+	// and again whenever vault refuses a request.
+	TokenCommand []string `yaml:"tokenCommand"`
+
 	// TLSConfig allows you to set any TLS options that the vault client
 	// accepts.
 	TLSConfig *api.TLSConfig `yaml:"tls"` // for other vault TLS options
 
+	// TLSServerName is the hostname vault's certificate is verified against
+	// and sent with SNI, when it differs from the host of URL (e.g. when
+	// connecting through an IP-based load balancer).  It overrides
+	// tls.tlsservername.
+	TLSServerName string `yaml:"tlsServerName"`
+
+	// CACertPEM is a PEM encoded CA certificate trusted to verify vault's
+	// certificate, in addition to the tls.cacert file.
+	CACertPEM string `yaml:"caCertPEM"`
+
+	// CAReload is the interval at which the tls.cacert file is re-read
+	// when it changes, so that the CA can be rotated without restarting
+	// pentagon.  Zero (the default) only reads it at startup.
+	CAReload time.Duration `yaml:"caReload"`
+
+	// Timeout limits how long a single vault read may take.  Zero (the
+	// default) uses the vault client's own timeout.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Transport tunes the connection pool of the vault client.
+	Transport TransportConfig `yaml:"transport"`
+
+	// CheckVersions makes pentagon read the metadata of key/value v2 secrets
+	// first and only read their data when a newer version than the one in
+	// the k8s secret exists.  This needs permission to read the metadata.
+	CheckVersions bool `yaml:"checkVersions"`
+
+	// RenewLeases makes pentagon renew the leases of the credentials of
+	// the consul and nomad engines when less than a third of their lease is
+	// left, rather than reading new credentials, until vault won't extend
+	// them any further.  This needs permission to update sys/leases/renew.
+	RenewLeases bool `yaml:"renewLeases"`
+
+	// RateLimit is the maximum average number of reads per second made to
+	// vault.  Zero (the default) means no limit.
+	RateLimit float32 `yaml:"rateLimit"`
+
+	// RateLimitBurst is the number of reads that may exceed RateLimit in a
+	// burst.  Default 1.
+	RateLimitBurst int `yaml:"rateLimitBurst"`
+
+	// ReadConcurrency limits the number of reads that are in flight at
+	// once, independently of the kubernetes writeConcurrency.  Zero (the
+	// default) means no limit beyond the number of workers.
+	ReadConcurrency int `yaml:"readConcurrency"`
+
+	// Events subscribes to vault's event notifications (vault 1.16+) when
+	// running as a daemon, and re-reflects the mappings of a secret as soon
+	// as it's written rather than waiting for the next refresh.
+	Events bool `yaml:"events"`
+
+	// HealthInterval is how often a daemon checks vault's sys/health
+	// endpoint and updates the vault health metrics.  Zero (the default)
+	// disables the checks.
+	HealthInterval time.Duration `yaml:"healthInterval"`
+
+	// TokenTTLWarning makes a daemon log a warning when the vault token
+	// expires in less than this, because logging in again keeps failing.
+	// The token's remaining time to live is exported either way.  Zero (the
+	// default) disables the warnings.
+	TokenTTLWarning time.Duration `yaml:"tokenTTLWarning"`
+
 	// AuthPath is the vault auth path when using AuthTypeKubernetes authType.
 	// The default is "auth/kubernetes"
 	AuthPath string `yaml:"authPath"`
+
+	// RoleClaims are the claims of the service account token that the role
+	// is taken from, in order, when using AuthTypeKubernetes without a Role.
+	// Dots separate the names of nested claims.  The default is the service
+	// account name, from the legacy or the projected token format.
+	RoleClaims []string `yaml:"roleClaims"`
+
+	// RoleTemplate derives the role from the claims of the service account
+	// token instead of RoleClaims, e.g.
+	// `{{claim "kubernetes.io.namespace"}}-{{claim "kubernetes.io.serviceaccount.name"}}`.
+	RoleTemplate string `yaml:"roleTemplate"`
+
+	// ServiceAccountTokenFile is the file holding the service account token
+	// used to log in with AuthTypeKubernetes.  It is read on every login so
+	// that rotated tokens are picked up.  The default is the token mounted
+	// in the pod, "/var/run/secrets/kubernetes.io/serviceaccount/token".
+	ServiceAccountTokenFile string `yaml:"serviceAccountTokenFile"`
+}
+
+// OnePasswordConfig is a 1Password Connect server, see onepassword.Client.
+type OnePasswordConfig struct {
+	// URL is the url of the Connect server.
+	URL string `yaml:"url"`
+
+	// Token is the Connect access token.
+	Token string `yaml:"token"`
+
+	// TokenFile is a file holding the access token instead, e.g. mounted
+	// from a kubernetes secret.  It is read for every request so that the
+	// token can be rotated.
+	TokenFile string `yaml:"tokenFile"`
+
+	// Timeout limits how long a single request may take.  Zero (the
+	// default) means no limit.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Validate checks that the server and its token are set.
+func (c OnePasswordConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if (c.Token == "") == (c.TokenFile == "") {
+		return fmt.Errorf("exactly one of token and tokenFile is required")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative: %s", c.Timeout)
+	}
+	return nil
+}
+
+// EtcdConfig is an etcd cluster, see etcd.Client.
+type EtcdConfig struct {
+	// Endpoints are the URLs of the cluster's members, e.g.
+	// "https://etcd-0:2379", which are tried in order.
+	Endpoints []string `yaml:"endpoints"`
+
+	// Username and Password authenticate to etcd if it has auth enabled.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// CACert is a file holding the CA certificates of the cluster, and
+	// CertFile and KeyFile a client certificate and key if the cluster
+	// requires one.
+	CACert   string `yaml:"caCert"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// Timeout limits how long a single read, or starting a watch, may
+	// take.  Watches then run until they fail.  Zero (the default) means
+	// no limit.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Watch syncs the mappings reading from the cluster as soon as one of
+	// their keys changes when running as a daemon, instead of waiting for
+	// the next refresh.
+	Watch bool `yaml:"watch"`
+}
+
+// Validate checks that the cluster has endpoints and that the client
+// certificate is complete.
+func (c EtcdConfig) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return fmt.Errorf("endpoints are required")
+	}
+	for _, e := range c.Endpoints {
+		if !strings.HasPrefix(e, "http://") && !strings.HasPrefix(e, "https://") {
+			return fmt.Errorf("endpoint %q must be an http:// or https:// URL", e)
+		}
+	}
+	if c.Password != "" && c.Username == "" {
+		return fmt.Errorf("password needs a username")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("needs both a certFile and a keyFile")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative: %s", c.Timeout)
+	}
+	return nil
+}
+
+// ConjurConfig is a CyberArk Conjur server, see conjur.Client.
+type ConjurConfig struct {
+	// URL is the url of the Conjur server, or of a follower.
+	URL string `yaml:"url"`
+
+	// Account is the Conjur organization account.
+	Account string `yaml:"account"`
+
+	// HostID is the ID of the host pentagon logs in as, e.g.
+	// "pentagon/prod", with or without the "host/" prefix.
+	HostID string `yaml:"hostID"`
+
+	// APIKey is the host's API key.
+	APIKey string `yaml:"apiKey"`
+
+	// APIKeyFile is a file holding the API key instead, e.g. mounted from
+	// a kubernetes secret.  It is read for every login so that the key can
+	// be rotated.
+	APIKeyFile string `yaml:"apiKeyFile"`
+
+	// CACert is a file holding the CA certificates of the server, which is
+	// often self-signed.
+	CACert string `yaml:"caCert"`
+
+	// Timeout limits how long a single request may take.  Zero (the
+	// default) means no limit.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Validate checks that the server, the account and the host's identity
+// are set.
+func (c ConjurConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if c.Account == "" {
+		return fmt.Errorf("account is required")
+	}
+	if c.HostID == "" {
+		return fmt.Errorf("hostID is required")
+	}
+	if (c.APIKey == "") == (c.APIKeyFile == "") {
+		return fmt.Errorf("exactly one of apiKey and apiKeyFile is required")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative: %s", c.Timeout)
+	}
+	return nil
+}
+
+// TokenSecretConfig names the key of a kubernetes secret holding a vault
+// token.
+type TokenSecretConfig struct {
+	// Namespace is the namespace of the secret.  The default is the
+	// configuration's namespace.
+	Namespace string `yaml:"namespace"`
+
+	// Name is the name of the secret.
+	Name string `yaml:"name"`
+
+	// Key is the key of the token in the secret.  The default is "token".
+	Key string `yaml:"key"`
+}
+
+// setDefaults sets the defaults of the token secret, which is looked up
+// in namespace unless it sets one.
+func (c *TokenSecretConfig) setDefaults(namespace string) {
+	if c.Namespace == "" {
+		c.Namespace = namespace
+	}
+	if c.Key == "" {
+		c.Key = "token"
+	}
+}
+
+// validateAuth checks that the settings of the auth type are set.
+func (c VaultConfig) validateAuth() error {
+	if c.AuthType == vault.AuthTypeKubernetesSecret && c.TokenSecret.Name == "" {
+		return fmt.Errorf("authType %s requires tokenSecret.name", c.AuthType)
+	}
+	if c.AuthType == vault.AuthTypeCommand && (len(c.TokenCommand) == 0 || c.TokenCommand[0] == "") {
+		return fmt.Errorf("authType %s requires tokenCommand", c.AuthType)
+	}
+	return nil
+}
+
+// Addresses returns the vault urls in the order they are used: URL and then
+// FailoverURLs.
+func (c VaultConfig) Addresses() []string {
+	return append([]string{c.URL}, c.FailoverURLs...)
+}
+
+// KubernetesConfig is the kubernetes client configuration.
+type KubernetesConfig struct {
+	// QPS is the maximum average number of requests per second made to the
+	// kubernetes API server.  Zero uses the client-go default.
+	QPS float32 `yaml:"qps"`
+
+	// Burst is the number of requests that may exceed QPS in a burst.  Zero
+	// uses the client-go default.
+	Burst int `yaml:"burst"`
+
+	// Timeout limits how long a single request to the API server may take.
+	// Zero (the default) means no limit.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// WriteConcurrency limits the number of secret writes (creates, updates
+	// and deletes) that are in flight at once.  Zero means no limit beyond
+	// the number of workers.
+	WriteConcurrency int `yaml:"writeConcurrency"`
+
+	// VerifyWrites reads every secret back after writing it and fails its
+	// mapping if the data was altered, e.g. by a mutating admission
+	// webhook.
+	VerifyWrites bool `yaml:"verifyWrites"`
+}
+
+// LeaderElectionConfig configures Lease-based leader election so that
+// several replicas can run with only the leader writing secrets.
+type LeaderElectionConfig struct {
+	// Enabled turns on leader election.  It requires Daemon.
+	Enabled bool `yaml:"enabled"`
+
+	// LeaseName is the name of the Lease in the Namespace used for the
+	// election.  Default "pentagon-<label>".
+	LeaseName string `yaml:"leaseName"`
+
+	// Identity identifies this replica.  Default is the hostname, which is
+	// the pod name in kubernetes.
+	Identity string `yaml:"identity"`
+
+	// LeaseDuration is how long non-leaders wait before taking over an
+	// unrenewed lease.  Default 15s.
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+
+	// RenewDeadline is how long the leader keeps trying to renew the lease
+	// before giving up leadership.  Default 10s.
+	RenewDeadline time.Duration `yaml:"renewDeadline"`
+
+	// RetryPeriod is the delay between attempts to acquire or renew the
+	// lease.  Default 2s.
+	RetryPeriod time.Duration `yaml:"retryPeriod"`
+}
+
+// ControllerConfig configures reflecting each mapping from a rate limited
+// work queue instead of in passes over all of them.
+type ControllerConfig struct {
+	// Enabled turns on the controller.  It requires Daemon.  The initial
+	// pass (and its reconciliation) still covers all of the mappings.
+	Enabled bool `yaml:"enabled"`
+
+	// BaseDelay is the delay before a failed mapping is retried.  It
+	// doubles with every consecutive failure up to MaxBackoff.  Default 1s.
+	BaseDelay time.Duration `yaml:"baseDelay"`
+}
+
+// WebhookConfig configures the mutating admission webhook that injects the
+// secrets referred to by pod annotations into pods.
+type WebhookConfig struct {
+	// Enabled turns on the webhook.  It requires Daemon.
+	Enabled bool `yaml:"enabled"`
+
+	// ListenAddress is the address the webhook is served on over TLS.
+	// Default ":8443".
+	ListenAddress string `yaml:"listen"`
+
+	// CertFile and KeyFile are the paths of the webhook's TLS certificate
+	// and key.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// LogFileConfig configures a log file, for deployments where nothing
+// collects the standard error of pentagon.
+type LogFileConfig struct {
+	// Path is the log file.  Empty (the default) only logs to standard
+	// error.
+	Path string `yaml:"path"`
+
+	// MaxSize is the size in bytes after which the file is rotated.  Zero
+	// (the default) doesn't rotate it by size.
+	MaxSize int64 `yaml:"maxSize"`
+
+	// MaxAge is the age after which the file is rotated.  Zero (the
+	// default) doesn't rotate it by age.
+	MaxAge time.Duration `yaml:"maxAge"`
+
+	// MaxBackups is the number of rotated files that are kept.  Zero (the
+	// default) keeps all of them.
+	MaxBackups int `yaml:"maxBackups"`
+}
+
+// AuditConfig configures the audit trail of secret changes.  The changed
+// keys are recorded, never their values.
+type AuditConfig struct {
+	// File is a file the changes are appended to as JSON lines.
+	File string `yaml:"file"`
+
+	// ConfigMap is the name of a ConfigMap in Namespace whose "audit.jsonl"
+	// key the changes are appended to as JSON lines.
+	ConfigMap string `yaml:"configMap"`
+
+	// MaxSize is the size in bytes that the oldest changes are dropped
+	// from the ConfigMap to stay under.  Default 512KiB.
+	MaxSize int `yaml:"maxSize"`
+}
+
+// StateConfig configures where the state of the mappings is stored.
+type StateConfig struct {
+	// ConfigMap is the name of a ConfigMap in Namespace whose "state.json"
+	// key holds the state.  Empty (the default) keeps the state in memory.
+	ConfigMap string `yaml:"configMap"`
+}
+
+// SinkConfig configures where secrets are written.
+type SinkConfig struct {
+	// Type is SinkTypeSecret (the default), SinkTypeConfigMap or
+	// SinkTypeFile.
+	Type SinkType `yaml:"type"`
+
+	// Directory is where the file sink writes secrets.
+	Directory string `yaml:"directory"`
+
+	// AgeRecipients encrypts the values written by the ConfigMap and file
+	// sinks to these age recipients, so that the sink never holds
+	// plaintext.  Empty (the default) writes plaintext.
+	AgeRecipients []string `yaml:"ageRecipients"`
+}
+
+// DiscoveryConfig configures the discovery of the mappings published in
+// ConfigMaps labeled with DiscoveryLabel.
+type DiscoveryConfig struct {
+	// Enabled reflects the mappings of the ConfigMaps into their own
+	// namespaces on every pass.
+	Enabled bool `yaml:"enabled"`
+
+	// VaultPathPrefixes restricts the vault paths of discovered mappings
+	// to the ones starting with all of the path segments of any of them.
+	// Empty (the default) allows any path.
+	VaultPathPrefixes []string `yaml:"vaultPathPrefixes"`
+}
+
+// OwnerReferencesConfig configures the owner references of the secrets
+// pentagon writes.
+type OwnerReferencesConfig struct {
+	// Enabled sets an owner reference on every secret written.  Secrets of
+	// PentagonMapping resources are owned by their resource, and the
+	// others by ConfigMap, which is created if it doesn't exist.
+	Enabled bool `yaml:"enabled"`
+
+	// ConfigMap is the name of the anchor ConfigMap in Namespace.  Default
+	// "pentagon-<label>".
+	ConfigMap string `yaml:"configMap"`
+}
+
+// SecretNamesConfig configures how the secret names of mappings that don't
+// set one are derived from their vault paths.
+type SecretNamesConfig struct {
+	// FromVaultPath derives the secret name of mappings that don't set one
+	// from their vault path.
+	FromVaultPath bool `yaml:"fromVaultPath"`
+
+	// StripPrefix is removed from the start of vault paths, e.g.
+	// "secrets/data/".
+	StripPrefix string `yaml:"stripPrefix"`
+
+	// Lowercase lowercases the derived names.
+	Lowercase bool `yaml:"lowercase"`
+}
+
+// SecretName returns the secret name derived from vaultPath: StripPrefix is
+// removed, the "/" separating the rest of the path are replaced with "-"
+// and, with Lowercase, the name is lowercased.
+func (c SecretNamesConfig) SecretName(vaultPath string) string {
+	name := strings.TrimPrefix(vaultPath, c.StripPrefix)
+	name = strings.ReplaceAll(strings.Trim(name, "/"), "/", "-")
+	if c.Lowercase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// MetricsConfig configures the labels of the per-mapping metrics.
+type MetricsConfig struct {
+	// Labels is "mapping" to give every mapping its own series (the
+	// default), "aggregate" to give all of them a single series, or
+	// "topFailures" to only give their own series to the TopFailures
+	// mappings that failed the most.
+	Labels MetricLabels `yaml:"labels"`
+
+	// TopFailures is the number of mappings with their own series with
+	// "topFailures".  Default 10.
+	TopFailures int `yaml:"topFailures"`
+}
+
+// RecreateConfig configures the immediate re-creation of managed secrets
+// that are deleted, rather than waiting for the next pass.
+type RecreateConfig struct {
+	// Enabled turns on re-creation.  It requires Daemon.
+	Enabled bool `yaml:"enabled"`
+
+	// RateLimit is the maximum average number of secrets re-created per
+	// second.  Default 1.
+	RateLimit float32 `yaml:"rateLimit"`
+
+	// Burst is the number of re-creations that may exceed RateLimit in a
+	// burst.  Default 5.
+	Burst int `yaml:"burst"`
 }
 
 // Mapping is a single mapping for a vault secret to a k8s secret.
@@ -131,4 +1417,157 @@ type Mapping struct {
 	// Vault secret.  This specifically overrides the DefaultEngineType
 	// specified in VaultConfig.
 	VaultEngineType vault.EngineType `yaml:"vaultEngineType"`
+
+	// Optional allows the vault secret to be missing.  A missing optional
+	// secret is logged and counted but does not fail the pass.
+	Optional bool `yaml:"optional"`
+
+	// Strict rejects the vault secret if it has no keys.  It is always set
+	// when Strict is set in the Config.
+	Strict bool `yaml:"strict"`
+
+	// RequiredKeys lists keys that must be present in the vault secret.  If
+	// any are missing, the mapping fails instead of being written.
+	RequiredKeys []string `yaml:"requiredKeys"`
+
+	// Validation constrains the values of keys of the secret.  If any
+	// value breaks a rule, the mapping fails instead of being written.
+	Validation []ValueRule `yaml:"validation"`
+
+	// Type is the type of the secret: Opaque, kubernetes.io/tls,
+	// kubernetes.io/ssh-auth or kubernetes.io/basic-auth.  The data of the
+	// well-known types is checked before it's written.  Empty (the default)
+	// picks Opaque or a docker config type from the data.
+	Type v1.SecretType `yaml:"type"`
+
+	// Paused leaves the k8s secret as it is, e.g. to freeze it during an
+	// incident.  Unlike removing the mapping, pausing it keeps the secret
+	// from being reconciled away.
+	Paused bool `yaml:"paused"`
+
+	// TransformExec is the command, with its arguments, that the data read
+	// from vault is piped through before being written.  The command reads
+	// and writes the data as a JSON object of base64 encoded values.
+	TransformExec []string `yaml:"transformExec"`
+
+	// MaxAge is how long the mapping may go without being reflected
+	// successfully before it is considered stale, or 0 for no limit.
+	MaxAge time.Duration `yaml:"maxAge"`
+
+	// Namespaces are the namespaces the secret is reflected into, rather
+	// than the configuration's namespace.
+	Namespaces []string `yaml:"namespaces"`
+
+	// AllNamespaces reflects the secret into every namespace except for
+	// ExcludeNamespaces and, unless they are listed in Namespaces, the
+	// SystemNamespaces.
+	AllNamespaces bool `yaml:"allNamespaces"`
+
+	// ExcludeNamespaces are left out of AllNamespaces.
+	ExcludeNamespaces []string `yaml:"excludeNamespaces"`
+
+	// NamespaceSelector is a label selector restricting AllNamespaces to
+	// the namespaces it matches.
+	NamespaceSelector string `yaml:"namespaceSelector"`
+
+	// DeletionPolicy is what happens to the secret in namespaces that the
+	// mapping no longer targets, DeletionPolicyDelete by default.
+	DeletionPolicy DeletionPolicy `yaml:"deletionPolicy"`
+
+	// Data overrides keys of the secret read from VaultPath, in order.
+	Data []DataOverride `yaml:"data"`
+
+	// Source is the name of the source that the vault secrets are read
+	// from.  Empty (the default) reads them from Vault.
+	Source string `yaml:"source"`
+
+	// RenewBefore reads the vault secret again whenever a PEM certificate
+	// in the secret expires within this long, rather than only on passes
+	// where it changed.  Zero (the default) disables renewal.
+	RenewBefore time.Duration `yaml:"renewBefore"`
+
+	// Timeout limits how long reflecting the mapping may take, from its
+	// vault reads through its transforms to writing its secret, on every
+	// attempt.  Zero (the default) means no limit besides the pass's.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Priority orders the mappings of every pass: mappings are reflected
+	// after all of the mappings with a higher priority are done.  Mappings
+	// with the same priority, by default 0, are reflected in order.
+	Priority int `yaml:"priority"`
+
+	// DependsOn are the secret names of the mappings that must have been
+	// reflected successfully in the same pass before this one is.
+	DependsOn []string `yaml:"dependsOn"`
+
+	// Groups tag the mapping so that runs can select it, or leave it out,
+	// with --only-group and --skip-group, and so that it can be part of
+	// Transactions.
+	Groups []string `yaml:"groups"`
+
+	// Canary writes the secret under another name for a number of passes
+	// before writing it under its own.
+	Canary CanaryConfig `yaml:"canary"`
+}
+
+// validateSink checks that the sink exists and that nothing in the
+// configuration needs k8s secrets when it writes something else.
+func (c *Config) validateSink() error {
+	switch c.Sink.Type {
+	case "", SinkTypeSecret:
+		if len(c.Sink.AgeRecipients) > 0 {
+			return fmt.Errorf("k8s secrets can't be encrypted")
+		}
+		if c.Sink.Directory != "" {
+			return fmt.Errorf("directory requires the file sink")
+		}
+		return nil
+	case SinkTypeConfigMap:
+		if c.Sink.Directory != "" {
+			return fmt.Errorf("directory requires the file sink")
+		}
+	case SinkTypeFile:
+		if c.Sink.Directory == "" {
+			return fmt.Errorf("the file sink requires a directory")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", c.Sink.Type)
+	}
+
+	for _, recipient := range c.Sink.AgeRecipients {
+		if _, err := age.ParseRecipient(recipient); err != nil {
+			return err
+		}
+	}
+
+	if c.Operator || c.Discovery.Enabled || c.Recreate.Enabled {
+		return fmt.Errorf("the %s sink can't be used in operator mode, with discovery or recreate", c.Sink.Type)
+	}
+	for _, m := range c.Mappings {
+		if m.FansOut() {
+			return fmt.Errorf("%s can't be reflected into other namespaces with the %s sink", m.SecretName, c.Sink.Type)
+		}
+	}
+	return nil
+}
+
+// validateTransactions checks that every transaction is a group of
+// mappings that a single reflector reflects.
+func (c *Config) validateTransactions() error {
+	if len(c.Transactions) > 0 && c.Shards > 1 {
+		return fmt.Errorf("transactions can't be split between shards")
+	}
+	for _, group := range c.Transactions {
+		found := false
+		for _, m := range c.Mappings {
+			if m.InGroups([]string{group}, nil) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("transaction %s isn't a group of any mapping", group)
+		}
+	}
+	return nil
 }
@@ -1,7 +1,9 @@
 package pentagon
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/vimeo/pentagon/vault"
 )
@@ -31,6 +33,10 @@ func TestSetDefaults(t *testing.T) {
 			t.Fatalf("empty vault engine type for mapping: %+v", m)
 		}
 	}
+
+	if c.MaxBackoff != 4*c.RefreshInterval {
+		t.Fatalf("unexpected default max backoff: %s", c.MaxBackoff)
+	}
 }
 
 func TestNoClobber(t *testing.T) {
@@ -70,4 +76,342 @@ func TestValidate(t *testing.T) {
 	if err != nil {
 		t.Fatalf("configuration should have been valid: %s", err)
 	}
+
+	c.RefreshInterval = time.Hour
+	c.MaxBackoff = time.Minute
+	err = c.Validate()
+	if err == nil {
+		t.Fatal("maxBackoff less than refresh should have been invalid")
+	}
+}
+
+func TestValidateReverseMappings(t *testing.T) {
+	c := &Config{
+		Daemon:          true,
+		Mappings:        []Mapping{{VaultPath: "secrets/data/db", SecretName: "db"}},
+		ReverseMappings: []ReverseMapping{{SecretName: "cluster-ca", VaultPath: "secrets/data/cluster/ca"}},
+	}
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	c.Controller.Enabled = true
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "controller mode") {
+		t.Errorf("reverse mappings in controller mode should have been invalid, got %v", err)
+	}
+}
+
+func TestSetDefaultsMappings(t *testing.T) {
+	c := &Config{
+		Vault: VaultConfig{
+			DefaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+		Strict: true,
+		Mappings: []Mapping{
+			{
+				VaultPath:  "foo",
+				SecretName: "foo",
+			},
+			{
+				VaultPath:       "bar",
+				SecretName:      "bar",
+				VaultEngineType: vault.EngineTypeKeyValueV1,
+			},
+		},
+	}
+
+	c.SetDefaults()
+
+	if c.Mappings[0].VaultEngineType != vault.EngineTypeKeyValueV2 {
+		t.Fatalf("foo should inherit the default engine type, is %s", c.Mappings[0].VaultEngineType)
+	}
+
+	if c.Mappings[1].VaultEngineType != vault.EngineTypeKeyValueV1 {
+		t.Fatalf("bar should keep its engine type, is %s", c.Mappings[1].VaultEngineType)
+	}
+
+	for _, m := range c.Mappings {
+		if !m.Strict {
+			t.Fatalf("mapping %s should be strict", m.SecretName)
+		}
+	}
+}
+
+func TestSecretNames(t *testing.T) {
+	c := &Config{
+		SecretNames: SecretNamesConfig{
+			FromVaultPath: true,
+			StripPrefix:   "secrets/data/",
+			Lowercase:     true,
+		},
+		Mappings: []Mapping{
+			{VaultPath: "secrets/data/Team/API-Key"},
+			{VaultPath: "secrets/data/db", SecretName: "database"},
+		},
+	}
+	c.SetDefaults()
+
+	if c.Mappings[0].SecretName != "team-api-key" {
+		t.Errorf("unexpected derived name: %q", c.Mappings[0].SecretName)
+	}
+	if c.Mappings[1].SecretName != "database" {
+		t.Errorf("explicit names should be kept, got %q", c.Mappings[1].SecretName)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	// names that only differ by the separator collide.
+	c.Mappings = append(c.Mappings, Mapping{VaultPath: "secrets/data/team-api-key"})
+	c.SetDefaults()
+	if err := c.Validate(); err == nil {
+		t.Fatal("duplicate secret names should have been invalid")
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	c := &Config{
+		Sources: map[string]VaultConfig{
+			"dr": {URL: "https://vault-dr.example.com"},
+		},
+		Mappings: []Mapping{
+			{VaultPath: "foo", SecretName: "foo", Source: "dr"},
+			{VaultPath: "bar", SecretName: "bar"},
+		},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	c.Mappings[1].Source = "missing"
+	if err := c.Validate(); err == nil {
+		t.Fatal("unknown source should have been invalid")
+	}
+
+	c.Mappings[1].Source = ""
+	c.Sources["nourl"] = VaultConfig{}
+	if err := c.Validate(); err == nil {
+		t.Fatal("source without a url should have been invalid")
+	}
+}
+
+func TestValidateNamespaceScoped(t *testing.T) {
+	c := &Config{
+		Namespace:       "team-a",
+		NamespaceScoped: true,
+		Mappings: []Mapping{
+			{VaultPath: "foo", SecretName: "foo"},
+			{VaultPath: "bar", SecretName: "bar", Namespaces: []string{"team-a"}},
+		},
+		TrustBundles: []TrustBundle{
+			{Name: "ca", VaultPath: "ca", Keys: []string{"ca.crt"}},
+		},
+	}
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	for name, change := range map[string]func(c *Config){
+		"other namespace":      func(c *Config) { c.Mappings[1].Namespaces = []string{"team-b"} },
+		"all namespaces":       func(c *Config) { c.Mappings[0].AllNamespaces = true },
+		"bundle namespace":     func(c *Config) { c.TrustBundles[0].Namespaces = []string{"team-b"} },
+		"cluster trust bundle": func(c *Config) { c.TrustBundles[0].ClusterTrustBundle = "ca" },
+		"operator":             func(c *Config) { c.Operator = true },
+		"discovery":            func(c *Config) { c.Discovery.Enabled = true },
+	} {
+		invalid := *c
+		invalid.Mappings = append([]Mapping{}, c.Mappings...)
+		invalid.TrustBundles = append([]TrustBundle{}, c.TrustBundles...)
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s should have been invalid", name)
+		}
+	}
+}
+
+func TestValidateSink(t *testing.T) {
+	c := &Config{
+		Mappings: []Mapping{{VaultPath: "foo", SecretName: "foo"}},
+		Sink: SinkConfig{
+			Type:          SinkTypeFile,
+			Directory:     "/var/lib/pentagon",
+			AgeRecipients: []string{"age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"},
+		},
+	}
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	for name, change := range map[string]func(c *Config){
+		"unknown type":        func(c *Config) { c.Sink.Type = "git" },
+		"no directory":        func(c *Config) { c.Sink.Directory = "" },
+		"configMap directory": func(c *Config) { c.Sink.Type = SinkTypeConfigMap },
+		"encrypted secrets":   func(c *Config) { c.Sink = SinkConfig{Type: SinkTypeSecret, AgeRecipients: c.Sink.AgeRecipients} },
+		"invalid recipient":   func(c *Config) { c.Sink.AgeRecipients = []string{"age1invalid"} },
+		"fan-out":             func(c *Config) { c.Mappings[0].AllNamespaces = true },
+		"operator":            func(c *Config) { c.Operator = true },
+		"recreate":            func(c *Config) { c.Daemon = true; c.Recreate.Enabled = true },
+	} {
+		invalid := *c
+		invalid.Mappings = append([]Mapping{}, c.Mappings...)
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s should have been invalid", name)
+		}
+	}
+}
+
+func TestValidateTokenSecret(t *testing.T) {
+	c := &Config{
+		Namespace: "team-a",
+		Vault:     VaultConfig{AuthType: vault.AuthTypeKubernetesSecret},
+		Mappings:  []Mapping{{VaultPath: "foo", SecretName: "foo"}},
+	}
+	c.SetDefaults()
+	if err := c.Validate(); err == nil {
+		t.Fatal("a token secret without a name should have been invalid")
+	}
+
+	c.Vault.TokenSecret.Name = "vault-token"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+	if c.Vault.TokenSecret.Namespace != "team-a" || c.Vault.TokenSecret.Key != "token" {
+		t.Fatalf("unexpected token secret defaults: %+v", c.Vault.TokenSecret)
+	}
+}
+
+func TestValidateFanOutCleanup(t *testing.T) {
+	c := &Config{
+		Mappings: []Mapping{{
+			VaultPath:         "foo",
+			SecretName:        "foo",
+			AllNamespaces:     true,
+			NamespaceSelector: "team in (a, b)",
+			DeletionPolicy:    DeletionPolicyRetain,
+		}},
+	}
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	for name, change := range map[string]func(m *Mapping){
+		"invalid selector":      func(m *Mapping) { m.NamespaceSelector = "team in (a" },
+		"selector without all":  func(m *Mapping) { m.AllNamespaces = false },
+		"invalid policy":        func(m *Mapping) { m.DeletionPolicy = "orphan" },
+		"policy without fanout": func(m *Mapping) { m.AllNamespaces, m.NamespaceSelector = false, "" },
+	} {
+		invalid := *c
+		invalid.Mappings = append([]Mapping{}, c.Mappings...)
+		change(&invalid.Mappings[0])
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s should have been invalid", name)
+		}
+	}
+}
+
+func TestValidateOnePassword(t *testing.T) {
+	c := &Config{
+		OnePassword: map[string]OnePasswordConfig{
+			"1password": {URL: "http://connect:8080", TokenFile: "/var/run/connect/token"},
+		},
+		Mappings: []Mapping{{VaultPath: "infra/db", SecretName: "db", Source: "1password"}},
+	}
+	c.Vault.DefaultEngineType = vault.EngineTypeKeyValueV2
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+	if c.Mappings[0].VaultEngineType != vault.EngineTypeKeyValueV1 {
+		t.Errorf("1Password mappings should default to kv, got %q", c.Mappings[0].VaultEngineType)
+	}
+
+	for name, change := range map[string]func(c *Config){
+		"no url":       func(c *Config) { c.OnePassword["1password"] = OnePasswordConfig{Token: "t"} },
+		"two tokens":   func(c *Config) { c.OnePassword["1password"] = OnePasswordConfig{URL: "u", Token: "t", TokenFile: "f"} },
+		"engine type":  func(c *Config) { c.Mappings[0].VaultEngineType = vault.EngineTypeKeyValueV2 },
+		"vault source": func(c *Config) { c.Sources = map[string]VaultConfig{"1password": {URL: "u"}} },
+	} {
+		invalid := *c
+		invalid.OnePassword = map[string]OnePasswordConfig{"1password": c.OnePassword["1password"]}
+		invalid.Mappings = append([]Mapping{}, c.Mappings...)
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s should have been invalid", name)
+		}
+	}
+}
+
+func TestValidateEtcd(t *testing.T) {
+	c := &Config{
+		Etcd: map[string]EtcdConfig{
+			"etcd": {Endpoints: []string{"https://etcd-0:2379"}, Username: "pentagon", Password: "p"},
+		},
+		Mappings: []Mapping{{VaultPath: "config/app", SecretName: "app", Source: "etcd"}},
+	}
+	c.Vault.DefaultEngineType = vault.EngineTypeKeyValueV2
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+	if c.Mappings[0].VaultEngineType != vault.EngineTypeKeyValueV1 {
+		t.Errorf("etcd mappings should default to kv, got %q", c.Mappings[0].VaultEngineType)
+	}
+
+	for name, change := range map[string]func(c *Config){
+		"no endpoints":     func(c *Config) { c.Etcd["etcd"] = EtcdConfig{} },
+		"bad endpoint":     func(c *Config) { c.Etcd["etcd"] = EtcdConfig{Endpoints: []string{"etcd-0:2379"}} },
+		"password only":    func(c *Config) { c.Etcd["etcd"] = EtcdConfig{Endpoints: []string{"http://e"}, Password: "p"} },
+		"cert without key": func(c *Config) { c.Etcd["etcd"] = EtcdConfig{Endpoints: []string{"http://e"}, CertFile: "c"} },
+		"engine type":      func(c *Config) { c.Mappings[0].VaultEngineType = vault.EngineTypeKeyValueV2 },
+		"vault source":     func(c *Config) { c.Sources = map[string]VaultConfig{"etcd": {URL: "u"}} },
+		"1Password source": func(c *Config) { c.OnePassword = map[string]OnePasswordConfig{"etcd": {URL: "u", Token: "t"}} },
+	} {
+		invalid := *c
+		invalid.Etcd = map[string]EtcdConfig{"etcd": c.Etcd["etcd"]}
+		invalid.Mappings = append([]Mapping{}, c.Mappings...)
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s should have been invalid", name)
+		}
+	}
+}
+
+func TestValidateConjur(t *testing.T) {
+	c := &Config{
+		Conjur: map[string]ConjurConfig{
+			"conjur": {URL: "https://conjur", Account: "acme", HostID: "pentagon/prod", APIKeyFile: "/var/run/conjur/api-key"},
+		},
+		Mappings: []Mapping{{VaultPath: "prod/db/password", SecretName: "db", Source: "conjur"}},
+	}
+	c.Vault.DefaultEngineType = vault.EngineTypeKeyValueV2
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+	if c.Mappings[0].VaultEngineType != vault.EngineTypeKeyValueV1 {
+		t.Errorf("Conjur mappings should default to kv, got %q", c.Mappings[0].VaultEngineType)
+	}
+
+	for name, change := range map[string]func(c *Config){
+		"no account":   func(c *Config) { c.Conjur["conjur"] = ConjurConfig{URL: "u", HostID: "h", APIKey: "k"} },
+		"no host":      func(c *Config) { c.Conjur["conjur"] = ConjurConfig{URL: "u", Account: "a", APIKey: "k"} },
+		"no api key":   func(c *Config) { c.Conjur["conjur"] = ConjurConfig{URL: "u", Account: "a", HostID: "h"} },
+		"engine type":  func(c *Config) { c.Mappings[0].VaultEngineType = vault.EngineTypeKeyValueV2 },
+		"etcd source":  func(c *Config) { c.Etcd = map[string]EtcdConfig{"conjur": {Endpoints: []string{"http://e"}}} },
+		"vault source": func(c *Config) { c.Sources = map[string]VaultConfig{"conjur": {URL: "u"}} },
+	} {
+		invalid := *c
+		invalid.Conjur = map[string]ConjurConfig{"conjur": c.Conjur["conjur"]}
+		invalid.Mappings = append([]Mapping{}, c.Mappings...)
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s should have been invalid", name)
+		}
+	}
 }
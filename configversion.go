@@ -0,0 +1,82 @@
+package pentagon
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigAPIVersion is the apiVersion of the current configuration schema.
+const ConfigAPIVersion = "pentagon.vimeo.com/v1"
+
+// configMigration upgrades configurations of apiVersion from to apiVersion
+// to.
+type configMigration struct {
+	from string
+	to   string
+
+	// migrate rewrites the decoded configuration in place.  It is nil when
+	// the schemas are the same.
+	migrate func(config map[interface{}]interface{}) error
+}
+
+// configMigrations are applied in order to upgrade older configurations.
+// A schema change adds a new ConfigAPIVersion and a migration from the
+// previous one, so that existing configurations keep loading.
+var configMigrations = []configMigration{
+	// configurations without an apiVersion predate it and have the v1
+	// schema.
+	{from: "", to: "pentagon.vimeo.com/v1"},
+}
+
+// MigrateConfig upgrades the YAML configuration raw to ConfigAPIVersion,
+// returning the upgraded YAML, or raw as is if it doesn't need rewriting.
+func MigrateConfig(raw []byte) ([]byte, error) {
+	config := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(raw, &config); err != nil {
+		return nil, err
+	}
+
+	original, ok := config["apiVersion"].(string)
+	if !ok && config["apiVersion"] != nil {
+		return nil, fmt.Errorf("apiVersion must be a string")
+	}
+
+	version := original
+	rewritten := false
+	for _, m := range configMigrations {
+		if m.from != version {
+			continue
+		}
+		if m.migrate != nil {
+			if err := m.migrate(config); err != nil {
+				return nil, fmt.Errorf(
+					"unable to migrate configuration from %q to %s: %s",
+					m.from,
+					m.to,
+					err,
+				)
+			}
+			rewritten = true
+		}
+		version = m.to
+	}
+
+	if version != ConfigAPIVersion {
+		return nil, fmt.Errorf(
+			"unsupported apiVersion %q, the latest supported is %s",
+			original,
+			ConfigAPIVersion,
+		)
+	}
+	if !rewritten {
+		return raw, nil
+	}
+
+	config["apiVersion"] = version
+	migrated, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return migrated, nil
+}
@@ -0,0 +1,63 @@
+package pentagon
+
+import (
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	for _, raw := range []string{
+		"mappings: []\n",
+		"apiVersion: pentagon.vimeo.com/v1\nmappings: []\n",
+	} {
+		migrated, err := MigrateConfig([]byte(raw))
+		if err != nil {
+			t.Fatalf("unable to migrate %q: %s", raw, err)
+		}
+		if string(migrated) != raw {
+			t.Errorf("%q shouldn't have been rewritten, got %q", raw, migrated)
+		}
+	}
+
+	for _, raw := range []string{
+		"apiVersion: pentagon.vimeo.com/v99\n",
+		"apiVersion: [v1]\n",
+		"[not a map]\n",
+	} {
+		if _, err := MigrateConfig([]byte(raw)); err == nil {
+			t.Errorf("%q should have failed to migrate", raw)
+		}
+	}
+}
+
+func TestMigrateConfigRewrite(t *testing.T) {
+	defer func(m []configMigration) { configMigrations = m }(configMigrations)
+	configMigrations = append(configMigrations, configMigration{
+		from: "pentagon.vimeo.com/v0",
+		to:   "pentagon.vimeo.com/v1",
+		migrate: func(config map[interface{}]interface{}) error {
+			config["refresh"] = config["refreshInterval"]
+			delete(config, "refreshInterval")
+			return nil
+		},
+	})
+
+	migrated, err := MigrateConfig([]byte(
+		"apiVersion: pentagon.vimeo.com/v0\nrefreshInterval: 1m\nmappings: []\n",
+	))
+	if err != nil {
+		t.Fatalf("unable to migrate: %s", err)
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(migrated, config); err != nil {
+		t.Fatalf("the migrated configuration should be current: %s", err)
+	}
+	if config.APIVersion != ConfigAPIVersion {
+		t.Errorf("expected apiVersion %s, got %s", ConfigAPIVersion, config.APIVersion)
+	}
+	if config.RefreshInterval.String() != "1m0s" {
+		t.Errorf("expected the refresh to be migrated, got %s", config.RefreshInterval)
+	}
+}
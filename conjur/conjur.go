@@ -0,0 +1,190 @@
+// Package conjur reads variables from CyberArk Conjur, so that pentagon
+// mappings can reflect them like vault secrets.
+package conjur
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// maxResponseSize bounds the size of a response of Conjur.
+const maxResponseSize = 16 << 20
+
+// tokenLifetime is how long an access token is used before logging in
+// again.  Conjur's tokens expire after 8 minutes.
+const tokenLifetime = 6 * time.Minute
+
+// Client reads variables from Conjur, logged in as a host.  It implements
+// vault.Logical, reading a path as the ID of a variable, e.g.
+// "prod/db/password", and returning a secret with the variable's value
+// under the last segment of its ID, e.g. "password".  Variables that
+// don't exist or don't have a value yet are read as nil, like missing
+// vault secrets.
+type Client struct {
+	url        string
+	account    string
+	login      string
+	apiKey     func() (string, error)
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+var (
+	_ vault.Logical       = (*Client)(nil)
+	_ vault.ContextReader = (*Client)(nil)
+)
+
+// NewClient returns a Client of the Conjur server at serverURL, logged in
+// to account as the host hostID, e.g. "pentagon/prod", with the API key
+// returned by apiKey, which is called for every login so that the key can
+// be rotated.  A nil httpClient uses http.DefaultClient.
+func NewClient(
+	serverURL string,
+	account string,
+	hostID string,
+	apiKey func() (string, error),
+	httpClient *http.Client,
+) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		url:        strings.TrimSuffix(serverURL, "/"),
+		account:    account,
+		login:      "host/" + strings.TrimPrefix(hostID, "host/"),
+		apiKey:     apiKey,
+		httpClient: httpClient,
+	}
+}
+
+// escape escapes s as a single segment of a URL path, including its
+// slashes, as Conjur expects of logins and variable IDs.
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// Read reads path, see Client.
+func (c *Client) Read(path string) (*api.Secret, error) {
+	return c.ReadWithContext(context.Background(), path)
+}
+
+// ReadWithContext reads path, giving up when ctx is done.
+func (c *Client) ReadWithContext(ctx context.Context, path string) (*api.Secret, error) {
+	id := strings.Trim(path, "/")
+	if id == "" {
+		return nil, fmt.Errorf("invalid Conjur variable ID %q", path)
+	}
+
+	variable := fmt.Sprintf("/secrets/%s/variable/%s", escape(c.account), escape(id))
+	for attempt := 0; ; attempt++ {
+		token, err := c.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest("GET", c.url+variable, nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Authorization", fmt.Sprintf("Token token=%q", token))
+
+		status, body, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		switch status {
+		case http.StatusOK:
+			segments := strings.Split(id, "/")
+			return &api.Secret{
+				Data: map[string]interface{}{segments[len(segments)-1]: string(body)},
+			}, nil
+		case http.StatusNotFound:
+			return nil, nil
+		case http.StatusUnauthorized:
+			// the token expired early, log in again once.
+			if attempt == 0 {
+				c.mu.Lock()
+				c.token = ""
+				c.mu.Unlock()
+				continue
+			}
+		}
+		return nil, fmt.Errorf(
+			"error reading Conjur variable %s: Code: %d. Errors: %s",
+			id,
+			status,
+			strings.TrimSpace(string(body)),
+		)
+	}
+}
+
+// Write fails, Conjur variables are only read.
+func (c *Client) Write(path string, data map[string]interface{}) (*api.Secret, error) {
+	return nil, fmt.Errorf("can't write %s, Conjur variables are read-only", path)
+}
+
+// authenticate returns the base64 encoded access token, logging in as the
+// host if there is none yet or it's about to expire.
+func (c *Client) authenticate(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	apiKey, err := c.apiKey()
+	if err != nil {
+		return "", fmt.Errorf("error getting the Conjur API key: %s", err)
+	}
+	req, err := http.NewRequest(
+		"POST",
+		fmt.Sprintf("%s/authn/%s/%s/authenticate", c.url, escape(c.account), escape(c.login)),
+		strings.NewReader(apiKey),
+	)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept-Encoding", "base64")
+
+	status, body, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("error authenticating to Conjur as %s: Code: %d", c.login, status)
+	}
+	c.token = strings.TrimSpace(string(body))
+	c.expires = time.Now().Add(tokenLifetime)
+	return c.token, nil
+}
+
+// do sends req and returns the status and body of the response.
+func (c *Client) do(req *http.Request) (int, []byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading response of %s: %s", req.URL.Path, err)
+	}
+	return resp.StatusCode, body, nil
+}
@@ -0,0 +1,100 @@
+package conjur
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// server returns a Conjur server of the account "acme" letting the host
+// "pentagon/prod" read "prod/db/password", and counts the logins in logins.
+// Tokens are revoked after every read of "prod/revoking".
+func server(t *testing.T, logins *int) *httptest.Server {
+	token := ""
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.EscapedPath(); {
+		case path == "/authn/acme/host%2Fpentagon%2Fprod/authenticate":
+			key, _ := ioutil.ReadAll(r.Body)
+			if r.Method != "POST" || string(key) != "api-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("Accept-Encoding") != "base64" {
+				t.Error("the token should be requested base64 encoded")
+			}
+			*logins++
+			token = base64.StdEncoding.EncodeToString([]byte(`{"protected":"...","payload":"..."}`))
+			w.Write([]byte(token))
+		case r.Header.Get("Authorization") != `Token token="`+token+`"` || token == "":
+			w.WriteHeader(http.StatusUnauthorized)
+		case path == "/secrets/acme/variable/prod%2Fdb%2Fpassword":
+			w.Write([]byte("hunter2"))
+		case path == "/secrets/acme/variable/prod%2Frevoking":
+			w.Write([]byte("value"))
+			token = ""
+		case path == "/secrets/acme/variable/prod%2Fforbidden":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"code":"forbidden","message":"Forbidden"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"not_found","message":"Variable not found"}}`))
+		}
+	}))
+}
+
+func TestRead(t *testing.T) {
+	logins := 0
+	s := server(t, &logins)
+	defer s.Close()
+
+	client := NewClient(s.URL, "acme", "pentagon/prod", func() (string, error) { return "api-key", nil }, nil)
+
+	for _, tbl := range []struct {
+		path     string
+		expected map[string]interface{}
+	}{
+		{"prod/db/password", map[string]interface{}{"password": "hunter2"}},
+		{"/prod/db/password/", map[string]interface{}{"password": "hunter2"}},
+		{"prod/missing", nil},
+		{"prod/revoking", map[string]interface{}{"revoking": "value"}},
+		{"prod/db/password", map[string]interface{}{"password": "hunter2"}},
+	} {
+		secret, err := client.Read(tbl.path)
+		if err != nil {
+			t.Errorf("unable to read %s: %s", tbl.path, err)
+			continue
+		}
+		if tbl.expected == nil {
+			if secret != nil {
+				t.Errorf("%s shouldn't exist: %v", tbl.path, secret.Data)
+			}
+			continue
+		}
+		if secret == nil || !reflect.DeepEqual(secret.Data, tbl.expected) {
+			t.Errorf("unexpected data of %s: %v", tbl.path, secret)
+		}
+	}
+	if logins != 2 {
+		t.Errorf("expected a login and another after the token was revoked, got %d", logins)
+	}
+
+	if _, err := client.Read("prod/forbidden"); !vault.IsPermissionDenied(err) {
+		t.Errorf("expected a permission denied error, got %v", err)
+	}
+	if _, err := client.Read("/"); err == nil {
+		t.Error("an empty variable ID should be invalid")
+	}
+	if _, err := client.Write("prod/db/password", nil); err == nil {
+		t.Error("writes should fail")
+	}
+
+	client = NewClient(s.URL, "acme", "host/pentagon/prod", func() (string, error) { return "wrong", nil }, nil)
+	if _, err := client.Read("prod/db/password"); err == nil {
+		t.Error("reads with the wrong API key should fail")
+	}
+}
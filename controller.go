@@ -0,0 +1,107 @@
+package pentagon
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Controller reflects each mapping from a rate limited work queue rather
+// than in passes over all of them.  A mapping that fails is retried on its
+// own exponential backoff without delaying the others, and a mapping that
+// succeeds is reflected again after the refresh interval.
+type Controller struct {
+	reflector *Reflector
+	mappings  map[string]Mapping
+	interval  time.Duration
+	queue     workqueue.RateLimitingInterface
+}
+
+// NewController returns a Controller reflecting mappings with reflector
+// every interval.  Failed mappings are retried after baseDelay, doubling
+// up to maxDelay.
+func NewController(
+	reflector *Reflector,
+	mappings []Mapping,
+	interval time.Duration,
+	baseDelay time.Duration,
+	maxDelay time.Duration,
+) *Controller {
+	byName := make(map[string]Mapping, len(mappings))
+	for _, m := range reflector.selectedMappings(mappings) {
+		byName[m.SecretName] = m
+	}
+
+	return &Controller{
+		reflector: reflector,
+		mappings:  byName,
+		interval:  interval,
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+			"pentagon",
+		),
+	}
+}
+
+// Run reflects the mappings with the given number of workers until ctx is
+// done.  The first reflection of every mapping happens after the refresh
+// interval since a full pass is expected to have just been made.
+func (c *Controller) Run(ctx context.Context, workers int) {
+	for name := range c.mappings {
+		c.queue.AddAfter(name, c.interval)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.processNext(ctx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	c.queue.ShutDown()
+	wg.Wait()
+}
+
+// processNext reflects the next mapping in the queue and requeues it.  It
+// returns false once the queue is shut down.
+func (c *Controller) processNext(ctx context.Context) bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	name := item.(string)
+	mapping, ok := c.mappings[name]
+	if !ok {
+		c.queue.Forget(item)
+		return true
+	}
+
+	err := c.reflector.Sync(ctx, []Mapping{mapping})
+	if ctx.Err() != nil {
+		return true
+	}
+	if err != nil {
+		requeuedMappingsCounter.Inc()
+		log.Printf(
+			"error reflecting %s, retrying after %d failures: %s",
+			name,
+			c.queue.NumRequeues(item)+1,
+			err,
+		)
+		c.queue.AddRateLimited(item)
+		return true
+	}
+
+	c.queue.Forget(item)
+	c.queue.AddAfter(item, c.interval)
+	return true
+}
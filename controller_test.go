@@ -0,0 +1,76 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestController(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	mock.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	k8sClient := k8sfake.NewSimpleClientset()
+
+	r := NewReflector(
+		&flakyVault{Mock: mock, failures: 2},
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+	)
+
+	// the missing secret keeps failing, which must not keep foo from
+	// being reflected.
+	c := NewController(
+		r,
+		[]Mapping{
+			{
+				VaultPath:       "secrets/data/missing",
+				SecretName:      "missing",
+				VaultEngineType: vault.EngineTypeKeyValueV1,
+			},
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "foo",
+				VaultEngineType: vault.EngineTypeKeyValueV1,
+			},
+		},
+		10*time.Millisecond,
+		time.Millisecond,
+		10*time.Millisecond,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, 1)
+		close(done)
+	}()
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	for i := 0; i < 100; i++ {
+		if _, err := secrets.Get("foo", metav1.GetOptions{}); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	s, err := secrets.Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should have been reflected after its failures: %s", err)
+	}
+	if string(s.Data["foo"]) != "bar" {
+		t.Fatalf("unexpected data: %s", s.Data["foo"])
+	}
+}
@@ -0,0 +1,149 @@
+// Package csi implements a Secrets Store CSI driver provider backed by
+// pentagon's mappings, so that workloads can mount vault secrets as files
+// without any k8s secret objects.
+//
+// The driver talks to providers over the gRPC service defined in
+// sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1, which Server
+// serves on a unix socket.  Provider.Mount takes and returns the same
+// information as that service's Mount call.
+package csi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+// MappingsAttribute is the SecretProviderClass parameter listing the
+// comma-separated secret names of the mappings to mount.
+const MappingsAttribute = "mappings"
+
+// PodNamespaceAttribute is the attribute the driver sets to the namespace of
+// the pod mounting the volume.
+const PodNamespaceAttribute = "csi.storage.k8s.io/pod.namespace"
+
+// File is a file to write in the mounted volume.
+type File struct {
+	// Path is relative to the root of the volume.
+	Path     string
+	Mode     int32
+	Contents []byte
+}
+
+// ObjectVersion is the version of a mounted mapping, which the driver uses
+// to decide whether a volume needs to be rotated.
+type ObjectVersion struct {
+	ID      string
+	Version string
+}
+
+// Provider mounts the vault secrets of mappings as files.
+type Provider struct {
+	vaultClient vault.Logical
+	namespace   string
+	mappings    map[string]pentagon.Mapping
+}
+
+// NewProvider returns a Provider reading mappings from vaultClient.
+// Mappings are referred to by their secret names, and are only mounted by
+// pods in the namespaces they target, with namespace as the default one.
+func NewProvider(
+	vaultClient vault.Logical,
+	namespace string,
+	mappings []pentagon.Mapping,
+) *Provider {
+	byName := make(map[string]pentagon.Mapping, len(mappings))
+	for _, m := range mappings {
+		byName[m.SecretName] = m
+	}
+	return &Provider{
+		vaultClient: vaultClient,
+		namespace:   namespace,
+		mappings:    byName,
+	}
+}
+
+// Mount returns the files for the mappings listed in the "mappings"
+// attribute, one directory per mapping named after its secret with one
+// file per key.  Mappings that don't target the namespace of the pod, from
+// the "csi.storage.k8s.io/pod.namespace" attribute, are refused.
+// attributes is the JSON encoded map of the SecretProviderClass parameters
+// and permission the JSON encoded file mode sent by the driver.
+func (p *Provider) Mount(
+	ctx context.Context,
+	attributes string,
+	permission string,
+) ([]File, []ObjectVersion, error) {
+	params := map[string]string{}
+	if err := json.Unmarshal([]byte(attributes), &params); err != nil {
+		return nil, nil, fmt.Errorf("error decoding attributes: %s", err)
+	}
+
+	mode := int32(0644)
+	if permission != "" {
+		parsed, err := strconv.ParseInt(strings.Trim(permission, `"`), 10, 32)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid permission %q: %s", permission, err)
+		}
+		mode = int32(parsed)
+	}
+
+	podNamespace := params[PodNamespaceAttribute]
+	if podNamespace == "" {
+		return nil, nil, fmt.Errorf("no %q attribute", PodNamespaceAttribute)
+	}
+
+	files := []File{}
+	versions := []ObjectVersion{}
+	for _, name := range strings.Split(params[MappingsAttribute], ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		mapping, ok := p.mappings[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown mapping %s", name)
+		}
+		if !mapping.TargetsNamespace(p.namespace, podNamespace) {
+			return nil, nil, fmt.Errorf("mapping %s doesn't target namespace %s", name, podNamespace)
+		}
+		if mapping.Source != "" {
+			return nil, nil, fmt.Errorf("mapping %s reads from source %s, which can't be mounted", name, mapping.Source)
+		}
+
+		data, version, err := pentagon.ReadMapping(ctx, p.vaultClient, mapping)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			files = append(files, File{
+				Path:     path.Join(name, key),
+				Mode:     mode,
+				Contents: data[key],
+			})
+		}
+		versions = append(versions, ObjectVersion{
+			ID:      name,
+			Version: version,
+		})
+	}
+
+	if len(versions) == 0 {
+		return nil, nil, fmt.Errorf("no mappings listed in %q", MappingsAttribute)
+	}
+
+	return files, versions, nil
+}
@@ -0,0 +1,85 @@
+package csi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestMount(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	mock.Write("secrets/data/db", map[string]interface{}{
+		"user":     "admin",
+		"password": "hunter2",
+	})
+
+	p := NewProvider(mock, "pentagon", []pentagon.Mapping{
+		{
+			VaultPath:       "secrets/data/db",
+			SecretName:      "db",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+			Namespaces:      []string{"team-a"},
+		},
+		{
+			VaultPath:       "secrets/data/db",
+			SecretName:      "local",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+	})
+
+	files, versions, err := p.Mount(
+		context.Background(),
+		`{"mappings": "db", "csi.storage.k8s.io/pod.name": "app", "csi.storage.k8s.io/pod.namespace": "team-a"}`,
+		`"420"`,
+	)
+	if err != nil {
+		t.Fatalf("mount didn't work: %s", err)
+	}
+
+	expected := []File{
+		{Path: "db/password", Mode: 420, Contents: []byte("hunter2")},
+		{Path: "db/user", Mode: 420, Contents: []byte("admin")},
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(files))
+	}
+	for i, f := range expected {
+		if files[i].Path != f.Path || files[i].Mode != f.Mode ||
+			string(files[i].Contents) != string(f.Contents) {
+			t.Errorf("file %d: expected %+v, got %+v", i, f, files[i])
+		}
+	}
+
+	if len(versions) != 1 || versions[0] != (ObjectVersion{ID: "db", Version: "1"}) {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+
+	_, _, err = p.Mount(context.Background(), `{"mappings": "other", "csi.storage.k8s.io/pod.namespace": "team-a"}`, "")
+	if err == nil {
+		t.Fatal("mounting an unknown mapping should have failed")
+	}
+
+	for attributes, reason := range map[string]string{
+		`{"mappings": "db"}`: "without a pod namespace",
+		`{"mappings": "db", "csi.storage.k8s.io/pod.namespace": "team-b"}`:    "into a namespace it doesn't target",
+		`{"mappings": "local", "csi.storage.k8s.io/pod.namespace": "team-a"}`: "into a namespace it doesn't target",
+		`{"mappings": "db", "csi.storage.k8s.io/pod.namespace": "pentagon"}`:  "into the default namespace when it lists others",
+	} {
+		if _, _, err := p.Mount(context.Background(), attributes, ""); err == nil {
+			t.Errorf("mounting %s should have failed", reason)
+		}
+	}
+	if _, _, err := p.Mount(context.Background(), `{"mappings": "local", "csi.storage.k8s.io/pod.namespace": "pentagon"}`, ""); err != nil {
+		t.Errorf("mounting into the default namespace didn't work: %s", err)
+	}
+
+	p = NewProvider(mock, "pentagon", []pentagon.Mapping{{VaultPath: "secrets/data/db", SecretName: "db", Source: "eu"}})
+	_, _, err = p.Mount(context.Background(), `{"mappings": "db", "csi.storage.k8s.io/pod.namespace": "pentagon"}`, "")
+	if err == nil {
+		t.Fatal("mounting a mapping of another source should have failed")
+	}
+}
@@ -0,0 +1,104 @@
+package csi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vimeo/pentagon/csi/v1alpha1"
+)
+
+// APIVersion is the version of the driver's provider API that is served.
+const APIVersion = "v1alpha1"
+
+// RuntimeName is the name the provider reports to the driver.
+const RuntimeName = "pentagon"
+
+// Server serves a Provider over the driver's gRPC API.
+type Server struct {
+	provider *Provider
+	version  string
+}
+
+var _ v1alpha1.CSIDriverProviderServer = (*Server)(nil)
+
+// NewServer returns a Server of provider, reporting version as the
+// provider's runtime version.
+func NewServer(provider *Provider, version string) *Server {
+	return &Server{provider: provider, version: version}
+}
+
+// Version returns the API version and the provider's version.
+func (s *Server) Version(
+	ctx context.Context,
+	req *v1alpha1.VersionRequest,
+) (*v1alpha1.VersionResponse, error) {
+	return &v1alpha1.VersionResponse{
+		Version:        APIVersion,
+		RuntimeName:    RuntimeName,
+		RuntimeVersion: s.version,
+	}, nil
+}
+
+// Mount returns the files of the mappings the SecretProviderClass lists,
+// see Provider.Mount.  The driver writes them to the volume.
+func (s *Server) Mount(
+	ctx context.Context,
+	req *v1alpha1.MountRequest,
+) (*v1alpha1.MountResponse, error) {
+	files, versions, err := s.provider.Mount(ctx, req.Attributes, req.Permission)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &v1alpha1.MountResponse{
+		Files:         make([]*v1alpha1.File, 0, len(files)),
+		ObjectVersion: make([]*v1alpha1.ObjectVersion, 0, len(versions)),
+	}
+	for _, f := range files {
+		resp.Files = append(resp.Files, &v1alpha1.File{
+			Path:     f.Path,
+			Mode:     f.Mode,
+			Contents: f.Contents,
+		})
+	}
+	for _, v := range versions {
+		resp.ObjectVersion = append(resp.ObjectVersion, &v1alpha1.ObjectVersion{
+			Id:      v.ID,
+			Version: v.Version,
+		})
+	}
+	return resp, nil
+}
+
+// Serve serves s on the unix socket at socket until ctx is done, replacing
+// the socket a previous provider left behind.  The driver looks for
+// providers' sockets named "<provider>.sock" in its providers directory,
+// "/var/run/secrets-store-csi-providers" by default.
+func (s *Server) Serve(ctx context.Context, socket string) error {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove the old socket: %s", err)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %s", socket, err)
+	}
+
+	server := grpc.NewServer()
+	v1alpha1.RegisterCSIDriverProviderServer(server, s)
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	if err := server.Serve(listener); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
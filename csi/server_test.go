@@ -0,0 +1,104 @@
+package csi
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/csi/v1alpha1"
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestServe(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	mock.Write("secrets/data/db", map[string]interface{}{
+		"password": "hunter2",
+	})
+	provider := NewProvider(mock, "pentagon", []pentagon.Mapping{
+		{
+			VaultPath:       "secrets/data/db",
+			SecretName:      "db",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+	})
+
+	dir, err := ioutil.TempDir("", "pentagon-csi")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a socket left behind by a previous provider is replaced.
+	socket := filepath.Join(dir, "pentagon.sock")
+	if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatalf("unable to create stale socket: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- NewServer(provider, "test").Serve(ctx, socket)
+	}()
+
+	conn, err := grpc.Dial(
+		socket,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithTimeout(5*time.Second),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	defer conn.Close()
+	client := v1alpha1.NewCSIDriverProviderClient(conn)
+
+	version, err := client.Version(ctx, &v1alpha1.VersionRequest{Version: APIVersion})
+	if err != nil {
+		t.Fatalf("version didn't work: %s", err)
+	}
+	if version.Version != APIVersion || version.RuntimeName != RuntimeName || version.RuntimeVersion != "test" {
+		t.Errorf("unexpected version: %+v", version)
+	}
+
+	resp, err := client.Mount(ctx, &v1alpha1.MountRequest{
+		Attributes: `{"mappings": "db", "csi.storage.k8s.io/pod.namespace": "pentagon"}`,
+		Permission: `"420"`,
+		TargetPath: "/var/lib/kubelet/pods/app/volumes/secrets",
+	})
+	if err != nil {
+		t.Fatalf("mount didn't work: %s", err)
+	}
+	if len(resp.Files) != 1 || resp.Files[0].Path != "db/password" ||
+		resp.Files[0].Mode != 420 || string(resp.Files[0].Contents) != "hunter2" {
+		t.Errorf("unexpected files: %v", resp.Files)
+	}
+	if len(resp.ObjectVersion) != 1 || resp.ObjectVersion[0].Id != "db" || resp.ObjectVersion[0].Version != "1" {
+		t.Errorf("unexpected versions: %v", resp.ObjectVersion)
+	}
+
+	if _, err := client.Mount(ctx, &v1alpha1.MountRequest{Attributes: `{"mappings": "other", "csi.storage.k8s.io/pod.namespace": "pentagon"}`}); err == nil {
+		t.Error("mounting an unknown mapping should have failed")
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serving failed: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the server didn't stop")
+	}
+}
@@ -0,0 +1,198 @@
+// Package v1alpha1 is the gRPC API that the Secrets Store CSI driver calls
+// providers with.  It is written by hand to be wire compatible with
+// provider/v1alpha1/service.proto of sigs.k8s.io/secrets-store-csi-driver,
+// whose generated package needs newer protobuf and gRPC libraries than
+// pentagon is built with.
+package v1alpha1
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the full name of the provider service.
+const ServiceName = "v1alpha1.CSIDriverProvider"
+
+// VersionRequest asks for the version of the provider.
+type VersionRequest struct {
+	// Version is the API version the driver speaks.
+	Version string `protobuf:"bytes,1,opt,name=version,proto3"`
+}
+
+func (m *VersionRequest) Reset()         { *m = VersionRequest{} }
+func (m *VersionRequest) String() string { return proto.CompactTextString(m) }
+func (*VersionRequest) ProtoMessage()    {}
+
+// VersionResponse is the version of the provider.
+type VersionResponse struct {
+	// Version is the API version the provider speaks, "v1alpha1".
+	Version        string `protobuf:"bytes,1,opt,name=version,proto3"`
+	RuntimeName    string `protobuf:"bytes,2,opt,name=runtime_name,json=runtimeName,proto3"`
+	RuntimeVersion string `protobuf:"bytes,3,opt,name=runtime_version,json=runtimeVersion,proto3"`
+}
+
+func (m *VersionResponse) Reset()         { *m = VersionResponse{} }
+func (m *VersionResponse) String() string { return proto.CompactTextString(m) }
+func (*VersionResponse) ProtoMessage()    {}
+
+// MountRequest asks for the files of a volume.
+type MountRequest struct {
+	// Attributes is the JSON encoded map of the SecretProviderClass
+	// parameters, along with the pod's details.
+	Attributes string `protobuf:"bytes,1,opt,name=attributes,proto3"`
+
+	// Secrets is the JSON encoded map of the node publish secret.
+	Secrets string `protobuf:"bytes,2,opt,name=secrets,proto3"`
+
+	// TargetPath is where the volume is mounted.
+	TargetPath string `protobuf:"bytes,3,opt,name=targetPath,proto3"`
+
+	// Permission is the JSON encoded file mode of the files.
+	Permission string `protobuf:"bytes,4,opt,name=permission,proto3"`
+
+	// CurrentObjectVersion are the versions currently mounted.
+	CurrentObjectVersion []*ObjectVersion `protobuf:"bytes,5,rep,name=current_object_version,json=currentObjectVersion,proto3"`
+}
+
+func (m *MountRequest) Reset()         { *m = MountRequest{} }
+func (m *MountRequest) String() string { return proto.CompactTextString(m) }
+func (*MountRequest) ProtoMessage()    {}
+
+// MountResponse is the files of a volume, which the driver writes.
+type MountResponse struct {
+	ObjectVersion []*ObjectVersion `protobuf:"bytes,1,rep,name=object_version,json=objectVersion,proto3"`
+	Error         *Error           `protobuf:"bytes,2,opt,name=error,proto3"`
+	Files         []*File          `protobuf:"bytes,3,rep,name=files,proto3"`
+}
+
+func (m *MountResponse) Reset()         { *m = MountResponse{} }
+func (m *MountResponse) String() string { return proto.CompactTextString(m) }
+func (*MountResponse) ProtoMessage()    {}
+
+// File is a file of a volume.
+type File struct {
+	Path     string `protobuf:"bytes,1,opt,name=path,proto3"`
+	Mode     int32  `protobuf:"varint,2,opt,name=mode,proto3"`
+	Contents []byte `protobuf:"bytes,3,opt,name=contents,proto3"`
+}
+
+func (m *File) Reset()         { *m = File{} }
+func (m *File) String() string { return proto.CompactTextString(m) }
+func (*File) ProtoMessage()    {}
+
+// ObjectVersion is the version of an object of a volume.
+type ObjectVersion struct {
+	Id      string `protobuf:"bytes,1,opt,name=id,proto3"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3"`
+}
+
+func (m *ObjectVersion) Reset()         { *m = ObjectVersion{} }
+func (m *ObjectVersion) String() string { return proto.CompactTextString(m) }
+func (*ObjectVersion) ProtoMessage()    {}
+
+// Error is the error code of a failed mount.
+type Error struct {
+	Code string `protobuf:"bytes,1,opt,name=code,proto3"`
+}
+
+func (m *Error) Reset()         { *m = Error{} }
+func (m *Error) String() string { return proto.CompactTextString(m) }
+func (*Error) ProtoMessage()    {}
+
+// CSIDriverProviderServer is the provider service.
+type CSIDriverProviderServer interface {
+	Version(context.Context, *VersionRequest) (*VersionResponse, error)
+	Mount(context.Context, *MountRequest) (*MountResponse, error)
+}
+
+// RegisterCSIDriverProviderServer serves srv as the provider service of s.
+func RegisterCSIDriverProviderServer(s *grpc.Server, srv CSIDriverProviderServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*CSIDriverProviderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Version", Handler: versionHandler},
+		{MethodName: "Mount", Handler: mountHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "service.proto",
+}
+
+func versionHandler(
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	in := new(VersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CSIDriverProviderServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Version"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CSIDriverProviderServer).Version(ctx, req.(*VersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func mountHandler(
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	in := new(MountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CSIDriverProviderServer).Mount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Mount"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CSIDriverProviderServer).Mount(ctx, req.(*MountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CSIDriverProviderClient calls the provider service, like the driver.
+type CSIDriverProviderClient interface {
+	Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error)
+	Mount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*MountResponse, error)
+}
+
+type client struct {
+	cc *grpc.ClientConn
+}
+
+// NewCSIDriverProviderClient returns a client of the provider service
+// served on cc.
+func NewCSIDriverProviderClient(cc *grpc.ClientConn) CSIDriverProviderClient {
+	return &client{cc}
+}
+
+func (c *client) Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error) {
+	out := new(VersionResponse)
+	err := c.cc.Invoke(ctx, "/"+ServiceName+"/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *client) Mount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*MountResponse, error) {
+	out := new(MountResponse)
+	err := c.cc.Invoke(ctx, "/"+ServiceName+"/Mount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package pentagon
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// DataOverride sets a key of a mapping's secret, overriding the key of the
+// same name read from the mapping's vault path.  The value is either read
+// from another vault secret or rendered from a template.
+type DataOverride struct {
+	// Key is the key of the k8s secret that is set.
+	Key string `yaml:"key"`
+
+	// VaultPath is the vault secret the value is read from, with the
+	// mapping's engine type.
+	VaultPath string `yaml:"vaultPath"`
+
+	// Property is the key of the vault secret holding the value.  Defaults
+	// to Key.
+	Property string `yaml:"property"`
+
+	// Template renders the value with text/template from the keys of the
+	// secret as merged so far, e.g. "{{.user}}:{{.password}}".  It is used
+	// instead of VaultPath.
+	Template string `yaml:"template"`
+}
+
+// Validate checks that the override sets its key from exactly one source.
+func (o DataOverride) Validate() error {
+	if o.Key == "" {
+		return fmt.Errorf("data overrides need a key")
+	}
+	if (o.VaultPath == "") == (o.Template == "") {
+		return fmt.Errorf("data override of %s needs either a vaultPath or a template", o.Key)
+	}
+	if o.Template != "" {
+		if _, err := template.New(o.Key).Option("missingkey=error").Parse(o.Template); err != nil {
+			return fmt.Errorf("invalid template of %s: %s", o.Key, err)
+		}
+	}
+	return nil
+}
+
+// overlayData returns data with the data overrides of mapping applied in
+// order, so later overrides take precedence over earlier ones, which take
+// precedence over data.  read returns the data of the vault secret at a
+// path, or nil if it doesn't exist.  data isn't modified.
+func overlayData(
+	mapping Mapping,
+	data map[string][]byte,
+	read func(path string) (map[string][]byte, error),
+) (map[string][]byte, error) {
+	if len(mapping.Data) == 0 {
+		return data, nil
+	}
+
+	merged := make(map[string][]byte, len(data)+len(mapping.Data))
+	for key, value := range data {
+		merged[key] = value
+	}
+
+	for _, o := range mapping.Data {
+		if o.Template != "" {
+			value, err := renderOverride(o, merged)
+			if err != nil {
+				return nil, err
+			}
+			merged[o.Key] = value
+			continue
+		}
+
+		source, err := read(o.VaultPath)
+		if err != nil {
+			return nil, err
+		}
+		if source == nil {
+			return nil, fmt.Errorf("secret %s not found", o.VaultPath)
+		}
+		property := o.Property
+		if property == "" {
+			property = o.Key
+		}
+		value, ok := source[property]
+		if !ok {
+			return nil, fmt.Errorf("secret %s has no key %s", o.VaultPath, property)
+		}
+		merged[o.Key] = value
+	}
+
+	return merged, nil
+}
+
+// renderOverride renders the template of o with the keys of data.
+func renderOverride(o DataOverride, data map[string][]byte) ([]byte, error) {
+	tmpl, err := template.New(o.Key).Option("missingkey=error").Parse(o.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template of %s: %s", o.Key, err)
+	}
+
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		values[key] = string(value)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, values); err != nil {
+		return nil, fmt.Errorf("error rendering %s: %s", o.Key, err)
+	}
+	return buf.Bytes(), nil
+}
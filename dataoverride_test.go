@@ -0,0 +1,88 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestDataOverrides(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		vaultClient.Write("secrets/data/base", map[string]interface{}{
+			"user":     "app",
+			"password": "base",
+			"host":     "db",
+		})
+		vaultClient.Write("secrets/data/rotated", map[string]interface{}{
+			"current": "rotated",
+		})
+
+		r := NewReflector(vaultClient, k8sClient, DefaultNamespace, DefaultLabelValue)
+		err := r.Reflect(context.Background(), []Mapping{{
+			VaultPath:       "secrets/data/base",
+			SecretName:      "merged",
+			VaultEngineType: engineType,
+			Data: []DataOverride{
+				{Key: "password", VaultPath: "secrets/data/rotated", Property: "current"},
+				{Key: "url", Template: "postgres://{{.user}}:{{.password}}@{{.host}}"},
+			},
+		}})
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("merged", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("merged should be there: %s", err)
+		}
+		for key, expected := range map[string]string{
+			"user":     "app",
+			"password": "rotated",
+			"host":     "db",
+			"url":      "postgres://app:rotated@db",
+		} {
+			if string(s.Data[key]) != expected {
+				t.Errorf("expected %s to be %q, got %q", key, expected, s.Data[key])
+			}
+		}
+	})
+}
+
+func TestDataOverrideErrors(t *testing.T) {
+	read := func(path string) (map[string][]byte, error) {
+		if path == "secrets/other" {
+			return map[string][]byte{"foo": []byte("bar")}, nil
+		}
+		return nil, nil
+	}
+
+	for testName, o := range map[string]DataOverride{
+		"missing secret":   {Key: "foo", VaultPath: "secrets/missing"},
+		"missing property": {Key: "foo", VaultPath: "secrets/other", Property: "baz"},
+		"missing key":      {Key: "foo", Template: "{{.baz}}"},
+	} {
+		_, err := overlayData(Mapping{Data: []DataOverride{o}}, map[string][]byte{}, read)
+		if err == nil {
+			t.Errorf("%s: expected an error", testName)
+		}
+	}
+
+	for testName, o := range map[string]DataOverride{
+		"no key":         {VaultPath: "secrets/other"},
+		"no source":      {Key: "foo"},
+		"both sources":   {Key: "foo", VaultPath: "secrets/other", Template: "bar"},
+		"invalid syntax": {Key: "foo", Template: "{{"},
+	} {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%s: expected the override to be invalid", testName)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package pentagon
+
+import (
+	"fmt"
+	"sync"
+)
+
+// dependency tracks whether a mapping other mappings depend on is done
+// being reflected within a pass.
+type dependency struct {
+	done   chan struct{}
+	once   sync.Once
+	failed bool
+}
+
+// finish marks the mapping as done, and whether it failed.
+func (d *dependency) finish(failed bool) {
+	d.once.Do(func() {
+		d.failed = failed
+		close(d.done)
+	})
+}
+
+// dependencies tracks the mappings of a pass that other mappings of the
+// pass depend on.
+type dependencies struct {
+	byName   map[string]*dependency
+	position map[string]int
+}
+
+// newDependencies returns the dependencies of mappings, which must be in
+// dependency order.
+func newDependencies(mappings []Mapping) *dependencies {
+	d := &dependencies{
+		byName:   make(map[string]*dependency, len(mappings)),
+		position: make(map[string]int, len(mappings)),
+	}
+	for i, m := range mappings {
+		if _, ok := d.byName[m.SecretName]; !ok {
+			d.byName[m.SecretName] = &dependency{done: make(chan struct{})}
+			d.position[m.SecretName] = i
+		}
+	}
+	return d
+}
+
+// wait waits for the dependencies of mapping that come before it to be
+// done, and returns an error if any of them failed.
+func (d *dependencies) wait(mapping Mapping) error {
+	for _, name := range mapping.DependsOn {
+		dep, ok := d.byName[name]
+		if !ok || d.position[name] >= d.position[mapping.SecretName] {
+			continue
+		}
+		<-dep.done
+		if dep.failed {
+			return fmt.Errorf("dependency %s of %s was not reflected", name, mapping.SecretName)
+		}
+	}
+	return nil
+}
+
+// finish marks mapping as done, and whether it failed.
+func (d *dependencies) finish(mapping Mapping, failed bool) {
+	d.byName[mapping.SecretName].finish(failed)
+}
+
+// dependencyOrder returns mappings with each mapping moved after the
+// mappings it depends on, keeping the order of the others.  Dependencies
+// that aren't part of mappings are ignored, and so are the dependencies
+// that would close a cycle.
+func dependencyOrder(mappings []Mapping) []Mapping {
+	byName := make(map[string]int, len(mappings))
+	for i, m := range mappings {
+		if _, ok := byName[m.SecretName]; !ok {
+			byName[m.SecretName] = i
+		}
+	}
+
+	ordered := make([]Mapping, 0, len(mappings))
+	visited := make([]bool, len(mappings))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, name := range mappings[i].DependsOn {
+			if j, ok := byName[name]; ok {
+				visit(j)
+			}
+		}
+		ordered = append(ordered, mappings[i])
+	}
+	for i := range mappings {
+		visit(i)
+	}
+	return ordered
+}
+
+// dependencyCycle returns an error naming the mappings of a cycle of
+// dependencies, if there is one.
+func dependencyCycle(mappings []Mapping) error {
+	byName := make(map[string]Mapping, len(mappings))
+	for _, m := range mappings {
+		byName[m.SecretName] = m
+	}
+
+	// visiting holds the path of mappings being visited, and done the
+	// mappings that aren't part of a cycle.
+	visiting := map[string]bool{}
+	done := map[string]bool{}
+	path := []string{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			cycle := name
+			for i := len(path) - 1; i >= 0 && path[i] != name; i-- {
+				cycle = path[i] + " -> " + cycle
+			}
+			return fmt.Errorf("dependency cycle: %s -> %s", name, cycle)
+		}
+		visiting[name] = true
+		path = append(path, name)
+		for _, dep := range byName[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		visiting[name] = false
+		done[name] = true
+		return nil
+	}
+
+	for _, m := range mappings {
+		if err := visit(m.SecretName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
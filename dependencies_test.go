@@ -0,0 +1,132 @@
+package pentagon
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestDependencies(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/ca", map[string]interface{}{"ca.crt": "ca"})
+	vaultClient.Write("secrets/cert", map[string]interface{}{"tls.crt": "cert"})
+	vaultClient.Write("secrets/other", map[string]interface{}{"foo": "bar"})
+
+	mappings := []Mapping{
+		{VaultPath: "secrets/cert", SecretName: "cert", DependsOn: []string{"ca"}},
+		{VaultPath: "secrets/other", SecretName: "other", DependsOn: []string{"missing"}},
+		{VaultPath: "secrets/ca", SecretName: "ca"},
+	}
+	for i := range mappings {
+		mappings[i].VaultEngineType = vault.EngineTypeKeyValueV1
+	}
+
+	var mu sync.Mutex
+	order := []string{}
+	errs := map[string]error{}
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		"test",
+		WithWorkers(4),
+		WithErrorPolicy(ErrorPolicyContinue),
+		WithResults(func(res SyncResult) {
+			mu.Lock()
+			order = append(order, res.Mapping.SecretName)
+			errs[res.Mapping.SecretName] = res.Err
+			mu.Unlock()
+		}),
+	)
+
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if indexOf(order, "ca") > indexOf(order, "cert") {
+		t.Fatalf("cert was reflected before the ca it depends on: %v", order)
+	}
+
+	// a failed dependency fails the mappings depending on it.
+	vaultClient.Delete("secrets/ca")
+	if err := r.Reflect(context.Background(), mappings); err == nil {
+		t.Fatal("reflect should have failed")
+	}
+	cert, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("cert should still be there: %s", err)
+	}
+	if string(cert.Data["tls.crt"]) != "cert" {
+		t.Fatalf("unexpected cert data: %v", cert.Data)
+	}
+	if errs["cert"] == nil {
+		t.Fatal("cert should have failed along with its dependency")
+	}
+	if errs["other"] != nil {
+		t.Fatalf("dependencies outside of the pass should be ignored: %s", errs["other"])
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	mappings := []Mapping{
+		{SecretName: "a", DependsOn: []string{"b"}},
+		{SecretName: "b", DependsOn: []string{"c"}},
+		{SecretName: "c", DependsOn: []string{"a"}},
+		{SecretName: "d", DependsOn: []string{"a"}},
+	}
+	if err := dependencyCycle(mappings); err == nil {
+		t.Fatal("the cycle should have been found")
+	}
+
+	mappings[2].DependsOn = nil
+	if err := dependencyCycle(mappings); err != nil {
+		t.Fatalf("unexpected cycle: %s", err)
+	}
+
+	names := ""
+	for _, m := range dependencyOrder(mappings) {
+		names += m.SecretName
+	}
+	if names != "cbad" {
+		t.Fatalf("unexpected order: %s", names)
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	c := &Config{
+		Mappings: []Mapping{
+			{VaultPath: "ca", SecretName: "ca"},
+			{VaultPath: "cert", SecretName: "cert", DependsOn: []string{"ca"}},
+		},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	c.Mappings[1].DependsOn = []string{"missing"}
+	if err := c.Validate(); err == nil {
+		t.Fatal("unknown dependency should have been invalid")
+	}
+
+	c.Mappings[0].DependsOn = []string{"cert"}
+	c.Mappings[1].DependsOn = []string{"ca"}
+	if err := c.Validate(); err == nil {
+		t.Fatal("dependency cycle should have been invalid")
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,249 @@
+package pentagon
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DiscoveryLabel selects the ConfigMaps whose mappings are discovered
+	// when it is set to "true".
+	DiscoveryLabel = "pentagon.vimeo.com/mappings"
+
+	// DiscoveryKey is the key of the YAML list of mappings in discovered
+	// ConfigMaps.
+	DiscoveryKey = "mappings.yaml"
+
+	// NamespacePlaceholder is replaced by the namespace of a discovered
+	// ConfigMap in the vault path prefixes its mappings are restricted to.
+	NamespacePlaceholder = "{namespace}"
+)
+
+// Discovery discovers the mappings of the ConfigMaps labeled with
+// DiscoveryLabel in every namespace, so that teams can publish mappings
+// without access to the configuration.  Each mapping is reflected into the
+// namespace of its ConfigMap.
+type Discovery struct {
+	client    kubernetes.Interface
+	namespace string
+	defaults  Mapping
+	prefixes  []string
+}
+
+// NewDiscovery returns a Discovery listing ConfigMaps with client.
+// Configured mappings that don't list namespaces go to namespace.  The
+// engine type and strictness of defaults apply to discovered mappings that
+// don't set them, and their vault paths must start with one of prefixes
+// unless it is empty, with NamespacePlaceholder replaced by the namespace of
+// their ConfigMap.
+func NewDiscovery(
+	client kubernetes.Interface,
+	namespace string,
+	defaults Mapping,
+	prefixes []string,
+) *Discovery {
+	return &Discovery{
+		client:    client,
+		namespace: namespace,
+		defaults:  defaults,
+		prefixes:  prefixes,
+	}
+}
+
+// Mappings returns mappings followed by the discovered mappings.
+// Discovered mappings of secrets that mappings or another ConfigMap already
+// map into the same namespace, and invalid ConfigMaps and mappings, are
+// logged and left out.
+func (d *Discovery) Mappings(mappings []Mapping) ([]Mapping, error) {
+	list, err := d.client.CoreV1().ConfigMaps("").List(metav1.ListOptions{
+		LabelSelector: DiscoveryLabel + "=true",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing mapping ConfigMaps: %s", err)
+	}
+
+	// ConfigMaps are read in order so that the same one wins every pass.
+	items := list.Items
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	// mappings into all namespaces take their secret names everywhere.
+	mapped := map[string]struct{}{}
+	everywhere := map[string]struct{}{}
+	for _, m := range mappings {
+		if m.AllNamespaces {
+			everywhere[m.SecretName] = struct{}{}
+		}
+		for _, namespace := range m.targetNamespaces(d.namespace, nil) {
+			mapped[namespace+"/"+m.SecretName] = struct{}{}
+		}
+	}
+
+	all := append([]Mapping{}, mappings...)
+	for i := range items {
+		cm := &items[i]
+		discovered, err := configMapMappings(cm, d.defaults, d.prefixes)
+		if err != nil {
+			log.Printf("ignoring mapping ConfigMap %s/%s: %s", cm.Namespace, cm.Name, err)
+			continue
+		}
+		for _, m := range discovered {
+			key := cm.Namespace + "/" + m.SecretName
+			_, taken := mapped[key]
+			if _, ok := everywhere[m.SecretName]; ok || taken {
+				log.Printf(
+					"ignoring mapping of %s in ConfigMap %s/%s: the secret is already mapped",
+					m.SecretName,
+					cm.Namespace,
+					cm.Name,
+				)
+				continue
+			}
+			mapped[key] = struct{}{}
+			all = append(all, m)
+		}
+	}
+	return all, nil
+}
+
+// configMapMappings returns the mappings of a discovered ConfigMap,
+// targeting its namespace.
+func configMapMappings(
+	cm *v1.ConfigMap,
+	defaults Mapping,
+	prefixes []string,
+) ([]Mapping, error) {
+	raw, ok := cm.Data[DiscoveryKey]
+	if !ok {
+		return nil, fmt.Errorf("no %s key", DiscoveryKey)
+	}
+
+	mappings := []Mapping{}
+	if err := yaml.UnmarshalStrict([]byte(raw), &mappings); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", DiscoveryKey, err)
+	}
+
+	allowed := namespacePrefixes(prefixes, cm.Namespace)
+	for i := range mappings {
+		m := &mappings[i]
+		if err := validateDiscovered(*m, allowed); err != nil {
+			return nil, err
+		}
+		if m.VaultEngineType == "" {
+			m.VaultEngineType = defaults.VaultEngineType
+		}
+		if defaults.Strict {
+			m.Strict = true
+		}
+		m.Namespaces = []string{cm.Namespace}
+	}
+	return mappings, nil
+}
+
+// namespacePrefixes returns prefixes with NamespacePlaceholder replaced by
+// namespace.
+func namespacePrefixes(prefixes []string, namespace string) []string {
+	allowed := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		allowed = append(allowed, strings.Replace(prefix, NamespacePlaceholder, namespace, -1))
+	}
+	return allowed
+}
+
+// validateDiscovered checks that a discovered mapping is valid and only
+// uses the settings that teams may set.
+func validateDiscovered(m Mapping, prefixes []string) error {
+	if m.VaultPath == "" {
+		return fmt.Errorf("a mapping has no vaultPath")
+	}
+	if errs := validation.IsDNS1123Subdomain(m.SecretName); len(errs) > 0 {
+		return fmt.Errorf("invalid secretName %q: %s", m.SecretName, strings.Join(errs, ", "))
+	}
+	if len(m.TransformExec) > 0 {
+		return fmt.Errorf("%s can't set transformExec", m.SecretName)
+	}
+	if m.FansOut() || len(m.ExcludeNamespaces) > 0 || m.NamespaceSelector != "" {
+		return fmt.Errorf("%s can't be reflected into other namespaces", m.SecretName)
+	}
+	if m.MaxAge < 0 || m.RenewBefore < 0 {
+		return fmt.Errorf("maxAge and renewBefore of %s can't be negative", m.SecretName)
+	}
+
+	paths := []string{m.VaultPath}
+	for _, o := range m.Data {
+		if err := o.Validate(); err != nil {
+			return fmt.Errorf("invalid data of %s: %s", m.SecretName, err)
+		}
+		if o.VaultPath != "" {
+			paths = append(paths, o.VaultPath)
+		}
+	}
+	for _, path := range paths {
+		if !cleanPath(path) {
+			return fmt.Errorf(
+				"vault path %s of %s can't have empty, \".\" or \"..\" segments",
+				path,
+				m.SecretName,
+			)
+		}
+		if !hasAnyPrefix(path, prefixes) {
+			return fmt.Errorf("vault path %s of %s isn't allowed", path, m.SecretName)
+		}
+	}
+	return nil
+}
+
+// hasAnyPrefix returns true if the segments of path start with all of the
+// segments of any of prefixes, or if there are none, so that the prefix
+// "secret/team" allows "secret/team/db" but not "secret/team-admin/db".
+// Paths that vault would clean into other paths never match.
+func hasAnyPrefix(path string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	if !cleanPath(path) {
+		return false
+	}
+	segments := strings.Split(path, "/")
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" {
+			return true
+		}
+		want := strings.Split(prefix, "/")
+		if len(want) > len(segments) {
+			continue
+		}
+		matched := true
+		for i := range want {
+			matched = matched && want[i] == segments[i]
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPath returns true if path has no empty, "." or ".." segments, which
+// vault's router would clean away, escaping any prefix.
+func cleanPath(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
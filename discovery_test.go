@@ -0,0 +1,168 @@
+package pentagon
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// mappingsConfigMap returns a ConfigMap publishing mappings.
+func mappingsConfigMap(namespace, name, mappings string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{DiscoveryLabel: "true"},
+		},
+		Data: map[string]string{DiscoveryKey: mappings},
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset(
+		mappingsConfigMap("team-a", "mappings", `
+- vaultPath: secrets/data/team-a/db
+  secretName: db
+- vaultPath: secrets/data/team-a/api
+  secretName: shared
+`),
+		mappingsConfigMap("team-b", "mappings", `
+- vaultPath: secrets/data/team-b/db
+  secretName: db
+  vaultEngineType: kv
+`),
+		mappingsConfigMap("team-b", "other-team", `
+- vaultPath: secrets/data/team-a/db
+  secretName: stolen
+`),
+		mappingsConfigMap("team-c", "fanout", `
+- vaultPath: secrets/data/team-c/db
+  secretName: db
+  allNamespaces: true
+`),
+		mappingsConfigMap("team-c", "exec", `
+- vaultPath: secrets/data/team-c/db
+  secretName: db
+  transformExec: [sh]
+`),
+	)
+
+	d := NewDiscovery(
+		k8sClient,
+		DefaultNamespace,
+		Mapping{VaultEngineType: vault.EngineTypeKeyValueV2, Strict: true},
+		[]string{"secrets/data/team-a/", "secrets/data/team-b/", "secrets/data/team-c/"},
+	)
+	configured := []Mapping{
+		{VaultPath: "secrets/data/shared", SecretName: "shared", Namespaces: []string{"team-a"}},
+	}
+	all, err := d.Mappings(configured)
+	if err != nil {
+		t.Fatalf("discovery didn't work: %s", err)
+	}
+
+	got := map[string]Mapping{}
+	for _, m := range all[len(configured):] {
+		got[m.Namespaces[0]+"/"+m.SecretName] = m
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 discovered mappings, got %v", got)
+	}
+
+	db, ok := got["team-a/db"]
+	if !ok || db.VaultEngineType != vault.EngineTypeKeyValueV2 || !db.Strict {
+		t.Errorf("team-a/db should have the defaults: %+v", db)
+	}
+	if m := got["team-b/db"]; m.VaultEngineType != vault.EngineTypeKeyValueV1 {
+		t.Errorf("team-b/db should keep its engine type: %+v", m)
+	}
+	if _, ok := got["team-b/stolen"]; !ok {
+		t.Errorf("team-b/stolen is within the prefixes and should be discovered")
+	}
+	if _, ok := got["team-a/shared"]; ok {
+		t.Errorf("team-a/shared is already configured and shouldn't be discovered")
+	}
+
+	// the namespace placeholder keeps teams to their own paths.
+	d.prefixes = []string{"secrets/data/" + NamespacePlaceholder + "/"}
+	all, err = d.Mappings(nil)
+	if err != nil {
+		t.Fatalf("discovery didn't work: %s", err)
+	}
+	for _, m := range all {
+		if m.SecretName == "stolen" {
+			t.Errorf("team-b/stolen reads the paths of team-a and shouldn't be discovered")
+		}
+	}
+	if len(all) != 3 {
+		t.Errorf("expected 3 discovered mappings, got %d", len(all))
+	}
+}
+
+func TestHasAnyPrefix(t *testing.T) {
+	prefixes := []string{"secrets/data/team", "shared/"}
+	for path, expected := range map[string]bool{
+		"secrets/data/team":             true,
+		"secrets/data/team/db":          true,
+		"shared/db":                     true,
+		"secrets/data/team-admin/db":    false,
+		"secrets/data/teams":            false,
+		"secrets/data":                  false,
+		"secrets/data/team/../other/db": false,
+		"secrets/data/team/./db":        false,
+		"secrets/data/team//db":         false,
+		"secrets/data/team/db/":         false,
+		"/secrets/data/team/db":         false,
+		"sharedsecrets/db":              false,
+	} {
+		if actual := hasAnyPrefix(path, prefixes); actual != expected {
+			t.Errorf("%s: expected %t, got %t", path, expected, actual)
+		}
+	}
+	if !hasAnyPrefix("anything/at/all", nil) {
+		t.Error("no prefixes should allow any path")
+	}
+}
+
+func TestValidateDiscoveredPaths(t *testing.T) {
+	prefixes := []string{"secrets/data/team"}
+	for testName, tbl := range map[string]struct {
+		mapping  Mapping
+		prefixes []string
+		allowed  bool
+	}{
+		"own path": {
+			prefixes: prefixes,
+			mapping:  Mapping{VaultPath: "secrets/data/team/db", SecretName: "db"},
+			allowed:  true,
+		},
+		"sibling namespace": {
+			prefixes: prefixes,
+			mapping:  Mapping{VaultPath: "secrets/data/team-admin/db", SecretName: "db"},
+		},
+		"escaping with ..": {
+			prefixes: prefixes,
+			mapping:  Mapping{VaultPath: "secrets/data/team/../other/db", SecretName: "db"},
+		},
+		"escaping data override": {
+			prefixes: prefixes,
+			mapping: Mapping{
+				VaultPath:  "secrets/data/team/db",
+				SecretName: "db",
+				Data:       []DataOverride{{Key: "password", VaultPath: "secrets/data/team/../../other/db"}},
+			},
+		},
+		"dot segments without prefixes": {
+			mapping: Mapping{VaultPath: "secrets/data/./db", SecretName: "db"},
+		},
+	} {
+		err := validateDiscovered(tbl.mapping, tbl.prefixes)
+		if (err == nil) != tbl.allowed {
+			t.Errorf("%s: expected allowed to be %t, got %v", testName, tbl.allowed, err)
+		}
+	}
+}
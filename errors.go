@@ -0,0 +1,119 @@
+package pentagon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// The errors of the reflector wrap one of these classes, so that callers can
+// tell failures apart with errors.Is, e.g.
+//
+//	if errors.Is(err, pentagon.ErrPathNotFound) {
+//
+// The messages of the errors are unchanged by their class.
+var (
+	// ErrAuthFailed is the class of requests vault or kubernetes refused,
+	// e.g. because the token expired or its policy doesn't allow it.
+	ErrAuthFailed = errors.New("permission denied")
+
+	// ErrPathNotFound is the class of mappings whose vault secret doesn't
+	// exist or was deleted, and isn't optional.
+	ErrPathNotFound = errors.New("vault secret not found")
+
+	// ErrSecretConflict is the class of k8s secrets that exist but aren't
+	// managed by the reflector, e.g. those of another pentagon instance.
+	ErrSecretConflict = errors.New("secret is managed by someone else")
+
+	// ErrInvalidSecret is the class of vault secrets whose data fails the
+	// checks of their mapping: required keys, validation rules or type.
+	ErrInvalidSecret = errors.New("invalid vault secret")
+
+	// ErrWriteBlocked is the class of writes refused by the policies, a
+	// write hook or the deletion guard.
+	ErrWriteBlocked = errors.New("write blocked")
+
+	// ErrTransactionFailed is the class of mappings not written or rolled
+	// back because another mapping of their transaction failed.
+	ErrTransactionFailed = errors.New("transaction failed")
+)
+
+// classError is an error of one of the classes above.
+type classError struct {
+	class error
+	err   error
+}
+
+// classify returns err as an error of class.
+func classify(class error, err error) error {
+	return &classError{class: class, err: err}
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+func (e *classError) Is(target error) bool {
+	return target == e.class
+}
+
+// readError returns the error of reading path from vault, which is an
+// ErrAuthFailed if vault refused the read.
+func readError(path string, err error) error {
+	wrapped := fmt.Errorf("error reading vault key '%s': %w", path, err)
+	if vault.IsPermissionDenied(err) {
+		return classify(ErrAuthFailed, wrapped)
+	}
+	return wrapped
+}
+
+// PassError is the error of a pass in which mappings failed with
+// ErrorPolicyContinue.  It matches any class or type one of its failures
+// matches with errors.Is and errors.As.
+type PassError struct {
+	// Failures are the errors of the mappings that failed and of the
+	// secrets rolled back with their transactions.
+	Failures []error
+
+	// Mappings is the number of mappings in the pass.
+	Mappings int
+}
+
+func (e *PassError) Error() string {
+	failures := make([]string, 0, len(e.Failures))
+	for _, err := range e.Failures {
+		failures = append(failures, err.Error())
+	}
+	return fmt.Sprintf(
+		"%d of %d mappings failed: %s",
+		len(e.Failures),
+		e.Mappings,
+		strings.Join(failures, "; "),
+	)
+}
+
+// Is returns true if one of the failures is target.
+func (e *PassError) Is(target error) bool {
+	for _, err := range e.Failures {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets target to the first failure that can be, see errors.As.
+func (e *PassError) As(target interface{}) bool {
+	for _, err := range e.Failures {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package pentagon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestErrorClasses(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{"a": "1"})
+	secrets := NewFakeSecrets(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "taken"},
+		Data:       map[string][]byte{"a": []byte("1")},
+	})
+
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(secrets),
+		WithErrorPolicy(ErrorPolicyContinue),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+
+	mapping := func(path, name string) Mapping {
+		return Mapping{
+			VaultPath:       path,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		}
+	}
+	invalid := mapping("secrets/foo", "invalid")
+	invalid.RequiredKeys = []string{"b"}
+
+	err = r.Reflect(context.Background(), []Mapping{
+		mapping("secrets/missing", "missing"),
+		mapping("secrets/foo", "taken"),
+		invalid,
+		mapping("secrets/foo", "ok"),
+	})
+
+	var passErr *PassError
+	if !errors.As(err, &passErr) {
+		t.Fatalf("expected a PassError, got %v", err)
+	}
+	if len(passErr.Failures) != 3 || passErr.Mappings != 4 {
+		t.Errorf("expected 3 of 4 mappings to fail: %s", err)
+	}
+	for _, class := range []error{ErrPathNotFound, ErrSecretConflict, ErrInvalidSecret} {
+		if !errors.Is(err, class) {
+			t.Errorf("expected the error to be a %q: %s", class, err)
+		}
+	}
+	if errors.Is(err, ErrAuthFailed) {
+		t.Errorf("no request was refused: %s", err)
+	}
+	if !errors.Is(passErr.Failures[0], ErrPathNotFound) ||
+		passErr.Failures[0].Error() != "secret secrets/missing not found" {
+		t.Errorf("unexpected error of the missing secret: %s", passErr.Failures[0])
+	}
+}
+
+func TestReadErrorPermissionDenied(t *testing.T) {
+	err := readError("secrets/foo", errors.New("Code: 403. Errors: permission denied"))
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("a refused read should be an ErrAuthFailed: %s", err)
+	}
+	if err.Error() != "error reading vault key 'secrets/foo': Code: 403. Errors: permission denied" {
+		t.Errorf("unexpected message: %s", err)
+	}
+
+	err = readError("secrets/foo", errors.New("Code: 500"))
+	if errors.Is(err, ErrAuthFailed) {
+		t.Errorf("only refused reads should be an ErrAuthFailed: %s", err)
+	}
+}
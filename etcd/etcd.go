@@ -0,0 +1,324 @@
+// Package etcd reads keys from etcd through its v3 JSON gateway, so that
+// pentagon mappings can reflect configuration stored in etcd like vault
+// secrets.
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// maxResponseSize bounds the size of a response of etcd, other than
+// watches.
+const maxResponseSize = 64 << 20
+
+// Client reads keys from etcd.  It implements vault.Logical, reading a path
+// as a secret with a key for every etcd key under "<path>/", named after
+// the rest of the etcd key with slashes replaced by dots, e.g. reading
+// "config/app" maps "config/app/db/password" to "db.password".  Paths
+// without keys are read as nil, like missing vault secrets.
+type Client struct {
+	endpoints  []string
+	username   string
+	password   string
+	timeout    time.Duration
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+var (
+	_ vault.Logical       = (*Client)(nil)
+	_ vault.ContextReader = (*Client)(nil)
+)
+
+// NewClient returns a Client of the etcd cluster serving endpoints, which
+// are tried in order, e.g. "https://etcd-0:2379".  With a username, it
+// authenticates as that user.  A non-zero timeout limits how long a read,
+// or starting a watch, may take, while a watch itself runs as long as its
+// context.  httpClient must have no Timeout of its own, which would end
+// watches, and a nil httpClient uses http.DefaultClient.
+func NewClient(
+	endpoints []string,
+	username string,
+	password string,
+	timeout time.Duration,
+	httpClient *http.Client,
+) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	trimmed := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		trimmed = append(trimmed, strings.TrimSuffix(e, "/"))
+	}
+	return &Client{
+		endpoints:  trimmed,
+		username:   username,
+		password:   password,
+		timeout:    timeout,
+		httpClient: httpClient,
+	}
+}
+
+// keyValue is a key of a range or watch response, with its key and value
+// base64 encoded.
+type keyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// prefixRange returns the base64 encoded key and range end of the keys
+// under path.
+func prefixRange(path string) (string, string) {
+	prefix := []byte(strings.Trim(path, "/") + "/")
+	end := append([]byte{}, prefix...)
+	end[len(end)-1]++
+	return base64.StdEncoding.EncodeToString(prefix), base64.StdEncoding.EncodeToString(end)
+}
+
+// Read reads path, see Client.
+func (c *Client) Read(path string) (*api.Secret, error) {
+	return c.ReadWithContext(context.Background(), path)
+}
+
+// ReadWithContext reads path, giving up when ctx is done.
+func (c *Client) ReadWithContext(ctx context.Context, path string) (*api.Secret, error) {
+	key, end := prefixRange(path)
+	var response struct {
+		KVs []keyValue `json:"kvs"`
+	}
+	err := c.post(ctx, "/v3/kv/range", map[string]string{"key": key, "range_end": end}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.KVs) == 0 {
+		return nil, nil
+	}
+
+	prefix := strings.Trim(path, "/") + "/"
+	data := make(map[string]interface{}, len(response.KVs))
+	for _, kv := range response.KVs {
+		k, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding key of %s: %s", path, err)
+		}
+		v, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding value of %s: %s", k, err)
+		}
+		name := strings.Replace(strings.TrimPrefix(string(k), prefix), "/", ".", -1)
+		data[name] = string(v)
+	}
+	return &api.Secret{Data: data}, nil
+}
+
+// Write fails, etcd keys are only read.
+func (c *Client) Write(path string, data map[string]interface{}) (*api.Secret, error) {
+	return nil, fmt.Errorf("can't write %s, etcd keys are read-only", path)
+}
+
+// Watch calls changed whenever a key under path is written or deleted,
+// until ctx is done or the watch fails, and returns the error it failed
+// with.
+func (c *Client) Watch(ctx context.Context, path string, changed func()) error {
+	key, end := prefixRange(path)
+	request := map[string]interface{}{
+		"create_request": map[string]string{"key": key, "range_end": end},
+	}
+
+	// only getting the response is limited by the timeout, the events
+	// then stream in until ctx is done.
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timer *time.Timer
+	if c.timeout > 0 {
+		timer = time.AfterFunc(c.timeout, cancel)
+	}
+	resp, err := c.do(watchCtx, "/v3/watch", request)
+	if timer != nil && !timer.Stop() && ctx.Err() == nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return fmt.Errorf("watch of %s timed out after %s", path, c.timeout)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the gateway streams a JSON object per response.
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var message struct {
+			Result struct {
+				Created  bool          `json:"created"`
+				Canceled bool          `json:"canceled"`
+				Reason   string        `json:"cancel_reason"`
+				Events   []interface{} `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("error reading watch of %s: %s", path, err)
+		}
+		if message.Error != nil {
+			return fmt.Errorf("watch of %s failed: %s", path, message.Error.Message)
+		}
+		if message.Result.Canceled {
+			return fmt.Errorf("watch of %s was canceled: %s", path, message.Result.Reason)
+		}
+		if len(message.Result.Events) > 0 {
+			changed()
+		}
+	}
+}
+
+// post decodes the response to a request of path with the JSON body
+// request into v, within the client's timeout.
+func (c *Client) post(ctx context.Context, path string, request, v interface{}) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	resp, err := c.do(ctx, path, request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("error reading response of %s: %s", path, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error decoding response of %s: %s", path, err)
+	}
+	return nil
+}
+
+// do posts request to path on the first endpoint that answers, logging in
+// first if needed and again if the token expired, and returns the response
+// if it succeeded.  Errors of requests etcd refused include "Code: 403"
+// like vault's, so that vault.IsPermissionDenied recognizes them.
+func (c *Client) do(ctx context.Context, path string, request interface{}) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.send(ctx, path, body, token)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && c.username != "" && attempt == 0 {
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+			continue
+		}
+		return nil, fmt.Errorf(
+			"error requesting %s from etcd: Code: %d. Errors: %s",
+			path,
+			resp.StatusCode,
+			strings.TrimSpace(string(message)),
+		)
+	}
+}
+
+// send posts body to path on each endpoint in turn until one answers.
+func (c *Client) send(ctx context.Context, path string, body []byte, token string) (*http.Response, error) {
+	var lastErr error
+	for _, endpoint := range c.endpoints {
+		req, err := http.NewRequest("POST", endpoint+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no etcd endpoint answered: %s", lastErr)
+}
+
+// authenticate returns the token to authenticate with, logging in if there
+// is none yet, or "" without a username.
+func (c *Client) authenticate(ctx context.Context) (string, error) {
+	if c.username == "" {
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"name": c.username, "password": c.password})
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.send(ctx, "/v3/auth/authenticate", body, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"error authenticating to etcd as %s: Code: %d",
+			c.username,
+			resp.StatusCode,
+		)
+	}
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&response); err != nil {
+		return "", fmt.Errorf("error decoding etcd token: %s", err)
+	}
+	c.token = response.Token
+	return c.token, nil
+}
@@ -0,0 +1,194 @@
+package etcd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// slowResponse is how long the gateway takes to answer slow requests.
+const slowResponse = 200 * time.Millisecond
+
+// gateway returns an etcd JSON gateway with auth enabled serving keys, and
+// counts the logins in logins.  Tokens expire after every read of
+// "config/expiring", and reads of "slow" and the events of its watches take
+// slowResponse.
+func gateway(t *testing.T, keys map[string]string, logins *int) *httptest.Server {
+	token := ""
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("unable to decode request: %s", err)
+		}
+
+		if r.URL.Path == "/v3/auth/authenticate" {
+			if request["name"] != "pentagon" || request["password"] != "hunter2" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			*logins++
+			token = "token-" + strings.Repeat("x", *logins)
+			json.NewEncoder(w).Encode(map[string]string{"token": token})
+			return
+		}
+		if token == "" || r.Header.Get("Authorization") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"etcdserver: invalid auth token","code":16}`))
+			return
+		}
+
+		decode := func(k string) string {
+			b, _ := base64.StdEncoding.DecodeString(request[k].(string))
+			return string(b)
+		}
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			key, end := decode("key"), decode("range_end")
+			if key == "slow/" {
+				time.Sleep(slowResponse)
+			}
+			if key == "forbidden/" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error":"etcdserver: permission denied","code":7}`))
+				return
+			}
+			kvs := []map[string]string{}
+			for k, v := range keys {
+				if k >= key && k < end {
+					kvs = append(kvs, map[string]string{
+						"key":   base64.StdEncoding.EncodeToString([]byte(k)),
+						"value": base64.StdEncoding.EncodeToString([]byte(v)),
+					})
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs})
+			if key == "config/expiring/" {
+				token = ""
+			}
+		case "/v3/watch":
+			create, _ := request["create_request"].(map[string]interface{})
+			slow := create != nil && create["key"] == base64.StdEncoding.EncodeToString([]byte("slow/"))
+			flusher := w.(http.Flusher)
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{"created": true}})
+			flusher.Flush()
+			for i := 0; i < 2; i++ {
+				if slow {
+					time.Sleep(slowResponse)
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"result": map[string]interface{}{"events": []map[string]string{{"type": "PUT"}}},
+				})
+				flusher.Flush()
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": map[string]interface{}{"canceled": true, "cancel_reason": "compacted"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRead(t *testing.T) {
+	logins := 0
+	server := gateway(t, map[string]string{
+		"config/app/db/password": "hunter2",
+		"config/app/url":         "https://example.com",
+		"config/application/url": "https://other.example.com",
+		"config/expiring/key":    "value",
+	}, &logins)
+	defer server.Close()
+
+	// the first endpoint doesn't answer.
+	client := NewClient([]string{"http://127.0.0.1:1", server.URL + "/"}, "pentagon", "hunter2", 0, nil)
+
+	for _, tbl := range []struct {
+		path     string
+		expected map[string]interface{}
+	}{
+		{"config/app", map[string]interface{}{"db.password": "hunter2", "url": "https://example.com"}},
+		{"/config/app/", map[string]interface{}{"db.password": "hunter2", "url": "https://example.com"}},
+		{"config/app/db", map[string]interface{}{"password": "hunter2"}},
+		{"config/missing", nil},
+		{"config/expiring", map[string]interface{}{"key": "value"}},
+		{"config/expiring", map[string]interface{}{"key": "value"}},
+	} {
+		secret, err := client.Read(tbl.path)
+		if err != nil {
+			t.Errorf("unable to read %s: %s", tbl.path, err)
+			continue
+		}
+		if tbl.expected == nil {
+			if secret != nil {
+				t.Errorf("%s shouldn't exist: %v", tbl.path, secret.Data)
+			}
+			continue
+		}
+		if secret == nil || !reflect.DeepEqual(secret.Data, tbl.expected) {
+			t.Errorf("unexpected data of %s: %v", tbl.path, secret)
+		}
+	}
+	if logins != 2 {
+		t.Errorf("expected a login and another after the token expired, got %d", logins)
+	}
+
+	if _, err := client.Read("forbidden"); !vault.IsPermissionDenied(err) {
+		t.Errorf("expected a permission denied error, got %v", err)
+	}
+	if _, err := client.Write("config/app", nil); err == nil {
+		t.Error("writes should fail")
+	}
+
+	client = NewClient([]string{server.URL}, "pentagon", "wrong", 0, nil)
+	if _, err := client.Read("config/app"); err == nil {
+		t.Error("reads with the wrong password should fail")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	logins := 0
+	server := gateway(t, nil, &logins)
+	defer server.Close()
+
+	client := NewClient([]string{server.URL}, "pentagon", "hunter2", 0, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changes := 0
+	err := client.Watch(ctx, "config/app", func() { changes++ })
+	if err == nil || !strings.Contains(err.Error(), "compacted") {
+		t.Errorf("expected the watch to be canceled, got %v", err)
+	}
+	if changes != 2 {
+		t.Errorf("expected 2 changes, got %d", changes)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	logins := 0
+	server := gateway(t, map[string]string{"slow/key": "value"}, &logins)
+	defer server.Close()
+
+	client := NewClient([]string{server.URL}, "pentagon", "hunter2", slowResponse/4, nil)
+	if _, err := client.Read("slow"); err == nil {
+		t.Error("reading slowly should have timed out")
+	}
+
+	// the watch outlives the timeout.
+	changes := 0
+	err := client.Watch(context.Background(), "slow", func() { changes++ })
+	if err == nil || !strings.Contains(err.Error(), "compacted") {
+		t.Errorf("expected the watch to be canceled, got %v", err)
+	}
+	if changes != 2 {
+		t.Errorf("expected 2 changes, got %d", changes)
+	}
+}
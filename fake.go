@@ -0,0 +1,116 @@
+package pentagon
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// FakeSecrets is a SecretClient keeping secrets in memory, for testing
+// code using a Reflector without an API server.  Like the API server, it
+// returns copies of its secrets and NotFound and AlreadyExists errors.
+type FakeSecrets struct {
+	mu              sync.Mutex
+	secrets         map[string]*v1.Secret
+	resourceVersion int
+}
+
+var _ SecretClient = (*FakeSecrets)(nil)
+
+// NewFakeSecrets returns a FakeSecrets holding copies of secrets.
+func NewFakeSecrets(secrets ...*v1.Secret) *FakeSecrets {
+	f := &FakeSecrets{
+		secrets: make(map[string]*v1.Secret, len(secrets)),
+	}
+	for _, secret := range secrets {
+		f.store(secret)
+	}
+	return f
+}
+
+// store saves a copy of secret with a new resource version.  f.mu must be
+// held unless f isn't shared yet.
+func (f *FakeSecrets) store(secret *v1.Secret) *v1.Secret {
+	f.resourceVersion++
+	stored := secret.DeepCopy()
+	stored.ResourceVersion = strconv.Itoa(f.resourceVersion)
+	f.secrets[secret.Name] = stored
+	return stored.DeepCopy()
+}
+
+// Get returns the secret named name.
+func (f *FakeSecrets) Get(name string, options metav1.GetOptions) (*v1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	secret, ok := f.secrets[name]
+	if !ok {
+		return nil, errors.NewNotFound(v1.Resource("secrets"), name)
+	}
+	return secret.DeepCopy(), nil
+}
+
+// List returns the secrets matching the label selector of options, sorted
+// by name.
+func (f *FakeSecrets) List(options metav1.ListOptions) (*v1.SecretList, error) {
+	selector, err := labels.Parse(options.LabelSelector)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.secrets))
+	for name, secret := range f.secrets {
+		if selector.Matches(labels.Set(secret.Labels)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	list := &v1.SecretList{Items: make([]v1.Secret, 0, len(names))}
+	for _, name := range names {
+		list.Items = append(list.Items, *f.secrets[name].DeepCopy())
+	}
+	return list, nil
+}
+
+// Create adds secret unless a secret with the same name exists.
+func (f *FakeSecrets) Create(secret *v1.Secret) (*v1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.secrets[secret.Name]; ok {
+		return nil, errors.NewAlreadyExists(v1.Resource("secrets"), secret.Name)
+	}
+	return f.store(secret), nil
+}
+
+// Update replaces the secret with the same name as secret.
+func (f *FakeSecrets) Update(secret *v1.Secret) (*v1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.secrets[secret.Name]; !ok {
+		return nil, errors.NewNotFound(v1.Resource("secrets"), secret.Name)
+	}
+	return f.store(secret), nil
+}
+
+// Delete removes the secret named name.
+func (f *FakeSecrets) Delete(name string, options *metav1.DeleteOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.secrets[name]; !ok {
+		return errors.NewNotFound(v1.Resource("secrets"), name)
+	}
+	delete(f.secrets, name)
+	return nil
+}
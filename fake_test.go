@@ -0,0 +1,69 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestFakeSecrets(t *testing.T) {
+	secrets := NewFakeSecrets(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "stale",
+			Labels: map[string]string{LabelKey: "test"},
+		},
+	})
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(secrets),
+		WithLabel("test"),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+
+	err = r.Reflect(context.Background(), []Mapping{{
+		VaultPath:       "secrets/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+	}})
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	s, err := secrets.Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if string(s.Data["foo"]) != "bar" {
+		t.Fatalf("unexpected data: %s", s.Data["foo"])
+	}
+
+	_, err = secrets.Get("stale", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatalf("stale should have been reconciled: %v", err)
+	}
+
+	list, err := secrets.List(metav1.ListOptions{LabelSelector: LabelKey + "=other"})
+	if err != nil || len(list.Items) != 0 {
+		t.Fatalf("no secret should have the other label: %v %v", list, err)
+	}
+
+	_, err = New(context.Background(), WithVault(vaultClient), WithSecretClient(secrets), WithCache())
+	if err == nil {
+		t.Fatal("caching should require a kubernetes client")
+	}
+}
@@ -0,0 +1,384 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DeletionPolicy is what happens to the secret of a mapping in a namespace
+// it no longer targets.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the secret.  It is the default.
+	DeletionPolicyDelete DeletionPolicy = "delete"
+
+	// DeletionPolicyRetain keeps the secret and its data, but removes its
+	// pentagon label so that it is no longer managed.
+	DeletionPolicyRetain DeletionPolicy = "retain"
+)
+
+// SystemNamespaces are left out of mappings with AllNamespaces unless they
+// are listed in their Namespaces.
+var SystemNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// FansOut returns true if the mapping is reflected into other namespaces
+// than the default one.
+func (m Mapping) FansOut() bool {
+	return m.AllNamespaces || len(m.Namespaces) > 0
+}
+
+// targetNamespaces returns the sorted namespaces the mapping is reflected
+// into, given the default namespace and all of the cluster's namespaces.
+func (m Mapping) targetNamespaces(defaultNamespace string, all []string) []string {
+	if !m.FansOut() {
+		return []string{defaultNamespace}
+	}
+
+	targets := map[string]struct{}{}
+	for _, namespace := range m.Namespaces {
+		targets[namespace] = struct{}{}
+	}
+	if m.AllNamespaces {
+		for _, namespace := range all {
+			if !contains(SystemNamespaces, namespace) {
+				targets[namespace] = struct{}{}
+			}
+		}
+	}
+	for _, namespace := range m.ExcludeNamespaces {
+		delete(targets, namespace)
+	}
+
+	namespaces := make([]string, 0, len(targets))
+	for namespace := range targets {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// TargetsNamespace returns true if the mapping is reflected into namespace,
+// given the default namespace.  Mappings restricted by a NamespaceSelector
+// never match since the labels of namespace aren't known.
+func (m Mapping) TargetsNamespace(defaultNamespace, namespace string) bool {
+	if m.NamespaceSelector != "" {
+		return false
+	}
+	return contains(m.targetNamespaces(defaultNamespace, []string{namespace}), namespace)
+}
+
+// FanOut reflects mappings into the namespaces they list, or into every
+// namespace with AllNamespaces, with a reflector per namespace.  Mappings
+// that don't list namespaces are reflected into the default namespace.
+type FanOut struct {
+	client       kubernetes.Interface
+	namespace    string
+	newReflector func(namespace string, opts ...Option) *Reflector
+
+	mu         sync.Mutex
+	reflectors map[string]*Reflector
+}
+
+// NewFanOut returns a FanOut listing namespaces with client, reflecting
+// mappings that don't list namespaces into namespace.  newReflector creates
+// the reflector for each namespace.
+func NewFanOut(
+	client kubernetes.Interface,
+	namespace string,
+	newReflector func(namespace string, opts ...Option) *Reflector,
+) *FanOut {
+	return &FanOut{
+		client:       client,
+		namespace:    namespace,
+		newReflector: newReflector,
+		reflectors:   map[string]*Reflector{},
+	}
+}
+
+// Reflector returns the reflector for namespace, creating it if needed.
+func (f *FanOut) Reflector(namespace string) *Reflector {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.reflectors[namespace]
+	if !ok {
+		r = f.newReflector(namespace)
+		f.reflectors[namespace] = r
+	}
+	return r
+}
+
+// Reflect reflects mappings into their namespaces.  A failure in one
+// namespace doesn't stop the others from being reflected.  The secrets of
+// mappings in namespaces they no longer target are deleted or retained
+// following their DeletionPolicy, and namespaces that no mapping targets
+// anymore are still reflected so that their secrets get reconciled.  Once
+// they were, their reflectors are stopped and removed.
+func (f *FanOut) Reflect(ctx context.Context, mappings []Mapping) error {
+	byNamespace, err := f.group(mappings)
+	if err != nil {
+		return err
+	}
+
+	if err := f.cleanUp(ctx, mappings, byNamespace); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	for namespace := range f.reflectors {
+		if _, ok := byNamespace[namespace]; !ok {
+			byNamespace[namespace] = []Mapping{}
+		}
+	}
+	f.mu.Unlock()
+
+	unmapped := []string{}
+	err = f.each(ctx, byNamespace, func(r *Reflector, ctx context.Context, mappings []Mapping) error {
+		err := r.Reflect(ctx, mappings)
+		if err == nil && len(mappings) == 0 {
+			unmapped = append(unmapped, r.k8sNamespace)
+		}
+		return err
+	})
+	f.remove(unmapped)
+	return err
+}
+
+// remove stops and removes the reflectors of namespaces, except for the
+// default namespace.
+func (f *FanOut) remove(namespaces []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, namespace := range namespaces {
+		r, ok := f.reflectors[namespace]
+		if !ok || namespace == f.namespace {
+			continue
+		}
+		r.stop()
+		delete(f.reflectors, namespace)
+	}
+}
+
+// Sync reflects only mappings into their namespaces, like Reflector.Sync.
+func (f *FanOut) Sync(ctx context.Context, mappings []Mapping) error {
+	byNamespace, err := f.group(mappings)
+	if err != nil {
+		return err
+	}
+	return f.each(ctx, byNamespace, (*Reflector).Sync)
+}
+
+// each calls reflect with the reflector and mappings of every namespace.
+func (f *FanOut) each(
+	ctx context.Context,
+	byNamespace map[string][]Mapping,
+	reflect func(*Reflector, context.Context, []Mapping) error,
+) error {
+	namespaces := make([]string, 0, len(byNamespace))
+	for namespace := range byNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	failures := []string{}
+	for _, namespace := range namespaces {
+		err := reflect(f.Reflector(namespace), ctx, byNamespace[namespace])
+		if err != nil {
+			log.Printf("error reflecting namespace %s: %s", namespace, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", namespace, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"%d of %d namespaces failed: %s",
+			len(failures),
+			len(namespaces),
+			strings.Join(failures, "; "),
+		)
+	}
+	return nil
+}
+
+// group returns mappings keyed by the namespaces they are reflected into.
+// The cluster's namespaces are only listed if a mapping needs them, once
+// per namespace selector.
+func (f *FanOut) group(mappings []Mapping) (map[string][]Mapping, error) {
+	listed := map[string][]string{}
+	byNamespace := map[string][]Mapping{}
+	for _, m := range mappings {
+		var all []string
+		if m.AllNamespaces {
+			var ok bool
+			all, ok = listed[m.NamespaceSelector]
+			if !ok {
+				var err error
+				all, err = f.listNamespaces(m.NamespaceSelector)
+				if err != nil {
+					return nil, err
+				}
+				listed[m.NamespaceSelector] = all
+			}
+		}
+		for _, namespace := range m.targetNamespaces(f.namespace, all) {
+			byNamespace[namespace] = append(byNamespace[namespace], m)
+		}
+	}
+	return byNamespace, nil
+}
+
+// listNamespaces returns the names of the namespaces matching selector, or
+// of every namespace if it is empty.
+func (f *FanOut) listNamespaces(selector string) ([]string, error) {
+	list, err := f.client.CoreV1().Namespaces().List(metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing namespaces: %s", err)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, namespace := range list.Items {
+		names = append(names, namespace.Name)
+	}
+	return names, nil
+}
+
+// cleanUp finds the secrets of the mappings that fan out in namespaces
+// that none of mappings targets anymore, e.g. because a namespace stopped
+// matching a namespaceSelector, and deletes or retains them following the
+// DeletionPolicy of their mapping.  Only secrets written by the reflector
+// from the mapping's vault path are touched, whether or not the namespace
+// was reflected since pentagon started.
+func (f *FanOut) cleanUp(
+	ctx context.Context,
+	mappings []Mapping,
+	byNamespace map[string][]Mapping,
+) error {
+	fannedOut := map[string]Mapping{}
+	for _, m := range mappings {
+		if _, ok := fannedOut[m.SecretName]; m.FansOut() && !ok {
+			fannedOut[m.SecretName] = m
+		}
+	}
+	if len(fannedOut) == 0 {
+		return nil
+	}
+
+	label := f.Reflector(f.namespace).labelValue
+	list, err := f.client.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelKey, label),
+	})
+	if err != nil {
+		return fmt.Errorf("error listing secrets: %s", err)
+	}
+
+	failures := []string{}
+	for i := range list.Items {
+		secret := &list.Items[i]
+		m, ok := fannedOut[secret.Name]
+		if !ok || secret.Annotations[PathAnnotation] != m.VaultPath ||
+			targets(byNamespace[secret.Namespace], secret.Name) {
+			continue
+		}
+		err := f.Reflector(secret.Namespace).release(ctx, secret, m.DeletionPolicy)
+		if err != nil {
+			log.Printf("error cleaning up %s/%s: %s", secret.Namespace, secret.Name, err)
+			failures = append(failures, fmt.Sprintf("%s/%s: %s", secret.Namespace, secret.Name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"error cleaning up secrets in namespaces no longer targeted: %s",
+			strings.Join(failures, "; "),
+		)
+	}
+	return nil
+}
+
+// targets returns true if one of mappings maps the secret named name.
+func targets(mappings []Mapping, name string) bool {
+	for _, m := range mappings {
+		if m.SecretName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// release deletes secret, or removes its pentagon label with
+// DeletionPolicyRetain, if it was written by the reflector and isn't
+// ignored.
+func (r *Reflector) release(ctx context.Context, secret *v1.Secret, policy DeletionPolicy) error {
+	if secret.Annotations[OwnerAnnotation] != r.instance {
+		return nil
+	}
+	if ignored(secret) {
+		log.Printf(
+			"not cleaning up %s in namespace %s: it has the %s annotation",
+			secret.Name,
+			secret.Namespace,
+			IgnoreAnnotation,
+		)
+		return nil
+	}
+	if err := r.checkOwner(secret); err != nil {
+		return err
+	}
+
+	release, err := r.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+
+	if policy == DeletionPolicyRetain {
+		retained := secret.DeepCopy()
+		delete(retained.Labels, LabelKey)
+		_, err := r.secrets().Update(retained)
+		release()
+		if err != nil {
+			return fmt.Errorf("error updating secret: %s", err)
+		}
+		log.Printf(
+			"retained secret %s in namespace %s, which its mapping no longer targets",
+			secret.Name,
+			secret.Namespace,
+		)
+		return nil
+	}
+
+	err = r.secrets().Delete(secret.Name, &metav1.DeleteOptions{})
+	release()
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting secret: %s", err)
+	}
+	r.auditDelete(secret)
+	if r.backups {
+		if err := r.deleteBackup(ctx, secret.Name); err != nil {
+			return err
+		}
+	}
+	log.Printf(
+		"deleted secret %s in namespace %s, which its mapping no longer targets",
+		secret.Name,
+		secret.Namespace,
+	)
+	return nil
+}
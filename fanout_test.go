@@ -0,0 +1,249 @@
+package pentagon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestTargetNamespaces(t *testing.T) {
+	all := []string{"default", "kube-system", "team-a", "team-b", "team-c"}
+	for testName, tbl := range map[string]struct {
+		mapping  Mapping
+		expected []string
+	}{
+		"default": {
+			mapping:  Mapping{},
+			expected: []string{"pentagon"},
+		},
+		"listed": {
+			mapping:  Mapping{Namespaces: []string{"team-b", "team-a"}},
+			expected: []string{"team-a", "team-b"},
+		},
+		"all": {
+			mapping:  Mapping{AllNamespaces: true},
+			expected: []string{"default", "team-a", "team-b", "team-c"},
+		},
+		"excluded": {
+			mapping: Mapping{
+				AllNamespaces:     true,
+				ExcludeNamespaces: []string{"default", "team-b"},
+			},
+			expected: []string{"team-a", "team-c"},
+		},
+		"system namespace listed": {
+			mapping: Mapping{
+				AllNamespaces: true,
+				Namespaces:    []string{"kube-system"},
+			},
+			expected: []string{"default", "kube-system", "team-a", "team-b", "team-c"},
+		},
+	} {
+		tbl := tbl
+		t.Run(testName, func(t *testing.T) {
+			actual := tbl.mapping.targetNamespaces("pentagon", all)
+			if !reflect.DeepEqual(actual, tbl.expected) {
+				t.Errorf("expected %v, got %v", tbl.expected, actual)
+			}
+			for _, namespace := range all {
+				targeted := contains(tbl.expected, namespace)
+				if tbl.mapping.TargetsNamespace("pentagon", namespace) != targeted {
+					t.Errorf("expected %s to be targeted: %t", namespace, targeted)
+				}
+			}
+		})
+	}
+
+	selected := Mapping{AllNamespaces: true, NamespaceSelector: "team=a"}
+	if selected.TargetsNamespace("pentagon", "team-a") {
+		t.Error("a mapping with a namespace selector shouldn't target a namespace without labels")
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	objects := []runtime.Object{}
+	for _, name := range []string{"default", "kube-system", "team-a", "team-b"} {
+		objects = append(objects, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	k8sClient := k8sfake.NewSimpleClientset(objects...)
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/registry", map[string]interface{}{"foo": "bar"})
+	vaultClient.Write("secrets/data/local", map[string]interface{}{"foo": "bar"})
+
+	fanOut := NewFanOut(k8sClient, "pentagon", func(namespace string, opts ...Option) *Reflector {
+		return NewReflector(vaultClient, k8sClient, namespace, "test", opts...)
+	})
+	mappings := []Mapping{
+		{
+			VaultPath:         "secrets/data/registry",
+			SecretName:        "registry",
+			VaultEngineType:   vault.EngineTypeKeyValueV2,
+			AllNamespaces:     true,
+			ExcludeNamespaces: []string{"team-b"},
+		},
+		{
+			VaultPath:       "secrets/data/local",
+			SecretName:      "local",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+	}
+	if err := fanOut.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	for _, tbl := range []struct {
+		namespace string
+		name      string
+		exists    bool
+	}{
+		{"default", "registry", true},
+		{"team-a", "registry", true},
+		{"team-b", "registry", false},
+		{"kube-system", "registry", false},
+		{"pentagon", "registry", false},
+		{"pentagon", "local", true},
+	} {
+		_, err := k8sClient.CoreV1().Secrets(tbl.namespace).Get(tbl.name, metav1.GetOptions{})
+		if (err == nil) != tbl.exists {
+			t.Errorf("expected %s/%s to exist: %t, got %v", tbl.namespace, tbl.name, tbl.exists, err)
+		}
+	}
+
+	// namespaces that are no longer targeted are reconciled, after which
+	// their reflectors are stopped and removed.
+	teamA := fanOut.Reflector("team-a")
+	mappings[0].ExcludeNamespaces = append(mappings[0].ExcludeNamespaces, "team-a")
+	if err := fanOut.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+	_, err := k8sClient.CoreV1().Secrets("team-a").Get("registry", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("team-a/registry should have been reconciled")
+	}
+	select {
+	case <-teamA.stopped:
+	default:
+		t.Error("the team-a reflector should have been stopped")
+	}
+
+	// the reflector of the default namespace is kept.
+	mappings[0].AllNamespaces = false
+	if err := fanOut.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work the third time: %s", err)
+	}
+	for _, namespace := range []string{"default", "team-a"} {
+		if _, ok := fanOut.reflectors[namespace]; ok {
+			t.Errorf("the %s reflector should have been removed", namespace)
+		}
+	}
+	if _, ok := fanOut.reflectors["pentagon"]; !ok {
+		t.Error("the pentagon reflector should have been kept")
+	}
+}
+
+func TestFanOutCleanup(t *testing.T) {
+	objects := []runtime.Object{}
+	for _, team := range []string{"a", "b"} {
+		objects = append(objects, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "team-" + team,
+			Labels: map[string]string{"team": team},
+		}})
+	}
+	objects = append(objects, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}})
+	k8sClient := k8sfake.NewSimpleClientset(objects...)
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/registry", map[string]interface{}{"foo": "bar"})
+
+	newFanOut := func() *FanOut {
+		return NewFanOut(k8sClient, "pentagon", func(namespace string, opts ...Option) *Reflector {
+			return NewReflector(vaultClient, k8sClient, namespace, DefaultLabelValue, opts...)
+		})
+	}
+	mappings := []Mapping{
+		{
+			VaultPath:         "secrets/data/registry",
+			SecretName:        "registry",
+			VaultEngineType:   vault.EngineTypeKeyValueV2,
+			AllNamespaces:     true,
+			NamespaceSelector: "team",
+		},
+		{
+			VaultPath:         "secrets/data/registry",
+			SecretName:        "retained",
+			VaultEngineType:   vault.EngineTypeKeyValueV2,
+			AllNamespaces:     true,
+			NamespaceSelector: "team",
+			DeletionPolicy:    DeletionPolicyRetain,
+		},
+		{
+			VaultPath:         "secrets/data/registry",
+			SecretName:        "ignored",
+			VaultEngineType:   vault.EngineTypeKeyValueV2,
+			AllNamespaces:     true,
+			NamespaceSelector: "team",
+		},
+	}
+	if err := newFanOut().Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if _, err := k8sClient.CoreV1().Secrets("sandbox").Get("registry", metav1.GetOptions{}); err == nil {
+		t.Error("sandbox doesn't match the selector and shouldn't have the secret")
+	}
+
+	// team-b stops matching the selector, and is cleaned up even though
+	// it was never reflected by this fan-out, except for secrets with the
+	// ignore annotation.
+	secrets := k8sClient.CoreV1().Secrets
+	ignored, err := secrets("team-b").Get("ignored", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get team-b/ignored: %s", err)
+	}
+	ignored.Annotations[IgnoreAnnotation] = "true"
+	if _, err := secrets("team-b").Update(ignored); err != nil {
+		t.Fatalf("unable to update team-b/ignored: %s", err)
+	}
+	namespaces := k8sClient.CoreV1().Namespaces()
+	teamB, err := namespaces.Get("team-b", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get team-b: %s", err)
+	}
+	teamB.Labels = nil
+	if _, err := namespaces.Update(teamB); err != nil {
+		t.Fatalf("unable to update team-b: %s", err)
+	}
+	if err := newFanOut().Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+
+	if _, err := secrets("team-a").Get("registry", metav1.GetOptions{}); err != nil {
+		t.Errorf("team-a/registry should have been kept: %s", err)
+	}
+	if _, err := secrets("team-b").Get("registry", metav1.GetOptions{}); err == nil {
+		t.Error("team-b/registry should have been deleted")
+	}
+	retained, err := secrets("team-b").Get("retained", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("team-b/retained should have been retained: %s", err)
+	}
+	if _, ok := retained.Labels[LabelKey]; ok || string(retained.Data["foo"]) != "bar" {
+		t.Errorf("team-b/retained should keep its data without the pentagon label: %+v", retained)
+	}
+	ignored, err = secrets("team-b").Get("ignored", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("team-b/ignored should have been left alone: %s", err)
+	}
+	if ignored.Labels[LabelKey] != DefaultLabelValue {
+		t.Errorf("team-b/ignored should keep the pentagon label: %+v", ignored)
+	}
+}
@@ -0,0 +1,61 @@
+package pentagon
+
+import "path"
+
+// WithFilters makes the reflector only reflect the mappings whose vault
+// paths match one of the globs vaultPaths, if it isn't empty, and whose
+// secret names match one of the globs secretNames, if it isn't empty.
+// Globs are matched with path.Match, so * doesn't match /.  Like with
+// WithGroups, the secrets of the other mappings are left alone.
+func WithFilters(vaultPaths, secretNames []string) Option {
+	return func(r *Reflector) {
+		r.vaultPathFilters = vaultPaths
+		r.secretNameFilters = secretNames
+	}
+}
+
+// MatchesFilters returns true if the mapping's vault path matches one of
+// the globs vaultPaths, if it isn't empty, and its secret name one of the
+// globs secretNames, if it isn't empty.  Invalid globs match nothing.
+func (m Mapping) MatchesFilters(vaultPaths, secretNames []string) bool {
+	matches := func(globs []string, name string) bool {
+		if len(globs) == 0 {
+			return true
+		}
+		for _, glob := range globs {
+			if ok, _ := path.Match(glob, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return matches(vaultPaths, m.VaultPath) && matches(secretNames, m.SecretName)
+}
+
+// filterMappings returns the mappings selected by the reflector's groups
+// and filters, and the secret names of the others.
+func (r *Reflector) filterMappings(mappings []Mapping) ([]Mapping, map[string]struct{}) {
+	unselected := map[string]struct{}{}
+	if len(r.onlyGroups) == 0 && len(r.skipGroups) == 0 &&
+		len(r.vaultPathFilters) == 0 && len(r.secretNameFilters) == 0 {
+		return mappings, unselected
+	}
+
+	selected := make([]Mapping, 0, len(mappings))
+	for _, m := range mappings {
+		if m.InGroups(r.onlyGroups, r.skipGroups) &&
+			m.MatchesFilters(r.vaultPathFilters, r.secretNameFilters) {
+			selected = append(selected, m)
+		} else {
+			unselected[m.SecretName] = struct{}{}
+		}
+	}
+	return selected, unselected
+}
+
+// selectedMappings returns the mappings of this reflector's shard that its
+// groups and filters select.
+func (r *Reflector) selectedMappings(mappings []Mapping) []Mapping {
+	selected, _ := r.filterMappings(r.shardMappings(mappings))
+	return selected
+}
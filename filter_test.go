@@ -0,0 +1,88 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestMatchesFilters(t *testing.T) {
+	m := Mapping{VaultPath: "secret/data/payments/stripe", SecretName: "payments-stripe"}
+	for _, c := range []struct {
+		vaultPaths  []string
+		secretNames []string
+		expected    bool
+	}{
+		{nil, nil, true},
+		{[]string{"secret/data/payments/*"}, nil, true},
+		{[]string{"secret/data/*"}, nil, false},
+		{[]string{"secret/data/billing/*", "secret/data/payments/*"}, nil, true},
+		{nil, []string{"payments-*"}, true},
+		{[]string{"secret/data/payments/*"}, []string{"billing-*"}, false},
+		{[]string{"["}, nil, false},
+	} {
+		if m.MatchesFilters(c.vaultPaths, c.secretNames) != c.expected {
+			t.Errorf(
+				"expected %t with vault paths %v and secret names %v",
+				c.expected,
+				c.vaultPaths,
+				c.secretNames,
+			)
+		}
+	}
+}
+
+func TestFiltersReflect(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+
+	mappings := []Mapping{}
+	for _, name := range []string{"payments", "billing"} {
+		vaultClient.Write("secrets/"+name, map[string]interface{}{"foo": name})
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/" + name,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		})
+	}
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test")
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	// a filtered pass only rewrites the matching secret, and doesn't
+	// reconcile the other.
+	vaultClient.Write("secrets/payments", map[string]interface{}{"foo": "new"})
+	vaultClient.Write("secrets/billing", map[string]interface{}{"foo": "new"})
+	r = NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		"test",
+		WithFilters([]string{"secrets/pay*"}, nil),
+	)
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	for name, expected := range map[string]string{
+		"payments": "new",
+		"billing":  "billing",
+	} {
+		secret, err := secrets.Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s should be there: %s", name, err)
+		}
+		if string(secret.Data["foo"]) != expected {
+			t.Errorf("expected %s in %s, got %s", expected, name, secret.Data["foo"])
+		}
+	}
+}
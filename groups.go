@@ -0,0 +1,29 @@
+package pentagon
+
+// WithGroups makes the reflector only reflect the mappings in at least one
+// of the groups only, if it isn't empty, and in none of the groups skip.
+// The secrets of the other mappings are left alone rather than reconciled,
+// so that several reflectors, e.g. a bootstrap job and a daemon, can split
+// up the mappings of one configuration.
+func WithGroups(only, skip []string) Option {
+	return func(r *Reflector) {
+		r.onlyGroups = only
+		r.skipGroups = skip
+	}
+}
+
+// InGroups returns true if the mapping is in at least one of the groups
+// only, if it isn't empty, and in none of the groups skip.
+func (m Mapping) InGroups(only, skip []string) bool {
+	in := func(groups []string) bool {
+		for _, g := range groups {
+			for _, mg := range m.Groups {
+				if g == mg {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return (len(only) == 0 || in(only)) && !in(skip)
+}
@@ -0,0 +1,92 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestInGroups(t *testing.T) {
+	m := Mapping{Groups: []string{"cluster-critical", "dns"}}
+	for _, c := range []struct {
+		only     []string
+		skip     []string
+		expected bool
+	}{
+		{nil, nil, true},
+		{[]string{"dns"}, nil, true},
+		{[]string{"ingress"}, nil, false},
+		{nil, []string{"cluster-critical"}, false},
+		{nil, []string{"ingress"}, true},
+		{[]string{"dns"}, []string{"cluster-critical"}, false},
+	} {
+		if m.InGroups(c.only, c.skip) != c.expected {
+			t.Errorf("expected %t with only %v and skip %v", c.expected, c.only, c.skip)
+		}
+	}
+
+	if (Mapping{}).InGroups([]string{"dns"}, nil) {
+		t.Errorf("mappings without groups shouldn't be in any")
+	}
+}
+
+func TestGroupsReflect(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+
+	mappings := []Mapping{}
+	for name, groups := range map[string][]string{
+		"critical": {"cluster-critical"},
+		"other":    nil,
+	} {
+		vaultClient.Write("secrets/"+name, map[string]interface{}{"foo": name})
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/" + name,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			Groups:          groups,
+		})
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	exists := func(name string) bool {
+		_, err := secrets.Get(name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		"test",
+		WithGroups([]string{"cluster-critical"}, nil),
+	)
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if !exists("critical") || exists("other") {
+		t.Fatalf("only the cluster-critical mapping should have been reflected")
+	}
+
+	// the other reflector must not reconcile the secrets of the group it
+	// skips.
+	r = NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		"test",
+		WithGroups(nil, []string{"cluster-critical"}),
+	)
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if !exists("critical") || !exists("other") {
+		t.Fatalf("both secrets should be there")
+	}
+}
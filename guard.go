@@ -0,0 +1,103 @@
+package pentagon
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ForceUpdateAnnotation lets the next update of a secret through the
+// deletion guard when set to "true" on the secret itself.  The update
+// replaces the annotations, so it only lets one update through.
+const ForceUpdateAnnotation = "pentagon.vimeo.com/force-update"
+
+// DeletionGuardConfig refuses updates that remove most of a secret's data,
+// e.g. because its vault secret was mis-edited.
+type DeletionGuardConfig struct {
+	// MaxRemovedKeys is the percentage of the keys of a secret that an
+	// update may remove.  Zero (the default) disables the check.
+	MaxRemovedKeys int `yaml:"maxRemovedKeys"`
+
+	// MaxShrink is the percentage by which an update may shrink the size
+	// of a secret's data.  Zero (the default) disables the check.
+	MaxShrink int `yaml:"maxShrink"`
+}
+
+// Validate checks that the percentages are within 0 and 100.
+func (g DeletionGuardConfig) Validate() error {
+	if g.MaxRemovedKeys < 0 || g.MaxRemovedKeys > 100 {
+		return fmt.Errorf("maxRemovedKeys must be a percentage: %d", g.MaxRemovedKeys)
+	}
+	if g.MaxShrink < 0 || g.MaxShrink > 100 {
+		return fmt.Errorf("maxShrink must be a percentage: %d", g.MaxShrink)
+	}
+	return nil
+}
+
+// WithDeletionGuard makes the reflector refuse to update a secret if that
+// removes more than the percentage maxRemovedKeys of its keys, or shrinks
+// its data by more than the percentage maxShrink, unless it has
+// ForceUpdateAnnotation.  Zero disables either check.
+func WithDeletionGuard(maxRemovedKeys, maxShrink int) Option {
+	return func(r *Reflector) {
+		r.deletionGuard = DeletionGuardConfig{
+			MaxRemovedKeys: maxRemovedKeys,
+			MaxShrink:      maxShrink,
+		}
+	}
+}
+
+// checkDeletionGuard returns an error if updating current to desired
+// removes too much of its data.
+func (r *Reflector) checkDeletionGuard(current, desired *v1.Secret) error {
+	g := r.deletionGuard
+	if current == nil || len(current.Data) == 0 ||
+		current.Annotations[ForceUpdateAnnotation] == "true" {
+		return nil
+	}
+
+	if g.MaxRemovedKeys > 0 {
+		removed := 0
+		for key := range current.Data {
+			if _, ok := desired.Data[key]; !ok {
+				removed++
+			}
+		}
+		if percent := removed * 100 / len(current.Data); percent > g.MaxRemovedKeys {
+			return fmt.Errorf(
+				"refusing to update secret %s: it would remove %d of its %d keys, over the %d%% limit (annotate it with %s=true to allow it)",
+				current.Name,
+				removed,
+				len(current.Data),
+				g.MaxRemovedKeys,
+				ForceUpdateAnnotation,
+			)
+		}
+	}
+
+	if g.MaxShrink > 0 {
+		before, after := dataSize(current.Data), dataSize(desired.Data)
+		if before > 0 && after < before {
+			if percent := (before - after) * 100 / before; percent > g.MaxShrink {
+				return fmt.Errorf(
+					"refusing to update secret %s: it would shrink its data from %d to %d bytes, over the %d%% limit (annotate it with %s=true to allow it)",
+					current.Name,
+					before,
+					after,
+					g.MaxShrink,
+					ForceUpdateAnnotation,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// dataSize returns the number of bytes of the keys and values of data.
+func dataSize(data map[string][]byte) int {
+	size := 0
+	for key, value := range data {
+		size += len(key) + len(value)
+	}
+	return size
+}
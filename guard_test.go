@@ -0,0 +1,103 @@
+package pentagon
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestCheckDeletionGuard(t *testing.T) {
+	current := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Data: map[string][]byte{
+			"a": []byte("0123456789"),
+			"b": []byte("0123456789"),
+			"c": []byte("0123456789"),
+			"d": []byte("0123456789"),
+		},
+	}
+	withData := func(keys ...string) *v1.Secret {
+		secret := &v1.Secret{Data: map[string][]byte{}}
+		for _, key := range keys {
+			secret.Data[key] = []byte("0123456789")
+		}
+		return secret
+	}
+
+	r := &Reflector{deletionGuard: DeletionGuardConfig{MaxRemovedKeys: 50}}
+	if err := r.checkDeletionGuard(current, withData("a", "b")); err != nil {
+		t.Errorf("removing half of the keys should be allowed: %s", err)
+	}
+	err := r.checkDeletionGuard(current, withData("a"))
+	if err == nil || !strings.Contains(err.Error(), "remove 3 of its 4 keys") {
+		t.Errorf("removing 3 of 4 keys should have been refused: %v", err)
+	}
+	if err := r.checkDeletionGuard(nil, withData()); err != nil {
+		t.Errorf("creating secrets should be allowed: %s", err)
+	}
+
+	r = &Reflector{deletionGuard: DeletionGuardConfig{MaxShrink: 25}}
+	shrunk := withData("a", "b", "c", "d")
+	shrunk.Data["a"] = nil
+	if err := r.checkDeletionGuard(current, shrunk); err != nil {
+		t.Errorf("shrinking by 10 of 44 bytes should be allowed: %s", err)
+	}
+	shrunk.Data["b"] = nil
+	if err := r.checkDeletionGuard(current, shrunk); err == nil {
+		t.Error("shrinking by 20 of 44 bytes should have been refused")
+	}
+
+	forced := current.DeepCopy()
+	forced.Annotations = map[string]string{ForceUpdateAnnotation: "true"}
+	if err := r.checkDeletionGuard(forced, withData()); err != nil {
+		t.Errorf("forced updates should be allowed: %s", err)
+	}
+}
+
+func TestDeletionGuardReflect(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{"a": "1"})
+	secrets := NewFakeSecrets(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "foo",
+			Labels: map[string]string{LabelKey: DefaultLabelValue},
+		},
+		Data: map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")},
+	})
+
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(secrets),
+		WithDeletionGuard(50, 0),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	mappings := []Mapping{{
+		VaultPath:       "secrets/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+	}}
+	if err := r.Reflect(context.Background(), mappings); err == nil {
+		t.Fatal("the update should have been refused")
+	}
+
+	secret, _ := secrets.Get("foo", metav1.GetOptions{})
+	secret.Annotations = map[string]string{ForceUpdateAnnotation: "true"}
+	secrets.Update(secret)
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("the forced update should have been allowed: %s", err)
+	}
+	secret, _ = secrets.Get("foo", metav1.GetOptions{})
+	if len(secret.Data) != 1 || secret.Annotations[ForceUpdateAnnotation] != "" {
+		t.Errorf("the update should have gone through once: %v", secret)
+	}
+}
@@ -0,0 +1,68 @@
+package pentagon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+)
+
+// WriteEvent describes a write of the secret of a mapping.
+type WriteEvent struct {
+	Mapping Mapping
+
+	// OldHash is the DataHash of the secret's data before the write.  It is
+	// empty if the secret is being created.
+	OldHash string
+
+	// NewHash is the DataHash of the data being written.
+	NewHash string
+}
+
+// WriteHook is called around every write of a secret, e.g. to validate,
+// announce or audit changes.  Hooks may be called concurrently by several
+// workers.
+type WriteHook interface {
+	// BeforeWrite is called before the secret is written.  Returning an
+	// error cancels the write and fails the mapping.
+	BeforeWrite(ctx context.Context, event WriteEvent) error
+
+	// AfterWrite is called once the write is done with its error, if any.
+	AfterWrite(ctx context.Context, event WriteEvent, err error)
+}
+
+// WithWriteHook adds hook to the hooks called around secret writes.  Hooks
+// are called in the order they were added.
+func WithWriteHook(hook WriteHook) Option {
+	return func(r *Reflector) {
+		r.writeHooks = append(r.writeHooks, hook)
+	}
+}
+
+// DataHash returns the hex encoded SHA-256 hash of secret data, which only
+// depends on its keys and values.
+func DataHash(data map[string][]byte) string {
+	// each key and value is prefixed by its length so that different data
+	// can't hash the same by moving bytes between them.
+	h := sha256.New()
+	length := make([]byte, 8)
+	for _, key := range sortedKeys(data) {
+		for _, b := range [][]byte{[]byte(key), data[key]} {
+			binary.BigEndian.PutUint64(length, uint64(len(b)))
+			h.Write(length)
+			h.Write(b)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sortedKeys returns the keys of data in order.
+func sortedKeys(data map[string][]byte) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,108 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// recordingHook records write events and refuses the ones for refuse.
+type recordingHook struct {
+	refuse string
+	before []WriteEvent
+	after  []WriteEvent
+}
+
+func (h *recordingHook) BeforeWrite(ctx context.Context, event WriteEvent) error {
+	h.before = append(h.before, event)
+	if event.Mapping.SecretName == h.refuse {
+		return fmt.Errorf("refused")
+	}
+	return nil
+}
+
+func (h *recordingHook) AfterWrite(ctx context.Context, event WriteEvent, err error) {
+	h.after = append(h.after, event)
+}
+
+func TestWriteHooks(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	vaultClient.Write("secrets/refused", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	hook := &recordingHook{refuse: "refused"}
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithErrorPolicy(ErrorPolicyContinue),
+		WithWriteHook(hook),
+	)
+
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+		{
+			VaultPath:       "secrets/refused",
+			SecretName:      "refused",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+	}
+	err := r.Reflect(context.Background(), mappings)
+	if err == nil {
+		t.Fatal("the refused write should fail the pass")
+	}
+
+	_, err = k8sClient.CoreV1().Secrets(DefaultNamespace).Get("refused", metav1.GetOptions{})
+	if err == nil {
+		t.Fatal("refused shouldn't have been written")
+	}
+	if len(hook.before) != 2 || len(hook.after) != 1 {
+		t.Fatalf("unexpected hook calls: %d before, %d after", len(hook.before), len(hook.after))
+	}
+
+	created := hook.after[0]
+	if created.OldHash != "" || created.NewHash != DataHash(map[string][]byte{"foo": []byte("bar")}) {
+		t.Fatalf("unexpected hashes for a new secret: %+v", created)
+	}
+
+	vaultClient.Write("secrets/foo", map[string]interface{}{
+		"foo": "baz",
+	})
+	err = r.Reflect(context.Background(), mappings[:1])
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	updated := hook.after[len(hook.after)-1]
+	if updated.OldHash != created.NewHash || updated.NewHash == created.NewHash {
+		t.Fatalf("unexpected hashes for an update: %+v", updated)
+	}
+}
+
+func TestDataHash(t *testing.T) {
+	a := DataHash(map[string][]byte{"ab": []byte("c")})
+	b := DataHash(map[string][]byte{"a": []byte("bc")})
+	if a == b {
+		t.Fatal("moving bytes between a key and its value should change the hash")
+	}
+	if DataHash(nil) != DataHash(map[string][]byte{}) {
+		t.Fatal("nil and empty data should hash the same")
+	}
+}
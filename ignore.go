@@ -0,0 +1,16 @@
+package pentagon
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// IgnoreAnnotation makes pentagon leave a secret alone, neither updating
+// nor deleting it, when set to "true" on the secret itself.  Unlike pausing
+// a mapping, it can be set by anyone allowed to edit the secret, e.g. with
+// kubectl annotate during an incident.
+const IgnoreAnnotation = "pentagon.vimeo.com/ignore"
+
+// ignored returns true if secret has IgnoreAnnotation set to "true".
+func ignored(secret *v1.Secret) bool {
+	return secret != nil && secret.Annotations[IgnoreAnnotation] == "true"
+}
@@ -0,0 +1,75 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestIgnoreAnnotation(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		vaultClient.Write("secrets/data/foo1", map[string]interface{}{"foo": "bar"})
+		vaultClient.Write("secrets/data/foo2", map[string]interface{}{"foo": "bar"})
+
+		mappings := []Mapping{
+			{
+				VaultPath:       "secrets/data/foo1",
+				SecretName:      "foo1",
+				VaultEngineType: engineType,
+			},
+			{
+				VaultPath:       "secrets/data/foo2",
+				SecretName:      "foo2",
+				VaultEngineType: engineType,
+			},
+		}
+
+		r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test")
+		err := r.Reflect(context.Background(), mappings)
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		// ignore both secrets by hand.
+		secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+		for _, name := range []string{"foo1", "foo2"} {
+			var s *v1.Secret
+			s, err = secrets.Get(name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s should be there: %s", name, err)
+			}
+			s.Annotations[IgnoreAnnotation] = "true"
+			s.Data["foo"] = []byte("by hand")
+			_, err = secrets.Update(s)
+			if err != nil {
+				t.Fatalf("unable to annotate %s: %s", name, err)
+			}
+		}
+
+		// foo1 isn't updated and foo2 isn't reconciled away.
+		vaultClient.Write("secrets/data/foo1", map[string]interface{}{"foo": "baz"})
+		err = r.Reflect(context.Background(), mappings[:1])
+		if err != nil {
+			t.Fatalf("reflect didn't work the second time: %s", err)
+		}
+
+		for _, name := range []string{"foo1", "foo2"} {
+			s, err := secrets.Get(name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s should still be there: %s", name, err)
+			}
+			if string(s.Data["foo"]) != "by hand" {
+				t.Fatalf("%s should have been left alone: %s", name, s.Data["foo"])
+			}
+		}
+	})
+}
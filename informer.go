@@ -0,0 +1,177 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"golang.org/x/time/rate"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WithInformer makes the reflector keep a cache of the secrets it manages
+// up to date with a shared informer rather than listing them on every pass.
+// The informer runs until stopCh is closed.
+func WithInformer(stopCh <-chan struct{}) Option {
+	return func(r *Reflector) {
+		r.informerStop = stopCh
+	}
+}
+
+// startInformer starts the shared informer over the secrets labeled with
+// this reflector's label value.
+func (r *Reflector) startInformer() {
+	informer := coreinformers.NewFilteredSecretInformer(
+		r.k8sClient,
+		r.k8sNamespace,
+		0,
+		cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = r.selector().String()
+		},
+	)
+	if r.deleted != nil {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: r.secretDeleted,
+		})
+	}
+
+	// the informer also stops with the reflector.
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-r.informerStop:
+		case <-r.stopped:
+		}
+		close(stop)
+	}()
+	go informer.Run(stop)
+
+	r.informerSynced = informer.HasSynced
+	r.secretLister = corelisters.NewSecretLister(informer.GetIndexer()).
+		Secrets(r.k8sNamespace)
+}
+
+// stop stops the informer of a reflector that is no longer used, before
+// its stop channel is closed.
+func (r *Reflector) stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopped)
+	})
+}
+
+// WithRecreateDeleted makes the reflector notice when one of its secrets is
+// deleted so that RecreateDeleted can re-create it right away.  At most
+// limit secrets are re-created per second, with bursts of up to burst.  It
+// requires WithInformer.
+func WithRecreateDeleted(limit float32, burst int) Option {
+	return func(r *Reflector) {
+		r.deleted = make(chan string, deletedQueueSize)
+		r.recreateLimiter = rate.NewLimiter(rate.Limit(limit), burst)
+	}
+}
+
+// deletedQueueSize is the number of deleted secrets that can wait to be
+// re-created.  Further deletions are left to the next pass.
+const deletedQueueSize = 100
+
+// secretDeleted queues a deleted secret to be re-created.
+func (r *Reflector) secretDeleted(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+
+	select {
+	case r.deleted <- secret.Name:
+	default:
+		log.Printf(
+			"too many deleted secrets queued, %s will be re-created by the next pass",
+			secret.Name,
+		)
+	}
+}
+
+// RecreateDeleted re-creates the secrets of mappings as they are deleted
+// until ctx is done.  Secrets that aren't part of mappings, such as the
+// ones removed by reconciliation, are left alone.  It does nothing unless
+// the reflector was created using WithRecreateDeleted.
+func (r *Reflector) RecreateDeleted(ctx context.Context, mappings []Mapping) {
+	if r.deleted == nil {
+		return
+	}
+
+	byName := make(map[string]Mapping, len(mappings))
+	for _, m := range mappings {
+		byName[m.SecretName] = m
+	}
+
+	for {
+		var name string
+		select {
+		case name = <-r.deleted:
+		case <-ctx.Done():
+			return
+		}
+
+		mapping, ok := byName[name]
+		if !ok {
+			continue
+		}
+
+		if err := r.recreateLimiter.Wait(ctx); err != nil {
+			return
+		}
+
+		log.Printf("kubernetes secret %s was deleted, re-creating it", name)
+		recreatedCounter.Inc()
+		err := r.Sync(ctx, []Mapping{mapping})
+		if err != nil {
+			log.Printf("error re-creating %s: %s", name, err)
+		}
+	}
+}
+
+// existingSecrets returns the secrets managed by this reflector keyed by
+// name, either from the informer cache or by listing them.  The returned
+// secrets must not be modified.
+func (r *Reflector) existingSecrets() (map[string]*v1.Secret, error) {
+	if r.secretLister != nil {
+		if !cache.WaitForCacheSync(r.informerStop, r.informerSynced) {
+			return nil, fmt.Errorf("secrets informer did not sync")
+		}
+
+		cached, err := r.secretLister.List(labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("error listing cached secrets: %s", err)
+		}
+
+		existing := make(map[string]*v1.Secret, len(cached))
+		for _, secret := range cached {
+			existing[secret.Name] = secret
+		}
+		return existing, nil
+	}
+
+	secretsList, err := r.secrets().List(
+		metav1.ListOptions{LabelSelector: r.selector().String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing secrets: %s", err)
+	}
+
+	existing := make(map[string]*v1.Secret, len(secretsList.Items))
+	for i := range secretsList.Items {
+		secret := &secretsList.Items[i]
+		existing[secret.Name] = secret
+	}
+	return existing, nil
+}
@@ -0,0 +1,62 @@
+package pentagon
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Orphans returns the secrets labeled for the reflector that none of
+// mappings refers to, sorted by name.  They are the secrets that
+// reconciliation deletes: secrets of other shards, owned by other instances
+// or ignored with IgnoreAnnotation aren't orphans.  Nothing is deleted.
+func (r *Reflector) Orphans(mappings []Mapping) ([]*v1.Secret, error) {
+	existing, err := r.existingSecrets()
+	if err != nil {
+		return nil, err
+	}
+	return r.orphans(existing, mappings), nil
+}
+
+// orphans returns the secrets of existing that are orphaned by mappings.
+func (r *Reflector) orphans(existing map[string]*v1.Secret, mappings []Mapping) []*v1.Secret {
+	mapped := make(map[string]struct{}, len(mappings))
+	for _, m := range mappings {
+		mapped[m.SecretName] = struct{}{}
+	}
+
+	orphans := []*v1.Secret{}
+	for name, secret := range existing {
+		if _, ok := mapped[name]; ok {
+			continue
+		}
+		if !r.ownsSecret(name) || r.checkOwner(secret) != nil || ignored(secret) {
+			continue
+		}
+		orphans = append(orphans, secret)
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Name < orphans[j].Name
+	})
+	return orphans
+}
+
+// recordInventory sets the number of managed and orphaned secrets after a
+// full pass over mappings, given the secrets that existed before the pass
+// and the number of secrets it created.
+func (r *Reflector) recordInventory(
+	existing map[string]*v1.Secret,
+	mappings []Mapping,
+	created int64,
+) {
+	managed := created
+	for _, m := range mappings {
+		if _, ok := existing[m.SecretName]; ok {
+			managed++
+		}
+	}
+	managedSecretsGauge.WithLabelValues(r.k8sNamespace).Set(float64(managed))
+	orphanedSecretsGauge.WithLabelValues(r.k8sNamespace).Set(
+		float64(len(r.orphans(existing, mappings))),
+	)
+}
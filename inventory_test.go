@@ -0,0 +1,79 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestInventory(t *testing.T) {
+	const namespace = "inventory"
+
+	// a secret sharing the label that belongs to another instance isn't an
+	// orphan of this one.
+	k8sClient := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "other",
+			Namespace:   namespace,
+			Labels:      map[string]string{LabelKey: DefaultLabelValue},
+			Annotations: map[string]string{OwnerAnnotation: "other"},
+		},
+	})
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/foo1", map[string]interface{}{"foo": "bar"})
+	vaultClient.Write("secrets/data/foo2", map[string]interface{}{"foo": "bar"})
+
+	r := NewReflector(vaultClient, k8sClient, namespace, DefaultLabelValue)
+
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo1",
+			SecretName:      "foo1",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+		{
+			VaultPath:       "secrets/data/foo2",
+			SecretName:      "foo2",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+	}
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	managed := managedSecretsGauge.WithLabelValues(namespace)
+	orphaned := orphanedSecretsGauge.WithLabelValues(namespace)
+	if v := testutil.ToFloat64(managed); v != 2 {
+		t.Errorf("expected 2 managed secrets, got %v", v)
+	}
+	if v := testutil.ToFloat64(orphaned); v != 0 {
+		t.Errorf("expected no orphaned secrets, got %v", v)
+	}
+
+	// the default label doesn't reconcile, so foo2 is left as an orphan.
+	if err := r.Reflect(context.Background(), mappings[:1]); err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+	if v := testutil.ToFloat64(managed); v != 1 {
+		t.Errorf("expected 1 managed secret, got %v", v)
+	}
+	if v := testutil.ToFloat64(orphaned); v != 1 {
+		t.Errorf("expected 1 orphaned secret, got %v", v)
+	}
+
+	orphans, err := r.Orphans(mappings[:1])
+	if err != nil {
+		t.Fatalf("error listing orphans: %s", err)
+	}
+	if len(orphans) != 1 || orphans[0].Name != "foo2" {
+		t.Errorf("expected foo2 to be the only orphan, got %v", orphans)
+	}
+}
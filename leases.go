@@ -0,0 +1,128 @@
+package pentagon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+const (
+	// LeaseIDAnnotation records the id of the vault lease of the
+	// credentials reflected into a k8s secret from a dynamic secrets
+	// engine.
+	LeaseIDAnnotation = "pentagon.vimeo.com/lease-id"
+
+	// LeaseExpiresAnnotation records when that lease expires.
+	LeaseExpiresAnnotation = "pentagon.vimeo.com/lease-expires"
+)
+
+// leased returns true if reading a secret of engineType generates new
+// credentials with a lease, so they are only read again when their lease
+// is running out.
+func leased(engineType vault.EngineType) bool {
+	switch engineType {
+	case vault.EngineTypeConsul, vault.EngineTypeNomad:
+		return true
+	default:
+		return false
+	}
+}
+
+// leaseValid returns true if secret holds credentials read from the vault
+// path of mapping whose lease has more than a third of its duration left
+// at now.
+func leaseValid(secret *v1.Secret, mapping Mapping, now time.Time) bool {
+	if secret.Annotations[PathAnnotation] != mapping.VaultPath {
+		return false
+	}
+	issued, err := time.Parse(time.RFC3339, secret.Annotations[LastSyncedAnnotation])
+	if err != nil {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, secret.Annotations[LeaseExpiresAnnotation])
+	if err != nil {
+		return false
+	}
+	return expires.Sub(now) > expires.Sub(issued)/3
+}
+
+// WithLeaseRenewal makes the reflector renew the vault leases of
+// credentials whose lease is running out, using the lease id recorded in
+// their k8s secret, rather than reading new credentials.  New credentials
+// are only read once vault won't extend the lease any further, or renewing
+// it fails.  Since the lease is recorded in the secret, a restarted
+// reflector resumes renewing the leases of its predecessor.
+func WithLeaseRenewal() Option {
+	return func(r *Reflector) {
+		r.leaseRenewal = true
+	}
+}
+
+// renewLease renews the vault lease recorded in secret, the secret of
+// mapping, through logical, and returns the secret with the renewed lease
+// once it's written, or nil if the lease can't be renewed and new
+// credentials should be read instead.
+func (r *Reflector) renewLease(
+	ctx context.Context,
+	logical vault.Logical,
+	mapping Mapping,
+	secret *v1.Secret,
+) *v1.Secret {
+	leaseID := secret.Annotations[LeaseIDAnnotation]
+	if leaseID == "" || secret.Annotations[PathAnnotation] != mapping.VaultPath {
+		return nil
+	}
+	expires, err := time.Parse(time.RFC3339, secret.Annotations[LeaseExpiresAnnotation])
+	if err != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	if !expires.After(now) {
+		return nil
+	}
+
+	renewal, err := logical.Write("sys/leases/renew", map[string]interface{}{
+		"lease_id": leaseID,
+	})
+	if err != nil {
+		log.Printf("unable to renew vault lease %s of %s: %s", leaseID, mapping.SecretName, err)
+		leaseRenewalsCounter.WithLabelValues("failed").Inc()
+		return nil
+	}
+	if renewal == nil || renewal.LeaseDuration <= 0 {
+		return nil
+	}
+
+	// vault caps leases at their max TTL, after which renewing them doesn't
+	// extend them.
+	renewedUntil := now.Add(time.Duration(renewal.LeaseDuration) * time.Second)
+	if !renewedUntil.After(expires) {
+		infof("vault lease %s of %s can't be extended past %s", leaseID, mapping.SecretName, expires)
+		return nil
+	}
+
+	renewed := secret.DeepCopy()
+	renewed.Annotations[LastSyncedAnnotation] = now.Format(time.RFC3339)
+	renewed.Annotations[LeaseExpiresAnnotation] = renewedUntil.Format(time.RFC3339)
+	if renewal.LeaseID != "" {
+		renewed.Annotations[LeaseIDAnnotation] = renewal.LeaseID
+	}
+	if err := r.writeSecret(ctx, renewed, true); err != nil {
+		log.Printf("unable to record the renewed lease of %s: %s", mapping.SecretName, err)
+		leaseRenewalsCounter.WithLabelValues("failed").Inc()
+		return nil
+	}
+
+	log.Printf(
+		"renewed vault lease %s of kubernetes secret %s until %s",
+		leaseID,
+		mapping.SecretName,
+		renewed.Annotations[LeaseExpiresAnnotation],
+	)
+	leaseRenewalsCounter.WithLabelValues("renewed").Inc()
+	return renewed
+}
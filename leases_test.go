@@ -0,0 +1,182 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// leasingVault generates a new token with a lease on every read, like the
+// Consul and Nomad engines.
+type leasingVault struct {
+	reads int
+}
+
+func (l *leasingVault) Read(path string) (*api.Secret, error) {
+	l.reads++
+	return &api.Secret{
+		LeaseID:       fmt.Sprintf("%s/%d", path, l.reads),
+		LeaseDuration: 3600,
+		Data: map[string]interface{}{
+			"token":    fmt.Sprintf("token-%d", l.reads),
+			"accessor": fmt.Sprintf("accessor-%d", l.reads),
+			"local":    false,
+		},
+	}, nil
+}
+
+func (l *leasingVault) Write(path string, data map[string]interface{}) (*api.Secret, error) {
+	return nil, fmt.Errorf("read only")
+}
+
+func TestLeases(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := &leasingVault{}
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, DefaultLabelValue)
+	mappings := []Mapping{{
+		VaultPath:       "consul/creds/app",
+		SecretName:      "consul-token",
+		VaultEngineType: vault.EngineTypeConsul,
+	}}
+	for i := 0; i < 2; i++ {
+		if err := r.Reflect(context.Background(), mappings); err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+	}
+
+	// the token is reused while its lease is valid.
+	if vaultClient.reads != 1 {
+		t.Fatalf("expected a single token to be generated, got %d", vaultClient.reads)
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	s, err := secrets.Get("consul-token", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("consul-token should be there: %s", err)
+	}
+	if string(s.Data["token"]) != "token-1" || string(s.Data["local"]) != "false" {
+		t.Fatalf("unexpected data: %v", s.Data)
+	}
+	if s.Annotations[LeaseIDAnnotation] != "consul/creds/app/1" {
+		t.Fatalf("unexpected lease: %v", s.Annotations)
+	}
+}
+
+func TestLeaseValid(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	mapping := Mapping{VaultPath: "nomad/creds/app"}
+
+	for name, test := range map[string]struct {
+		path    string
+		issued  time.Time
+		expires time.Time
+		valid   bool
+	}{
+		"fresh":      {"nomad/creds/app", now.Add(-time.Hour), now.Add(2 * time.Hour), true},
+		"expiring":   {"nomad/creds/app", now.Add(-2 * time.Hour), now.Add(time.Hour - time.Second), false},
+		"expired":    {"nomad/creds/app", now.Add(-2 * time.Hour), now.Add(-time.Hour), false},
+		"other path": {"nomad/creds/other", now.Add(-time.Hour), now.Add(2 * time.Hour), false},
+	} {
+		secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				PathAnnotation:         test.path,
+				LastSyncedAnnotation:   test.issued.Format(time.RFC3339),
+				LeaseExpiresAnnotation: test.expires.Format(time.RFC3339),
+			},
+		}}
+		if valid := leaseValid(secret, mapping, now); valid != test.valid {
+			t.Errorf("%s: expected %t, got %t", name, test.valid, valid)
+		}
+	}
+}
+
+// renewingVault is a leasingVault whose leases can be renewed for up to
+// renewTTL seconds.
+type renewingVault struct {
+	leasingVault
+	renewTTL int
+	renewals []string
+}
+
+func (v *renewingVault) Write(path string, data map[string]interface{}) (*api.Secret, error) {
+	if path != "sys/leases/renew" {
+		return nil, fmt.Errorf("unexpected write to %s", path)
+	}
+	leaseID := data["lease_id"].(string)
+	v.renewals = append(v.renewals, leaseID)
+	return &api.Secret{LeaseID: leaseID, LeaseDuration: v.renewTTL, Renewable: true}, nil
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	now := time.Now().UTC()
+	expires := now.Add(10 * time.Minute).Format(time.RFC3339)
+	secrets := NewFakeSecrets(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "consul-token",
+			Labels: map[string]string{LabelKey: DefaultLabelValue},
+			Annotations: map[string]string{
+				PathAnnotation:         "consul/creds/app",
+				LastSyncedAnnotation:   now.Add(-50 * time.Minute).Format(time.RFC3339),
+				LeaseIDAnnotation:      "consul/creds/app/0",
+				LeaseExpiresAnnotation: expires,
+			},
+		},
+		Data: map[string][]byte{"token": []byte("token-0")},
+	})
+	vaultClient := &renewingVault{renewTTL: 3600}
+	mappings := []Mapping{{
+		VaultPath:       "consul/creds/app",
+		SecretName:      "consul-token",
+		VaultEngineType: vault.EngineTypeConsul,
+	}}
+
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(secrets),
+		WithLeaseRenewal(),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	// the lease of the previous token is renewed rather than reading a new
+	// one.
+	if vaultClient.reads != 0 || len(vaultClient.renewals) != 1 ||
+		vaultClient.renewals[0] != "consul/creds/app/0" {
+		t.Fatalf("expected the lease to be renewed, got %d reads and renewals %v",
+			vaultClient.reads, vaultClient.renewals)
+	}
+	s, _ := secrets.Get("consul-token", metav1.GetOptions{})
+	if string(s.Data["token"]) != "token-0" || s.Annotations[LeaseExpiresAnnotation] == expires {
+		t.Fatalf("expected the renewed lease to be recorded: %v %v", s.Data, s.Annotations)
+	}
+
+	// once vault won't extend the lease, a new token is read.
+	s.Annotations[LastSyncedAnnotation] = now.Add(-50 * time.Minute).Format(time.RFC3339)
+	s.Annotations[LeaseExpiresAnnotation] = expires
+	secrets.Update(s)
+	vaultClient.renewTTL = 300
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if vaultClient.reads != 1 {
+		t.Fatalf("expected a new token to be read, got %d reads", vaultClient.reads)
+	}
+	s, _ = secrets.Get("consul-token", metav1.GetOptions{})
+	if string(s.Data["token"]) != "token-1" {
+		t.Fatalf("unexpected data: %v", s.Data)
+	}
+}
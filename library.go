@@ -0,0 +1,80 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// New returns a Reflector configured entirely by options, for controllers
+// embedding pentagon rather than running its binary.  WithVault and either
+// WithKubernetes or WithSecretClient are required.  Secrets are written to DefaultNamespace
+// with the DefaultLabelValue label unless WithNamespace and WithLabel say
+// otherwise.  Background work started by options, like the cache of
+// WithCache, stops when ctx is done.
+func New(ctx context.Context, opts ...Option) (*Reflector, error) {
+	r := newReflector()
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.vaultClient == nil {
+		return nil, fmt.Errorf("a vault client is required, see WithVault")
+	}
+	if r.k8sClient == nil {
+		if r.secretClient == nil {
+			return nil, fmt.Errorf("a kubernetes client is required, see WithKubernetes")
+		}
+		if r.useCache || r.informerStop != nil {
+			return nil, fmt.Errorf("caching secrets requires a kubernetes client")
+		}
+	}
+
+	r.start(ctx.Done())
+
+	return r, nil
+}
+
+// WithVault sets the client used to read vault secrets.
+func WithVault(client vault.Logical) Option {
+	return func(r *Reflector) {
+		r.vaultClient = client
+	}
+}
+
+// WithKubernetes sets the client used to manage k8s secrets.
+func WithKubernetes(client kubernetes.Interface) Option {
+	return func(r *Reflector) {
+		r.k8sClient = client
+	}
+}
+
+// WithNamespace sets the namespace of the k8s secrets.
+func WithNamespace(namespace string) Option {
+	return func(r *Reflector) {
+		r.k8sNamespace = namespace
+	}
+}
+
+// WithLabel sets the value of the LabelKey label of the k8s secrets.  Like
+// with the label configuration, a value other than DefaultLabelValue makes
+// Reflect delete the secrets with the label that are no longer mapped.
+func WithLabel(value string) Option {
+	return func(r *Reflector) {
+		r.labelValue = value
+	}
+}
+
+// WithCache makes the reflector keep a cache of the secrets it manages up
+// to date rather than listing them on every pass, like WithInformer.  The
+// cache runs until the context passed to New is done, or forever with
+// NewReflector.
+func WithCache() Option {
+	return func(r *Reflector) {
+		r.useCache = true
+	}
+}
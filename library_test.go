@@ -0,0 +1,59 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestNew(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := New(ctx, WithKubernetes(k8sfake.NewSimpleClientset()))
+	if err == nil {
+		t.Fatal("a reflector without a vault client should be refused")
+	}
+
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	r, err := New(
+		ctx,
+		WithVault(vaultClient),
+		WithKubernetes(k8sClient),
+		WithNamespace("team"),
+		WithLabel("embedded"),
+		WithWorkers(2),
+		WithCache(),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+
+	err = r.Reflect(ctx, []Mapping{{
+		VaultPath:       "secrets/data/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV2,
+	}})
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	s, err := k8sClient.CoreV1().Secrets("team").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be in the team namespace: %s", err)
+	}
+	if s.Labels[LabelKey] != "embedded" || s.Annotations[OwnerAnnotation] != "embedded" {
+		t.Fatalf("unexpected metadata: %v %v", s.Labels, s.Annotations)
+	}
+}
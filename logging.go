@@ -0,0 +1,61 @@
+package pentagon
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// LogLevel selects which messages are logged.
+type LogLevel string
+
+const (
+	// LogLevelDebug also logs the details of reflecting every mapping.
+	LogLevelDebug LogLevel = "debug"
+
+	// LogLevelInfo logs the outcome of every mapping.  It is the default.
+	LogLevelInfo LogLevel = "info"
+
+	// LogLevelWarn only logs failures, warnings and the summary of passes.
+	LogLevelWarn LogLevel = "warn"
+)
+
+// logLevels orders the log levels by verbosity.
+var logLevels = map[LogLevel]int32{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+}
+
+// currentLogLevel is the order of the level set with SetLogLevel.
+var currentLogLevel = logLevels[LogLevelInfo]
+
+// SetLogLevel sets the level of the messages logged by pentagon.  It can be
+// called at any time.
+func SetLogLevel(level LogLevel) error {
+	order, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("unknown log level: %q", level)
+	}
+	atomic.StoreInt32(&currentLogLevel, order)
+	return nil
+}
+
+// logEnabled returns whether messages of level are logged.
+func logEnabled(level LogLevel) bool {
+	return logLevels[level] >= atomic.LoadInt32(&currentLogLevel)
+}
+
+// debugf logs a message with LogLevelDebug.
+func debugf(format string, args ...interface{}) {
+	if logEnabled(LogLevelDebug) {
+		log.Printf(format, args...)
+	}
+}
+
+// infof logs a message with LogLevelInfo.
+func infof(format string, args ...interface{}) {
+	if logEnabled(LogLevelInfo) {
+		log.Printf(format, args...)
+	}
+}
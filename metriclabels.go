@@ -0,0 +1,154 @@
+package pentagon
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricLabels selects the value of the secret label of per-mapping
+// metrics, bounding their cardinality on large configurations.
+type MetricLabels string
+
+const (
+	// MetricLabelsMapping labels the metrics of every mapping with its
+	// secret name.
+	MetricLabelsMapping MetricLabels = "mapping"
+
+	// MetricLabelsAggregate labels the metrics of every mapping with
+	// OtherSecretsLabel, leaving a single series per metric.
+	MetricLabelsAggregate MetricLabels = "aggregate"
+
+	// MetricLabelsTopFailures labels the metrics of the mappings that failed
+	// the most with their secret names and those of the other mappings with
+	// OtherSecretsLabel.
+	MetricLabelsTopFailures MetricLabels = "topFailures"
+)
+
+// OtherSecretsLabel is the secret label of the metrics of mappings that
+// don't have series of their own.  It can't be the name of a secret.
+const OtherSecretsLabel = "_other"
+
+// WithMetricLabels selects how the per-mapping metrics are labelled.  With
+// MetricLabelsTopFailures, the top mappings with the most failures keep
+// their own series; the ranking is updated after every call to Reflect or
+// Sync.  The default is MetricLabelsMapping.
+func WithMetricLabels(labels MetricLabels, top int) Option {
+	return func(r *Reflector) {
+		r.metricLabels = labels
+		r.topFailures = top
+	}
+}
+
+// metricLabel returns the secret label of the metrics of the mapping of the
+// secret named name.
+func (r *Reflector) metricLabel(name string) string {
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	return r.metricLabelLocked(name)
+}
+
+// metricLabelLocked is metricLabel for callers holding metricsMu.
+func (r *Reflector) metricLabelLocked(name string) string {
+	switch r.metricLabels {
+	case MetricLabelsAggregate:
+		return OtherSecretsLabel
+	case MetricLabelsTopFailures:
+		if _, ok := r.topFailed[name]; ok {
+			return name
+		}
+		return OtherSecretsLabel
+	default:
+		return name
+	}
+}
+
+// recordFailure counts a failure of the mapping of the secret named name.
+func (r *Reflector) recordFailure(name string) {
+	mappingFailuresCounter.WithLabelValues(r.metricLabel(name)).Inc()
+
+	if r.metricLabels != MetricLabelsTopFailures {
+		return
+	}
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	r.failureCounts[name]++
+}
+
+// rankFailures updates the mappings that have series of their own with
+// MetricLabelsTopFailures.  Ties go to the first secret name.
+func (r *Reflector) rankFailures() {
+	if r.metricLabels != MetricLabelsTopFailures {
+		return
+	}
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+
+	names := make([]string, 0, len(r.failureCounts))
+	for name := range r.failureCounts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := r.failureCounts[names[i]], r.failureCounts[names[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > r.topFailures {
+		names = names[:r.topFailures]
+	}
+
+	r.topFailed = make(map[string]struct{}, len(names))
+	for _, name := range names {
+		r.topFailed[name] = struct{}{}
+	}
+}
+
+// setPausedMetric records whether the mapping of the secret named name is
+// paused.
+func (r *Reflector) setPausedMetric(name string, paused bool) {
+	r.setMappingGauge(pausedMappingsGauge, r.pausedLabels, name, paused)
+}
+
+// setVersionMetric records version, the key/value v2 version reflected into
+// the secret named name.  Versions can't be aggregated, so mappings without
+// a series of their own, or reflected from other engines, have none.
+func (r *Reflector) setVersionMetric(name, version string) {
+	v, err := strconv.ParseInt(version, 10, 64)
+	if err != nil || r.metricLabel(name) != name {
+		mappingVersionGauge.DeleteLabelValues(name)
+		return
+	}
+	mappingVersionGauge.WithLabelValues(name).Set(float64(v))
+}
+
+// setMappingGauge records whether the mapping of the secret named name is
+// in a state counted by gauge, with labels holding the label of every
+// mapping in that state.  The gauge counts the mappings sharing a label,
+// which is 1 when mappings have their own labels.
+func (r *Reflector) setMappingGauge(
+	gauge *prometheus.GaugeVec,
+	labels map[string]string,
+	name string,
+	set bool,
+) {
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+
+	label, wasSet := labels[name]
+	switch {
+	case set && !wasSet:
+		label = r.metricLabelLocked(name)
+		labels[name] = label
+		gauge.WithLabelValues(label).Inc()
+	case !set && wasSet:
+		delete(labels, name)
+		if label == name {
+			gauge.DeleteLabelValues(label)
+		} else {
+			gauge.WithLabelValues(label).Dec()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestMetricLabels(t *testing.T) {
+	r := newReflector()
+	if label := r.metricLabel("foo"); label != "foo" {
+		t.Errorf("expected mappings to have their own label by default, got %q", label)
+	}
+
+	WithMetricLabels(MetricLabelsAggregate, 0)(r)
+	if label := r.metricLabel("foo"); label != OtherSecretsLabel {
+		t.Errorf("expected aggregated label, got %q", label)
+	}
+}
+
+func TestMetricLabelsTopFailures(t *testing.T) {
+	r := newReflector()
+	WithMetricLabels(MetricLabelsTopFailures, 1)(r)
+
+	r.recordFailure("foo")
+	r.recordFailure("foo")
+	r.recordFailure("bar")
+
+	// the ranking only changes between passes.
+	if label := r.metricLabel("foo"); label != OtherSecretsLabel {
+		t.Errorf("expected foo to be aggregated before ranking, got %q", label)
+	}
+
+	r.rankFailures()
+	for name, expected := range map[string]string{
+		"foo": "foo",
+		"bar": OtherSecretsLabel,
+		"baz": OtherSecretsLabel,
+	} {
+		if label := r.metricLabel(name); label != expected {
+			t.Errorf("expected %s to be labelled %q, got %q", name, expected, label)
+		}
+	}
+}
+
+func TestPausedMetricAggregate(t *testing.T) {
+	r := newReflector()
+	WithMetricLabels(MetricLabelsAggregate, 0)(r)
+	gauge := pausedMappingsGauge.WithLabelValues(OtherSecretsLabel)
+
+	r.setPausedMetric("foo", true)
+	r.setPausedMetric("bar", true)
+	r.setPausedMetric("foo", true)
+	if v := testutil.ToFloat64(gauge); v != 2 {
+		t.Errorf("expected 2 paused mappings, got %v", v)
+	}
+
+	r.setPausedMetric("foo", false)
+	if v := testutil.ToFloat64(gauge); v != 1 {
+		t.Errorf("expected 1 paused mapping, got %v", v)
+	}
+}
+
+func TestVersionMetric(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/versioned", map[string]interface{}{"foo": "bar"})
+	vaultClient.Write("secrets/data/versioned", map[string]interface{}{"foo": "baz"})
+
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(NewFakeSecrets()),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	err = r.Reflect(context.Background(), []Mapping{{
+		VaultPath:       "secrets/data/versioned",
+		SecretName:      "versioned",
+		VaultEngineType: vault.EngineTypeKeyValueV2,
+	}})
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if v := testutil.ToFloat64(mappingVersionGauge.WithLabelValues("versioned")); v != 2 {
+		t.Errorf("expected version 2 to be reflected, got %v", v)
+	}
+
+	// versions of aggregated mappings aren't exported.
+	WithMetricLabels(MetricLabelsAggregate, 0)(r)
+	r.setVersionMetric("versioned", "3")
+	if mappingVersionGauge.DeleteLabelValues("versioned") {
+		t.Error("expected the version of an aggregated mapping to be removed")
+	}
+	if mappingVersionGauge.DeleteLabelValues(OtherSecretsLabel) {
+		t.Error("expected no version for aggregated mappings")
+	}
+}
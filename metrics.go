@@ -0,0 +1,81 @@
+package pentagon
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var optionalMissingCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pentagon_optional_secret_missing_total",
+	Help: "Number of times the vault secret for an optional mapping was not found",
+}, []string{"secret"})
+
+var skippedMappingsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_skipped_mappings",
+	Help: "Number of mappings skipped by the last pass because it was cancelled or ran out of time",
+})
+
+var unchangedSecretsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_unchanged_secrets",
+	Help: "Number of secrets that were already up to date in the last pass",
+})
+
+var recreatedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "pentagon_recreated_secrets_total",
+	Help: "Number of deleted secrets that were re-created without waiting for the next pass",
+})
+
+var requeuedMappingsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "pentagon_requeued_mappings_total",
+	Help: "Number of times a failed mapping was queued to be retried by the controller",
+})
+
+var pausedMappingsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pentagon_mapping_paused",
+	Help: "Number of paused mappings, 1 for the secret of every paused mapping unless metric labels are aggregated",
+}, []string{"secret"})
+
+var mappingFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pentagon_mapping_failures_total",
+	Help: "Number of times reflecting a mapping failed, after retries",
+}, []string{"secret"})
+
+var staleMappingsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pentagon_mapping_stale",
+	Help: "Number of mappings that weren't reflected successfully within their maxAge, 1 for the secret of every stale mapping unless metric labels are aggregated",
+}, []string{"secret"})
+
+var managedSecretsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pentagon_managed_secrets",
+	Help: "Number of mapped secrets that exist after the last pass",
+}, []string{"namespace"})
+
+var orphanedSecretsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pentagon_orphaned_secrets",
+	Help: "Number of secrets labeled for this instance that no mapping refers to, which reconciliation deletes",
+}, []string{"namespace"})
+
+var sourceDeletedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pentagon_mapping_source_deleted",
+	Help: "Number of mappings whose key/value v2 secret is deleted in vault, 1 for the secret of every such mapping unless metric labels are aggregated",
+}, []string{"secret"})
+
+var certificateExpiryGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pentagon_certificate_expiry_timestamp",
+	Help: "Unix time at which the earliest PEM certificate in the secret of a mapping expires, of all of the mappings sharing the label if metric labels are aggregated",
+}, []string{"secret"})
+
+var mappingVersionGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pentagon_mapping_vault_version",
+	Help: "Version of the key/value v2 secret currently reflected into the secret of a mapping, for the mappings with a series of their own",
+}, []string{"secret"})
+
+var verificationFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pentagon_write_verification_failures_total",
+	Help: "Number of times a secret read back after being written didn't hold the data written",
+}, []string{"secret"})
+
+var leaseRenewalsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pentagon_lease_renewals_total",
+	Help: "Number of attempts to renew the vault lease of the credentials in a secret, by result",
+}, []string{"result"})
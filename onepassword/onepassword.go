@@ -0,0 +1,247 @@
+// Package onepassword reads items from a 1Password Connect server, so that
+// pentagon mappings can reflect them like vault secrets.
+package onepassword
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// maxResponseSize bounds the size of a response of the Connect server.
+const maxResponseSize = 16 << 20
+
+// idPattern matches the IDs of 1Password vaults and items, which are used
+// as is rather than looked up by name.
+var idPattern = regexp.MustCompile(`^[a-z0-9]{26}$`)
+
+// Client reads items from a 1Password Connect server.  It implements
+// vault.Logical, reading paths of the form "<vault>/<item>" as a secret
+// with a key for every field of the item, named after the field's label,
+// and "<vault>/<item>/<field>" as a secret with only that field.  Vaults,
+// items and fields are addressed by name (or label) or by ID.  Items that
+// don't exist are read as nil, like missing vault secrets.
+type Client struct {
+	url        string
+	token      func() (string, error)
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	vaults map[string]string
+}
+
+var (
+	_ vault.Logical       = (*Client)(nil)
+	_ vault.ContextReader = (*Client)(nil)
+)
+
+// NewClient returns a Client of the Connect server at serverURL,
+// authenticating with the access token returned by token, which is called
+// for every request so that the token can be rotated.  A nil httpClient
+// uses http.DefaultClient.
+func NewClient(
+	serverURL string,
+	token func() (string, error),
+	httpClient *http.Client,
+) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		url:        strings.TrimSuffix(serverURL, "/"),
+		token:      token,
+		httpClient: httpClient,
+		vaults:     map[string]string{},
+	}
+}
+
+// item is an item of the Connect API.
+type item struct {
+	ID     string  `json:"id"`
+	Title  string  `json:"title"`
+	Fields []field `json:"fields"`
+}
+
+// field is a field of an item.
+type field struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Read reads path, see Client.
+func (c *Client) Read(path string) (*api.Secret, error) {
+	return c.ReadWithContext(context.Background(), path)
+}
+
+// ReadWithContext reads path, giving up when ctx is done.
+func (c *Client) ReadWithContext(ctx context.Context, path string) (*api.Secret, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf(
+			"invalid 1Password path %q, must be <vault>/<item> or <vault>/<item>/<field>",
+			path,
+		)
+	}
+
+	vaultID, err := c.vaultID(ctx, parts[0])
+	if err != nil || vaultID == "" {
+		return nil, err
+	}
+	itemID, err := c.itemID(ctx, vaultID, parts[1])
+	if err != nil || itemID == "" {
+		return nil, err
+	}
+
+	var it item
+	found, err := c.get(ctx, fmt.Sprintf("/v1/vaults/%s/items/%s", vaultID, itemID), nil, &it)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	data := map[string]interface{}{}
+	for _, f := range it.Fields {
+		if f.Label == "" {
+			continue
+		}
+		if len(parts) == 3 {
+			if f.Label == parts[2] || f.ID == parts[2] {
+				data[f.Label] = f.Value
+				break
+			}
+			continue
+		}
+		// the first of the fields sharing a label is kept.
+		if _, ok := data[f.Label]; !ok {
+			data[f.Label] = f.Value
+		}
+	}
+	if len(parts) == 3 && len(data) == 0 {
+		return nil, nil
+	}
+	return &api.Secret{Data: data}, nil
+}
+
+// Write fails, 1Password items are only read.
+func (c *Client) Write(path string, data map[string]interface{}) (*api.Secret, error) {
+	return nil, fmt.Errorf("can't write %s, 1Password items are read-only", path)
+}
+
+// vaultID returns the ID of the vault named name, or name if it's an ID.
+// Each name is only looked up once.  It returns "" if the vault doesn't
+// exist.
+func (c *Client) vaultID(ctx context.Context, name string) (string, error) {
+	if idPattern.MatchString(name) {
+		return name, nil
+	}
+
+	c.mu.Lock()
+	id, ok := c.vaults[name]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var vaults []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	filter := url.Values{"filter": {fmt.Sprintf("name eq %q", name)}}
+	if _, err := c.get(ctx, "/v1/vaults", filter, &vaults); err != nil {
+		return "", err
+	}
+	for _, v := range vaults {
+		if v.Name == name {
+			c.mu.Lock()
+			c.vaults[name] = v.ID
+			c.mu.Unlock()
+			return v.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// itemID returns the ID of the item titled title in the vault vaultID, or
+// title if it's an ID.  It returns "" if the item doesn't exist.
+func (c *Client) itemID(ctx context.Context, vaultID, title string) (string, error) {
+	if idPattern.MatchString(title) {
+		return title, nil
+	}
+
+	var items []item
+	filter := url.Values{"filter": {fmt.Sprintf("title eq %q", title)}}
+	path := fmt.Sprintf("/v1/vaults/%s/items", vaultID)
+	if _, err := c.get(ctx, path, filter, &items); err != nil {
+		return "", err
+	}
+	for _, it := range items {
+		if it.Title == title {
+			return it.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// get decodes the response to a GET request of path with the query
+// params into v, and returns false if the server answered 404.  Errors of
+// requests the server refused include "Code: 403" like vault's, so that
+// vault.IsPermissionDenied recognizes them.
+func (c *Client) get(ctx context.Context, path string, params url.Values, v interface{}) (bool, error) {
+	token, err := c.token()
+	if err != nil {
+		return false, fmt.Errorf("error getting the 1Password Connect token: %s", err)
+	}
+
+	u := c.url + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return false, fmt.Errorf("error reading response of %s: %s", path, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &apiErr)
+		return false, fmt.Errorf(
+			"error requesting %s from 1Password Connect: Code: %d. Errors: %s",
+			path,
+			resp.StatusCode,
+			apiErr.Message,
+		)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return false, fmt.Errorf("error decoding response of %s: %s", path, err)
+	}
+	return true, nil
+}
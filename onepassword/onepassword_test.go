@@ -0,0 +1,123 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+const (
+	vaultID = "aaaaaaaaaaaaaaaaaaaaaaaaaa"
+	itemID  = "bbbbbbbbbbbbbbbbbbbbbbbbbb"
+
+	// forbiddenID is an item the token can't read.
+	forbiddenID = "cccccccccccccccccccccccccc"
+)
+
+// connect returns a Connect server with a vault named "infra" holding an
+// item titled "db", and counts the vaults looked up in lookups.
+func connect(t *testing.T, lookups *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":401,"message":"Invalid token signature"}`))
+			return
+		}
+
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/vaults":
+			*lookups++
+			if r.URL.Query().Get("filter") != `name eq "infra"` {
+				response = []interface{}{}
+				break
+			}
+			response = []map[string]string{{"id": vaultID, "name": "infra"}}
+		case "/v1/vaults/" + vaultID + "/items":
+			if r.URL.Query().Get("filter") != `title eq "db"` {
+				response = []interface{}{}
+				break
+			}
+			response = []map[string]string{{"id": itemID, "title": "db"}}
+		case "/v1/vaults/" + vaultID + "/items/" + itemID:
+			response = map[string]interface{}{
+				"id":    itemID,
+				"title": "db",
+				"fields": []map[string]string{
+					{"id": "username", "label": "username", "value": "admin"},
+					{"id": "password", "label": "password", "value": "hunter2"},
+					{"id": "notesPlain", "label": "", "value": "ignored"},
+					{"id": "other", "label": "username", "value": "shadowed"},
+				},
+			}
+		case "/v1/vaults/" + vaultID + "/items/" + forbiddenID:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"status":403,"message":"Authorization: token doesn't have access"}`))
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status":404,"message":"not found"}`))
+			return
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("unable to encode response: %s", err)
+		}
+	}))
+}
+
+func TestRead(t *testing.T) {
+	lookups := 0
+	server := connect(t, &lookups)
+	defer server.Close()
+
+	client := NewClient(server.URL, func() (string, error) { return "secret-token", nil }, nil)
+
+	for _, tbl := range []struct {
+		path     string
+		expected map[string]interface{}
+	}{
+		{"infra/db", map[string]interface{}{"username": "admin", "password": "hunter2"}},
+		{"infra/db/password", map[string]interface{}{"password": "hunter2"}},
+		{vaultID + "/" + itemID, map[string]interface{}{"username": "admin", "password": "hunter2"}},
+		{"infra/db/missing", nil},
+		{"infra/missing", nil},
+		{"missing/db", nil},
+	} {
+		secret, err := client.Read(tbl.path)
+		if err != nil {
+			t.Errorf("unable to read %s: %s", tbl.path, err)
+			continue
+		}
+		if tbl.expected == nil {
+			if secret != nil {
+				t.Errorf("%s shouldn't exist: %v", tbl.path, secret.Data)
+			}
+			continue
+		}
+		if secret == nil || !reflect.DeepEqual(secret.Data, tbl.expected) {
+			t.Errorf("unexpected data of %s: %v", tbl.path, secret)
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("expected infra to be looked up once and missing once, got %d lookups", lookups)
+	}
+
+	if _, err := client.Read("infra"); err == nil {
+		t.Error("a path without an item should be invalid")
+	}
+	if _, err := client.Read("infra/" + forbiddenID); !vault.IsPermissionDenied(err) {
+		t.Errorf("expected a permission denied error, got %v", err)
+	}
+	if _, err := client.Write("infra/db", nil); err == nil {
+		t.Error("writes should fail")
+	}
+
+	client = NewClient(server.URL, func() (string, error) { return "wrong", nil }, nil)
+	if _, err := client.Read("infra/db"); err == nil {
+		t.Error("reads with the wrong token should fail")
+	}
+}
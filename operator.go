@@ -0,0 +1,388 @@
+package pentagon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// MappingResource is the PentagonMapping custom resource.  Each one maps a
+// vault secret to a k8s secret in the resource's own namespace.
+var MappingResource = schema.GroupVersionResource{
+	Group:    "pentagon.vimeo.com",
+	Version:  "v1alpha1",
+	Resource: "pentagonmappings",
+}
+
+// Operator reflects the mappings defined by PentagonMapping resources in
+// every namespace, alongside the mappings from the configuration file.
+type Operator struct {
+	client       dynamic.Interface
+	namespace    string
+	defaults     Mapping
+	prefixes     []string
+	newReflector func(namespace string, opts ...Option) *Reflector
+
+	mu         sync.Mutex
+	reflectors map[string]*Reflector
+
+	// results holds the latest result of every mapping keyed by namespace
+	// and secret name.
+	results map[string]map[string]SyncResult
+}
+
+// NewOperator returns an Operator listing PentagonMapping resources with
+// client.  Mappings passed to Reflect go to namespace.  The engine type and
+// strictness of defaults apply to resources that don't set them.  Unless
+// prefixes is empty, resources are only accepted when their vault paths
+// start with one of them, with NamespacePlaceholder replaced by the
+// resource's namespace.  newReflector creates the reflector for each
+// namespace with the extra options passed.
+func NewOperator(
+	client dynamic.Interface,
+	namespace string,
+	defaults Mapping,
+	prefixes []string,
+	newReflector func(namespace string, opts ...Option) *Reflector,
+) *Operator {
+	return &Operator{
+		client:       client,
+		namespace:    namespace,
+		defaults:     defaults,
+		prefixes:     prefixes,
+		newReflector: newReflector,
+		reflectors:   map[string]*Reflector{},
+		results:      map[string]map[string]SyncResult{},
+	}
+}
+
+// Reflector returns the reflector for namespace, creating it if needed.
+func (o *Operator) Reflector(namespace string) *Reflector {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	r, ok := o.reflectors[namespace]
+	if !ok {
+		o.results[namespace] = map[string]SyncResult{}
+		r = o.newReflector(namespace, WithResults(func(res SyncResult) {
+			o.mu.Lock()
+			o.results[namespace][res.Mapping.SecretName] = res
+			o.mu.Unlock()
+		}))
+		o.reflectors[namespace] = r
+	}
+	return r
+}
+
+// Reflect reflects mappings into the operator's namespace and the mappings
+// of every PentagonMapping resource into its own namespace.  A failure in
+// one namespace doesn't stop the others from being reflected.  Namespaces
+// whose resources were all removed are still reflected so that their
+// secrets get reconciled, after which their reflectors are stopped and
+// removed.  The status of every resource is updated with the result of its
+// mapping.
+func (o *Operator) Reflect(ctx context.Context, mappings []Mapping) error {
+	list, err := o.client.Resource(MappingResource).Namespace("").List(
+		metav1.ListOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("error listing PentagonMappings: %s", err)
+	}
+
+	byNamespace := groupMappings(list, o.defaults, o.prefixes)
+	owners := resourceOwners(list, o.defaults, o.prefixes)
+	byNamespace[o.namespace] = append(byNamespace[o.namespace], mappings...)
+
+	// only the results of this pass are reported in statuses.
+	o.mu.Lock()
+	for namespace := range o.reflectors {
+		o.results[namespace] = map[string]SyncResult{}
+		if _, ok := byNamespace[namespace]; !ok {
+			byNamespace[namespace] = []Mapping{}
+		}
+	}
+	o.mu.Unlock()
+
+	namespaces := make([]string, 0, len(byNamespace))
+	for namespace := range byNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	failures := []string{}
+	unmapped := []string{}
+	for _, namespace := range namespaces {
+		r := o.Reflector(namespace)
+		r.setResourceOwners(owners[namespace])
+		err := r.Reflect(ctx, byNamespace[namespace])
+		if err != nil {
+			log.Printf("error reflecting namespace %s: %s", namespace, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", namespace, err))
+		} else if len(byNamespace[namespace]) == 0 {
+			unmapped = append(unmapped, namespace)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	o.updateStatuses(list)
+	o.remove(unmapped)
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"%d of %d namespaces failed: %s",
+			len(failures),
+			len(namespaces),
+			strings.Join(failures, "; "),
+		)
+	}
+	return nil
+}
+
+// remove stops and removes the reflectors of namespaces, except for the
+// operator's namespace.
+func (o *Operator) remove(namespaces []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, namespace := range namespaces {
+		r, ok := o.reflectors[namespace]
+		if !ok || namespace == o.namespace {
+			continue
+		}
+		r.stop()
+		delete(o.reflectors, namespace)
+		delete(o.results, namespace)
+	}
+}
+
+// updateStatuses sets the status of every resource whose mapping was
+// reflected, and of invalid resources.  Failing to update a status doesn't
+// fail the pass.
+func (o *Operator) updateStatuses(list *unstructured.UnstructuredList) {
+	now := time.Now().UTC()
+	for i := range list.Items {
+		item := &list.Items[i]
+
+		var res SyncResult
+		m, err := resourceMapping(item, o.defaults, o.prefixes)
+		if err != nil {
+			res = SyncResult{Err: fmt.Errorf("invalid mapping: %s", err)}
+		} else {
+			var ok bool
+			o.mu.Lock()
+			res, ok = o.results[item.GetNamespace()][m.SecretName]
+			o.mu.Unlock()
+			if !ok {
+				continue
+			}
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"status": resourceStatus(item, res, now),
+		})
+		if err != nil {
+			log.Printf("error encoding status of %s/%s: %s", item.GetNamespace(), item.GetName(), err)
+			continue
+		}
+
+		_, err = o.client.Resource(MappingResource).
+			Namespace(item.GetNamespace()).
+			Patch(item.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+		if err != nil {
+			log.Printf("error updating status of %s/%s: %s", item.GetNamespace(), item.GetName(), err)
+		}
+	}
+}
+
+// resourceStatus returns the status of a PentagonMapping given the result
+// of its mapping.  The last sync time and synced version are kept from the
+// previous status after a failure or while paused, and condition transition
+// times only change along with their status.
+func resourceStatus(
+	item *unstructured.Unstructured,
+	res SyncResult,
+	now time.Time,
+) map[string]interface{} {
+	status, _, _ := unstructured.NestedMap(item.Object, "status")
+	if status == nil {
+		status = map[string]interface{}{}
+	}
+	status["observedGeneration"] = item.GetGeneration()
+
+	ready := map[string]interface{}{
+		"type":    "Ready",
+		"status":  "True",
+		"reason":  "Synced",
+		"message": "",
+	}
+	failed := map[string]interface{}{
+		"type":    "SyncFailed",
+		"status":  "False",
+		"reason":  "Synced",
+		"message": "",
+	}
+	if res.Err != nil {
+		ready["status"] = "False"
+		ready["reason"] = "SyncFailed"
+		ready["message"] = res.Err.Error()
+		failed["status"] = "True"
+		failed["reason"] = "SyncFailed"
+		failed["message"] = res.Err.Error()
+	} else if res.Paused {
+		ready["reason"] = "Paused"
+		ready["message"] = "syncing is paused"
+		failed["reason"] = "Paused"
+	} else {
+		status["lastSyncTime"] = now.Format(time.RFC3339)
+		if res.Version != "" {
+			status["syncedVersion"] = res.Version
+		}
+	}
+	status["paused"] = res.Paused
+
+	previous, _, _ := unstructured.NestedSlice(status, "conditions")
+	conditions := []interface{}{}
+	for _, c := range []map[string]interface{}{ready, failed} {
+		c["lastTransitionTime"] = now.Format(time.RFC3339)
+		for _, p := range previous {
+			prev, ok := p.(map[string]interface{})
+			if ok && prev["type"] == c["type"] && prev["status"] == c["status"] {
+				if t, ok := prev["lastTransitionTime"]; ok {
+					c["lastTransitionTime"] = t
+				}
+			}
+		}
+		conditions = append(conditions, c)
+	}
+	status["conditions"] = conditions
+
+	return status
+}
+
+// groupMappings converts PentagonMapping resources to mappings keyed by
+// namespace.  Invalid resources are logged and left out.
+func groupMappings(
+	list *unstructured.UnstructuredList,
+	defaults Mapping,
+	prefixes []string,
+) map[string][]Mapping {
+	byNamespace := map[string][]Mapping{}
+	for i := range list.Items {
+		item := &list.Items[i]
+		m, err := resourceMapping(item, defaults, prefixes)
+		if err != nil {
+			log.Printf(
+				"ignoring PentagonMapping %s/%s: %s",
+				item.GetNamespace(),
+				item.GetName(),
+				err,
+			)
+			continue
+		}
+		byNamespace[item.GetNamespace()] = append(byNamespace[item.GetNamespace()], m)
+	}
+	return byNamespace
+}
+
+// resourceOwners returns owner references to the valid PentagonMapping
+// resources keyed by namespace and secret name, for WithOwnerReferences.
+func resourceOwners(
+	list *unstructured.UnstructuredList,
+	defaults Mapping,
+	prefixes []string,
+) map[string]map[string]metav1.OwnerReference {
+	owners := map[string]map[string]metav1.OwnerReference{}
+	for i := range list.Items {
+		item := &list.Items[i]
+		m, err := resourceMapping(item, defaults, prefixes)
+		if err != nil {
+			continue
+		}
+		if owners[item.GetNamespace()] == nil {
+			owners[item.GetNamespace()] = map[string]metav1.OwnerReference{}
+		}
+		owners[item.GetNamespace()][m.SecretName] = resourceOwner(item.GetName(), item.GetUID())
+	}
+	return owners
+}
+
+// resourceMapping returns the mapping described by the spec of a
+// PentagonMapping.  The secret name defaults to the resource's name, and the
+// mapping is checked like a discovered one against prefixes.
+func resourceMapping(
+	item *unstructured.Unstructured,
+	defaults Mapping,
+	prefixes []string,
+) (Mapping, error) {
+	m := Mapping{
+		VaultEngineType: defaults.VaultEngineType,
+		Strict:          defaults.Strict,
+	}
+
+	var err error
+	var found bool
+	m.VaultPath, found, err = unstructured.NestedString(item.Object, "spec", "vaultPath")
+	if err != nil {
+		return m, err
+	}
+	if !found || m.VaultPath == "" {
+		return m, fmt.Errorf("spec.vaultPath is required")
+	}
+
+	m.SecretName, found, err = unstructured.NestedString(item.Object, "spec", "secretName")
+	if err != nil {
+		return m, err
+	}
+	if !found || m.SecretName == "" {
+		m.SecretName = item.GetName()
+	}
+
+	engineType, found, err := unstructured.NestedString(item.Object, "spec", "vaultEngineType")
+	if err != nil {
+		return m, err
+	}
+	if found && engineType != "" {
+		m.VaultEngineType = vault.EngineType(engineType)
+	}
+
+	m.Optional, _, err = unstructured.NestedBool(item.Object, "spec", "optional")
+	if err != nil {
+		return m, err
+	}
+
+	strict, found, err := unstructured.NestedBool(item.Object, "spec", "strict")
+	if err != nil {
+		return m, err
+	}
+	if found && strict {
+		m.Strict = true
+	}
+
+	m.RequiredKeys, _, err = unstructured.NestedStringSlice(item.Object, "spec", "requiredKeys")
+	if err != nil {
+		return m, err
+	}
+
+	m.Paused = item.GetAnnotations()[PausedAnnotation] == "true"
+
+	if err := validateDiscovered(m, namespacePrefixes(prefixes, item.GetNamespace())); err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,210 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func mappingResource(namespace, name string, spec map[string]interface{}) unstructured.Unstructured {
+	return unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "pentagon.vimeo.com/v1alpha1",
+			"kind":       "PentagonMapping",
+			"metadata": map[string]interface{}{
+				"namespace": namespace,
+				"name":      name,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func TestGroupMappings(t *testing.T) {
+	list := &unstructured.UnstructuredList{
+		Items: []unstructured.Unstructured{
+			mappingResource("team-a", "db", map[string]interface{}{
+				"vaultPath": "secrets/data/a/db",
+			}),
+			mappingResource("team-a", "api", map[string]interface{}{
+				"vaultPath":       "secrets/data/a/api",
+				"secretName":      "api-key",
+				"vaultEngineType": "kv-v2",
+				"optional":        true,
+				"requiredKeys":    []interface{}{"key"},
+			}),
+			mappingResource("team-b", "broken", map[string]interface{}{
+				"secretName": "no-path",
+			}),
+		},
+	}
+
+	byNamespace := groupMappings(list, Mapping{
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+	}, nil)
+
+	expected := map[string][]Mapping{
+		"team-a": {
+			{
+				VaultPath:       "secrets/data/a/db",
+				SecretName:      "db",
+				VaultEngineType: vault.EngineTypeKeyValueV1,
+			},
+			{
+				VaultPath:       "secrets/data/a/api",
+				SecretName:      "api-key",
+				VaultEngineType: vault.EngineTypeKeyValueV2,
+				Optional:        true,
+				RequiredKeys:    []string{"key"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(byNamespace, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, byNamespace)
+	}
+}
+
+func TestResourceStatus(t *testing.T) {
+	item := mappingResource("team-a", "db", map[string]interface{}{
+		"vaultPath": "secrets/data/a/db",
+	})
+	synced := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	status := resourceStatus(&item, SyncResult{Version: "3"}, synced)
+	if status["lastSyncTime"] != "2020-01-01T00:00:00Z" || status["syncedVersion"] != "3" {
+		t.Fatalf("unexpected status after a sync: %v", status)
+	}
+	item.Object["status"] = status
+
+	failed := synced.Add(time.Hour)
+	status = resourceStatus(&item, SyncResult{Err: fmt.Errorf("boom")}, failed)
+	if status["lastSyncTime"] != "2020-01-01T00:00:00Z" || status["syncedVersion"] != "3" {
+		t.Fatalf("a failure should keep the last sync: %v", status)
+	}
+
+	for _, c := range status["conditions"].([]interface{}) {
+		condition := c.(map[string]interface{})
+		switch condition["type"] {
+		case "Ready":
+			if condition["status"] != "False" || condition["message"] != "boom" {
+				t.Errorf("unexpected Ready condition: %v", condition)
+			}
+		case "SyncFailed":
+			if condition["status"] != "True" {
+				t.Errorf("unexpected SyncFailed condition: %v", condition)
+			}
+		default:
+			t.Errorf("unexpected condition: %v", condition)
+		}
+		if condition["lastTransitionTime"] != "2020-01-01T01:00:00Z" {
+			t.Errorf("condition should have transitioned: %v", condition)
+		}
+	}
+	item.Object["status"] = status
+
+	// a second failure doesn't change the transition times.
+	status = resourceStatus(&item, SyncResult{Err: fmt.Errorf("boom")}, failed.Add(time.Hour))
+	for _, c := range status["conditions"].([]interface{}) {
+		condition := c.(map[string]interface{})
+		if condition["lastTransitionTime"] != "2020-01-01T01:00:00Z" {
+			t.Errorf("condition should not have transitioned again: %v", condition)
+		}
+	}
+}
+
+func TestResourceMappingPrefixes(t *testing.T) {
+	prefixes := []string{"secrets/data/{namespace}", "secrets/data/shared"}
+
+	for testName, tc := range map[string]struct {
+		namespace string
+		vaultPath string
+		allowed   bool
+	}{
+		"own namespace":     {namespace: "team-a", vaultPath: "secrets/data/team-a/db", allowed: true},
+		"shared":            {namespace: "team-a", vaultPath: "secrets/data/shared/ca", allowed: true},
+		"other namespace":   {namespace: "team-a", vaultPath: "secrets/data/team-b/db"},
+		"sibling namespace": {namespace: "team", vaultPath: "secrets/data/team-a/db"},
+		"parent segment":    {namespace: "team-a", vaultPath: "secrets/data/team-a/../team-b/db"},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			item := mappingResource(tc.namespace, "db", map[string]interface{}{
+				"vaultPath": tc.vaultPath,
+			})
+			_, err := resourceMapping(&item, Mapping{}, prefixes)
+			if tc.allowed && err != nil {
+				t.Fatalf("expected %s to be allowed: %s", tc.vaultPath, err)
+			}
+			if !tc.allowed && err == nil {
+				t.Fatalf("expected %s to be refused", tc.vaultPath)
+			}
+
+			list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{item}}
+			if _, ok := groupMappings(list, Mapping{}, prefixes)[tc.namespace]; ok != tc.allowed {
+				t.Fatalf("expected %s to be reflected: %t", tc.vaultPath, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestOperatorRemovesReflectors(t *testing.T) {
+	item := mappingResource("team-a", "db", map[string]interface{}{
+		"vaultPath": "secrets/data/db",
+	})
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), &item)
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/db", map[string]interface{}{"foo": "bar"})
+
+	operator := NewOperator(
+		dynamicClient,
+		"pentagon",
+		Mapping{VaultEngineType: vault.EngineTypeKeyValueV2},
+		nil,
+		func(namespace string, opts ...Option) *Reflector {
+			return NewReflector(vaultClient, k8sClient, namespace, "test", opts...)
+		},
+	)
+	if err := operator.Reflect(context.Background(), nil); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if _, err := k8sClient.CoreV1().Secrets("team-a").Get("db", metav1.GetOptions{}); err != nil {
+		t.Fatalf("team-a/db should have been reflected: %s", err)
+	}
+	teamA := operator.Reflector("team-a")
+
+	// once its resource is removed, the namespace is reconciled and its
+	// reflector stopped and removed.
+	err := dynamicClient.Resource(MappingResource).Namespace("team-a").Delete("db", &metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("unable to delete the resource: %s", err)
+	}
+	if err := operator.Reflect(context.Background(), nil); err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+	if _, err := k8sClient.CoreV1().Secrets("team-a").Get("db", metav1.GetOptions{}); err == nil {
+		t.Error("team-a/db should have been reconciled")
+	}
+	select {
+	case <-teamA.stopped:
+	default:
+		t.Error("the team-a reflector should have been stopped")
+	}
+	if _, ok := operator.reflectors["team-a"]; ok {
+		t.Error("the team-a reflector should have been removed")
+	}
+	if _, ok := operator.reflectors["pentagon"]; !ok {
+		t.Error("the pentagon reflector should have been kept")
+	}
+}
@@ -0,0 +1,91 @@
+package pentagon
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// OwnerAnnotation records the identity of the pentagon instance that wrote
+// a secret.
+const OwnerAnnotation = "pentagon.vimeo.com/owner"
+
+// WithInstance sets the identity of the reflector, which is recorded in the
+// OwnerAnnotation of the secrets it writes.  It defaults to the label
+// value.  A reflector never updates or deletes a secret that records
+// another identity, even if it has the reflector's label.
+func WithInstance(id string) Option {
+	return func(r *Reflector) {
+		if id != "" {
+			r.instance = id
+		}
+	}
+}
+
+// WithLabels adds labels, e.g. the team or environment of the instance, to
+// every secret the reflector writes, alongside the pentagon label.  A
+// secret that has any of these labels with another value is treated as
+// owned by another instance.
+func WithLabels(labels map[string]string) Option {
+	return func(r *Reflector) {
+		r.labels = make(map[string]string, len(labels))
+		for key, value := range labels {
+			if key != LabelKey {
+				r.labels[key] = value
+			}
+		}
+	}
+}
+
+// secretLabels returns the labels of the secrets the reflector writes.
+func (r *Reflector) secretLabels() map[string]string {
+	secretLabels := make(map[string]string, len(r.labels)+1)
+	for key, value := range r.labels {
+		secretLabels[key] = value
+	}
+	secretLabels[LabelKey] = r.labelValue
+	return secretLabels
+}
+
+// checkOwner returns an error unless secret may be updated or deleted by
+// the reflector, which requires it to have the reflector's label and, if
+// it records an owner or has any of the labels set with WithLabels, the
+// reflector's identity and values for those labels.  Secrets written before
+// owners or labels were recorded only need the pentagon label.
+func (r *Reflector) checkOwner(secret *v1.Secret) error {
+	label, ok := secret.Labels[LabelKey]
+	if !ok {
+		return classify(ErrSecretConflict, fmt.Errorf(
+			"secret %s exists and is not managed by pentagon",
+			secret.Name,
+		))
+	}
+	if label != r.labelValue {
+		return classify(ErrSecretConflict, fmt.Errorf(
+			"secret %s is managed by the pentagon instance with label %q, not %q",
+			secret.Name,
+			label,
+			r.labelValue,
+		))
+	}
+	if owner, ok := secret.Annotations[OwnerAnnotation]; ok && owner != r.instance {
+		return classify(ErrSecretConflict, fmt.Errorf(
+			"secret %s is owned by pentagon instance %q, not %q",
+			secret.Name,
+			owner,
+			r.instance,
+		))
+	}
+	for key, value := range r.labels {
+		if actual, ok := secret.Labels[key]; ok && actual != value {
+			return classify(ErrSecretConflict, fmt.Errorf(
+				"secret %s has the label %s=%s, not %s",
+				secret.Name,
+				key,
+				actual,
+				value,
+			))
+		}
+	}
+	return nil
+}
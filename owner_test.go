@@ -0,0 +1,152 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestOwnership(t *testing.T) {
+	for testName, tbl := range map[string]struct {
+		labels      map[string]string
+		annotations map[string]string
+	}{
+		"unmanaged": {},
+		"other label": {
+			labels: map[string]string{LabelKey: "other"},
+		},
+		"other instance": {
+			labels:      map[string]string{LabelKey: "test"},
+			annotations: map[string]string{OwnerAnnotation: "other"},
+		},
+		"other team": {
+			labels: map[string]string{LabelKey: "test", "team": "other"},
+		},
+	} {
+		tbl := tbl
+		t.Run(testName, func(t *testing.T) {
+			k8sClient := k8sfake.NewSimpleClientset(&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   DefaultNamespace,
+					Labels:      tbl.labels,
+					Annotations: tbl.annotations,
+				},
+				Data: map[string][]byte{"foo": []byte("theirs")},
+			})
+			vaultClient := vault.NewMock(map[string]vault.EngineType{
+				"secrets": vault.EngineTypeKeyValueV1,
+			})
+			vaultClient.Write("secrets/foo", map[string]interface{}{
+				"foo": "ours",
+			})
+
+			r := NewReflector(
+				vaultClient,
+				k8sClient,
+				DefaultNamespace,
+				"test",
+				WithLabels(map[string]string{"team": "ours"}),
+			)
+
+			// neither writing nor reconciling may touch the secret.
+			for _, mappings := range [][]Mapping{
+				{{
+					VaultPath:       "secrets/foo",
+					SecretName:      "foo",
+					VaultEngineType: vault.EngineTypeKeyValueV1,
+				}},
+				{},
+			} {
+				err := r.Reflect(context.Background(), mappings)
+				if tbl.labels[LabelKey] == "test" || len(mappings) > 0 {
+					if err == nil {
+						t.Fatalf("reflecting %d mappings should fail", len(mappings))
+					}
+				}
+
+				s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("foo should still be there: %s", err)
+				}
+				if string(s.Data["foo"]) != "theirs" {
+					t.Fatalf("foo shouldn't have been updated: %s", s.Data["foo"])
+				}
+			}
+		})
+	}
+}
+
+func TestOwnerAnnotation(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test", WithInstance("a"))
+	err := r.Reflect(context.Background(), []Mapping{{
+		VaultPath:       "secrets/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+	}})
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if s.Annotations[OwnerAnnotation] != "a" {
+		t.Fatalf("unexpected owner: %q", s.Annotations[OwnerAnnotation])
+	}
+}
+
+func TestLabels(t *testing.T) {
+	// secrets written before labels were added are adopted.
+	k8sClient := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: DefaultNamespace,
+			Labels:    map[string]string{LabelKey: "test"},
+		},
+	})
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		"test",
+		WithLabels(map[string]string{"team": "a", "environment": "prod"}),
+	)
+	err := r.Reflect(context.Background(), []Mapping{{
+		VaultPath:       "secrets/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+	}})
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if s.Labels[LabelKey] != "test" || s.Labels["team"] != "a" || s.Labels["environment"] != "prod" {
+		t.Fatalf("unexpected labels: %v", s.Labels)
+	}
+}
@@ -0,0 +1,105 @@
+package pentagon
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WithOwnerReferences sets an owner reference on every secret the reflector
+// writes, so that kubernetes garbage collects the secrets along with their
+// owner.  Secrets of PentagonMapping resources are owned by their resource
+// and the others by anchor, which must be in the reflector's namespace.
+// Without an anchor, the other secrets have no owner.
+func WithOwnerReferences(anchor *metav1.OwnerReference) Option {
+	return func(r *Reflector) {
+		r.ownerReferences = true
+		r.anchor = anchor
+	}
+}
+
+// Anchor returns an owner reference to the ConfigMap named name in
+// namespace, creating the ConfigMap if it doesn't exist, for use with
+// WithOwnerReferences.
+func Anchor(
+	client kubernetes.Interface,
+	namespace string,
+	name string,
+) (*metav1.OwnerReference, error) {
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+		})
+		if errors.IsAlreadyExists(err) {
+			cm, err = configMaps.Get(name, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting anchor ConfigMap %s: %s", name, err)
+	}
+
+	return &metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Name:       cm.Name,
+		UID:        cm.UID,
+	}, nil
+}
+
+// setResourceOwners records the PentagonMapping resources owning the
+// secrets of the reflector keyed by secret name, for the next pass.
+func (r *Reflector) setResourceOwners(owners map[string]metav1.OwnerReference) {
+	r.ownersMu.Lock()
+	defer r.ownersMu.Unlock()
+	r.resourceOwners = owners
+}
+
+// secretOwners returns the owner references of the secret named name.
+func (r *Reflector) secretOwners(name string) []metav1.OwnerReference {
+	if !r.ownerReferences {
+		return nil
+	}
+
+	r.ownersMu.Lock()
+	owner, ok := r.resourceOwners[name]
+	r.ownersMu.Unlock()
+	if ok {
+		return []metav1.OwnerReference{owner}
+	}
+	if r.anchor != nil {
+		return []metav1.OwnerReference{*r.anchor}
+	}
+	return nil
+}
+
+// resourceOwner returns an owner reference to a PentagonMapping.
+func resourceOwner(name string, uid types.UID) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: MappingResource.GroupVersion().String(),
+		Kind:       "PentagonMapping",
+		Name:       name,
+		UID:        uid,
+	}
+}
+
+// ownersEqual returns true if a and b reference the same owners.
+func ownersEqual(a, b []metav1.OwnerReference) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].UID != b[i].UID {
+			return false
+		}
+	}
+	return true
+}
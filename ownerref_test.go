@@ -0,0 +1,98 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestOwnerReferences(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pentagon-test",
+			Namespace: DefaultNamespace,
+			UID:       "anchor-uid",
+		},
+	})
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{"foo": "bar"})
+	vaultClient.Write("secrets/data/bar", map[string]interface{}{"foo": "bar"})
+
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+		{
+			VaultPath:       "secrets/data/bar",
+			SecretName:      "bar",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+	}
+
+	// secrets written before owner references were enabled get them on
+	// the next pass.
+	err := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test").
+		Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	anchor, err := Anchor(k8sClient, DefaultNamespace, "pentagon-test")
+	if err != nil {
+		t.Fatalf("error getting anchor: %s", err)
+	}
+	if anchor.Kind != "ConfigMap" || anchor.UID != "anchor-uid" {
+		t.Fatalf("unexpected anchor: %+v", anchor)
+	}
+
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		"test",
+		WithOwnerReferences(anchor),
+	)
+	r.setResourceOwners(map[string]metav1.OwnerReference{
+		"bar": resourceOwner("bar-mapping", "resource-uid"),
+	})
+	err = r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+
+	for name, uid := range map[string]string{
+		"foo": "anchor-uid",
+		"bar": "resource-uid",
+	} {
+		s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s should be there: %s", name, err)
+		}
+		if len(s.OwnerReferences) != 1 || string(s.OwnerReferences[0].UID) != uid {
+			t.Errorf("expected %s to be owned by %s, got %+v", name, uid, s.OwnerReferences)
+		}
+	}
+}
+
+func TestAnchorCreated(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+
+	_, err := Anchor(k8sClient, DefaultNamespace, "pentagon-test")
+	if err != nil {
+		t.Fatalf("error getting anchor: %s", err)
+	}
+
+	_, err = k8sClient.CoreV1().ConfigMaps(DefaultNamespace).Get("pentagon-test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("anchor should have been created: %s", err)
+	}
+}
@@ -0,0 +1,53 @@
+package pentagon
+
+import (
+	"log"
+)
+
+// PausedAnnotation pauses the mapping of a PentagonMapping resource when
+// set to "true".
+const PausedAnnotation = "pentagon.vimeo.com/paused"
+
+// Pause stops the reflector from writing the secret named name until Resume
+// is called, like setting Paused in its mapping does.  Pauses only last as
+// long as the reflector.
+func (r *Reflector) Pause(name string) {
+	r.pausedMu.Lock()
+	defer r.pausedMu.Unlock()
+	r.paused[name] = struct{}{}
+}
+
+// Resume undoes Pause.  Mappings that are paused in their configuration
+// stay paused.
+func (r *Reflector) Resume(name string) {
+	r.pausedMu.Lock()
+	defer r.pausedMu.Unlock()
+	delete(r.paused, name)
+}
+
+// isPaused returns true if mapping is paused in its configuration or with
+// Pause, and records it in the paused metric.
+func (r *Reflector) isPaused(mapping Mapping) bool {
+	r.pausedMu.Lock()
+	_, paused := r.paused[mapping.SecretName]
+	r.pausedMu.Unlock()
+
+	if !paused && !mapping.Paused {
+		r.setPausedMetric(mapping.SecretName, false)
+		return false
+	}
+
+	log.Printf("mapping %s is paused, leaving its secret alone", mapping.SecretName)
+	r.setPausedMetric(mapping.SecretName, true)
+	return true
+}
+
+// pausedVersion returns the version of the key/value v2 secret held by the
+// secret of a paused mapping.
+func (p *pass) pausedVersion(mapping Mapping) string {
+	current, ok := p.existing[mapping.SecretName]
+	if !ok {
+		return ""
+	}
+	return current.Annotations[VersionAnnotation]
+}
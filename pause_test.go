@@ -0,0 +1,87 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestPause(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"foo": "bar",
+		})
+
+		results := map[string]SyncResult{}
+		r := NewReflector(
+			vaultClient,
+			k8sClient,
+			DefaultNamespace,
+			"test",
+			WithResults(func(res SyncResult) {
+				results[res.Mapping.SecretName] = res
+			}),
+		)
+
+		mapping := Mapping{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: engineType,
+		}
+		err := r.Reflect(context.Background(), []Mapping{mapping})
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"foo": "baz",
+		})
+
+		check := func(expected string) {
+			s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("foo should be there: %s", err)
+			}
+			if string(s.Data["foo"]) != expected {
+				t.Fatalf("expected foo to be %q, got %q", expected, s.Data["foo"])
+			}
+		}
+
+		// a paused mapping is left alone and isn't reconciled away.
+		paused := mapping
+		paused.Paused = true
+		err = r.Reflect(context.Background(), []Mapping{paused})
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+		check("bar")
+		if !results["foo"].Paused {
+			t.Fatalf("foo should have been reported as paused: %+v", results["foo"])
+		}
+
+		r.Pause("foo")
+		err = r.Reflect(context.Background(), []Mapping{mapping})
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+		check("bar")
+
+		r.Resume("foo")
+		err = r.Reflect(context.Background(), []Mapping{mapping})
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+		check("baz")
+		if results["foo"].Paused {
+			t.Fatalf("foo should have been resumed: %+v", results["foo"])
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/vimeo/pentagon"
+)
+
+// pauseHandler returns a handler calling pause with the secret named by the
+// "secret" query parameter of POST requests, e.g. Reflector.Pause.
+func pauseHandler(pause func(name string), done string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.URL.Query().Get("secret")
+		if name == "" {
+			http.Error(w, "missing secret parameter", http.StatusBadRequest)
+			return
+		}
+
+		pause(name)
+		log.Printf("%s mapping of secret %s from %s", done, name, r.RemoteAddr)
+		fmt.Fprintf(w, "%s %s\n", done, name)
+	})
+}
+
+// requestLoggingHandler returns a handler enabling or disabling the logging
+// of vault and kubernetes requests with the "enabled" query parameter of
+// POST requests.
+func requestLoggingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "invalid enabled parameter", http.StatusBadRequest)
+			return
+		}
+
+		pentagon.SetRequestLogging(enabled)
+		log.Printf("request logging set to %t from %s", enabled, r.RemoteAddr)
+		fmt.Fprintf(w, "request logging %t\n", enabled)
+	})
+}
+
+// statusHandler returns a handler serving the states of the mappings
+// returned by state, e.g. Reflector.State, as JSON keyed by secret name.
+func statusHandler(state func() map[string]pentagon.MappingState) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(state()); err != nil {
+			log.Printf("error writing status: %s", err)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vimeo/pentagon"
+)
+
+func TestPauseHandler(t *testing.T) {
+	paused := []string{}
+	handler := pauseHandler(func(name string) {
+		paused = append(paused, name)
+	}, "paused")
+
+	for testName, tbl := range map[string]struct {
+		method string
+		url    string
+		status int
+	}{
+		"pause":          {http.MethodPost, "/pause?secret=foo", http.StatusOK},
+		"get":            {http.MethodGet, "/pause?secret=bar", http.StatusMethodNotAllowed},
+		"missing secret": {http.MethodPost, "/pause", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tbl.method, tbl.url, nil))
+		if w.Code != tbl.status {
+			t.Errorf("%s: expected status %d, got %d", testName, tbl.status, w.Code)
+		}
+	}
+
+	if len(paused) != 1 || paused[0] != "foo" {
+		t.Fatalf("only foo should have been paused: %v", paused)
+	}
+}
+
+func TestRequestLoggingHandler(t *testing.T) {
+	handler := requestLoggingHandler()
+	defer pentagon.SetRequestLogging(false)
+
+	// the requests are made in order, each one starting from the state the
+	// previous one left.
+	for _, tbl := range []struct {
+		method  string
+		url     string
+		status  int
+		enabled bool
+	}{
+		{http.MethodPost, "/debug/requests?enabled=true", http.StatusOK, true},
+		{http.MethodGet, "/debug/requests?enabled=false", http.StatusMethodNotAllowed, true},
+		{http.MethodPost, "/debug/requests?enabled=maybe", http.StatusBadRequest, true},
+		{http.MethodPost, "/debug/requests?enabled=false", http.StatusOK, false},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tbl.method, tbl.url, nil))
+		if w.Code != tbl.status {
+			t.Errorf("%s %s: expected status %d, got %d", tbl.method, tbl.url, tbl.status, w.Code)
+		}
+		if pentagon.RequestLogging() != tbl.enabled {
+			t.Errorf("%s %s: expected request logging %t", tbl.method, tbl.url, tbl.enabled)
+		}
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	handler := statusHandler(func() map[string]pentagon.MappingState {
+		return map[string]pentagon.MappingState{
+			"foo": {VaultPath: "secrets/foo", Version: "2"},
+		}
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	states := map[string]pentagon.MappingState{}
+	if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil {
+		t.Fatalf("invalid status: %s", err)
+	}
+	if states["foo"].Version != "2" {
+		t.Errorf("unexpected status: %v", states)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
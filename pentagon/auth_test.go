@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestGCPAudience(t *testing.T) {
+	for testName, tbl := range map[string]struct {
+		audience string
+		expected string
+		err      bool
+	}{
+		"default":  {"", "vault.example.com/vault/reader", false},
+		"template": {"https://{{.Host}}/roles/{{.Role}}", "https://vault.example.com/roles/reader", false},
+		"static":   {"vault", "vault", false},
+		"unknown":  {"{{.Project}}", "", true},
+		"invalid":  {"{{.Host", "", true},
+	} {
+		audience, err := gcpAudience(tbl.audience, "vault.example.com", "reader")
+		if (err != nil) != tbl.err {
+			t.Errorf("%s: unexpected error: %v", testName, err)
+			continue
+		}
+		if audience != tbl.expected {
+			t.Errorf("%s: expected %q, got %q", testName, tbl.expected, audience)
+		}
+	}
+}
+
+// testToken returns an unsigned JWT with the JSON encoded claims.
+func testToken(claims string) string {
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+}
+
+func TestServiceAccountRole(t *testing.T) {
+	legacy := testToken(`{"sub":"system:serviceaccount:ns:legacy","kubernetes.io/serviceaccount/service-account.name":"legacy"}`)
+	projected := testToken(`{"sub":"system:serviceaccount:ns:projected","exp":1700000000,"kubernetes.io":{"namespace":"ns","serviceaccount":{"name":"projected","uid":"1234"}}}`)
+
+	for testName, tbl := range map[string]struct {
+		token    string
+		claims   []string
+		template string
+		expected string
+		err      bool
+	}{
+		"legacy":           {legacy, nil, "", "legacy", false},
+		"projected":        {projected, nil, "", "projected", false},
+		"claims":           {projected, []string{"missing", "sub"}, "", "system:serviceaccount:ns:projected", false},
+		"missing claims":   {projected, []string{"missing"}, "", "", true},
+		"template":         {projected, nil, `{{claim "kubernetes.io.namespace"}}-{{claim "kubernetes.io.serviceaccount.name"}}`, "ns-projected", false},
+		"template missing": {legacy, nil, `{{claim "kubernetes.io.namespace"}}`, "", true},
+		"not a string":     {projected, []string{"exp"}, "", "", true},
+	} {
+		payload, err := NewServiceAccountToken(tbl.token)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", testName, err)
+		}
+		role, err := payload.Role(tbl.claims, tbl.template)
+		if (err != nil) != tbl.err {
+			t.Errorf("%s: unexpected error: %v", testName, err)
+			continue
+		}
+		if role != tbl.expected {
+			t.Errorf("%s: expected %q, got %q", testName, tbl.expected, role)
+		}
+	}
+}
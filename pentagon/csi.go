@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon/csi"
+)
+
+// defaultCSISocket is where the Secrets Store CSI driver looks for the
+// provider named pentagon by default.
+const defaultCSISocket = "/var/run/secrets-store-csi-providers/pentagon.sock"
+
+// runCSIProvider serves the mappings of the configuration to the Secrets
+// Store CSI driver until it's terminated, logging in to vault again every
+// refresh interval.
+func runCSIProvider(args []string) int {
+	flags := flag.NewFlagSet("csi-provider", flag.ContinueOnError)
+	socket := flags.String("socket", defaultCSISocket, "unix socket to serve the driver on")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		log.Printf("usage: pentagon csi-provider [--socket <path>] <config>")
+		return 10
+	}
+
+	config, code := readConfig(flags.Arg(0), envOverrides())
+	if code != 0 {
+		return code
+	}
+
+	ca, err := getVaultCAPool(config.Vault)
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+
+	k8sConfig, err := getK8sConfig(config.Kubernetes, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	vaultClient, _, err := getVaultClient(config.Vault, config.TLS, ca, k8sClient, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+
+	// the provider reads every mapping from vault, so only vault is
+	// logged in to.
+	login := vaultLogin(vaultClient, config, nil, k8sClient)
+	if err := login(); err != nil {
+		log.Printf("error setting vault token. %s", err)
+		return 30
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	terminated := make(chan os.Signal, 1)
+	signal.Notify(terminated, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-terminated
+		cancel()
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-time.After(config.RefreshInterval):
+			case <-ctx.Done():
+				return
+			}
+			if err := login(); err != nil {
+				log.Printf("error setting vault token. %s", err)
+			}
+		}
+	}()
+
+	provider := csi.NewProvider(
+		vaultLogical(vaultClient, config.Vault),
+		config.Namespace,
+		config.Mappings,
+	)
+	log.Printf("serving the Secrets Store CSI driver on %s", *socket)
+	if err := csi.NewServer(provider, VERSION).Serve(ctx, *socket); err != nil {
+		log.Printf("error serving the Secrets Store CSI driver: %s", err)
+		return 50
+	}
+	return 0
+}
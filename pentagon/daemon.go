@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/vimeo/pentagon"
+)
+
+// renewCheckInterval is how often the certificates of the mappings with a
+// renewBefore are checked between passes.
+const renewCheckInterval = 5 * time.Minute
+
+var backoffGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_backoff_seconds",
+	Help: "Current delay before the next attempt to reflect secrets after a failure. 0 when the last attempt succeeded",
+})
+
+// runDaemon periodically logs in to vault with login and reflects secrets.  A
+// failed pass doubles the delay before the next one (up to
+// config.MaxBackoff) and a successful pass resets it to
+// config.RefreshInterval.  It returns an error once
+// config.MaxConsecutiveFailures passes in a row have failed, or nil once ctx
+// is done.
+func runDaemon(
+	ctx context.Context,
+	login func() error,
+	reflector reflecter,
+	config *pentagon.Config,
+) error {
+	delay := config.RefreshInterval
+	failures := 0
+	for {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+
+		err := login()
+		if err != nil {
+			err = fmt.Errorf("error setting vault token. %s", err)
+		} else {
+			err = reflectPass(ctx, reflector, config)
+			if err != nil {
+				err = fmt.Errorf("error reflecting vault values into kubernetes: %s", err)
+			}
+		}
+
+		if err != nil {
+			log.Print(err)
+			notifier.failed(err)
+			failures++
+			if config.MaxConsecutiveFailures > 0 &&
+				failures >= config.MaxConsecutiveFailures {
+				return fmt.Errorf(
+					"giving up after %d consecutive failures, last: %s",
+					failures,
+					err,
+				)
+			}
+			delay = failedPass(delay, config)
+			continue
+		}
+
+		successGauge.Set(1)
+		backoffGauge.Set(0)
+		notifier.passed()
+		failures = 0
+		delay = config.RefreshInterval
+	}
+}
+
+// runController reflects each mapping from its own queue until ctx is done,
+// logging in to vault with login every config.RefreshInterval.
+func runController(
+	ctx context.Context,
+	login func() error,
+	reflector *pentagon.Reflector,
+	config *pentagon.Config,
+) {
+	controller := pentagon.NewController(
+		reflector,
+		config.Mappings,
+		config.RefreshInterval,
+		config.Controller.BaseDelay,
+		config.MaxBackoff,
+	)
+	go controller.Run(ctx, config.Workers)
+
+	for {
+		select {
+		case <-time.After(config.RefreshInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		err := login()
+		if err != nil {
+			log.Printf("error setting vault token. %s", err)
+		}
+	}
+}
+
+// failedPass records a failed pass and returns the delay to wait before the
+// next attempt.
+func failedPass(delay time.Duration, config *pentagon.Config) time.Duration {
+	successGauge.Set(0)
+	next := nextBackoff(delay, config.MaxBackoff)
+	log.Printf("backing off, next attempt in %s", next)
+	backoffGauge.Set(next.Seconds())
+	return next
+}
+
+// nextBackoff doubles the current delay without exceeding max.
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max || next <= 0 {
+		return max
+	}
+	return next
+}
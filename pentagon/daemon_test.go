@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vimeo/pentagon"
+)
+
+// scriptedReflecter fails or succeeds each pass as scripted, and fails
+// every pass after the script.
+type scriptedReflecter struct {
+	script []bool
+	passes int
+}
+
+func (s *scriptedReflecter) Reflect(ctx context.Context, mappings []pentagon.Mapping) error {
+	pass := s.passes
+	s.passes++
+	if pass < len(s.script) && s.script[pass] {
+		return nil
+	}
+	return errors.New("vault is down")
+}
+
+func TestNextBackoff(t *testing.T) {
+	for testName, tbl := range map[string]struct {
+		current  time.Duration
+		max      time.Duration
+		expected time.Duration
+	}{
+		"doubles":  {current: time.Minute, max: time.Hour, expected: 2 * time.Minute},
+		"capped":   {current: 40 * time.Minute, max: time.Hour, expected: time.Hour},
+		"at-max":   {current: time.Hour, max: time.Hour, expected: time.Hour},
+		"overflow": {current: time.Duration(1 << 62), max: time.Hour, expected: time.Hour},
+	} {
+		if next := nextBackoff(tbl.current, tbl.max); next != tbl.expected {
+			t.Errorf("%s: expected %s, got %s", testName, tbl.expected, next)
+		}
+	}
+}
+
+func TestRunDaemonMaxConsecutiveFailures(t *testing.T) {
+	for testName, tbl := range map[string]struct {
+		script   []bool
+		expected int
+	}{
+		"failing":          {script: nil, expected: 3},
+		"reset by success": {script: []bool{false, false, true}, expected: 6},
+		"first passes ok":  {script: []bool{true, true}, expected: 5},
+	} {
+		config := &pentagon.Config{
+			RefreshInterval:        time.Millisecond,
+			MaxBackoff:             time.Millisecond,
+			MaxConsecutiveFailures: 3,
+		}
+		reflector := &scriptedReflecter{script: tbl.script}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := runDaemon(ctx, func() error { return nil }, reflector, config)
+		cancel()
+		if err == nil || !strings.Contains(err.Error(), "3 consecutive failures") {
+			t.Errorf("%s: expected to give up after 3 failures, got %v", testName, err)
+		}
+		if reflector.passes != tbl.expected {
+			t.Errorf("%s: expected %d passes, got %d", testName, tbl.expected, reflector.passes)
+		}
+	}
+}
+
+func TestRunDaemonLoginFailures(t *testing.T) {
+	config := &pentagon.Config{
+		RefreshInterval:        time.Millisecond,
+		MaxBackoff:             time.Millisecond,
+		MaxConsecutiveFailures: 2,
+	}
+	logins := 0
+	login := func() error {
+		logins++
+		return errors.New("permission denied")
+	}
+	reflector := &scriptedReflecter{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := runDaemon(ctx, login, reflector, config); err == nil {
+		t.Error("failed logins should count as failures")
+	}
+	if logins != 2 || reflector.passes != 0 {
+		t.Errorf("expected 2 logins and no passes, got %d and %d", logins, reflector.passes)
+	}
+}
+
+func TestRunDaemonWithoutLimit(t *testing.T) {
+	config := &pentagon.Config{
+		RefreshInterval: time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := runDaemon(ctx, func() error { return nil }, &scriptedReflecter{}, config); err != nil {
+		t.Errorf("without maxConsecutiveFailures the daemon should run until ctx is done: %s", err)
+	}
+}
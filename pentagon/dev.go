@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+// devSecret is a secret as printed by runDev.
+type devSecret struct {
+	Type string            `yaml:"type"`
+	Data map[string]string `yaml:"data"`
+}
+
+// runDev reflects the mappings of the configured namespace once, reading
+// vault secrets from the fixtures in dir and keeping the k8s secrets in
+// memory, and prints the secrets to out.  It returns the exit code.
+func runDev(config *pentagon.Config, dir string, out io.Writer) int {
+	mock := vault.NewMock(engineMounts(config))
+	if err := mock.LoadFixtures(dir); err != nil {
+		log.Printf("unable to load fixtures: %s", err)
+		return 20
+	}
+
+	// every source is served from the same fixtures.
+	sources := make(map[string]vault.Logical, len(config.Sources))
+	for name := range config.Sources {
+		sources[name] = mock
+	}
+	for name := range config.OnePassword {
+		sources[name] = mock
+	}
+	for name := range config.Etcd {
+		sources[name] = mock
+	}
+	for name := range config.Conjur {
+		sources[name] = mock
+	}
+
+	secrets := pentagon.NewFakeSecrets()
+	reflector, err := pentagon.New(
+		context.Background(),
+		pentagon.WithVault(mock),
+		pentagon.WithSecretClient(secrets),
+		pentagon.WithNamespace(config.Namespace),
+		pentagon.WithLabel(config.Label),
+		pentagon.WithInstance(config.Instance),
+		pentagon.WithLabels(config.Labels),
+		pentagon.WithPolicies(config.Policies),
+		pentagon.WithErrorPolicy(config.OnError),
+		pentagon.WithSources(sources),
+	)
+	if err != nil {
+		log.Printf("unable to create reflector: %s", err)
+		return 40
+	}
+
+	err = reflector.Reflect(context.Background(), namespaceMappings(config.Mappings))
+	if err != nil {
+		log.Printf("error reflecting fixtures: %s", err)
+		return 40
+	}
+
+	list, err := secrets.List(metav1.ListOptions{})
+	if err != nil {
+		log.Printf("error listing secrets: %s", err)
+		return 40
+	}
+	printed := make(map[string]devSecret, len(list.Items))
+	for _, secret := range list.Items {
+		data := make(map[string]string, len(secret.Data))
+		for key, value := range secret.Data {
+			data[key] = string(value)
+		}
+		printed[secret.Name] = devSecret{Type: string(secret.Type), Data: data}
+	}
+
+	encoded, err := yaml.Marshal(printed)
+	if err != nil {
+		log.Printf("error encoding secrets: %s", err)
+		return 40
+	}
+	out.Write(encoded)
+	return 0
+}
+
+// engineMounts returns the engine types of the first segments of the vault
+// paths of the mappings, for vault.NewMock.
+func engineMounts(config *pentagon.Config) map[string]vault.EngineType {
+	mounts := map[string]vault.EngineType{}
+	for _, m := range config.Mappings {
+		paths := []string{m.VaultPath}
+		for _, o := range m.Data {
+			paths = append(paths, o.VaultPath)
+		}
+		for _, path := range paths {
+			mount := strings.SplitN(path, "/", 2)[0]
+			if _, ok := mounts[mount]; !ok && mount != "" {
+				mounts[mount] = m.VaultEngineType
+			}
+		}
+	}
+	return mounts
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestRunDev(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatalf("unable to create fixtures: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for path, content := range map[string]string{
+		"secrets/data/foo.yaml": "password: hunter2\n",
+		"kv/bar.json":           `{"token": "abc"}`,
+		"kv/README.md":          "not a fixture",
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unable to create fixtures: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unable to create fixtures: %s", err)
+		}
+	}
+
+	config := &pentagon.Config{
+		Mappings: []pentagon.Mapping{
+			{VaultPath: "secrets/data/foo", SecretName: "foo", VaultEngineType: vault.EngineTypeKeyValueV2},
+			{VaultPath: "kv/bar", SecretName: "bar"},
+		},
+	}
+	config.SetDefaults()
+
+	out := &bytes.Buffer{}
+	if code := runDev(config, dir, out); code != 0 {
+		t.Fatalf("unexpected exit code %d", code)
+	}
+
+	printed := map[string]devSecret{}
+	if err := yaml.Unmarshal(out.Bytes(), &printed); err != nil {
+		t.Fatalf("invalid output: %s", err)
+	}
+	if printed["foo"].Data["password"] != "hunter2" || printed["bar"].Data["token"] != "abc" {
+		t.Fatalf("unexpected secrets: %+v", printed)
+	}
+
+	config.Mappings = append(config.Mappings, pentagon.Mapping{
+		VaultPath:  "kv/missing",
+		SecretName: "missing",
+	})
+	config.SetDefaults()
+	if code := runDev(config, dir, &bytes.Buffer{}); code != 40 {
+		t.Fatalf("a missing fixture should have failed, got exit code %d", code)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+// the External Secrets Operator resources that can be converted.
+var (
+	externalSecretResource = schema.GroupVersionResource{
+		Group:    "external-secrets.io",
+		Version:  "v1beta1",
+		Resource: "externalsecrets",
+	}
+	secretStoreResource = schema.GroupVersionResource{
+		Group:    "external-secrets.io",
+		Version:  "v1beta1",
+		Resource: "secretstores",
+	}
+	clusterSecretStoreResource = schema.GroupVersionResource{
+		Group:    "external-secrets.io",
+		Version:  "v1beta1",
+		Resource: "clustersecretstores",
+	}
+)
+
+// esoObject holds the fields of ExternalSecrets, SecretStores and
+// ClusterSecretStores that matter to pentagon.
+type esoObject struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		SecretStoreRef struct {
+			Name string `yaml:"name"`
+			Kind string `yaml:"kind"`
+		} `yaml:"secretStoreRef"`
+		Target struct {
+			Name string `yaml:"name"`
+		} `yaml:"target"`
+		Data []struct {
+			SecretKey string       `yaml:"secretKey"`
+			RemoteRef esoRemoteRef `yaml:"remoteRef"`
+		} `yaml:"data"`
+		DataFrom []struct {
+			esoRemoteRef `yaml:",inline"`
+			Extract      *esoRemoteRef `yaml:"extract"`
+		} `yaml:"dataFrom"`
+		Provider struct {
+			Vault *struct {
+				Path    string `yaml:"path"`
+				Version string `yaml:"version"`
+			} `yaml:"vault"`
+		} `yaml:"provider"`
+	} `yaml:"spec"`
+}
+
+// esoRemoteRef refers to a vault secret, or one of its properties.
+type esoRemoteRef struct {
+	Key      string `yaml:"key"`
+	Property string `yaml:"property"`
+}
+
+// esoStore is the vault mount used by a secret store.
+type esoStore struct {
+	mount      string
+	engineType vault.EngineType
+}
+
+// importedMapping is a mapping converted from an ExternalSecret along with
+// the namespace it was in.
+type importedMapping struct {
+	namespace string
+	mapping   pentagon.Mapping
+}
+
+// runImport implements `pentagon import external-secrets`, printing the
+// mappings converted from ExternalSecrets read from files or, if none are
+// given, from the cluster.  It returns the process's exit code.
+func runImport(args []string) int {
+	if len(args) < 1 || args[0] != "external-secrets" {
+		log.Printf("usage: pentagon import external-secrets [--resources] [file...]")
+		return 10
+	}
+	args = args[1:]
+
+	resources := false
+	if len(args) > 0 && args[0] == "--resources" {
+		resources = true
+		args = args[1:]
+	}
+
+	var objects []esoObject
+	var err error
+	if len(args) > 0 {
+		objects, err = readESOFiles(args)
+	} else {
+		objects, err = listESOObjects()
+	}
+	if err != nil {
+		log.Printf("error reading external secrets: %s", err)
+		return 20
+	}
+
+	imported, warnings := convertExternalSecrets(objects)
+	for _, w := range warnings {
+		log.Print(w)
+	}
+
+	if resources {
+		err = writeMappingResources(os.Stdout, imported)
+	} else {
+		err = writeMappings(os.Stdout, imported)
+	}
+	if err != nil {
+		log.Printf("error writing mappings: %s", err)
+		return 20
+	}
+	return 0
+}
+
+// readESOFiles decodes all of the YAML documents in files.
+func readESOFiles(files []string) ([]esoObject, error) {
+	objects := []esoObject{}
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err := decodeESOObjects(contents)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %s", file, err)
+		}
+		objects = append(objects, decoded...)
+	}
+	return objects, nil
+}
+
+// decodeESOObjects decodes all of the YAML documents in contents.
+func decodeESOObjects(contents []byte) ([]esoObject, error) {
+	objects := []esoObject{}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		obj := esoObject{}
+		err := decoder.Decode(&obj)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// listESOObjects lists the ExternalSecrets and secret stores of every
+// namespace of the cluster pentagon runs in.
+func listESOObjects() ([]esoObject, error) {
+	k8sConfig, err := getK8sConfig(pentagon.KubernetesConfig{}, userAgent(nil))
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []esoObject{}
+	for _, resource := range []schema.GroupVersionResource{
+		clusterSecretStoreResource,
+		secretStoreResource,
+		externalSecretResource,
+	} {
+		list, err := client.Resource(resource).Namespace("").List(metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %s", resource.Resource, err)
+		}
+
+		for _, item := range list.Items {
+			// round trip through YAML to reuse the struct tags.
+			raw, err := yaml.Marshal(item.Object)
+			if err != nil {
+				return nil, err
+			}
+			obj := esoObject{}
+			if err := yaml.Unmarshal(raw, &obj); err != nil {
+				return nil, err
+			}
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// convertExternalSecrets converts the ExternalSecrets among objects to
+// mappings using the vault stores among them.  ExternalSecrets that can't
+// be represented by a mapping are left out with a warning.
+func convertExternalSecrets(objects []esoObject) ([]importedMapping, []string) {
+	stores := map[string]esoStore{}
+	for _, obj := range objects {
+		if obj.Kind != "SecretStore" && obj.Kind != "ClusterSecretStore" {
+			continue
+		}
+		v := obj.Spec.Provider.Vault
+		if v == nil {
+			continue
+		}
+		store := esoStore{
+			mount:      strings.Trim(v.Path, "/"),
+			engineType: vault.EngineTypeKeyValueV2,
+		}
+		if v.Version == "v1" {
+			store.engineType = vault.EngineTypeKeyValueV1
+		}
+		namespace := obj.Metadata.Namespace
+		if obj.Kind == "ClusterSecretStore" {
+			namespace = ""
+		}
+		stores[obj.Kind+"/"+namespace+"/"+obj.Metadata.Name] = store
+	}
+
+	imported := []importedMapping{}
+	warnings := []string{}
+	for _, obj := range objects {
+		if obj.Kind != "ExternalSecret" {
+			continue
+		}
+		id := obj.Metadata.Namespace + "/" + obj.Metadata.Name
+
+		storeKind := obj.Spec.SecretStoreRef.Kind
+		if storeKind == "" {
+			storeKind = "SecretStore"
+		}
+		storeNamespace := obj.Metadata.Namespace
+		if storeKind == "ClusterSecretStore" {
+			storeNamespace = ""
+		}
+		store, ok := stores[storeKind+"/"+storeNamespace+"/"+obj.Spec.SecretStoreRef.Name]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf(
+				"skipping %s: %s %s is not a known vault store",
+				id,
+				storeKind,
+				obj.Spec.SecretStoreRef.Name,
+			))
+			continue
+		}
+
+		key, requiredKeys, err := externalSecretKey(obj)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipping %s: %s", id, err))
+			continue
+		}
+
+		secretName := obj.Spec.Target.Name
+		if secretName == "" {
+			secretName = obj.Metadata.Name
+		}
+
+		imported = append(imported, importedMapping{
+			namespace: obj.Metadata.Namespace,
+			mapping: pentagon.Mapping{
+				VaultPath:       storePath(store, key),
+				SecretName:      secretName,
+				VaultEngineType: store.engineType,
+				RequiredKeys:    requiredKeys,
+			},
+		})
+	}
+
+	return imported, warnings
+}
+
+// externalSecretKey returns the single vault key an ExternalSecret reads as
+// a whole, along with the properties it requires.  Pentagon reflects whole
+// secrets, so ExternalSecrets combining keys or renaming properties can't
+// be converted.
+func externalSecretKey(obj esoObject) (string, []string, error) {
+	keys := map[string]struct{}{}
+	for _, from := range obj.Spec.DataFrom {
+		ref := from.esoRemoteRef
+		if from.Extract != nil {
+			ref = *from.Extract
+		}
+		if ref.Key == "" || ref.Property != "" {
+			return "", nil, fmt.Errorf("unsupported dataFrom entry")
+		}
+		keys[ref.Key] = struct{}{}
+	}
+
+	requiredKeys := []string{}
+	for _, d := range obj.Spec.Data {
+		if d.RemoteRef.Property != d.SecretKey {
+			return "", nil, fmt.Errorf(
+				"property %s is renamed to %s",
+				d.RemoteRef.Property,
+				d.SecretKey,
+			)
+		}
+		keys[d.RemoteRef.Key] = struct{}{}
+		requiredKeys = append(requiredKeys, d.SecretKey)
+	}
+
+	if len(keys) != 1 {
+		return "", nil, fmt.Errorf("reads %d vault keys rather than 1", len(keys))
+	}
+	if len(obj.Spec.DataFrom) > 0 || len(requiredKeys) == 0 {
+		requiredKeys = nil
+	}
+
+	for key := range keys {
+		return key, requiredKeys, nil
+	}
+	return "", nil, nil
+}
+
+// storePath returns the vault path pentagon reads for a key of store.
+func storePath(store esoStore, key string) string {
+	key = strings.TrimPrefix(strings.Trim(key, "/"), store.mount+"/")
+	if store.mount == "" {
+		return key
+	}
+	if store.engineType == vault.EngineTypeKeyValueV2 {
+		return store.mount + "/data/" + key
+	}
+	return store.mount + "/" + key
+}
+
+// mappingFields returns m in the form used in configuration files,
+// leaving out unset fields.
+func mappingFields(m pentagon.Mapping) yaml.MapSlice {
+	fields := yaml.MapSlice{
+		{Key: "vaultPath", Value: m.VaultPath},
+		{Key: "secretName", Value: m.SecretName},
+		{Key: "vaultEngineType", Value: string(m.VaultEngineType)},
+	}
+	if len(m.RequiredKeys) > 0 {
+		fields = append(fields, yaml.MapItem{Key: "requiredKeys", Value: m.RequiredKeys})
+	}
+	return fields
+}
+
+// writeMappings writes the mappings section of a configuration file.  The
+// namespaces of the ExternalSecrets are listed in comments since a
+// configuration only reflects into a single namespace.
+func writeMappings(w io.Writer, imported []importedMapping) error {
+	namespaces := map[string]struct{}{}
+	mappings := make([]yaml.MapSlice, 0, len(imported))
+	for _, im := range imported {
+		namespaces[im.namespace] = struct{}{}
+		mappings = append(mappings, mappingFields(im.mapping))
+	}
+
+	if len(namespaces) > 1 {
+		names := make([]string, 0, len(namespaces))
+		for namespace := range namespaces {
+			names = append(names, namespace)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(
+			w,
+			"# these mappings come from several namespaces (%s), consider --resources\n",
+			strings.Join(names, ", "),
+		)
+	}
+
+	out, err := yaml.Marshal(yaml.MapSlice{{Key: "mappings", Value: mappings}})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// writeMappingResources writes a PentagonMapping resource for every
+// mapping in the namespace of its ExternalSecret.
+func writeMappingResources(w io.Writer, imported []importedMapping) error {
+	for _, im := range imported {
+		resource := yaml.MapSlice{
+			{Key: "apiVersion", Value: pentagon.MappingResource.GroupVersion().String()},
+			{Key: "kind", Value: "PentagonMapping"},
+			{Key: "metadata", Value: yaml.MapSlice{
+				{Key: "name", Value: im.mapping.SecretName},
+				{Key: "namespace", Value: im.namespace},
+			}},
+			{Key: "spec", Value: mappingFields(im.mapping)},
+		}
+		out, err := yaml.Marshal(resource)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runExport implements `pentagon export external-secrets`, printing an
+// ExternalSecret for every mapping of a configuration file.  It returns
+// the process's exit code.
+func runExport(args []string) int {
+	if len(args) != 3 || args[0] != "external-secrets" {
+		log.Printf("usage: pentagon export external-secrets <store> <config>")
+		return 10
+	}
+
+	config, code := readConfig(args[2], envOverrides())
+	if code != 0 {
+		return code
+	}
+
+	err := writeExternalSecrets(os.Stdout, args[1], config)
+	if err != nil {
+		log.Printf("error writing external secrets: %s", err)
+		return 20
+	}
+	return 0
+}
+
+// writeExternalSecrets writes an ExternalSecret reading each mapping from
+// a SecretStore.  Mappings under different mounts need a store per mount,
+// named "<store>-<mount>".
+func writeExternalSecrets(w io.Writer, store string, config *pentagon.Config) error {
+	mounts := map[string]struct{}{}
+	for _, m := range config.Mappings {
+		mounts[strings.SplitN(m.VaultPath, "/", 2)[0]] = struct{}{}
+	}
+
+	for _, m := range config.Mappings {
+		parts := strings.SplitN(m.VaultPath, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("vault path %s has no mount", m.VaultPath)
+		}
+		mount, key := parts[0], parts[1]
+		if m.VaultEngineType == vault.EngineTypeKeyValueV2 {
+			key = strings.TrimPrefix(key, "data/")
+		}
+
+		storeName := store
+		if len(mounts) > 1 {
+			storeName = store + "-" + mount
+		}
+
+		externalSecret := yaml.MapSlice{
+			{Key: "apiVersion", Value: externalSecretResource.GroupVersion().String()},
+			{Key: "kind", Value: "ExternalSecret"},
+			{Key: "metadata", Value: yaml.MapSlice{
+				{Key: "name", Value: m.SecretName},
+				{Key: "namespace", Value: config.Namespace},
+			}},
+			{Key: "spec", Value: yaml.MapSlice{
+				{Key: "refreshInterval", Value: config.RefreshInterval.String()},
+				{Key: "secretStoreRef", Value: yaml.MapSlice{
+					{Key: "name", Value: storeName},
+					{Key: "kind", Value: "SecretStore"},
+				}},
+				{Key: "target", Value: yaml.MapSlice{
+					{Key: "name", Value: m.SecretName},
+				}},
+				{Key: "dataFrom", Value: []yaml.MapSlice{
+					{{Key: "extract", Value: yaml.MapSlice{
+						{Key: "key", Value: key},
+					}}},
+				}},
+			}},
+		}
+		out, err := yaml.Marshal(externalSecret)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
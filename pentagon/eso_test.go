@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+const esoResources = `
+apiVersion: external-secrets.io/v1beta1
+kind: SecretStore
+metadata:
+  name: vault
+  namespace: team-a
+spec:
+  provider:
+    vault:
+      server: https://vault.example.com
+      path: secrets
+      version: v2
+---
+apiVersion: external-secrets.io/v1beta1
+kind: ClusterSecretStore
+metadata:
+  name: legacy
+spec:
+  provider:
+    vault:
+      path: kv
+      version: v1
+---
+apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: db
+  namespace: team-a
+spec:
+  secretStoreRef:
+    name: vault
+  target:
+    name: db-credentials
+  dataFrom:
+  - extract:
+      key: team-a/db
+---
+apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: api
+  namespace: team-b
+spec:
+  secretStoreRef:
+    name: legacy
+    kind: ClusterSecretStore
+  data:
+  - secretKey: token
+    remoteRef:
+      key: team-b/api
+      property: token
+---
+apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: renamed
+  namespace: team-a
+spec:
+  secretStoreRef:
+    name: vault
+  data:
+  - secretKey: password
+    remoteRef:
+      key: team-a/db
+      property: pass
+`
+
+func TestConvertExternalSecrets(t *testing.T) {
+	f, err := ioutil.TempFile("", "eso")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(esoResources)
+	f.Close()
+
+	objects, err := readESOFiles([]string{f.Name()})
+	if err != nil {
+		t.Fatalf("unable to read resources: %s", err)
+	}
+
+	imported, warnings := convertExternalSecrets(objects)
+	expected := []importedMapping{
+		{
+			namespace: "team-a",
+			mapping: pentagon.Mapping{
+				VaultPath:       "secrets/data/team-a/db",
+				SecretName:      "db-credentials",
+				VaultEngineType: vault.EngineTypeKeyValueV2,
+			},
+		},
+		{
+			namespace: "team-b",
+			mapping: pentagon.Mapping{
+				VaultPath:       "kv/team-b/api",
+				SecretName:      "api",
+				VaultEngineType: vault.EngineTypeKeyValueV1,
+				RequiredKeys:    []string{"token"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(imported, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, imported)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "team-a/renamed") {
+		t.Fatalf("the renamed property should have been skipped: %v", warnings)
+	}
+
+	out := &bytes.Buffer{}
+	if err := writeMappingResources(out, imported); err != nil {
+		t.Fatalf("unable to write resources: %s", err)
+	}
+	if !strings.Contains(out.String(), "kind: PentagonMapping") ||
+		!strings.Contains(out.String(), "namespace: team-b") {
+		t.Fatalf("unexpected resources:\n%s", out)
+	}
+}
+
+func TestWriteExternalSecrets(t *testing.T) {
+	config := &pentagon.Config{
+		Namespace: "team-a",
+		Mappings: []pentagon.Mapping{
+			{
+				VaultPath:       "secrets/data/team-a/db",
+				SecretName:      "db",
+				VaultEngineType: vault.EngineTypeKeyValueV2,
+			},
+		},
+	}
+	config.SetDefaults()
+
+	out := &bytes.Buffer{}
+	if err := writeExternalSecrets(out, "vault", config); err != nil {
+		t.Fatalf("unable to write external secrets: %s", err)
+	}
+
+	objects, err := decodeESOObjects(out.Bytes())
+	if err != nil {
+		t.Fatalf("unable to read external secrets back: %s", err)
+	}
+	objects = append(objects, esoObject{})
+	objects[1].Kind = "SecretStore"
+	objects[1].Metadata.Name = "vault"
+	objects[1].Metadata.Namespace = "team-a"
+	objects[1].Spec.Provider.Vault = &struct {
+		Path    string `yaml:"path"`
+		Version string `yaml:"version"`
+	}{Path: "secrets", Version: "v2"}
+
+	// converting back gives the original mapping.
+	imported, warnings := convertExternalSecrets(objects)
+	if len(warnings) != 0 || len(imported) != 1 ||
+		!reflect.DeepEqual(imported[0].mapping, config.Mappings[0]) {
+		t.Fatalf("unexpected round trip: %+v %v", imported, warnings)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/etcd"
+)
+
+var etcdChangesCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "pentagon_etcd_changes_total",
+	Help: "Number of etcd changes that caused mappings to be reflected",
+})
+
+// watchEtcd watches the paths read by the mappings of every etcd source
+// with watch enabled, reflecting those mappings whenever one of their keys
+// changes, until ctx is done.
+func watchEtcd(
+	ctx context.Context,
+	clients map[string]*etcd.Client,
+	reflector syncer,
+	config *pentagon.Config,
+) {
+	for name, client := range clients {
+		if !config.Etcd[name].Watch {
+			continue
+		}
+		for _, path := range etcdPaths(config.Mappings, name) {
+			go watchEtcdPath(ctx, client, name, path, reflector, config)
+		}
+	}
+}
+
+// etcdPaths returns the distinct paths read by the mappings of the source
+// named source, sorted.
+func etcdPaths(mappings []pentagon.Mapping, source string) []string {
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, m := range mappings {
+		if m.Source != source || seen[m.VaultPath] {
+			continue
+		}
+		seen[m.VaultPath] = true
+		paths = append(paths, m.VaultPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// watchEtcdPath reflects the mappings reading path from the etcd source
+// named source whenever a key under path changes, watching again whenever
+// the watch fails.
+func watchEtcdPath(
+	ctx context.Context,
+	client *etcd.Client,
+	source string,
+	path string,
+	reflector syncer,
+	config *pentagon.Config,
+) {
+	mappings := []pentagon.Mapping{}
+	for _, m := range config.Mappings {
+		if m.Source == source && m.VaultPath == path {
+			mappings = append(mappings, m)
+		}
+	}
+
+	delay := minEventsBackoff
+	for {
+		connected := time.Now()
+		err := client.Watch(ctx, path, func() {
+			etcdChangesCounter.Inc()
+			log.Printf("etcd change under %s of source %s", path, source)
+			if err := reflector.Sync(ctx, mappings); err != nil {
+				log.Printf("error reflecting %s after etcd change: %s", path, err)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		// watches that lasted a while start backing off from scratch.
+		if time.Since(connected) > config.RefreshInterval {
+			delay = minEventsBackoff
+		}
+		log.Printf("etcd watch of %s failed, retrying in %s: %s", path, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = nextBackoff(delay, config.RefreshInterval)
+	}
+}
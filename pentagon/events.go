@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+var eventsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "pentagon_vault_events_total",
+	Help: "Number of vault events that caused mappings to be reflected",
+})
+
+// minEventsBackoff is the delay before the first attempt to resubscribe
+// to vault events.
+const minEventsBackoff = time.Second
+
+// syncer reflects only the mappings it is given, like Reflector.Sync.
+type syncer interface {
+	Sync(ctx context.Context, mappings []pentagon.Mapping) error
+}
+
+// watchEvents reflects the mappings of every secret vault reports as
+// written until ctx is done, resubscribing whenever the subscription fails.
+func watchEvents(
+	ctx context.Context,
+	events *vault.Events,
+	reflector syncer,
+	config *pentagon.Config,
+) {
+	delay := minEventsBackoff
+	for {
+		connected := time.Now()
+		err := events.Subscribe(ctx, vault.EventTypeKeyValue, func(e vault.Event) {
+			mappings := mappingsForPath(config.Mappings, e.Path)
+			if len(mappings) == 0 {
+				return
+			}
+
+			eventsCounter.Inc()
+			log.Printf("vault event %s for %s", e.Type, e.Path)
+			err := reflector.Sync(ctx, mappings)
+			if err != nil {
+				log.Printf("error reflecting %s after vault event: %s", e.Path, err)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		// subscriptions that lasted a while start backing off from scratch.
+		if time.Since(connected) > config.RefreshInterval {
+			delay = minEventsBackoff
+		}
+		log.Printf("vault event subscription failed, retrying in %s: %s", delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = nextBackoff(delay, config.RefreshInterval)
+	}
+}
+
+// mappingsForPath returns the mappings reading the vault secret at path,
+// including in their data overrides.
+func mappingsForPath(mappings []pentagon.Mapping, path string) []pentagon.Mapping {
+	matched := []pentagon.Mapping{}
+	for _, m := range mappings {
+		if m.VaultPath == path {
+			matched = append(matched, m)
+			continue
+		}
+		for _, o := range m.Data {
+			if o.VaultPath == path {
+				matched = append(matched, m)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// vaultTLSConfig returns the TLS configuration the vault client uses so
+// that other connections to vault can share it.
+func vaultTLSConfig(
+	vaultConfig pentagon.VaultConfig,
+	hardening pentagon.TLSConfig,
+	ca *vault.CAPool,
+) (*tls.Config, error) {
+	c, err := vaultAPIConfig(vaultConfig, hardening, ca)
+	if err != nil {
+		return nil, err
+	}
+	return c.HttpClient.Transport.(*http.Transport).TLSClientConfig, nil
+}
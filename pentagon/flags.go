@@ -0,0 +1,21 @@
+package main
+
+import "strings"
+
+// listFlag is a flag that can be repeated, with comma-separated values.
+type listFlag []string
+
+// String returns the values of the flag, comma-separated.
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set adds the comma-separated values of s.
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestListFlag(t *testing.T) {
+	var groups listFlag
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&groups, "only-group", "")
+	err := flags.Parse([]string{
+		"--only-group", "cluster-critical",
+		"--only-group", "ingress, dns",
+		"config.yaml",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := listFlag{"cluster-critical", "ingress", "dns"}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected %v, got %v", expected, groups)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+var vaultSealedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_vault_sealed",
+	Help: "Whether vault was sealed at the last health check. 1 for sealed, 0 otherwise",
+})
+
+var vaultStandbyGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_vault_standby",
+	Help: "Whether vault was a standby node at the last health check. 1 for standby, 0 otherwise",
+})
+
+var vaultUnreachableGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_vault_unreachable",
+	Help: "Whether the last vault health check failed. 1 for failed, 0 otherwise",
+})
+
+// monitorHealth checks the health of vault every interval until ctx is
+// done.  Each check may take up to interval.
+func monitorHealth(ctx context.Context, checker vault.HealthChecker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkHealth(ctx, checker, interval)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkHealth checks the health of vault once and updates the vault health
+// metrics.  The sealed and standby gauges keep their values when vault
+// can't be reached.
+func checkHealth(ctx context.Context, checker vault.HealthChecker, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	health, err := checker.Health(ctx)
+	if err != nil {
+		log.Printf("vault health check failed: %s", err)
+		vaultUnreachableGauge.Set(1)
+		return
+	}
+
+	vaultUnreachableGauge.Set(0)
+	vaultSealedGauge.Set(boolGauge(health.Sealed))
+	vaultStandbyGauge.Set(boolGauge(health.Standby || health.PerformanceStandby))
+}
+
+// boolGauge returns the gauge value of b.
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeHealth struct {
+	health *api.HealthResponse
+	err    error
+}
+
+func (f fakeHealth) Health(ctx context.Context) (*api.HealthResponse, error) {
+	return f.health, f.err
+}
+
+func TestCheckHealth(t *testing.T) {
+	for _, tbl := range []struct {
+		name        string
+		checker     fakeHealth
+		sealed      float64
+		standby     float64
+		unreachable float64
+	}{
+		{"active", fakeHealth{health: &api.HealthResponse{}}, 0, 0, 0},
+		{"sealed", fakeHealth{health: &api.HealthResponse{Sealed: true}}, 1, 0, 0},
+		{"standby", fakeHealth{health: &api.HealthResponse{PerformanceStandby: true}}, 0, 1, 0},
+		// a failed check leaves the previous sealed and standby values.
+		{"unreachable", fakeHealth{err: fmt.Errorf("connection refused")}, 0, 1, 1},
+	} {
+		checkHealth(context.Background(), tbl.checker, time.Second)
+
+		if v := testutil.ToFloat64(vaultSealedGauge); v != tbl.sealed {
+			t.Errorf("%s: expected sealed %v, got %v", tbl.name, tbl.sealed, v)
+		}
+		if v := testutil.ToFloat64(vaultStandbyGauge); v != tbl.standby {
+			t.Errorf("%s: expected standby %v, got %v", tbl.name, tbl.standby, v)
+		}
+		if v := testutil.ToFloat64(vaultUnreachableGauge); v != tbl.unreachable {
+			t.Errorf("%s: expected unreachable %v, got %v", tbl.name, tbl.unreachable, v)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/vimeo/pentagon"
+)
+
+var leaderGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_leader",
+	Help: "Whether this instance is the leader. 1 for leader, 0 otherwise",
+})
+
+// runLeaderElection campaigns for the configured Lease and calls run once
+// this instance becomes the leader.  The context passed to run is cancelled
+// when leadership is lost.  It returns once leadership is lost.
+func runLeaderElection(
+	ctx context.Context,
+	client kubernetes.Interface,
+	config *pentagon.Config,
+	run func(context.Context),
+) error {
+	leConfig := config.LeaderElection
+
+	identity := leConfig.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("error getting hostname for identity: %s", err)
+		}
+		identity = hostname
+	}
+
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		config.Namespace,
+		leConfig.LeaseName,
+		client.CoreV1(),
+		client.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		return fmt.Errorf("error creating lease lock: %s", err)
+	}
+
+	elector, err := leaderelection.NewLeaderElector(
+		leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: leConfig.LeaseDuration,
+			RenewDeadline: leConfig.RenewDeadline,
+			RetryPeriod:   leConfig.RetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.Printf("%s is now the leader", identity)
+					leaderGauge.Set(1)
+					run(ctx)
+				},
+				OnStoppedLeading: func() {
+					log.Printf("%s is no longer the leader", identity)
+					leaderGauge.Set(0)
+				},
+				OnNewLeader: func(leader string) {
+					log.Printf("observed new leader %s", leader)
+				},
+			},
+			Name: leConfig.LeaseName,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error creating leader elector: %s", err)
+	}
+
+	log.Printf("%s campaigning for lease %s", identity, leConfig.LeaseName)
+	elector.Run(ctx)
+
+	return nil
+}
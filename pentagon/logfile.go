@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vimeo/pentagon"
+)
+
+// rotatedTimeFormat is the suffix added to the names of rotated log files.
+const rotatedTimeFormat = "20060102T150405.000"
+
+// logFile is an io.Writer appending to a file that is rotated once it
+// reaches a maximum size or age.  Rotated files are renamed with the time
+// of their rotation and the oldest ones are removed.
+type logFile struct {
+	config pentagon.LogFileConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+}
+
+// openLogFile opens the log file described by config, appending to it if
+// it exists.
+func openLogFile(config pentagon.LogFileConfig) (*logFile, error) {
+	l := &logFile{
+		config: config,
+		now:    time.Now,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the file, whose age starts when it was last modified if it
+// already exists.
+func (l *logFile) open() error {
+	f, err := os.OpenFile(l.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %s", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error opening log file: %s", err)
+	}
+
+	l.file = f
+	l.size = info.Size()
+	l.created = l.now()
+	if info.Size() > 0 {
+		l.created = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p to the file, rotating it first if needed.
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tooBig := l.config.MaxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.config.MaxSize
+	tooOld := l.config.MaxAge > 0 && l.now().Sub(l.created) >= l.config.MaxAge
+	if tooBig || tooOld {
+		if err := l.rotate(); err != nil {
+			// keep writing to the current file rather than losing logs.
+			fmt.Fprintf(os.Stderr, "error rotating log file: %s\n", err)
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file and opens a new one, then removes the rotated
+// files past the maximum number of backups.
+func (l *logFile) rotate() error {
+	rotated := l.config.Path + "." + l.now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(l.config.Path, rotated); err != nil {
+		return err
+	}
+	l.file.Close()
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	if l.config.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(l.config.Path + ".*")
+	if err != nil {
+		return err
+	}
+	// the time format sorts chronologically.
+	sort.Strings(backups)
+	for len(backups) > l.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
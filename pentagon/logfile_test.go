@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vimeo/pentagon"
+)
+
+func TestLogFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pentagon-log")
+	if err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pentagon.log")
+	l, err := openLogFile(pentagon.LogFileConfig{
+		Path:       path,
+		MaxSize:    10,
+		MaxAge:     time.Hour,
+		MaxBackups: 2,
+	})
+	if err != nil {
+		t.Fatalf("unable to open log file: %s", err)
+	}
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.created = now
+
+	write := func(s string) {
+		if _, err := l.Write([]byte(s)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	write("first\n")
+	write("second\n") // too big, rotates
+	write("third\n")  // too big, rotates
+	now = now.Add(time.Hour)
+	write("4th\n") // too old, rotates and drops "first"
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read log file: %s", err)
+	}
+	if string(contents) != "4th\n" {
+		t.Errorf("expected the latest line in the log file, got %q", contents)
+	}
+
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+	for i, expected := range []string{"second\n", "third\n"} {
+		contents, err := ioutil.ReadFile(backups[i])
+		if err != nil {
+			t.Fatalf("unable to read backup: %s", err)
+		}
+		if string(contents) != expected {
+			t.Errorf("expected backup %d to be %q, got %q", i, expected, contents)
+		}
+	}
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"strings"
-	"time"
+	"text/template"
 
 	"cloud.google.com/go/compute/metadata"
 	"github.com/hashicorp/vault/api"
 	yaml "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -23,6 +30,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/vimeo/pentagon"
 	"github.com/vimeo/pentagon/vault"
+	"github.com/vimeo/pentagon/webhook"
 )
 
 var successGauge = promauto.NewGauge(prometheus.GaugeOpts{
@@ -31,135 +39,797 @@ var successGauge = promauto.NewGauge(prometheus.GaugeOpts{
 })
 
 func main() {
-	if len(os.Args) != 2 {
-		log.Printf(
-			"incorrect number of arguments. need 2, got %d [%#v]",
-			len(os.Args),
-			os.Args,
-		)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "rollback":
+			os.Exit(runRollback(os.Args[2:]))
+		case "orphans":
+			os.Exit(runOrphans(os.Args[2:]))
+		case "sync":
+			os.Exit(runSync(os.Args[2:]))
+		case "csi-provider":
+			os.Exit(runCSIProvider(os.Args[2:]))
+		}
+	}
+
+	flags := flag.NewFlagSet("pentagon", flag.ContinueOnError)
+	once := flags.Bool(
+		"once",
+		false,
+		"reflect secrets once and exit, even if the configuration enables daemon mode",
+	)
+	devSource := flags.String(
+		"dev-source",
+		"",
+		"reflect secrets once from the vault fixtures in this directory into memory and print them",
+	)
+	var onlyGroups, skipGroups listFlag
+	flags.Var(&onlyGroups, "only-group", "only reflect the mappings in this group (repeatable)")
+	flags.Var(&skipGroups, "skip-group", "don't reflect the mappings in this group (repeatable)")
+	var vaultPathFilters, secretNameFilters listFlag
+	flags.Var(&vaultPathFilters, "filter", "only reflect the mappings whose vault path matches this glob (repeatable)")
+	flags.Var(&secretNameFilters, "target-name", "only reflect the mappings whose secret name matches this glob (repeatable)")
+	o := overrides{}
+	o.addFlags(flags)
+	if err := flags.Parse(os.Args[1:]); err != nil || flags.NArg() != 1 {
+		log.Printf("usage: pentagon [flags] <config>")
 		os.Exit(10)
 	}
+	for _, glob := range append(append([]string{}, vaultPathFilters...), secretNameFilters...) {
+		if _, err := path.Match(glob, ""); err != nil {
+			log.Printf("invalid glob %q: %s", glob, err)
+			os.Exit(10)
+		}
+	}
 
-	configFile, err := ioutil.ReadFile(os.Args[1])
+	config, code := readConfig(flags.Arg(0), o)
+	if code != 0 {
+		os.Exit(code)
+	}
+
+	if *devSource != "" {
+		os.Exit(runDev(config, *devSource, os.Stdout))
+	}
+
+	// a single pass needs none of the daemon's features, and doesn't wait
+	// for the lease of a running daemon.
+	if *once {
+		config.Daemon = false
+		config.LeaderElection.Enabled = false
+	}
+
+	ca, err := getVaultCAPool(config.Vault)
 	if err != nil {
-		log.Printf("error opening configuration file: %s", err)
-		os.Exit(20)
+		log.Printf("unable to get vault client: %s", err)
+		os.Exit(30)
+	}
+	if ca != nil && config.Vault.CAReload > 0 {
+		go ca.Run(context.Background(), config.Vault.CAReload)
 	}
 
-	config := &pentagon.Config{}
-	err = yaml.Unmarshal(configFile, config)
+	k8sConfig, err := getK8sConfig(config.Kubernetes, userAgent(config))
 	if err != nil {
-		log.Printf("error parsing configuration file: %s", err)
-		os.Exit(21)
+		log.Printf("unable to get kubernetes client: %s", err)
+		os.Exit(31)
 	}
 
-	config.SetDefaults()
+	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		os.Exit(31)
+	}
 
-	if err := config.Validate(); err != nil {
-		log.Printf("configuration error: %s", err)
-		os.Exit(22)
+	vaultClient, vaultHealth, err := getVaultClient(config.Vault, config.TLS, ca, k8sClient, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		os.Exit(30)
 	}
 
-	vaultClient, err := getVaultClient(config.Vault)
+	sources, err := getSources(config, k8sClient)
 	if err != nil {
 		log.Printf("unable to get vault client: %s", err)
 		os.Exit(30)
 	}
+	etcdClients, err := getEtcdClients(config)
+	if err != nil {
+		log.Printf("unable to get etcd client: %s", err)
+		os.Exit(30)
+	}
+	conjurClients, err := getConjurClients(config)
+	if err != nil {
+		log.Printf("unable to get Conjur client: %s", err)
+		os.Exit(30)
+	}
+	login := vaultLogin(vaultClient, config, sources, k8sClient)
+
+	logical := vaultLogical(vaultClient, config.Vault)
 
-	k8sClient, err := getK8sClient()
+	shardIndex, shardCount, err := getShard(config.Shards)
 	if err != nil {
-		log.Printf("unable to get kubernetes client: %s", err)
-		os.Exit(31)
+		log.Printf("configuration error: %s", err)
+		os.Exit(22)
+	}
+	if shardCount > 1 {
+		log.Printf("reflecting shard %d of %d", shardIndex, shardCount)
+	}
+	if len(onlyGroups) > 0 || len(skipGroups) > 0 {
+		log.Printf(
+			"only reflecting the groups %v, skipping the groups %v",
+			[]string(onlyGroups),
+			[]string(skipGroups),
+		)
+	}
+	if len(vaultPathFilters) > 0 || len(secretNameFilters) > 0 {
+		log.Printf(
+			"only reflecting the mappings matching the vault paths %v and the secret names %v",
+			[]string(vaultPathFilters),
+			[]string(secretNameFilters),
+		)
 	}
 
-	reflector := pentagon.NewReflector(
-		vaultClient.Logical(),
-		k8sClient,
-		config.Namespace,
-		config.Label,
-	)
-	err = reflector.Reflect(config.Mappings)
+	opts := []pentagon.Option{
+		pentagon.WithShard(shardIndex, shardCount),
+		pentagon.WithGroups(onlyGroups, skipGroups),
+		pentagon.WithFilters(vaultPathFilters, secretNameFilters),
+		pentagon.WithTransactions(config.Transactions),
+		pentagon.WithInstance(config.Instance),
+		pentagon.WithLabels(config.Labels),
+		pentagon.WithPolicies(config.Policies),
+		pentagon.WithDeletionGuard(config.DeletionGuard.MaxRemovedKeys, config.DeletionGuard.MaxShrink),
+		pentagon.WithErrorPolicy(config.OnError),
+		pentagon.WithRetries(config.Retries, config.RetryBackoff),
+		pentagon.WithWorkers(config.Workers),
+		pentagon.WithWriteConcurrency(config.Kubernetes.WriteConcurrency),
+		pentagon.WithVaultTimeout(config.Vault.Timeout),
+		pentagon.WithMetricLabels(config.Metrics.Labels, config.Metrics.TopFailures),
+		pentagon.WithSources(sourceLogicals(config, sources, etcdClients, conjurClients)),
+	}
+
+	if config.Backups {
+		opts = append(opts, pentagon.WithBackups())
+	}
+	opts = append(opts, auditOptions(config, k8sClient)...)
+	if config.State.ConfigMap != "" {
+		opts = append(opts, pentagon.WithStateStore(pentagon.NewConfigMapStateStore(
+			k8sClient,
+			config.Namespace,
+			config.State.ConfigMap,
+		)))
+	}
+
+	if config.Vault.CheckVersions {
+		opts = append(opts, pentagon.WithVersionCheck())
+	}
+	if config.Vault.RenewLeases {
+		opts = append(opts, pentagon.WithLeaseRenewal())
+	}
+	if config.Kubernetes.VerifyWrites {
+		opts = append(opts, pentagon.WithWriteVerification())
+	}
+
+	// daemons keep a cache of their secrets rather than listing them on
+	// every pass, unless they are written to another sink.
+	if config.Sink.Type != pentagon.SinkTypeSecret {
+		sink, err := sinkClient(config, k8sClient)
+		if err != nil {
+			log.Printf("unable to set up the %s sink: %s", config.Sink.Type, err)
+			os.Exit(31)
+		}
+		opts = append(opts, pentagon.WithSecretClient(sink))
+	} else if config.Daemon {
+		opts = append(opts, pentagon.WithInformer(make(chan struct{})))
+	}
+
+	if config.Recreate.Enabled {
+		opts = append(opts, pentagon.WithRecreateDeleted(
+			config.Recreate.RateLimit,
+			config.Recreate.Burst,
+		))
+	}
+
+	anchor, err := getAnchor(config, k8sClient)
 	if err != nil {
-		log.Printf("error reflecting vault values into kubernetes: %s", err)
-		os.Exit(40)
+		log.Printf("unable to set up owner references: %s", err)
+		os.Exit(31)
 	}
-	successGauge.Set(1)
 
-	if config.Daemon {
-		log.Printf("running as a daemon. Refresh interval is %s", config.RefreshInterval.String())
+	newReflector := func(
+		namespace string,
+		extra ...pentagon.Option,
+	) *pentagon.Reflector {
+		if config.OwnerReferences.Enabled {
+			// the anchor can't own secrets in other namespaces.
+			ref := anchor
+			if namespace != config.Namespace {
+				ref = nil
+			}
+			extra = append(extra, pentagon.WithOwnerReferences(ref))
+		}
+		return pentagon.NewReflector(
+			logical,
+			k8sClient,
+			namespace,
+			config.Label,
+			append(append([]pentagon.Option{}, opts...), extra...)...,
+		)
+	}
+
+	// in operator mode every pass covers all of the namespaces with
+	// PentagonMappings.  events and re-creation still only cover the
+	// mappings in the configuration file.  mappings fanning out to other
+	// namespaces get a reflector per namespace, and only the mappings of
+	// the configured namespace are re-created, paused and checked for
+	// staleness.  discovered mappings are reflected like mappings fanning
+	// out, into the namespaces of their ConfigMaps.
+	var reflector *pentagon.Reflector
+	var passReflector reflecter
+	var eventSyncer syncer
+	if config.Operator {
+		dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+		if err != nil {
+			log.Printf("unable to get kubernetes client: %s", err)
+			os.Exit(31)
+		}
+		operator := pentagon.NewOperator(
+			dynamicClient,
+			config.Namespace,
+			pentagon.Mapping{
+				VaultEngineType: config.Vault.DefaultEngineType,
+				Strict:          config.Strict,
+			},
+			config.OperatorVaultPathPrefixes,
+			newReflector,
+		)
+		reflector = operator.Reflector(config.Namespace)
+		passReflector = operator
+		eventSyncer = reflector
+	} else if fansOut(config.Mappings) || config.Discovery.Enabled {
+		fanOut := pentagon.NewFanOut(k8sClient, config.Namespace, newReflector)
+		reflector = fanOut.Reflector(config.Namespace)
+		passReflector = fanOut
+		eventSyncer = fanOut
+		if config.Discovery.Enabled {
+			passReflector = withDiscovery{
+				reflecter: fanOut,
+				discovery: pentagon.NewDiscovery(
+					k8sClient,
+					config.Namespace,
+					pentagon.Mapping{
+						VaultEngineType: config.Vault.DefaultEngineType,
+						Strict:          config.Strict,
+					},
+					config.Discovery.VaultPathPrefixes,
+				),
+			}
+		}
+	} else {
+		reflector = newReflector(config.Namespace)
+		passReflector = reflector
+		eventSyncer = reflector
+	}
+	localMappings := namespaceMappings(config.Mappings)
 
+	if len(config.ReverseMappings) > 0 {
+		passReflector = withReverse{
+			reflecter: passReflector,
+			reverse: pentagon.NewReverseReflector(
+				logical,
+				k8sClient,
+				config.Namespace,
+			),
+			mappings: config.ReverseMappings,
+		}
+	}
+	if len(config.TrustBundles) > 0 {
+		dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+		if err != nil {
+			log.Printf("unable to get kubernetes client: %s", err)
+			os.Exit(31)
+		}
+		passReflector = withTrustBundles{
+			reflecter: passReflector,
+			bundles: pentagon.NewTrustBundleReflector(
+				logical,
+				k8sClient,
+				dynamicClient,
+				config.Namespace,
+				config.Label,
+				config.NamespaceScoped,
+			),
+			trustBundles: config.TrustBundles,
+		}
+	}
+	ready := &readiness{
+		stale: func() []string { return reflector.Stale(localMappings) },
+	}
+	if config.Daemon {
 		http.Handle("/metrics", promhttp.Handler())
-		go http.ListenAndServe(config.ListenAddress, nil)
-		ticker := time.NewTicker(config.RefreshInterval)
-		for range ticker.C {
-			err := setVaultToken(vaultClient, config.Vault)
-			if err != nil {
-				log.Printf("error setting vault token. %s", err)
-				successGauge.Set(0)
-				continue
+		http.Handle("/ready", ready)
+		http.Handle("/status", statusHandler(reflector.State))
+		if config.Admin {
+			http.Handle("/pause", pauseHandler(reflector.Pause, "paused"))
+			http.Handle("/resume", pauseHandler(reflector.Resume, "resumed"))
+			http.Handle("/debug/requests", requestLoggingHandler())
+		}
+		go serveMetrics(config)
+
+		// vault's health is reported, and failover happens, whether or not
+		// this instance leads.
+		if config.Vault.HealthInterval > 0 {
+			go monitorHealth(
+				context.Background(),
+				vaultHealth,
+				config.Vault.HealthInterval,
+			)
+		}
+	}
+
+	if config.Webhook.Enabled {
+		go serveWebhook(config)
+	}
+
+	var events *vault.Events
+	if config.Vault.Events {
+		tlsConfig, err := vaultTLSConfig(config.Vault, config.TLS, ca)
+		if err != nil {
+			log.Printf("unable to configure vault events: %s", err)
+			os.Exit(30)
+		}
+		events = vault.NewEvents(vaultClient, tlsConfig)
+	}
+
+	go notifier.runWatchdog(context.Background())
+
+	run := func(ctx context.Context) {
+		err := reflectPass(ctx, passReflector, config)
+		if err != nil {
+			log.Printf("error reflecting vault values into kubernetes: %s", err)
+			os.Exit(40)
+		}
+		successGauge.Set(1)
+		ready.setReady()
+		notifier.passed()
+
+		if config.Daemon {
+			log.Printf("running as a daemon. Refresh interval is %s", config.RefreshInterval.String())
+
+			if events != nil {
+				go watchEvents(ctx, events, eventSyncer, config)
 			}
-			err = reflector.Reflect(config.Mappings)
+			go watchEtcd(ctx, etcdClients, eventSyncer, config)
+			go reflector.RecreateDeleted(ctx, localMappings)
+			go watchStaleness(ctx, ready.stale, staleCheckInterval)
+			go reflector.RenewCertificates(ctx, localMappings, renewCheckInterval)
+
+			// only leaders keep logging in, so only their tokens are
+			// watched.
+			go watchToken(ctx, vault.NewClient(vaultClient), config.Vault.TokenTTLWarning)
+			watchTokenSecrets(ctx, vaultClient, config, sources, k8sClient)
+
+			if config.Controller.Enabled {
+				runController(ctx, login, reflector, config)
+				return
+			}
+
+			err = runDaemon(ctx, login, passReflector, config)
 			if err != nil {
-				successGauge.Set(0)
-				log.Printf("error reflecting vault values into kubernetes: %s", err)
-				continue
+				log.Printf("daemon exiting: %s", err)
+				os.Exit(41)
 			}
-			successGauge.Set(1)
 		}
 	}
+
+	if !config.LeaderElection.Enabled {
+		run(context.Background())
+		return
+	}
+
+	err = runLeaderElection(context.Background(), k8sClient, config, run)
+	if err != nil {
+		log.Printf("leader election error: %s", err)
+	}
+	os.Exit(42)
+}
+
+// auditOptions returns the options adding the configured auditors.
+func auditOptions(config *pentagon.Config, k8sClient kubernetes.Interface) []pentagon.Option {
+	opts := []pentagon.Option{}
+	if config.Audit.File != "" {
+		opts = append(opts, pentagon.WithAuditor(pentagon.NewFileAuditor(config.Audit.File)))
+	}
+	if config.Audit.ConfigMap != "" {
+		opts = append(opts, pentagon.WithAuditor(pentagon.NewConfigMapAuditor(
+			k8sClient,
+			config.Namespace,
+			config.Audit.ConfigMap,
+			config.Audit.MaxSize,
+		)))
+	}
+	return opts
+}
+
+// fansOut returns true if any of mappings is reflected into other
+// namespaces than the configured one.
+func fansOut(mappings []pentagon.Mapping) bool {
+	for _, m := range mappings {
+		if m.FansOut() {
+			return true
+		}
+	}
+	return false
 }
 
-func getK8sClient() (*kubernetes.Clientset, error) {
+// namespaceMappings returns the mappings reflected into the configured
+// namespace only.
+func namespaceMappings(mappings []pentagon.Mapping) []pentagon.Mapping {
+	local := []pentagon.Mapping{}
+	for _, m := range mappings {
+		if !m.FansOut() {
+			local = append(local, m)
+		}
+	}
+	return local
+}
+
+// getAnchor returns the owner reference to the anchor of the secrets, or
+// nil if owner references aren't enabled.
+func getAnchor(
+	config *pentagon.Config,
+	k8sClient kubernetes.Interface,
+) (*metav1.OwnerReference, error) {
+	if !config.OwnerReferences.Enabled {
+		return nil, nil
+	}
+	return pentagon.Anchor(k8sClient, config.Namespace, config.OwnerReferences.ConfigMap)
+}
+
+// readConfig reads, overrides, defaults and validates the configuration
+// file at path, and sets up logging.  On failure it returns the exit code
+// to use.
+func readConfig(path string, o overrides) (*pentagon.Config, int) {
+	configFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("error opening configuration file: %s", err)
+		return nil, 20
+	}
+
+	configFile, err = pentagon.MigrateConfig(configFile)
+	if err != nil {
+		log.Printf("error parsing configuration file: %s", err)
+		return nil, 21
+	}
+
+	// unknown fields are most likely typos of settings which would
+	// otherwise silently keep their defaults.
+	unmarshal := yaml.UnmarshalStrict
+	if o.lenient {
+		unmarshal = yaml.Unmarshal
+	}
+	config := &pentagon.Config{}
+	err = unmarshal(configFile, config)
+	if err != nil {
+		log.Printf("error parsing configuration file: %s", err)
+		return nil, 21
+	}
+
+	if err := o.apply(config); err != nil {
+		log.Printf("configuration error: %s", err)
+		return nil, 22
+	}
+
+	config.SetDefaults()
+
+	if err := config.Validate(); err != nil {
+		log.Printf("configuration error: %s", err)
+		return nil, 22
+	}
+
+	if err := pentagon.SetLogLevel(config.LogLevel); err != nil {
+		log.Printf("configuration error: %s", err)
+		return nil, 22
+	}
+	pentagon.SetRequestLogging(config.LogRequests)
+
+	if config.LogFile.Path != "" {
+		f, err := openLogFile(config.LogFile)
+		if err != nil {
+			log.Printf("configuration error: %s", err)
+			return nil, 22
+		}
+		log.SetOutput(io.MultiWriter(os.Stderr, f))
+	}
+
+	return config, 0
+}
+
+// serveWebhook serves the admission webhook injecting secrets into pods.
+func serveWebhook(config *pentagon.Config) {
+	mux := http.NewServeMux()
+	mux.Handle("/mutate", webhook.NewInjector(config.Namespace, config.Mappings))
+	server := &http.Server{
+		Addr:      config.Webhook.ListenAddress,
+		Handler:   mux,
+		TLSConfig: &tls.Config{},
+	}
+	err := config.TLS.Apply(server.TLSConfig)
+	if err == nil {
+		err = server.ListenAndServeTLS(config.Webhook.CertFile, config.Webhook.KeyFile)
+	}
+	log.Printf("webhook server stopped: %s", err)
+}
+
+// serveMetrics serves the metrics and admin endpoints, over HTTPS if the
+// tls configuration has a certificate.
+func serveMetrics(config *pentagon.Config) {
+	if config.TLS.CertFile == "" {
+		err := http.ListenAndServe(config.ListenAddress, nil)
+		log.Printf("metrics server stopped: %s", err)
+		return
+	}
+
+	server := &http.Server{
+		Addr:      config.ListenAddress,
+		TLSConfig: &tls.Config{},
+	}
+	err := config.TLS.Apply(server.TLSConfig)
+	if err == nil {
+		err = server.ListenAndServeTLS(config.TLS.CertFile, config.TLS.KeyFile)
+	}
+	log.Printf("metrics server stopped: %s", err)
+}
+
+// reflecter reflects all of the mappings in a single pass.  It is
+// implemented by both pentagon.Reflector and pentagon.Operator.
+type reflecter interface {
+	Reflect(ctx context.Context, mappings []pentagon.Mapping) error
+}
+
+// withReverse writes the reverse mappings to vault after every pass.
+type withReverse struct {
+	reflecter
+	reverse  *pentagon.ReverseReflector
+	mappings []pentagon.ReverseMapping
+}
+
+// Reflect reflects mappings, then the reverse mappings even if some of the
+// mappings failed.
+func (w withReverse) Reflect(ctx context.Context, mappings []pentagon.Mapping) error {
+	err := w.reflecter.Reflect(ctx, mappings)
+	return joinErrors(err, w.reverse.Reflect(ctx, w.mappings))
+}
+
+// withDiscovery adds the discovered mappings to every pass.
+type withDiscovery struct {
+	reflecter
+	discovery *pentagon.Discovery
+}
+
+// Reflect reflects mappings and the discovered mappings.
+func (w withDiscovery) Reflect(ctx context.Context, mappings []pentagon.Mapping) error {
+	all, err := w.discovery.Mappings(mappings)
+	if err != nil {
+		return err
+	}
+	return w.reflecter.Reflect(ctx, all)
+}
+
+// withTrustBundles writes the trust bundles to ConfigMaps after every pass.
+type withTrustBundles struct {
+	reflecter
+	bundles      *pentagon.TrustBundleReflector
+	trustBundles []pentagon.TrustBundle
+}
+
+// Reflect reflects mappings, then the trust bundles even if some of the
+// mappings failed.
+func (w withTrustBundles) Reflect(ctx context.Context, mappings []pentagon.Mapping) error {
+	err := w.reflecter.Reflect(ctx, mappings)
+	return joinErrors(err, w.bundles.Reflect(ctx, w.trustBundles))
+}
+
+// joinErrors returns the errors that aren't nil of err and other as one.
+func joinErrors(err, other error) error {
+	switch {
+	case err != nil && other != nil:
+		return fmt.Errorf("%w; %s", err, other)
+	case err != nil:
+		return err
+	default:
+		return other
+	}
+}
+
+// reflectPass runs a single pass over all of the mappings, limited to
+// config.PassTimeout.
+func reflectPass(
+	ctx context.Context,
+	reflector reflecter,
+	config *pentagon.Config,
+) error {
+	if config.PassTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.PassTimeout)
+		defer cancel()
+	}
+
+	return reflector.Reflect(ctx, config.Mappings)
+}
+
+func getK8sConfig(k8sConfig pentagon.KubernetesConfig, userAgent string) (*rest.Config, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, err
 	}
-	// creates the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+	config.UserAgent = userAgent
+	if k8sConfig.QPS > 0 {
+		config.QPS = k8sConfig.QPS
+	}
+	if k8sConfig.Burst > 0 {
+		config.Burst = k8sConfig.Burst
+	}
+	config.Timeout = k8sConfig.Timeout
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		return pentagon.NewRequestLogger("kubernetes", rt)
+	}
+
+	return config, nil
+}
+
+// getVaultClient returns a vault client logged in to vault and the checker
+// of its health.  With failover urls, the client starts on the first healthy
+// server and the checker moves it to another one when that one fails.
+func getVaultClient(
+	vaultConfig pentagon.VaultConfig,
+	hardening pentagon.TLSConfig,
+	ca *vault.CAPool,
+	k8sClient kubernetes.Interface,
+	userAgent string,
+) (*api.Client, vault.HealthChecker, error) {
+	c, err := vaultAPIConfig(vaultConfig, hardening, ca)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	client, err := api.NewClient(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers := client.Headers()
+	headers.Set("User-Agent", userAgent)
+	client.SetHeaders(headers)
+	c.HttpClient.Transport = pentagon.NewRequestLogger("vault", c.HttpClient.Transport)
+
+	if len(vaultConfig.FailoverURLs) == 0 {
+		err = setVaultToken(client, vaultConfig, k8sClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, vault.NewClient(client), nil
 	}
 
-	return clientset, nil
+	// every move to another server logs in to it, including the first.
+	failover, err := vault.NewFailover(
+		client,
+		vaultConfig.Addresses(),
+		func(address string) error {
+			return setVaultToken(client, vaultConfig, k8sClient)
+		},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultConfig.HealthInterval)
+	defer cancel()
+	if _, err := failover.Health(ctx); err != nil {
+		return nil, nil, err
+	}
+	return client, failover, nil
 }
 
-func getVaultClient(vaultConfig pentagon.VaultConfig) (*api.Client, error) {
+// vaultAPIConfig returns the configuration of the vault client.  If ca is
+// set, vault's certificate is verified against its current certificates.
+func vaultAPIConfig(
+	vaultConfig pentagon.VaultConfig,
+	hardening pentagon.TLSConfig,
+	ca *vault.CAPool,
+) (*api.Config, error) {
 	c := api.DefaultConfig()
 	c.Address = vaultConfig.URL
 
 	// Set any TLS-specific options for vault if they were provided in the
 	// configuration.  The zero-value of the TLSConfig struct should be safe
 	// to use anyway.
+	tlsOptions := api.TLSConfig{}
 	if vaultConfig.TLSConfig != nil {
-		c.ConfigureTLS(vaultConfig.TLSConfig)
+		tlsOptions = *vaultConfig.TLSConfig
+	}
+	if vaultConfig.TLSServerName != "" {
+		tlsOptions.TLSServerName = vaultConfig.TLSServerName
+	}
+	if tlsOptions != (api.TLSConfig{}) {
+		if err := c.ConfigureTLS(&tlsOptions); err != nil {
+			return nil, err
+		}
 	}
 
-	client, err := api.NewClient(c)
+	transport := c.HttpClient.Transport.(*http.Transport)
+	vaultConfig.Transport.Apply(transport)
+
+	tlsConfig := transport.TLSClientConfig
+	err := hardening.Apply(tlsConfig)
 	if err != nil {
 		return nil, err
 	}
-	err = setVaultToken(client, vaultConfig)
-	if err != nil {
-		return nil, err
+
+	// with failover, the same connection settings are used for every
+	// vault address.
+	if ca != nil && !tlsConfig.InsecureSkipVerify {
+		serverNames := []string{tlsConfig.ServerName}
+		if tlsConfig.ServerName == "" {
+			serverNames = []string{}
+			for _, address := range vaultConfig.Addresses() {
+				u, err := url.Parse(address)
+				if err != nil {
+					return nil, fmt.Errorf("invalid vault url: %s", err)
+				}
+				serverNames = append(serverNames, u.Hostname())
+			}
+		}
+		ca.Configure(tlsConfig, serverNames...)
 	}
 
-	return client, nil
+	return c, nil
 }
 
-func setVaultToken(client *api.Client, vaultConfig pentagon.VaultConfig) error {
+// getVaultCAPool returns the pool of CA certificates to verify vault with
+// when they are given inline or can be reloaded, or nil otherwise.
+func getVaultCAPool(vaultConfig pentagon.VaultConfig) (*vault.CAPool, error) {
+	if vaultConfig.CACertPEM == "" && vaultConfig.CAReload == 0 {
+		return nil, nil
+	}
+
+	file := ""
+	if vaultConfig.TLSConfig != nil {
+		file = vaultConfig.TLSConfig.CACert
+	}
+	return vault.NewCAPool(file, vaultConfig.CACertPEM)
+}
+
+// setVaultToken logs client in to vault as configured.  k8sClient reads
+// the token with AuthTypeKubernetesSecret.
+func setVaultToken(
+	client *api.Client,
+	vaultConfig pentagon.VaultConfig,
+	k8sClient kubernetes.Interface,
+) error {
 	switch vaultConfig.AuthType {
 	case vault.AuthTypeToken:
 		client.SetToken(vaultConfig.Token)
 	case vault.AuthTypeGCPDefault:
-		err := setVaultTokenViaGCP(client, vaultConfig.Role)
+		err := setVaultTokenViaGCP(client, vaultConfig.Role, vaultConfig.GCPAudience)
 		if err != nil {
 			return fmt.Errorf("unable to set token via gcp: %s", err)
 		}
 	case vault.AuthTypeKubernetes:
-		err := setVaultTokenViaKubernetes(client, vaultConfig.Role, vaultConfig.AuthPath)
+		err := setVaultTokenViaKubernetes(client, vaultConfig)
 		if err != nil {
 			return fmt.Errorf("unable to set token via kubernetes: %s", err)
 		}
+	case vault.AuthTypeKubernetesSecret:
+		err := setVaultTokenViaSecret(client, vaultConfig, k8sClient)
+		if err != nil {
+			return fmt.Errorf("unable to set token via kubernetes secret: %s", err)
+		}
+	case vault.AuthTypeCommand:
+		err := setVaultTokenViaCommand(client, vaultConfig)
+		if err != nil {
+			return fmt.Errorf("unable to set token via command: %s", err)
+		}
 	default:
 		return fmt.Errorf(
 			"unsupported vault auth type: %s",
@@ -178,7 +848,29 @@ func getRoleViaGCP() (string, error) {
 	return components[0], nil
 }
 
-func setVaultTokenViaGCP(vaultClient *api.Client, role string) error {
+// gcpAudience returns the audience of the GCP identity token used to log in
+// with role to the vault at host, given the audience template.
+func gcpAudience(audience, host, role string) (string, error) {
+	if audience == "" {
+		audience = pentagon.DefaultGCPAudience
+	}
+	tmpl, err := template.New("audience").Parse(audience)
+	if err != nil {
+		return "", fmt.Errorf("invalid gcpAudience: %s", err)
+	}
+
+	buf := &strings.Builder{}
+	err = tmpl.Execute(buf, struct {
+		Host string
+		Role string
+	}{host, role})
+	if err != nil {
+		return "", fmt.Errorf("invalid gcpAudience: %s", err)
+	}
+	return buf.String(), nil
+}
+
+func setVaultTokenViaGCP(vaultClient *api.Client, role, audience string) error {
 	// if that's not provided, get it from the default service account
 	var err error
 	if role == "" {
@@ -199,10 +891,11 @@ func setVaultTokenViaGCP(vaultClient *api.Client, role string) error {
 	if err != nil {
 		return fmt.Errorf("error parsing vault address: %s", err)
 	}
-	values.Add(
-		"audience",
-		fmt.Sprintf("%s/vault/%s", vaultAddress.Hostname(), role),
-	)
+	aud, err := gcpAudience(audience, vaultAddress.Hostname(), role)
+	if err != nil {
+		return err
+	}
+	values.Add("audience", aud)
 	values.Add("format", "full")
 	metadataURL.RawQuery = values.Encode()
 
@@ -229,26 +922,43 @@ func setVaultTokenViaGCP(vaultClient *api.Client, role string) error {
 	return nil
 }
 
-func setVaultTokenViaKubernetes(vaultClient *api.Client, role, authPath string) error {
-	config, err := rest.InClusterConfig()
+// defaultServiceAccountTokenFile is where the token of the pod's service
+// account is mounted.
+const defaultServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// setVaultTokenViaKubernetes logs in to vault with the service account token
+// in the configured file.  The file is read on every login because bound service
+// account tokens are rotated by the kubelet.
+func setVaultTokenViaKubernetes(vaultClient *api.Client, vaultConfig pentagon.VaultConfig) error {
+	role := vaultConfig.Role
+	authPath := vaultConfig.AuthPath
+	tokenFile := vaultConfig.ServiceAccountTokenFile
+	if tokenFile == "" {
+		tokenFile = defaultServiceAccountTokenFile
+	}
+	token, err := ioutil.ReadFile(tokenFile)
 	if err != nil {
 		return fmt.Errorf("error getting ServiceAccount token: %s", err)
 	}
+	jwt := strings.TrimSpace(string(token))
+
 	if authPath == "" {
 		authPath = "auth/kubernetes"
 	}
 	if role == "" {
-		payload, err := NewServiceAccountToken(config.BearerToken)
+		payload, err := NewServiceAccountToken(jwt)
+		if err == nil {
+			role, err = payload.Role(vaultConfig.RoleClaims, vaultConfig.RoleTemplate)
+		}
 		if err != nil {
 			return fmt.Errorf("error getting role from ServiceAccount token: %s", err)
 		}
-		role = payload.Data["kubernetes.io/serviceaccount/service-account.name"]
 	}
 	vaultResp, err := vaultClient.Logical().Write(
 		fmt.Sprintf("%s/login", authPath),
 		map[string]interface{}{
 			"role": role,
-			"jwt":  config.BearerToken,
+			"jwt":  jwt,
 		},
 	)
 
@@ -261,26 +971,95 @@ func setVaultTokenViaKubernetes(vaultClient *api.Client, role, authPath string)
 	return nil
 }
 
-type TokenPayload struct {
-	Data map[string]string
+// defaultRoleClaims are the claims of a service account token holding the
+// name of the service account, in the legacy and in the projected token
+// formats.
+var defaultRoleClaims = []string{
+	"kubernetes.io/serviceaccount/service-account.name",
+	"kubernetes.io.serviceaccount.name",
 }
 
-func (e *TokenPayload) UnmarshalJSON(b []byte) error {
-	// base64 decode the payload
-	raw, err := base64.RawStdEncoding.DecodeString(string(b))
-	if err != nil {
-		return err
-	}
-	// unmarshal the raw text into our map[string]string
-	return json.Unmarshal(raw, &e.Data)
+// TokenPayload holds the claims of a service account token.
+type TokenPayload struct {
+	Claims map[string]interface{}
 }
 
+// NewServiceAccountToken returns the claims of the JWT token, without
+// verifying its signature.
 func NewServiceAccountToken(token string) (TokenPayload, error) {
 	payload := TokenPayload{}
 	tokenParts := strings.Split(token, ".")
 	if len(tokenParts) != 3 {
 		return payload, fmt.Errorf("invalid token format")
 	}
-	err := json.Unmarshal([]byte(tokenParts[1]), &payload)
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(tokenParts[1], "="))
+	if err != nil {
+		return payload, fmt.Errorf("invalid token payload: %s", err)
+	}
+	err = json.Unmarshal(raw, &payload.Claims)
 	return payload, err
 }
+
+// Claim returns the string value of the claim at path.  Dots in path
+// separate the names of nested claims, but names may also contain dots,
+// so "kubernetes.io.serviceaccount.name" finds both the "name" of the
+// "serviceaccount" of the "kubernetes.io" claim and a claim with that name.
+func (p TokenPayload) Claim(path string) (string, bool) {
+	return claim(p.Claims, path)
+}
+
+// claim returns the string value at path in claims.
+func claim(claims map[string]interface{}, path string) (string, bool) {
+	if value, ok := claims[path].(string); ok {
+		return value, true
+	}
+	for i := range path {
+		if path[i] != '.' {
+			continue
+		}
+		nested, ok := claims[path[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := claim(nested, path[i+1:]); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Role returns the vault role derived from the token's claims.  With a
+// roleTemplate, it's the template's output with {{claim "<path>"}} replaced
+// by the claims at those paths.  Otherwise it's the value of the first of
+// claims that the token has.
+func (p TokenPayload) Role(claims []string, roleTemplate string) (string, error) {
+	if roleTemplate != "" {
+		tmpl, err := template.New("role").Funcs(template.FuncMap{
+			"claim": func(path string) (string, error) {
+				value, ok := p.Claim(path)
+				if !ok {
+					return "", fmt.Errorf("token has no %s claim", path)
+				}
+				return value, nil
+			},
+		}).Parse(roleTemplate)
+		if err != nil {
+			return "", fmt.Errorf("invalid roleTemplate: %s", err)
+		}
+		buf := &strings.Builder{}
+		if err := tmpl.Execute(buf, nil); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	if len(claims) == 0 {
+		claims = defaultRoleClaims
+	}
+	for _, path := range claims {
+		if value, ok := p.Claim(path); ok && value != "" {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("token has none of the claims %s", strings.Join(claims, ", "))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon"
+)
+
+// runOrphans lists the secrets labeled for the configured instance that no
+// mapping refers to, without deleting anything.
+func runOrphans(args []string) int {
+	if len(args) != 1 {
+		log.Printf("usage: pentagon orphans <config>")
+		return 10
+	}
+
+	config, code := readConfig(args[0], envOverrides())
+	if code != 0 {
+		return code
+	}
+
+	k8sConfig, err := getK8sConfig(config.Kubernetes, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	// orphans are only listed, so vault isn't needed, and the secrets of
+	// every shard are covered.
+	reflector := pentagon.NewReflector(
+		nil,
+		k8sClient,
+		config.Namespace,
+		config.Label,
+		pentagon.WithInstance(config.Instance),
+	)
+
+	orphans, err := reflector.Orphans(config.Mappings)
+	if err != nil {
+		log.Printf("error listing orphans: %s", err)
+		return 40
+	}
+
+	err = writeOrphans(os.Stdout, orphans, time.Now())
+	if err != nil {
+		log.Printf("error writing orphans: %s", err)
+		return 40
+	}
+	return 0
+}
+
+// writeOrphans writes a table of orphans with their age and the time they
+// were last synced as of now.
+func writeOrphans(w io.Writer, orphans []*v1.Secret, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tAGE\tLAST SYNCED")
+	for _, secret := range orphans {
+		age := "-"
+		if !secret.CreationTimestamp.IsZero() {
+			age = now.Sub(secret.CreationTimestamp.Time).Round(time.Second).String()
+		}
+		synced, ok := secret.Annotations[pentagon.LastSyncedAnnotation]
+		if !ok {
+			synced = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", secret.Namespace, secret.Name, age, synced)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon"
+)
+
+func TestWriteOrphans(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	orphans := []*v1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "old",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-90 * time.Minute)),
+				Annotations: map[string]string{
+					pentagon.LastSyncedAnnotation: "2024-01-02T02:00:00Z",
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "unknown",
+				Namespace: "default",
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeOrphans(buf, orphans, now); err != nil {
+		t.Fatalf("error writing orphans: %s", err)
+	}
+
+	expected := "NAMESPACE  NAME     AGE      LAST SYNCED\n" +
+		"default    old      1h30m0s  2024-01-02T02:00:00Z\n" +
+		"default    unknown  -        -\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
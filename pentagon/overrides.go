@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vimeo/pentagon"
+)
+
+// overrides holds the settings of the configuration file that are
+// overridden by flags or environment variables, so that deployments can
+// tune them without editing the file.  Empty settings aren't overridden.
+type overrides struct {
+	listen   string
+	refresh  string
+	logLevel string
+	label    string
+
+	// lenient ignores unknown fields of the configuration file rather
+	// than rejecting them.
+	lenient bool
+}
+
+// envOverrides returns the overrides set by environment variables.
+func envOverrides() overrides {
+	return overrides{
+		listen:   os.Getenv("PENTAGON_LISTEN"),
+		refresh:  os.Getenv("PENTAGON_REFRESH"),
+		logLevel: os.Getenv("PENTAGON_LOG_LEVEL"),
+		label:    os.Getenv("PENTAGON_LABEL"),
+		lenient:  os.Getenv("PENTAGON_LENIENT_CONFIG") == "true",
+	}
+}
+
+// addFlags registers the flags overriding settings, which take precedence
+// over the environment variables.
+func (o *overrides) addFlags(flags *flag.FlagSet) {
+	env := envOverrides()
+	flags.StringVar(&o.listen, "listen", env.listen, "address to serve metrics on, overriding listen ($PENTAGON_LISTEN)")
+	flags.StringVar(&o.refresh, "refresh", env.refresh, "refresh interval, overriding refresh ($PENTAGON_REFRESH)")
+	flags.StringVar(&o.logLevel, "log-level", env.logLevel, "debug, info or warn, overriding logLevel ($PENTAGON_LOG_LEVEL)")
+	flags.StringVar(&o.label, "label", env.label, "label value of the secrets, overriding label ($PENTAGON_LABEL)")
+	flags.BoolVar(&o.lenient, "lenient-config", env.lenient, "ignore unknown fields of the configuration file ($PENTAGON_LENIENT_CONFIG)")
+}
+
+// apply sets the overridden settings in config, before its defaults are
+// set.
+func (o overrides) apply(config *pentagon.Config) error {
+	if o.listen != "" {
+		config.ListenAddress = o.listen
+	}
+	if o.refresh != "" {
+		refresh, err := time.ParseDuration(o.refresh)
+		if err != nil {
+			return fmt.Errorf("invalid refresh override: %s", err)
+		}
+		config.RefreshInterval = refresh
+	}
+	if o.logLevel != "" {
+		config.LogLevel = pentagon.LogLevel(o.logLevel)
+	}
+	if o.label != "" {
+		config.Label = o.label
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vimeo/pentagon"
+)
+
+func TestOverrides(t *testing.T) {
+	os.Setenv("PENTAGON_LABEL", "from-env")
+	os.Setenv("PENTAGON_REFRESH", "1m")
+	defer os.Unsetenv("PENTAGON_LABEL")
+	defer os.Unsetenv("PENTAGON_REFRESH")
+
+	o := overrides{}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.addFlags(flags)
+	err := flags.Parse([]string{"--refresh", "30s", "--log-level", "debug", "config.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	config := &pentagon.Config{
+		ListenAddress:   ":9999",
+		RefreshInterval: time.Hour,
+		Label:           "from-file",
+	}
+	if err := o.apply(config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// flags win over the environment, which wins over the file.
+	if config.RefreshInterval != 30*time.Second {
+		t.Errorf("expected refresh from the flag, got %s", config.RefreshInterval)
+	}
+	if config.Label != "from-env" {
+		t.Errorf("expected label from the environment, got %s", config.Label)
+	}
+	if config.ListenAddress != ":9999" {
+		t.Errorf("expected listen from the file, got %s", config.ListenAddress)
+	}
+	if config.LogLevel != pentagon.LogLevelDebug {
+		t.Errorf("expected log level from the flag, got %s", config.LogLevel)
+	}
+
+	if err := (overrides{refresh: "soon"}).apply(config); err == nil {
+		t.Errorf("expected an invalid refresh to fail")
+	}
+}
+
+func TestReadConfigStrict(t *testing.T) {
+	f, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatalf("unable to create config: %s", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+refreshinterval: 1m
+mappings:
+  - vaultPath: secrets/data/foo
+    secretName: foo
+`)
+	f.Close()
+	if err != nil {
+		t.Fatalf("unable to write config: %s", err)
+	}
+
+	if _, code := readConfig(f.Name(), overrides{}); code != 21 {
+		t.Errorf("expected the unknown field to fail parsing, got %d", code)
+	}
+
+	config, code := readConfig(f.Name(), overrides{lenient: true})
+	if code != 0 {
+		t.Fatalf("expected a lenient parse to succeed, got %d", code)
+	}
+	if config.RefreshInterval != 15*time.Minute {
+		t.Errorf("expected the default refresh, got %s", config.RefreshInterval)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// staleCheckInterval is how often the staleness of mappings with a maxAge
+// is checked, so that the stale metric is current without readiness probes.
+const staleCheckInterval = 30 * time.Second
+
+// readiness becomes ready once the first pass over every mapping succeeds
+// and stays ready after that, unless stale returns mappings that haven't
+// been reflected within their maxAge.
+type readiness struct {
+	ready int32
+	stale func() []string
+}
+
+// setReady marks the first successful pass.
+func (r *readiness) setReady() {
+	atomic.StoreInt32(&r.ready, 1)
+}
+
+// isReady returns whether a pass has succeeded.
+func (r *readiness) isReady() bool {
+	return atomic.LoadInt32(&r.ready) == 1
+}
+
+// ServeHTTP answers 200 once a pass has succeeded and 503 before or while
+// mappings are stale, for readiness probes and for init containers waiting
+// on pentagon's secrets.
+func (r *readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.isReady() {
+		http.Error(w, "no successful pass yet", http.StatusServiceUnavailable)
+		return
+	}
+	if r.stale != nil {
+		if stale := r.stale(); len(stale) > 0 {
+			http.Error(
+				w,
+				fmt.Sprintf("stale mappings: %s", strings.Join(stale, ", ")),
+				http.StatusServiceUnavailable,
+			)
+			return
+		}
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// watchStaleness calls stale every interval until ctx is done.
+func watchStaleness(ctx context.Context, stale func() []string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stale()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	ready := &readiness{}
+
+	w := httptest.NewRecorder()
+	ready.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d before the first pass, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	ready.setReady()
+
+	w = httptest.NewRecorder()
+	ready.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d after the first pass, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestReadinessStale(t *testing.T) {
+	stale := []string{"foo"}
+	ready := &readiness{stale: func() []string { return stale }}
+	ready.setReady()
+
+	w := httptest.NewRecorder()
+	ready.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d with stale mappings, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	stale = nil
+
+	w = httptest.NewRecorder()
+	ready.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d once mappings are fresh, got %d", http.StatusOK, w.Code)
+	}
+}
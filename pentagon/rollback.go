@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+// runRollback reflects an old version of the key/value v2 secret of the
+// mapping of a secret into that secret.
+func runRollback(args []string) int {
+	if len(args) != 4 || args[1] != "--to-version" {
+		log.Printf("usage: pentagon rollback <secret> --to-version <version> <config>")
+		return 10
+	}
+
+	version, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || version < 1 {
+		log.Printf("invalid version %q", args[2])
+		return 10
+	}
+
+	config, code := readConfig(args[3], envOverrides())
+	if code != 0 {
+		return code
+	}
+
+	var mapping *pentagon.Mapping
+	for i := range config.Mappings {
+		if config.Mappings[i].SecretName == args[0] {
+			mapping = &config.Mappings[i]
+			break
+		}
+	}
+	if mapping == nil {
+		log.Printf("no mapping for secret %s", args[0])
+		return 10
+	}
+	if mapping.FansOut() {
+		log.Printf("secret %s is reflected into other namespaces, which rollback doesn't support", args[0])
+		return 10
+	}
+
+	ca, err := getVaultCAPool(config.Vault)
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+
+	k8sConfig, err := getK8sConfig(config.Kubernetes, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	vaultClient, _, err := getVaultClient(config.Vault, config.TLS, ca, k8sClient, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+
+	sources, err := getSources(config, k8sClient)
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+	etcdClients, err := getEtcdClients(config)
+	if err != nil {
+		log.Printf("unable to get etcd client: %s", err)
+		return 30
+	}
+	conjurClients, err := getConjurClients(config)
+	if err != nil {
+		log.Printf("unable to get Conjur client: %s", err)
+		return 30
+	}
+
+	opts := []pentagon.Option{
+		pentagon.WithVaultTimeout(config.Vault.Timeout),
+		pentagon.WithInstance(config.Instance),
+		pentagon.WithLabels(config.Labels),
+		pentagon.WithPolicies(config.Policies),
+		pentagon.WithSources(sourceLogicals(config, sources, etcdClients, conjurClients)),
+	}
+	if config.Backups {
+		opts = append(opts, pentagon.WithBackups())
+	}
+	opts = append(opts, auditOptions(config, k8sClient)...)
+
+	anchor, err := getAnchor(config, k8sClient)
+	if err != nil {
+		log.Printf("unable to set up owner references: %s", err)
+		return 31
+	}
+	if anchor != nil {
+		opts = append(opts, pentagon.WithOwnerReferences(anchor))
+	}
+
+	reflector := pentagon.NewReflector(
+		vault.NewClient(vaultClient),
+		k8sClient,
+		config.Namespace,
+		config.Label,
+		opts...,
+	)
+
+	err = reflector.Rollback(context.Background(), *mapping, version)
+	if err != nil {
+		log.Printf("error rolling back %s: %s", mapping.SecretName, err)
+		return 40
+	}
+	return 0
+}
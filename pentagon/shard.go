@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// shardIndexEnv and shardCountEnv override the shard index and count.
+const (
+	shardIndexEnv = "PENTAGON_SHARD_INDEX"
+	shardCountEnv = "PENTAGON_SHARD_COUNT"
+)
+
+// getShard returns this replica's shard index and the number of shards.
+// The count comes from $PENTAGON_SHARD_COUNT or the configuration, and the
+// index from $PENTAGON_SHARD_INDEX or the ordinal at the end of a
+// StatefulSet pod's hostname (e.g. "pentagon-2").
+func getShard(configCount int) (int, int, error) {
+	count := configCount
+	if v := os.Getenv(shardCountEnv); v != "" {
+		c, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s %q: %s", shardCountEnv, v, err)
+		}
+		count = c
+	}
+
+	if count <= 1 {
+		return 0, 1, nil
+	}
+
+	var index int
+	if v := os.Getenv(shardIndexEnv); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s %q: %s", shardIndexEnv, v, err)
+		}
+		index = i
+	} else {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return 0, 0, fmt.Errorf("error getting hostname: %s", err)
+		}
+		index, err = statefulSetOrdinal(hostname)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if index < 0 || index >= count {
+		return 0, 0, fmt.Errorf("shard index %d is not within %d shards", index, count)
+	}
+
+	return index, count, nil
+}
+
+// statefulSetOrdinal returns the ordinal from a StatefulSet pod's hostname.
+func statefulSetOrdinal(hostname string) (int, error) {
+	i := strings.LastIndex(hostname, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("hostname %q has no StatefulSet ordinal", hostname)
+	}
+
+	ordinal, err := strconv.Atoi(hostname[i+1:])
+	if err != nil {
+		return 0, fmt.Errorf("hostname %q has no StatefulSet ordinal", hostname)
+	}
+
+	return ordinal, nil
+}
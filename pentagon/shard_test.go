@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStatefulSetOrdinal(t *testing.T) {
+	ordinal, err := statefulSetOrdinal("pentagon-shards-3")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ordinal != 3 {
+		t.Fatalf("ordinal should be 3, is %d", ordinal)
+	}
+
+	for _, hostname := range []string{"pentagon", "pentagon-abc12"} {
+		if _, err := statefulSetOrdinal(hostname); err == nil {
+			t.Fatalf("%s should not have an ordinal", hostname)
+		}
+	}
+}
+
+func TestGetShardEnv(t *testing.T) {
+	os.Setenv(shardIndexEnv, "1")
+	os.Setenv(shardCountEnv, "3")
+	defer os.Unsetenv(shardIndexEnv)
+	defer os.Unsetenv(shardCountEnv)
+
+	index, count, err := getShard(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if index != 1 || count != 3 {
+		t.Fatalf("expected shard 1 of 3, got %d of %d", index, count)
+	}
+
+	os.Setenv(shardIndexEnv, "3")
+	if _, _, err := getShard(0); err == nil {
+		t.Fatal("index 3 should be out of range")
+	}
+}
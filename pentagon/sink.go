@@ -0,0 +1,28 @@
+package main
+
+import (
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/age"
+)
+
+// sinkClient returns the client writing secrets to the sink of config,
+// encrypting their values to its age recipients if it has any.
+func sinkClient(config *pentagon.Config, k8sClient kubernetes.Interface) (pentagon.SecretClient, error) {
+	var client pentagon.SecretClient
+	if config.Sink.Type == pentagon.SinkTypeFile {
+		client = pentagon.NewFileSecrets(config.Sink.Directory)
+	} else {
+		client = pentagon.NewConfigMapSecrets(k8sClient, config.Namespace)
+	}
+
+	if len(config.Sink.AgeRecipients) == 0 {
+		return client, nil
+	}
+	encrypter, err := age.NewEncrypter(config.Sink.AgeRecipients...)
+	if err != nil {
+		return nil, err
+	}
+	return pentagon.NewEncryptedSecrets(client, encrypter), nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/conjur"
+	"github.com/vimeo/pentagon/etcd"
+	"github.com/vimeo/pentagon/onepassword"
+	"github.com/vimeo/pentagon/vault"
+)
+
+// getSources returns vault clients logged in to the configured sources,
+// keyed by name.
+func getSources(
+	config *pentagon.Config,
+	k8sClient kubernetes.Interface,
+) (map[string]*api.Client, error) {
+	clients := make(map[string]*api.Client, len(config.Sources))
+	for name, sourceConfig := range config.Sources {
+		ca, err := getVaultCAPool(sourceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %s", name, err)
+		}
+		client, _, err := getVaultClient(sourceConfig, config.TLS, ca, k8sClient, userAgent(config))
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %s", name, err)
+		}
+		clients[name] = client
+	}
+	return clients, nil
+}
+
+// vaultLogical wraps client for reflectors, limiting its rate and
+// concurrency of reads as configured.  With a token command, the command is run again whenever
+// vault refuses a request.
+func vaultLogical(client *api.Client, vaultConfig pentagon.VaultConfig) vault.Logical {
+	var logical vault.Logical = vault.NewClient(client)
+	if vaultConfig.AuthType == vault.AuthTypeCommand {
+		logical = vault.NewReauthenticating(logical, func() error {
+			return setVaultTokenViaCommand(client, vaultConfig)
+		})
+	}
+	if vaultConfig.RateLimit > 0 {
+		logical = vault.NewRateLimited(
+			logical,
+			vaultConfig.RateLimit,
+			vaultConfig.RateLimitBurst,
+		)
+	}
+	if vaultConfig.ReadConcurrency > 0 {
+		logical = vault.NewConcurrencyLimited(logical, vaultConfig.ReadConcurrency)
+	}
+	return logical
+}
+
+// sourceLogicals wraps the clients of the sources for pentagon.WithSources,
+// along with clients of the 1Password sources and the etcd and Conjur
+// clients.
+func sourceLogicals(
+	config *pentagon.Config,
+	clients map[string]*api.Client,
+	etcdClients map[string]*etcd.Client,
+	conjurClients map[string]*conjur.Client,
+) map[string]vault.Logical {
+	logicals := make(
+		map[string]vault.Logical,
+		len(clients)+len(config.OnePassword)+len(etcdClients)+len(conjurClients),
+	)
+	for name, client := range clients {
+		logicals[name] = vaultLogical(client, config.Sources[name])
+	}
+	for name, sourceConfig := range config.OnePassword {
+		logicals[name] = onePasswordClient(sourceConfig)
+	}
+	for name, client := range etcdClients {
+		logicals[name] = client
+	}
+	for name, client := range conjurClients {
+		logicals[name] = client
+	}
+	return logicals
+}
+
+// getEtcdClients returns clients of the configured etcd sources, keyed by
+// name.
+func getEtcdClients(config *pentagon.Config) (map[string]*etcd.Client, error) {
+	clients := make(map[string]*etcd.Client, len(config.Etcd))
+	for name, sourceConfig := range config.Etcd {
+		tlsConfig, err := sourceTLSConfig(
+			config.TLS,
+			sourceConfig.CACert,
+			sourceConfig.CertFile,
+			sourceConfig.KeyFile,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("etcd source %s: %s", name, err)
+		}
+		clients[name] = etcd.NewClient(
+			sourceConfig.Endpoints,
+			sourceConfig.Username,
+			sourceConfig.Password,
+			sourceConfig.Timeout,
+			&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		)
+	}
+	return clients, nil
+}
+
+// getConjurClients returns clients of the configured Conjur sources, keyed
+// by name.
+func getConjurClients(config *pentagon.Config) (map[string]*conjur.Client, error) {
+	clients := make(map[string]*conjur.Client, len(config.Conjur))
+	for name, sourceConfig := range config.Conjur {
+		tlsConfig, err := sourceTLSConfig(config.TLS, sourceConfig.CACert, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("Conjur source %s: %s", name, err)
+		}
+		sourceConfig := sourceConfig
+		apiKey := func() (string, error) {
+			if sourceConfig.APIKeyFile == "" {
+				return sourceConfig.APIKey, nil
+			}
+			key, err := ioutil.ReadFile(sourceConfig.APIKeyFile)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(string(key)), nil
+		}
+		clients[name] = conjur.NewClient(
+			sourceConfig.URL,
+			sourceConfig.Account,
+			sourceConfig.HostID,
+			apiKey,
+			&http.Client{
+				Timeout:   sourceConfig.Timeout,
+				Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			},
+		)
+	}
+	return clients, nil
+}
+
+// sourceTLSConfig returns the TLS configuration of connections to a
+// source trusting the CA certificates in the file caCert, if set, and
+// presenting the client certificate in certFile and keyFile, if set,
+// hardened like vault's.
+func sourceTLSConfig(
+	hardening pentagon.TLSConfig,
+	caCert string,
+	certFile string,
+	keyFile string,
+) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if err := hardening.Apply(tlsConfig); err != nil {
+		return nil, err
+	}
+	if caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read caCert: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// onePasswordClient returns a client of the 1Password Connect server of
+// sourceConfig.
+func onePasswordClient(sourceConfig pentagon.OnePasswordConfig) *onepassword.Client {
+	token := func() (string, error) {
+		if sourceConfig.TokenFile == "" {
+			return sourceConfig.Token, nil
+		}
+		token, err := ioutil.ReadFile(sourceConfig.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	return onepassword.NewClient(
+		sourceConfig.URL,
+		token,
+		&http.Client{Timeout: sourceConfig.Timeout},
+	)
+}
+
+// vaultLogin returns a function logging in to vault and to every source
+// again, which keeps trying the others when one fails.
+func vaultLogin(
+	vaultClient *api.Client,
+	config *pentagon.Config,
+	sources map[string]*api.Client,
+	k8sClient kubernetes.Interface,
+) func() error {
+	return func() error {
+		err := setVaultToken(vaultClient, config.Vault, k8sClient)
+		for name, client := range sources {
+			sourceErr := setVaultToken(client, config.Sources[name], k8sClient)
+			if sourceErr != nil && err == nil {
+				err = fmt.Errorf("source %s: %s", name, sourceErr)
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon"
+)
+
+// runSync reflects the mapping of a single secret with debug logging and
+// request logging enabled, without reconciling anything, and prints the
+// outcome.
+func runSync(args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	name := flags.String("mapping", "", "secret name of the mapping to reflect")
+	if err := flags.Parse(args); err != nil || *name == "" || flags.NArg() != 1 {
+		log.Printf("usage: pentagon sync --mapping <secret> <config>")
+		return 10
+	}
+
+	config, code := readConfig(flags.Arg(0), envOverrides())
+	if code != 0 {
+		return code
+	}
+
+	var mapping *pentagon.Mapping
+	for i := range config.Mappings {
+		if config.Mappings[i].SecretName == *name {
+			mapping = &config.Mappings[i]
+			break
+		}
+	}
+	if mapping == nil {
+		log.Printf("no mapping for secret %s", *name)
+		return 10
+	}
+	if mapping.FansOut() {
+		log.Printf("secret %s is reflected into other namespaces, which sync doesn't support", *name)
+		return 10
+	}
+
+	pentagon.SetLogLevel(pentagon.LogLevelDebug)
+	pentagon.SetRequestLogging(true)
+
+	ca, err := getVaultCAPool(config.Vault)
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+
+	k8sConfig, err := getK8sConfig(config.Kubernetes, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Printf("unable to get kubernetes client: %s", err)
+		return 31
+	}
+
+	vaultClient, _, err := getVaultClient(config.Vault, config.TLS, ca, k8sClient, userAgent(config))
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+
+	sources, err := getSources(config, k8sClient)
+	if err != nil {
+		log.Printf("unable to get vault client: %s", err)
+		return 30
+	}
+	etcdClients, err := getEtcdClients(config)
+	if err != nil {
+		log.Printf("unable to get etcd client: %s", err)
+		return 30
+	}
+	conjurClients, err := getConjurClients(config)
+	if err != nil {
+		log.Printf("unable to get Conjur client: %s", err)
+		return 30
+	}
+
+	var result pentagon.SyncResult
+	opts := []pentagon.Option{
+		pentagon.WithInstance(config.Instance),
+		pentagon.WithLabels(config.Labels),
+		pentagon.WithPolicies(config.Policies),
+		pentagon.WithDeletionGuard(config.DeletionGuard.MaxRemovedKeys, config.DeletionGuard.MaxShrink),
+		pentagon.WithRetries(config.Retries, config.RetryBackoff),
+		pentagon.WithVaultTimeout(config.Vault.Timeout),
+		pentagon.WithSources(sourceLogicals(config, sources, etcdClients, conjurClients)),
+		pentagon.WithResults(func(res pentagon.SyncResult) { result = res }),
+	}
+	if config.Backups {
+		opts = append(opts, pentagon.WithBackups())
+	}
+	if config.Vault.CheckVersions {
+		opts = append(opts, pentagon.WithVersionCheck())
+	}
+	if config.Vault.RenewLeases {
+		opts = append(opts, pentagon.WithLeaseRenewal())
+	}
+	if config.Kubernetes.VerifyWrites {
+		opts = append(opts, pentagon.WithWriteVerification())
+	}
+	opts = append(opts, auditOptions(config, k8sClient)...)
+	if config.State.ConfigMap != "" {
+		opts = append(opts, pentagon.WithStateStore(pentagon.NewConfigMapStateStore(
+			k8sClient,
+			config.Namespace,
+			config.State.ConfigMap,
+		)))
+	}
+
+	anchor, err := getAnchor(config, k8sClient)
+	if err != nil {
+		log.Printf("unable to set up owner references: %s", err)
+		return 31
+	}
+	if anchor != nil {
+		opts = append(opts, pentagon.WithOwnerReferences(anchor))
+	}
+
+	reflector := pentagon.NewReflector(
+		vaultLogical(vaultClient, config.Vault),
+		k8sClient,
+		config.Namespace,
+		config.Label,
+		opts...,
+	)
+
+	err = reflector.Sync(context.Background(), []pentagon.Mapping{*mapping})
+	if err != nil && result.Err == nil {
+		result.Mapping = *mapping
+		result.Err = err
+	}
+
+	// the keys of the secret show what the mapping wrote.
+	secret, getErr := k8sClient.CoreV1().Secrets(config.Namespace).Get(
+		mapping.SecretName,
+		metav1.GetOptions{},
+	)
+	if getErr != nil {
+		secret = nil
+	}
+
+	if err := writeSyncResult(os.Stdout, config.Namespace, result, secret); err != nil {
+		log.Printf("error writing result: %s", err)
+	}
+	if result.Err != nil {
+		return 40
+	}
+	return 0
+}
+
+// writeSyncResult writes the outcome of syncing the mapping of result in
+// namespace, and the keys of its secret if it exists.
+func writeSyncResult(
+	w io.Writer,
+	namespace string,
+	result pentagon.SyncResult,
+	secret *v1.Secret,
+) error {
+	status := "synced"
+	switch {
+	case result.Err != nil:
+		status = fmt.Sprintf("failed: %s", result.Err)
+	case result.Paused:
+		status = "paused"
+	}
+
+	lines := []string{
+		fmt.Sprintf("secret:     %s/%s", namespace, result.Mapping.SecretName),
+		fmt.Sprintf("vault path: %s", result.Mapping.VaultPath),
+		fmt.Sprintf("status:     %s", status),
+	}
+	if result.Version != "" {
+		lines = append(lines, fmt.Sprintf("version:    %s", result.Version))
+	}
+	if secret != nil {
+		keys := make([]string, 0, len(secret.Data))
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		lines = append(
+			lines,
+			fmt.Sprintf("keys:       %s", strings.Join(keys, ", ")),
+			fmt.Sprintf("synced at:  %s", secret.Annotations[pentagon.LastSyncedAnnotation]),
+		)
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon"
+)
+
+func TestWriteSyncResult(t *testing.T) {
+	mapping := pentagon.Mapping{VaultPath: "secrets/data/foo", SecretName: "foo"}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				pentagon.LastSyncedAnnotation: "2024-01-02T03:04:05Z",
+			},
+		},
+		Data: map[string][]byte{"password": nil, "user": nil},
+	}
+
+	buf := &bytes.Buffer{}
+	err := writeSyncResult(buf, "default", pentagon.SyncResult{
+		Mapping: mapping,
+		Version: "3",
+	}, secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := strings.Join([]string{
+		"secret:     default/foo",
+		"vault path: secrets/data/foo",
+		"status:     synced",
+		"version:    3",
+		"keys:       password, user",
+		"synced at:  2024-01-02T03:04:05Z",
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	err = writeSyncResult(buf, "default", pentagon.SyncResult{
+		Mapping: mapping,
+		Err:     fmt.Errorf("secret secrets/data/foo not found"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(buf.String(), "status:     failed: secret secrets/data/foo not found\n") ||
+		strings.Contains(buf.String(), "keys:") {
+		t.Errorf("unexpected output of a failure:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// notifier tells systemd about pentagon when it runs as a Type=notify
+// service, and does nothing otherwise.
+var notifier = newSystemd()
+
+// systemd notifies systemd of pentagon's readiness and pings its watchdog,
+// see sd_notify(3).  The watchdog is only pinged while the last pass
+// succeeded, so systemd restarts pentagon once passes fail for longer than
+// WatchdogSec.
+type systemd struct {
+	// socket is $NOTIFY_SOCKET, empty when not run by systemd.
+	socket string
+
+	// watchdog is the WatchdogSec of the service, or zero without a
+	// watchdog.
+	watchdog time.Duration
+
+	ready   int32
+	healthy int32
+}
+
+// newSystemd returns a systemd notifier configured from the environment
+// systemd sets for the service.
+func newSystemd() *systemd {
+	s := &systemd{socket: os.Getenv("NOTIFY_SOCKET")}
+
+	// the watchdog may be meant for another process of the service.
+	pid := os.Getenv("WATCHDOG_PID")
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return s
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err == nil && usec > 0 {
+		s.watchdog = time.Duration(usec) * time.Microsecond
+	}
+	return s
+}
+
+// notify sends state, e.g. "READY=1", to systemd.
+func (s *systemd) notify(state string) error {
+	if s.socket == "" {
+		return nil
+	}
+	conn, err := net.Dial("unixgram", s.socket)
+	if err != nil {
+		return fmt.Errorf("error connecting to systemd: %s", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return fmt.Errorf("error notifying systemd: %s", err)
+	}
+	return nil
+}
+
+// passed records a successful pass.  systemd is told pentagon is ready
+// after the first one.
+func (s *systemd) passed() {
+	atomic.StoreInt32(&s.healthy, 1)
+	state := "STATUS=last pass succeeded"
+	if atomic.CompareAndSwapInt32(&s.ready, 0, 1) {
+		state = "READY=1\n" + state
+	}
+	if err := s.notify(state); err != nil {
+		log.Print(err)
+	}
+}
+
+// failed records a failed pass, which stops the watchdog pings until a
+// pass succeeds again.
+func (s *systemd) failed(err error) {
+	atomic.StoreInt32(&s.healthy, 0)
+	if err := s.notify(fmt.Sprintf("STATUS=last pass failed: %s", err)); err != nil {
+		log.Print(err)
+	}
+}
+
+// ping pings the watchdog if the last pass succeeded, and returns whether
+// it did.
+func (s *systemd) ping() bool {
+	if atomic.LoadInt32(&s.healthy) != 1 {
+		return false
+	}
+	if err := s.notify("WATCHDOG=1"); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+// runWatchdog pings the watchdog twice per WatchdogSec until ctx is done.
+func (s *systemd) runWatchdog(ctx context.Context) {
+	if s.socket == "" || s.watchdog <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.watchdog / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.ping()
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSystemdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pentagon-systemd")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	defer conn.Close()
+
+	received := func() string {
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("nothing was sent to systemd: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	s := &systemd{socket: socket, watchdog: time.Second}
+	if s.ping() {
+		t.Error("the watchdog shouldn't be pinged before a pass succeeded")
+	}
+
+	s.passed()
+	if state := received(); state != "READY=1\nSTATUS=last pass succeeded" {
+		t.Errorf("unexpected state after the first pass: %q", state)
+	}
+	if !s.ping() {
+		t.Error("the watchdog should be pinged after a pass succeeded")
+	}
+	if state := received(); state != "WATCHDOG=1" {
+		t.Errorf("unexpected watchdog ping: %q", state)
+	}
+
+	s.failed(errors.New("vault is down"))
+	if state := received(); state != "STATUS=last pass failed: vault is down" {
+		t.Errorf("unexpected state after a failed pass: %q", state)
+	}
+	if s.ping() {
+		t.Error("the watchdog shouldn't be pinged after a pass failed")
+	}
+
+	s.passed()
+	if state := received(); state != "STATUS=last pass succeeded" {
+		t.Errorf("readiness should only be sent once: %q", state)
+	}
+}
+
+func TestSystemdOutsideSystemd(t *testing.T) {
+	s := &systemd{}
+	s.passed()
+	if err := s.notify("READY=1"); err != nil {
+		t.Errorf("notifying without systemd should do nothing: %s", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var tokenTTLGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pentagon_vault_token_ttl_seconds",
+	Help: "Remaining time to live of the vault token at the last check. 0 for tokens that don't expire",
+})
+
+// tokenCheckInterval is how often the vault token's time to live is
+// checked.
+const tokenCheckInterval = time.Minute
+
+// tokenTTLer looks up the remaining time to live of a vault token.
+type tokenTTLer interface {
+	TokenTTL(ctx context.Context) (time.Duration, error)
+}
+
+// watchToken checks the time to live of the vault token every
+// tokenCheckInterval until ctx is done.
+func watchToken(ctx context.Context, token tokenTTLer, warning time.Duration) {
+	ticker := time.NewTicker(tokenCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		checkToken(ctx, token, warning)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkToken updates the token time to live gauge and warns when the token
+// expires in less than warning, which happens when logging in again keeps
+// failing.
+func checkToken(ctx context.Context, token tokenTTLer, warning time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, tokenCheckInterval)
+	defer cancel()
+
+	ttl, err := token.TokenTTL(ctx)
+	if err != nil {
+		log.Printf("error looking up vault token: %s", err)
+		return
+	}
+
+	tokenTTLGauge.Set(ttl.Seconds())
+	if ttl > 0 && ttl < warning {
+		log.Printf("warning: vault token expires in %s", ttl)
+	}
+}
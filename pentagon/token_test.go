@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeToken struct {
+	ttl time.Duration
+	err error
+}
+
+func (f fakeToken) TokenTTL(ctx context.Context) (time.Duration, error) {
+	return f.ttl, f.err
+}
+
+func TestCheckToken(t *testing.T) {
+	checkToken(context.Background(), fakeToken{ttl: 90 * time.Second}, time.Minute)
+	if v := testutil.ToFloat64(tokenTTLGauge); v != 90 {
+		t.Errorf("expected ttl 90, got %v", v)
+	}
+
+	// failed lookups leave the last ttl.
+	checkToken(context.Background(), fakeToken{err: fmt.Errorf("permission denied")}, time.Minute)
+	if v := testutil.ToFloat64(tokenTTLGauge); v != 90 {
+		t.Errorf("expected ttl 90 after a failed lookup, got %v", v)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/vimeo/pentagon"
+)
+
+// tokenCommandTimeout is how long the token command may run.
+const tokenCommandTimeout = 30 * time.Second
+
+// setVaultTokenViaCommand sets the token of vaultClient to the output of
+// the configured token command.
+func setVaultTokenViaCommand(vaultClient *api.Client, vaultConfig pentagon.VaultConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenCommandTimeout)
+	defer cancel()
+
+	token, err := runTokenCommand(ctx, vaultConfig.TokenCommand)
+	if err != nil {
+		return err
+	}
+	vaultClient.SetToken(token)
+	return nil
+}
+
+// runTokenCommand runs command and returns the token it printed.  The
+// command is killed when ctx is done.
+func runTokenCommand(ctx context.Context, command []string) (string, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf(
+			"token command %s failed: %s: %s",
+			command[0],
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", fmt.Errorf("token command %s printed no token", command[0])
+	}
+	return token, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunTokenCommand(t *testing.T) {
+	for testName, tbl := range map[string]struct {
+		command  []string
+		expected string
+		err      bool
+	}{
+		"token":    {[]string{"sh", "-c", "echo s.abcd"}, "s.abcd", false},
+		"failure":  {[]string{"sh", "-c", "echo denied >&2; exit 1"}, "", true},
+		"no token": {[]string{"true"}, "", true},
+		"missing":  {[]string{"/nonexistent/helper", "get"}, "", true},
+	} {
+		token, err := runTokenCommand(context.Background(), tbl.command)
+		if (err != nil) != tbl.err {
+			t.Errorf("%s: unexpected error: %v", testName, err)
+			continue
+		}
+		if token != tbl.expected {
+			t.Errorf("%s: expected %q, got %q", testName, tbl.expected, token)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+// setVaultTokenViaSecret sets the token of vaultClient to the one in the
+// configured kubernetes secret.  The secret is read on every login so that
+// rotated tokens are picked up.
+func setVaultTokenViaSecret(
+	vaultClient *api.Client,
+	vaultConfig pentagon.VaultConfig,
+	k8sClient kubernetes.Interface,
+) error {
+	ref := vaultConfig.TokenSecret
+	secret, err := k8sClient.CoreV1().Secrets(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting secret %s/%s: %s", ref.Namespace, ref.Name, err)
+	}
+	token, err := secretToken(secret, ref.Key)
+	if err != nil {
+		return err
+	}
+	vaultClient.SetToken(token)
+	return nil
+}
+
+// secretToken returns the vault token in the key of secret.
+func secretToken(secret *v1.Secret, key string) (string, error) {
+	token := strings.TrimSpace(string(secret.Data[key]))
+	if token == "" {
+		return "", fmt.Errorf(
+			"secret %s/%s has no token in key %s",
+			secret.Namespace,
+			secret.Name,
+			key,
+		)
+	}
+	return token, nil
+}
+
+// watchTokenSecret sets the token of vaultClient as soon as the configured
+// kubernetes secret is updated with a new one, until ctx is done.
+func watchTokenSecret(
+	ctx context.Context,
+	vaultClient *api.Client,
+	vaultConfig pentagon.VaultConfig,
+	k8sClient kubernetes.Interface,
+) {
+	ref := vaultConfig.TokenSecret
+	informer := coreinformers.NewFilteredSecretInformer(
+		k8sClient,
+		ref.Namespace,
+		0,
+		cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", ref.Name).String()
+		},
+	)
+
+	update := func(obj interface{}) {
+		secret, ok := obj.(*v1.Secret)
+		if !ok {
+			return
+		}
+		token, err := secretToken(secret, ref.Key)
+		if err != nil {
+			log.Printf("ignoring update of the vault token secret: %s", err)
+			return
+		}
+		if token != vaultClient.Token() {
+			log.Printf("vault token rotated in secret %s/%s", ref.Namespace, ref.Name)
+			vaultClient.SetToken(token)
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj interface{}) { update(obj) },
+	})
+	informer.Run(ctx.Done())
+}
+
+// watchTokenSecrets watches the token secrets of vault and of the sources
+// logging in with vault.AuthTypeKubernetesSecret until ctx is done.
+func watchTokenSecrets(
+	ctx context.Context,
+	vaultClient *api.Client,
+	config *pentagon.Config,
+	sources map[string]*api.Client,
+	k8sClient kubernetes.Interface,
+) {
+	if config.Vault.AuthType == vault.AuthTypeKubernetesSecret {
+		go watchTokenSecret(ctx, vaultClient, config.Vault, k8sClient)
+	}
+	for name, client := range sources {
+		if config.Sources[name].AuthType == vault.AuthTypeKubernetesSecret {
+			go watchTokenSecret(ctx, client, config.Sources[name], k8sClient)
+		}
+	}
+}
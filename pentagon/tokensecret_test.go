@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestVaultTokenViaSecret(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: "broker"},
+		Data:       map[string][]byte{"token": []byte("s.abcd\n")},
+	})
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatalf("unable to create vault client: %s", err)
+	}
+
+	vaultConfig := pentagon.VaultConfig{
+		AuthType: vault.AuthTypeKubernetesSecret,
+		TokenSecret: pentagon.TokenSecretConfig{
+			Namespace: "broker",
+			Name:      "vault-token",
+			Key:       "token",
+		},
+	}
+	if err := setVaultToken(client, vaultConfig, k8sClient); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if client.Token() != "s.abcd" {
+		t.Fatalf("unexpected token: %q", client.Token())
+	}
+
+	vaultConfig.TokenSecret.Key = "missing"
+	if err := setVaultToken(client, vaultConfig, k8sClient); err == nil {
+		t.Fatal("a missing key should have failed")
+	}
+
+	vaultConfig.TokenSecret.Name = "missing"
+	if err := setVaultToken(client, vaultConfig, k8sClient); err == nil {
+		t.Fatal("a missing secret should have failed")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/vimeo/pentagon"
+)
+
+// VERSION and BUILD are set by the Makefile with -ldflags.
+var (
+	VERSION = "dev"
+	BUILD   = ""
+)
+
+// userAgent returns the User-Agent that the vault and kubernetes clients
+// send, "pentagon/<version>/<instance>", so that vault audit logs and API
+// server logs attribute requests to the pentagon deployment making them.
+// The instance defaults to the label, and is left out without config.
+func userAgent(config *pentagon.Config) string {
+	if config == nil {
+		return fmt.Sprintf("pentagon/%s", VERSION)
+	}
+	instance := config.Instance
+	if instance == "" {
+		instance = config.Label
+	}
+	return fmt.Sprintf("pentagon/%s/%s", VERSION, instance)
+}
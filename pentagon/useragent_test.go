@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/vimeo/pentagon"
+)
+
+func TestUserAgent(t *testing.T) {
+	for _, tbl := range []struct {
+		config   *pentagon.Config
+		expected string
+	}{
+		{nil, "pentagon/dev"},
+		{&pentagon.Config{Label: "payments"}, "pentagon/dev/payments"},
+		{&pentagon.Config{Label: "payments", Instance: "payments-eu"}, "pentagon/dev/payments-eu"},
+	} {
+		if actual := userAgent(tbl.config); actual != tbl.expected {
+			t.Errorf("expected %q, got %q", tbl.expected, actual)
+		}
+	}
+}
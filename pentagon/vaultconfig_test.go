@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/vimeo/pentagon"
+)
+
+func TestVaultTLSServerName(t *testing.T) {
+	for testName, tbl := range map[string]struct {
+		tls        *api.TLSConfig
+		serverName string
+		expected   string
+	}{
+		"unset":    {nil, "", ""},
+		"option":   {nil, "vault.example.com", "vault.example.com"},
+		"tls":      {&api.TLSConfig{TLSServerName: "tls.example.com"}, "", "tls.example.com"},
+		"override": {&api.TLSConfig{TLSServerName: "tls.example.com"}, "vault.example.com", "vault.example.com"},
+	} {
+		c, err := vaultAPIConfig(pentagon.VaultConfig{
+			URL:           "https://10.0.0.1:8200",
+			TLSConfig:     tbl.tls,
+			TLSServerName: tbl.serverName,
+		}, pentagon.TLSConfig{}, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", testName, err)
+		}
+
+		tlsConfig := c.HttpClient.Transport.(*http.Transport).TLSClientConfig
+		if tlsConfig.ServerName != tbl.expected {
+			t.Errorf("%s: expected server name %q, got %q", testName, tbl.expected, tlsConfig.ServerName)
+		}
+	}
+}
+
+func TestVaultTransport(t *testing.T) {
+	c, err := vaultAPIConfig(pentagon.VaultConfig{
+		URL: "https://vault.example.com:8200",
+		Transport: pentagon.TransportConfig{
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     time.Minute,
+		},
+	}, pentagon.TLSConfig{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	transport := c.HttpClient.Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 64 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("unexpected transport: %+v", transport)
+	}
+}
@@ -0,0 +1,66 @@
+package pentagontest
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon"
+)
+
+// NewReflector returns a reflector reading from v over HTTP and writing to
+// namespace of a fake clientset holding objects, with the secrets labeled
+// with labelValue, along with the clientset.
+func NewReflector(
+	t testing.TB,
+	v *Vault,
+	namespace string,
+	labelValue string,
+	objects []runtime.Object,
+	opts ...pentagon.Option,
+) (*pentagon.Reflector, *k8sfake.Clientset) {
+	t.Helper()
+
+	k8sClient := k8sfake.NewSimpleClientset(objects...)
+	r := pentagon.NewReflector(v.Logical(t), k8sClient, namespace, labelValue, opts...)
+	return r, k8sClient
+}
+
+// SecretData returns the data of the secret named name in namespace as
+// strings, failing the test if it doesn't exist.
+func SecretData(
+	t testing.TB,
+	k8sClient kubernetes.Interface,
+	namespace string,
+	name string,
+) map[string]string {
+	t.Helper()
+
+	secret, err := k8sClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get secret %s/%s: %s", namespace, name, err)
+	}
+	data := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	return data
+}
+
+// NoSecret fails the test if the secret named name exists in namespace.
+func NoSecret(
+	t testing.TB,
+	k8sClient kubernetes.Interface,
+	namespace string,
+	name string,
+) {
+	t.Helper()
+
+	_, err := k8sClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err == nil {
+		t.Fatalf("secret %s/%s shouldn't exist", namespace, name)
+	}
+}
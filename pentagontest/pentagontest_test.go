@@ -0,0 +1,71 @@
+package pentagontest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vimeo/pentagon"
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestReflect(t *testing.T) {
+	v := NewVault(t, map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+		"kv":      vault.EngineTypeKeyValueV1,
+	}, map[string]map[string]interface{}{
+		"secrets/data/foo": {"password": "hunter2"},
+		"kv/bar":           {"token": "abc"},
+	})
+	defer v.Close()
+
+	r, k8sClient := NewReflector(t, v, pentagon.DefaultNamespace, "test", nil)
+	mappings := []pentagon.Mapping{
+		{VaultPath: "secrets/data/foo", SecretName: "foo", VaultEngineType: vault.EngineTypeKeyValueV2},
+		{VaultPath: "kv/bar", SecretName: "bar", VaultEngineType: vault.EngineTypeKeyValueV1},
+	}
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if SecretData(t, k8sClient, pentagon.DefaultNamespace, "foo")["password"] != "hunter2" {
+		t.Fatal("foo should have been reflected")
+	}
+	if SecretData(t, k8sClient, pentagon.DefaultNamespace, "bar")["token"] != "abc" {
+		t.Fatal("bar should have been reflected")
+	}
+
+	// writes over HTTP create new versions, and removed mappings are
+	// reconciled.
+	if _, err := v.Logical(t).Write("secrets/data/foo", map[string]interface{}{
+		"data": map[string]interface{}{"password": "rotated"},
+	}); err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+	if err := r.Reflect(context.Background(), mappings[:1]); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	if SecretData(t, k8sClient, pentagon.DefaultNamespace, "foo")["password"] != "rotated" {
+		t.Fatal("foo should have been rotated")
+	}
+	NoSecret(t, k8sClient, pentagon.DefaultNamespace, "bar")
+
+	old, err := vault.ReadVersion(context.Background(), v.Logical(t), "secrets/data/foo", 1)
+	if err != nil || old == nil {
+		t.Fatalf("the first version should be readable: %v %v", old, err)
+	}
+}
+
+func TestVaultToken(t *testing.T) {
+	v := NewVault(t, map[string]vault.EngineType{"kv": vault.EngineTypeKeyValueV1}, nil)
+	defer v.Close()
+
+	client := v.Client(t)
+	client.SetToken("wrong")
+	if _, err := client.Logical().Read("kv/foo"); !vault.IsPermissionDenied(err) {
+		t.Fatalf("a wrong token should have been denied: %v", err)
+	}
+
+	secret, err := v.Logical(t).Read("kv/missing")
+	if err != nil || secret != nil {
+		t.Fatalf("missing secrets should read as nil: %v %v", secret, err)
+	}
+}
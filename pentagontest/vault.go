@@ -0,0 +1,158 @@
+// Package pentagontest provides an in-memory vault server and helpers
+// wiring it to a fake kubernetes clientset, for integration tests of code
+// embedding a pentagon Reflector.
+package pentagontest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// Token is the only token the vault server of NewVault accepts.
+const Token = "pentagontest"
+
+// Vault is a vault server keeping its secrets in a vault.Mock.  It serves
+// reads, writes and deletes of secrets, including old versions of
+// key/value v2 secrets, over HTTP like vault does.
+type Vault struct {
+	*vault.Mock
+	server *httptest.Server
+}
+
+// NewVault starts a vault server with the engines of mounts, keyed by the
+// first segment of their paths, and pre-loaded with fixtures keyed by
+// vault path.  Close stops the server.
+func NewVault(
+	t testing.TB,
+	mounts map[string]vault.EngineType,
+	fixtures map[string]map[string]interface{},
+) *Vault {
+	t.Helper()
+
+	v := &Vault{Mock: vault.NewMock(mounts)}
+	for path, data := range fixtures {
+		if _, err := v.Write(path, data); err != nil {
+			t.Fatalf("unable to load fixture %s: %s", path, err)
+		}
+	}
+
+	v.server = httptest.NewServer(http.HandlerFunc(v.serveHTTP))
+	return v
+}
+
+// Close stops the server.
+func (v *Vault) Close() {
+	v.server.Close()
+}
+
+// LoadFixtures loads the fixture files in dir like vault.Mock.LoadFixtures,
+// failing the test if they are invalid.
+func (v *Vault) LoadFixtures(t testing.TB, dir string) {
+	t.Helper()
+	if err := v.Mock.LoadFixtures(dir); err != nil {
+		t.Fatalf("unable to load fixtures: %s", err)
+	}
+}
+
+// URL returns the address of the server.
+func (v *Vault) URL() string {
+	return v.server.URL
+}
+
+// Client returns a vault api client logged in to the server.
+func (v *Vault) Client(t testing.TB) *api.Client {
+	t.Helper()
+
+	config := api.DefaultConfig()
+	config.Address = v.server.URL
+	config.MaxRetries = 0
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("unable to create vault client: %s", err)
+	}
+	client.SetToken(Token)
+	return client
+}
+
+// Logical returns a vault.Logical reading from the server over HTTP, like
+// the one pentagon uses.
+func (v *Vault) Logical(t testing.TB) vault.Logical {
+	t.Helper()
+	return vault.NewClient(v.Client(t))
+}
+
+// serveHTTP serves the secrets API under /v1/.
+func (v *Vault) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != Token {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		writeErrors(w, http.StatusNotFound, "no handler for route")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	var secret *api.Secret
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		secret, err = v.read(r, path)
+	case http.MethodPut, http.MethodPost:
+		data := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		secret, err = v.Write(path, data)
+	case http.MethodDelete:
+		v.Delete(path)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeErrors(w, http.StatusMethodNotAllowed, "unsupported method")
+		return
+	}
+
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if secret == nil {
+		writeErrors(w, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secret)
+}
+
+// read reads the secret at path, or the version of the query.
+func (v *Vault) read(r *http.Request, path string) (*api.Secret, error) {
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		return v.Read(path)
+	}
+	n, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return v.ReadVersion(r.Context(), path, n)
+}
+
+// writeErrors writes an error response like vault's.
+func writeErrors(w http.ResponseWriter, status int, errs ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if errs == nil {
+		errs = []string{}
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"errors": errs})
+}
@@ -0,0 +1,128 @@
+package pentagon
+
+import (
+	"fmt"
+	"path"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Policy is a rule that the secrets written by a reflector must follow.
+// Writes of secrets that violate a policy are blocked.  Policies are
+// declarative, there are no CEL or Rego expressions.
+type Policy struct {
+	// Name identifies the policy in violation messages.
+	Name string `yaml:"name"`
+
+	// Namespaces limits the policy to secrets in these namespaces.  Empty
+	// means every namespace.
+	Namespaces []string `yaml:"namespaces"`
+
+	// DeniedKeys are patterns, as matched by path.Match, of keys that
+	// secrets must not contain.
+	DeniedKeys []string `yaml:"deniedKeys"`
+
+	// MaxValueSize is the maximum size of a single value in bytes.  Zero
+	// means no limit.
+	MaxValueSize int `yaml:"maxValueSize"`
+
+	// MaxSize is the maximum size of all of the keys and values of a secret
+	// in bytes.  Zero means no limit.
+	MaxSize int `yaml:"maxSize"`
+
+	// AllowedTypes lists the types that secrets may have.  Empty means any
+	// type.
+	AllowedTypes []v1.SecretType `yaml:"allowedTypes"`
+}
+
+// Validate makes sure that the policy can be evaluated.
+func (p Policy) Validate() error {
+	for _, pattern := range p.DeniedKeys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid deniedKeys pattern %q: %s", pattern, err)
+		}
+	}
+	if p.MaxValueSize < 0 || p.MaxSize < 0 {
+		return fmt.Errorf("maxValueSize and maxSize must not be negative")
+	}
+	return nil
+}
+
+// Check returns an error describing the first violation of the policy by
+// secret in namespace, or nil if it complies.
+func (p Policy) Check(namespace string, secret *v1.Secret) error {
+	if len(p.Namespaces) > 0 && !contains(p.Namespaces, namespace) {
+		return nil
+	}
+
+	violation := func(format string, args ...interface{}) error {
+		return fmt.Errorf(
+			"policy %s: secrets in namespace %s %s",
+			p.Name,
+			namespace,
+			fmt.Sprintf(format, args...),
+		)
+	}
+
+	if len(p.AllowedTypes) > 0 {
+		allowed := false
+		for _, t := range p.AllowedTypes {
+			allowed = allowed || t == secret.Type
+		}
+		if !allowed {
+			return violation("must not have type %s", secret.Type)
+		}
+	}
+
+	size := 0
+	for _, key := range sortedKeys(secret.Data) {
+		value := secret.Data[key]
+		for _, pattern := range p.DeniedKeys {
+			if matched, _ := path.Match(pattern, key); matched {
+				return violation("must not contain key %s", key)
+			}
+		}
+		if p.MaxValueSize > 0 && len(value) > p.MaxValueSize {
+			return violation(
+				"must not have values over %d bytes, %s has %d",
+				p.MaxValueSize,
+				key,
+				len(value),
+			)
+		}
+		size += len(key) + len(value)
+	}
+	if p.MaxSize > 0 && size > p.MaxSize {
+		return violation("must not be over %d bytes, %s is %d", p.MaxSize, secret.Name, size)
+	}
+
+	return nil
+}
+
+// WithPolicies blocks the writes of secrets that violate any of policies.
+func WithPolicies(policies []Policy) Option {
+	return func(r *Reflector) {
+		r.policies = policies
+	}
+}
+
+// checkPolicies returns the first violation of the reflector's policies by
+// secret.
+func (r *Reflector) checkPolicies(secret *v1.Secret) error {
+	for _, p := range r.policies {
+		if err := p.Check(r.k8sNamespace, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contains returns true if values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
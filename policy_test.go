@@ -0,0 +1,71 @@
+package pentagon
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Data: map[string][]byte{
+			"DEBUG_TOKEN": []byte("secret"),
+			"password":    []byte("hunter2"),
+		},
+		Type: v1.SecretTypeOpaque,
+	}
+
+	for testName, tbl := range map[string]struct {
+		policy    Policy
+		namespace string
+		violation string
+	}{
+		"denied key": {
+			policy:    Policy{Name: "no-debug", Namespaces: []string{"prod"}, DeniedKeys: []string{"DEBUG_*"}},
+			namespace: "prod",
+			violation: "policy no-debug: secrets in namespace prod must not contain key DEBUG_TOKEN",
+		},
+		"other namespace": {
+			policy:    Policy{Name: "no-debug", Namespaces: []string{"prod"}, DeniedKeys: []string{"DEBUG_*"}},
+			namespace: "dev",
+		},
+		"value size": {
+			policy:    Policy{Name: "small", MaxValueSize: 6},
+			namespace: "dev",
+			violation: "policy small: secrets in namespace dev must not have values over 6 bytes, password has 7",
+		},
+		"total size": {
+			policy:    Policy{Name: "small", MaxSize: 20},
+			namespace: "dev",
+			violation: "policy small: secrets in namespace dev must not be over 20 bytes, app is 32",
+		},
+		"type": {
+			policy:    Policy{Name: "tls", AllowedTypes: []v1.SecretType{v1.SecretTypeTLS}},
+			namespace: "dev",
+			violation: "policy tls: secrets in namespace dev must not have type Opaque",
+		},
+		"compliant": {
+			policy:    Policy{Name: "all", DeniedKeys: []string{"token"}, MaxValueSize: 7, MaxSize: 32},
+			namespace: "dev",
+		},
+	} {
+		err := tbl.policy.Check(tbl.namespace, secret)
+		switch {
+		case tbl.violation == "" && err != nil:
+			t.Errorf("%s: unexpected violation: %s", testName, err)
+		case tbl.violation != "" && (err == nil || err.Error() != tbl.violation):
+			t.Errorf("%s: expected %q, got %v", testName, tbl.violation, err)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := (Policy{DeniedKeys: []string{"["}}).Validate(); err == nil {
+		t.Fatal("invalid patterns should be refused")
+	}
+	if err := (Policy{MaxSize: -1}).Validate(); err == nil {
+		t.Fatal("negative sizes should be refused")
+	}
+}
@@ -0,0 +1,13 @@
+package pentagon
+
+import "sort"
+
+// byPriority returns mappings sorted by descending Priority, keeping the
+// order of mappings with the same priority.
+func byPriority(mappings []Mapping) []Mapping {
+	sorted := append([]Mapping{}, mappings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	return sorted
+}
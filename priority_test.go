@@ -0,0 +1,75 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestPriority(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+
+	mappings := []Mapping{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("foo%d", i)
+		vaultClient.Write("secrets/"+name, map[string]interface{}{"foo": name})
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/" + name,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			Priority:        i % 3,
+		})
+	}
+
+	var mu sync.Mutex
+	priorities := []int{}
+	r := NewReflector(
+		vaultClient,
+		k8sfake.NewSimpleClientset(),
+		DefaultNamespace,
+		"test",
+		WithWorkers(4),
+		WithResults(func(res SyncResult) {
+			mu.Lock()
+			priorities = append(priorities, res.Mapping.Priority)
+			mu.Unlock()
+		}),
+	)
+
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	if len(priorities) != len(mappings) {
+		t.Fatalf("expected %d results, got %d", len(mappings), len(priorities))
+	}
+	for i := 1; i < len(priorities); i++ {
+		if priorities[i] > priorities[i-1] {
+			t.Fatalf("mappings were reflected out of priority order: %v", priorities)
+		}
+	}
+}
+
+func TestByPriority(t *testing.T) {
+	sorted := byPriority([]Mapping{
+		{SecretName: "a"},
+		{SecretName: "b", Priority: -1},
+		{SecretName: "c", Priority: 10},
+		{SecretName: "d"},
+	})
+
+	names := ""
+	for _, m := range sorted {
+		names += m.SecretName
+	}
+	if names != "cadb" {
+		t.Fatalf("unexpected order: %s", names)
+	}
+}
@@ -0,0 +1,102 @@
+package pentagon
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// readCache deduplicates vault reads within a single pass so that many
+// mappings referencing the same vault path only read it once.  Entries are
+// keyed by the full path that is read, so reads of different versions of
+// the same secret are kept apart.  Failed reads are not cached so that they
+// can be retried.
+type readCache struct {
+	vaultClient vault.Logical
+
+	mu      sync.Mutex
+	entries map[string]*readCacheEntry
+	data    map[dataKey]map[string][]byte
+}
+
+// dataKey identifies converted secret data.
+type dataKey struct {
+	path       string
+	engineType vault.EngineType
+}
+
+type readCacheEntry struct {
+	done   chan struct{}
+	secret *api.Secret
+	err    error
+}
+
+func newReadCache(vaultClient vault.Logical) *readCache {
+	return &readCache{
+		vaultClient: vaultClient,
+		entries:     map[string]*readCacheEntry{},
+		data:        map[dataKey]map[string][]byte{},
+	}
+}
+
+// Read reads path from vault unless it has already been read (or is being
+// read by another worker) in which case that result is returned.
+func (c *readCache) Read(ctx context.Context, path string) (*api.Secret, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[path]; ok {
+		c.mu.Unlock()
+		select {
+		case <-entry.done:
+			return entry.secret, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	entry := &readCacheEntry{done: make(chan struct{})}
+	c.entries[path] = entry
+	c.mu.Unlock()
+
+	entry.secret, entry.err = vault.ReadWithContext(ctx, c.vaultClient, path)
+	close(entry.done)
+
+	if entry.err != nil {
+		c.mu.Lock()
+		delete(c.entries, path)
+		c.mu.Unlock()
+	}
+
+	return entry.secret, entry.err
+}
+
+// Data converts secret, which was read from path, to k8s secret data for
+// engineType.  The conversion is only done once per path and engine type so
+// that large values are only copied once per pass.  The returned data is
+// shared and must not be modified.
+func (c *readCache) Data(
+	path string,
+	engineType vault.EngineType,
+	secret *api.Secret,
+) (map[string][]byte, error) {
+	key := dataKey{path: path, engineType: engineType}
+
+	c.mu.Lock()
+	data, ok := c.data[key]
+	c.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	data, err := secretData(secret, engineType)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.data[key] = data
+	c.mu.Unlock()
+
+	return data, nil
+}
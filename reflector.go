@@ -1,14 +1,27 @@
 package pentagon
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/time/rate"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/vimeo/pentagon/vault"
 )
@@ -17,184 +30,1184 @@ import (
 // by pentagon.
 const LabelKey = "pentagon"
 
+// VersionAnnotation is the annotation recording the version of the key/value
+// v2 secret that was reflected into a k8s secret.
+const VersionAnnotation = "pentagon.vimeo.com/vault-version"
+
+// PathAnnotation is the annotation recording the vault path that was
+// reflected into a k8s secret.  Together with VersionAnnotation it lets a
+// restarted pentagon skip secrets that are already up to date.
+const PathAnnotation = "pentagon.vimeo.com/vault-path"
+
+// LastSyncedAnnotation is the annotation recording when pentagon last wrote
+// a k8s secret, in RFC 3339 format.  Secrets that are already up to date
+// aren't written, so it doesn't change on every pass.
+const LastSyncedAnnotation = "pentagon.vimeo.com/last-synced"
+
+// ErrorPolicy controls what happens to the rest of a pass when reflecting a
+// single mapping fails.
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyAbort stops the pass at the first failed mapping.
+	ErrorPolicyAbort ErrorPolicy = "abort"
+
+	// ErrorPolicyContinue reflects the remaining mappings after a failure.
+	// The pass still returns an error describing every failed mapping.
+	ErrorPolicyContinue ErrorPolicy = "continue"
+)
+
+// Option configures optional Reflector behavior.
+type Option func(*Reflector)
+
+// WithErrorPolicy sets the policy used when a mapping fails.  The default
+// is ErrorPolicyAbort.
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(r *Reflector) {
+		r.errorPolicy = policy
+	}
+}
+
+// WithRetries makes a failed mapping be retried up to retries times within
+// a pass, waiting backoff before the first retry and doubling the wait for
+// each one after that.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(r *Reflector) {
+		r.retries = retries
+		r.retryBackoff = backoff
+	}
+}
+
+// WithWorkers sets the number of mappings that are reflected concurrently.
+// The default is 1, which reflects mappings serially.
+func WithWorkers(workers int) Option {
+	return func(r *Reflector) {
+		if workers > 0 {
+			r.workers = workers
+		}
+	}
+}
+
+// WithWriteConcurrency limits the number of secret writes to kubernetes
+// that are in flight at once.  Zero means no limit beyond the number of
+// workers.
+func WithWriteConcurrency(limit int) Option {
+	return func(r *Reflector) {
+		if limit > 0 {
+			r.writeSem = make(chan struct{}, limit)
+		} else {
+			r.writeSem = nil
+		}
+	}
+}
+
+// WithVaultTimeout limits how long a single vault read may take.  Zero
+// means no limit other than the one set on the vault client.
+func WithVaultTimeout(timeout time.Duration) Option {
+	return func(r *Reflector) {
+		r.vaultTimeout = timeout
+	}
+}
+
+// WithVersionCheck makes the reflector read the metadata of key/value v2
+// secrets before their data.  If the version reflected into the existing
+// k8s secret is still the current version, the data isn't read at all.
+// This needs permission to read the secrets' metadata paths.
+func WithVersionCheck() Option {
+	return func(r *Reflector) {
+		r.versionCheck = true
+	}
+}
+
+// SyncResult is the outcome of reflecting a single mapping.
+type SyncResult struct {
+	Mapping Mapping
+
+	// Version is the version of the key/value v2 secret that the k8s
+	// secret now holds.  It is empty for other engines and failures.
+	Version string
+
+	// Err is the reason the mapping failed, or nil.
+	Err error
+
+	// Paused is set if the mapping was paused and its secret left alone.
+	Paused bool
+}
+
+// WithResults makes the reflector call report with the result of every
+// mapping it reflects.  report may be called concurrently by several
+// workers.  Mappings that were skipped aren't reported, but paused ones
+// are.
+func WithResults(report func(SyncResult)) Option {
+	return func(r *Reflector) {
+		r.report = report
+	}
+}
+
 // NewReflector returns a new relfector
 func NewReflector(
 	vaultClient vault.Logical,
 	k8sClient kubernetes.Interface,
 	k8sNamespace string,
 	labelValue string,
+	opts ...Option,
 ) *Reflector {
+	r := newReflector()
+	r.vaultClient = vaultClient
+	r.k8sClient = k8sClient
+	r.k8sNamespace = k8sNamespace
+	r.labelValue = labelValue
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.start(make(chan struct{}))
+
+	return r
+}
+
+// newReflector returns a reflector with the default settings.
+func newReflector() *Reflector {
 	return &Reflector{
-		vaultClient:  vaultClient,
-		k8sClient:    k8sClient,
-		k8sNamespace: k8sNamespace,
-		labelValue:   labelValue,
+		k8sNamespace:  DefaultNamespace,
+		labelValue:    DefaultLabelValue,
+		stopped:       make(chan struct{}),
+		errorPolicy:   ErrorPolicyAbort,
+		workers:       1,
+		paused:        map[string]struct{}{},
+		metricLabels:  MetricLabelsMapping,
+		failureCounts: map[string]int{},
+		topFailed:     map[string]struct{}{},
+		pausedLabels:  map[string]string{},
+		deletedLabels: map[string]string{},
+		certExpiry:    map[string]time.Time{},
+		certLabels:    map[string]string{},
+		started:       time.Now(),
+		lastSynced:    map[string]time.Time{},
+		states:        map[string]MappingState{},
+		stateDirty:    map[string]bool{},
+	}
+}
+
+// start finishes setting up a reflector once its options are applied.  A
+// cache requested with WithCache runs until stop is closed.
+func (r *Reflector) start(stop <-chan struct{}) {
+	if r.instance == "" {
+		r.instance = r.labelValue
+	}
+
+	if r.useCache && r.informerStop == nil {
+		r.informerStop = stop
+	}
+	if r.informerStop != nil {
+		r.startInformer()
 	}
 }
 
 // Reflector moves things from vault to kubernetes
 type Reflector struct {
 	vaultClient  vault.Logical
+	sources      map[string]vault.Logical
 	k8sClient    kubernetes.Interface
+	secretClient SecretClient
 	k8sNamespace string
 	labelValue   string
+	labels       map[string]string
+	instance     string
+	errorPolicy  ErrorPolicy
+	retries      int
+	retryBackoff time.Duration
+	workers      int
+	writeSem     chan struct{}
+	vaultTimeout time.Duration
+	shardIndex   int
+	shardCount   int
+	versionCheck bool
+	verifyWrites bool
+	report       func(SyncResult)
+	backups      bool
+	writeHooks   []WriteHook
+	policies     []Policy
+	metricLabels MetricLabels
+	topFailures  int
+	auditors     []Auditor
+
+	// set when using WithGroups or WithFilters, see filterMappings
+	onlyGroups        []string
+	skipGroups        []string
+	vaultPathFilters  []string
+	secretNameFilters []string
+
+	// set when using WithTransactions
+	transactions []string
+
+	// set when using WithDeletionGuard
+	deletionGuard DeletionGuardConfig
+
+	// set when using WithLeaseRenewal
+	leaseRenewal bool
+
+	// set when using WithStateStore
+	stateStore  StateStore
+	stateLoaded bool
+	stateDirty  map[string]bool
+
+	// set when using WithOwnerReferences, see secretOwners
+	ownerReferences bool
+	anchor          *metav1.OwnerReference
+	ownersMu        sync.Mutex
+	resourceOwners  map[string]metav1.OwnerReference
+
+	// changes not yet handed to the auditors
+	auditMu      sync.Mutex
+	auditEntries []AuditEntry
+
+	// per-mapping metric state, see metricLabel
+	metricsMu     sync.Mutex
+	failureCounts map[string]int
+	topFailed     map[string]struct{}
+	pausedLabels  map[string]string
+	deletedLabels map[string]string
+	certExpiry    map[string]time.Time
+	certLabels    map[string]string
+
+	// when each mapping was last reflected, see Stale
+	syncedMu   sync.Mutex
+	started    time.Time
+	lastSynced map[string]time.Time
+
+	// the state of each mapping, see State
+	stateMu sync.Mutex
+	states  map[string]MappingState
+
+	// secrets paused with Pause
+	pausedMu sync.Mutex
+	paused   map[string]struct{}
+
+	// set when using WithInformer or WithCache
+	useCache       bool
+	informerStop   <-chan struct{}
+	informerSynced cache.InformerSynced
+	secretLister   corelisters.SecretNamespaceLister
+
+	// closed by stop
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	// set when using WithRecreateDeleted
+	deleted         chan string
+	recreateLimiter *rate.Limiter
+}
+
+// selector selects the secrets managed by this reflector.
+func (r *Reflector) selector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{LabelKey: r.labelValue})
 }
 
 // Reflect actually syncs the values between vault and k8s secrets based on
-// the mappings passed.
-func (r *Reflector) Reflect(mappings []Mapping) error {
+// the mappings passed.  If ctx is done before all of the mappings have been
+// reflected, the remaining ones are skipped, nothing is reconciled and an
+// error is returned.
+func (r *Reflector) Reflect(ctx context.Context, mappings []Mapping) error {
+	return r.reflect(ctx, mappings, true)
+}
 
-	secrets := r.k8sClient.CoreV1().Secrets(r.k8sNamespace)
+// Sync reflects only the mappings passed, e.g. the ones whose vault secrets
+// were just written.  Unlike Reflect, it never reconciles secrets that
+// aren't part of mappings.
+func (r *Reflector) Sync(ctx context.Context, mappings []Mapping) error {
+	return r.reflect(ctx, mappings, false)
+}
 
-	// only select secrets that we created
-	listOptions := metav1.ListOptions{
-		LabelSelector: labels.Set{LabelKey: r.labelValue}.String(),
-	}
+// reflect reflects mappings and, if fullPass is set, records the pass in
+// metrics and reconciles the secrets that are no longer mapped.
+func (r *Reflector) reflect(
+	ctx context.Context,
+	mappings []Mapping,
+	fullPass bool,
+) error {
+	mappings, unselected := r.filterMappings(r.shardMappings(mappings))
+	mappings = dependencyOrder(byPriority(mappings))
+	defer r.flushAudit(ctx)
+	r.loadState(ctx)
+	defer r.saveState(ctx)
 
-	secretsList, err := secrets.List(listOptions)
+	// only select secrets that we created, keyed by name so we can easily
+	// access them.  the secrets of mappings left out by groups or filters
+	// are still mapped, so they're neither reconciled nor counted as orphans.
+	existing, err := r.existingSecrets()
 	if err != nil {
-		return fmt.Errorf("error listing secrets: %s", err)
+		return err
+	}
+	for name := range unselected {
+		delete(existing, name)
 	}
 
-	// make a set of the secrets keyed by name so we can easily access them.
-	secretsSet := make(map[string]struct{}, secretsList.Size())
-	for _, secret := range secretsList.Items {
-		secretsSet[secret.ObjectMeta.Name] = struct{}{}
+	p := &pass{
+		existing:     existing,
+		reads:        newReadCache(r.vaultClient),
+		sourceReads:  r.newSourceReads(),
+		transactions: r.newTransactions(mappings),
 	}
+	r.prepareTransactions(ctx, p)
 
 	// make a set of the secrets that we're actually updating so we can
 	// reconcile later.
 	touchedSecrets := map[string]struct{}{}
 
-	for _, mapping := range mappings {
-		secretData, err := r.vaultClient.Read(mapping.VaultPath)
+	// mappings are handed out to a fixed number of workers which bounds the
+	// number of concurrent requests to both vault and kubernetes.  inFlight
+	// counts the mappings handed out so that mappings wait for those of a
+	// higher priority to be done, and mappings wait for their dependencies
+	// in their worker.
+	var mu sync.Mutex
+	var abortErr error
+	failures := []error{}
+	skipped := []string{}
+	inFlight := sync.WaitGroup{}
+	deps := newDependencies(mappings)
+
+	reflectOne := func(mapping Mapping) {
+		failed := true
+		defer func() { deps.finish(mapping, failed) }()
+
+		mu.Lock()
+		aborted := abortErr != nil
+		if ctx.Err() != nil {
+			skipped = append(skipped, mapping.SecretName)
+			aborted = true
+		}
+		mu.Unlock()
+		if aborted {
+			p.finishTransactions(mapping, fmt.Errorf("skipped"))
+			return
+		}
+
+		var version string
+		var err error
+		paused := r.isPaused(mapping)
+		if paused {
+			version = p.pausedVersion(mapping)
+		} else if err = deps.wait(mapping); err == nil {
+			version, err = r.reflectMappingWithRetries(ctx, p, mapping)
+		}
+		failed = err != nil
+		p.finishTransactions(mapping, err)
+		if r.report != nil {
+			r.report(SyncResult{
+				Mapping: mapping,
+				Version: version,
+				Err:     err,
+				Paused:  paused,
+			})
+		}
+
+		r.recordState(mapping, version, p.existing[mapping.SecretName], err)
 		if err != nil {
-			return fmt.Errorf(
-				"error reading vault key '%s': %s",
-				mapping.VaultPath,
-				err,
-			)
+			r.recordFailure(mapping.SecretName)
+		} else {
+			r.markSynced(mapping.SecretName)
+			r.setVersionMetric(mapping.SecretName, version)
 		}
 
-		if secretData == nil {
-			return fmt.Errorf("secret %s not found", mapping.VaultPath)
+		mu.Lock()
+		if err != nil {
+			if r.errorPolicy != ErrorPolicyContinue {
+				if abortErr == nil {
+					abortErr = err
+				}
+			} else {
+				log.Printf("error reflecting %s: %s", mapping.SecretName, err)
+				failures = append(failures, err)
+			}
 		}
 
-		var k8sSecretData map[string][]byte
+		// record the fact that we either updated it or failed to.
+		// failed secrets are kept so that reconciliation doesn't
+		// remove them.
+		touchedSecrets[mapping.SecretName] = struct{}{}
+		if mapping.Canary.Passes > 0 {
+			touchedSecrets[mapping.CanaryName()] = struct{}{}
+		}
+		mu.Unlock()
+	}
 
-		// convert map[string]interface{} to map[string][]byte
-		switch mapping.VaultEngineType {
-		case vault.EngineTypeKeyValueV1:
-			k8sSecretData, err = r.castData(secretData.Data)
-			if err != nil {
-				return fmt.Errorf("error casting data: %s", err)
+	work := make(chan Mapping)
+	wg := sync.WaitGroup{}
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mapping := range work {
+				reflectOne(mapping)
+				inFlight.Done()
 			}
-		case vault.EngineTypeKeyValueV2:
-			// there's an extra level of wrapping with the v2 kv secrets engine
-			if unwrapped, ok := secretData.Data["data"].(map[string]interface{}); ok {
-				k8sSecretData, err = r.castData(unwrapped)
-			} else {
-				return fmt.Errorf("key/value v2 interface did not have " +
-					"expected extra wrapping")
+		}()
+	}
+
+dispatch:
+	for i, mapping := range mappings {
+		if i > 0 && mapping.Priority != mappings[i-1].Priority {
+			inFlight.Wait()
+		}
+		inFlight.Add(1)
+		select {
+		case work <- mapping:
+		case <-ctx.Done():
+			inFlight.Done()
+			mu.Lock()
+			for _, m := range mappings[i:] {
+				skipped = append(skipped, m.SecretName)
 			}
-		default:
-			return fmt.Errorf(
-				"unknown vault engine type: %q",
-				mapping.VaultEngineType,
-			)
+			mu.Unlock()
+			break dispatch
 		}
+	}
+	close(work)
+	wg.Wait()
+
+	// transactions are rolled back before anything else, even if the pass
+	// was cancelled or aborted.
+	rolledBack := r.rollbackTransactions(p)
+	failures = append(failures, rolledBack...)
+
+	if fullPass {
+		skippedMappingsGauge.Set(float64(len(skipped)))
+		unchangedSecretsGauge.Set(float64(p.unchanged))
+		r.recordInventory(existing, mappings, p.created)
+	}
+	r.rankFailures()
+	log.Printf(
+		"wrote %d secrets, %d were already up to date",
+		p.written,
+		p.unchanged,
+	)
 
-		// create the new Secret
-		newSecret := &v1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      mapping.SecretName,
-				Namespace: r.k8sNamespace,
-				Labels: map[string]string{
-					LabelKey: r.labelValue,
-				},
-			},
-			Data: k8sSecretData,
-			Type: v1.SecretTypeOpaque,
+	// some mappings may not have been reflected, so reconciling could
+	// remove secrets that are still mapped.
+	if err := ctx.Err(); err != nil {
+		if len(skipped) > 0 {
+			log.Printf("skipped mappings: %s", strings.Join(skipped, ", "))
 		}
+		return fmt.Errorf(
+			"pass did not complete: %w, skipped %d of %d mappings",
+			err,
+			len(skipped),
+			len(mappings),
+		)
+	}
 
-		// if the secret has ".dockercfg", use type "kubernetes.io/dockercfg"
-		if k8sSecretData[v1.DockerConfigKey] != nil {
-			newSecret.Type = v1.SecretTypeDockercfg
+	if abortErr != nil {
+		return abortErr
+	}
+
+	// if we're not using the default label value, reconcile any secrets
+	// that are no longer in vault, but might still exist from previous runs
+	// in kubernetes
+	if fullPass && r.labelValue != DefaultLabelValue {
+		err = r.reconcile(ctx, existing, touchedSecrets)
+		if err != nil {
+			return fmt.Errorf("error reconciling: %w", err)
 		}
+		orphanedSecretsGauge.WithLabelValues(r.k8sNamespace).Set(0)
+	}
+
+	if len(failures) > 0 {
+		return &PassError{Failures: failures, Mappings: len(mappings)}
+	}
 
-		// same with .dockerconfigson
-		if k8sSecretData[v1.DockerConfigJsonKey] != nil {
-			newSecret.Type = v1.SecretTypeDockerConfigJson
+	return nil
+}
+
+// pass holds the state shared by all of the mappings reflected by a single
+// call to Reflect or Sync.
+type pass struct {
+	// existing holds the secrets that already exist keyed by name.  They
+	// must not be modified.
+	existing map[string]*v1.Secret
+
+	// transactions are the transactions of the pass, keyed by group.
+	transactions map[string]*transaction
+
+	// reads deduplicates vault reads across mappings, and sourceReads
+	// across the mappings of each source.
+	reads       *readCache
+	sourceReads map[string]*readCache
+
+	// written and unchanged count the secrets that were written and the
+	// ones that were already up to date.  created counts the written
+	// secrets that didn't exist.
+	written   int64
+	unchanged int64
+	created   int64
+}
+
+// reflectMappingWithRetries calls reflectMapping, retrying failures as
+// configured with WithRetries.
+func (r *Reflector) reflectMappingWithRetries(
+	ctx context.Context,
+	p *pass,
+	mapping Mapping,
+) (string, error) {
+	backoff := r.retryBackoff
+	version, err := r.reflectMappingWithin(ctx, p, mapping)
+	for attempt := 1; err != nil && attempt <= r.retries; attempt++ {
+		log.Printf(
+			"error reflecting %s, retrying in %s (%d/%d): %s",
+			mapping.SecretName,
+			backoff,
+			attempt,
+			r.retries,
+			err,
+		)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", err
 		}
+		backoff *= 2
+		version, err = r.reflectMappingWithin(ctx, p, mapping)
+	}
+
+	return version, err
+}
 
-		// there are other types as needed. See https://pkg.go.dev/k8s.io/api/core/v1?tab=doc#SecretTypeOpaque
+// reflectMappingWithin calls reflectMapping within the Timeout of mapping,
+// if it has one.  Once it runs out, nothing more is read or written.
+func (r *Reflector) reflectMappingWithin(
+	ctx context.Context,
+	p *pass,
+	mapping Mapping,
+) (string, error) {
+	if mapping.Timeout <= 0 {
+		return r.reflectMapping(ctx, p, mapping)
+	}
 
-		if _, ok := secretsSet[mapping.SecretName]; ok {
-			// secret already exists, so we should update it
-			_, err = secrets.Update(newSecret)
-			if err != nil {
-				return fmt.Errorf("error updating secret: %s", err)
-			}
-		} else {
-			// secret doesn't exist, so create it
-			_, err = secrets.Create(newSecret)
-			if err != nil {
-				return fmt.Errorf("error creating secret: %s", err)
-			}
+	mappingCtx, cancel := context.WithTimeout(ctx, mapping.Timeout)
+	defer cancel()
+	version, err := r.reflectMapping(mappingCtx, p, mapping)
+	if err != nil && ctx.Err() == nil && mappingCtx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("timed out after %s: %w", mapping.Timeout, err)
+	}
+	return version, err
+}
+
+// reflectMapping reads a single mapping's secret from vault and creates or
+// updates the k8s secret.  It returns the key/value v2 version reflected,
+// if any.
+func (r *Reflector) reflectMapping(
+	ctx context.Context,
+	p *pass,
+	mapping Mapping,
+) (string, error) {
+	readCtx := ctx
+	if r.vaultTimeout > 0 {
+		var cancel context.CancelFunc
+		readCtx, cancel = context.WithTimeout(ctx, r.vaultTimeout)
+		defer cancel()
+	}
+
+	reads, err := p.readsFor(mapping)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.transactionErr(mapping); err != nil {
+		return "", err
+	}
+
+	// mappings with a canary are written to their canary secret instead
+	// until it was written in enough passes.
+	mapping, canary := canaryFor(p, mapping)
+
+	current, exists := p.existing[mapping.SecretName]
+	if exists && ignored(current) {
+		log.Printf(
+			"kubernetes secret %s has the %s annotation, leaving it alone",
+			mapping.SecretName,
+			IgnoreAnnotation,
+		)
+		atomic.AddInt64(&p.unchanged, 1)
+		return current.Annotations[VersionAnnotation], nil
+	}
+	if exists {
+		if err := r.checkOwner(current); err != nil {
+			return "", err
 		}
+	}
 
+	// certificates expiring soon are always read again.
+	renew := exists && renewalDue(mapping, current.Data, time.Now())
+	if renew {
 		log.Printf(
-			"reflected vault secret %s to kubernetes %s",
+			"certificates of kubernetes secret %s expire within %s, reading vault secret %s",
+			mapping.SecretName,
+			mapping.RenewBefore,
 			mapping.VaultPath,
+		)
+	}
+
+	if exists && !renew && canary.settled() && leased(mapping.VaultEngineType) &&
+		!leaseValid(current, mapping, time.Now()) && r.leaseRenewal {
+		if renewed := r.renewLease(ctx, reads.vaultClient, mapping, current); renewed != nil {
+			current = renewed
+		}
+	}
+
+	if exists && !renew && canary.settled() && leased(mapping.VaultEngineType) &&
+		leaseValid(current, mapping, time.Now()) {
+		infof(
+			"kubernetes secret %s has credentials of vault lease %s until %s",
 			mapping.SecretName,
+			current.Annotations[LeaseIDAnnotation],
+			current.Annotations[LeaseExpiresAnnotation],
 		)
+		r.recordCertificates(mapping.SecretName, current.Data)
+		atomic.AddInt64(&p.unchanged, 1)
+		return current.Annotations[VersionAnnotation], nil
+	}
+
+	// the version only covers the vault path, not the data overrides.
+	if exists && !renew && canary.settled() && r.versionCheck && len(mapping.Data) == 0 &&
+		mapping.VaultEngineType == vault.EngineTypeKeyValueV2 {
+		upToDate, err := r.currentVersion(readCtx, reads, mapping, current)
+		if err != nil {
+			return "", err
+		}
+		if upToDate {
+			infof(
+				"kubernetes secret %s has the current version of vault secret %s",
+				mapping.SecretName,
+				mapping.VaultPath,
+			)
+			r.recordCertificates(mapping.SecretName, current.Data)
+			atomic.AddInt64(&p.unchanged, 1)
+			return current.Annotations[VersionAnnotation], nil
+		}
+	}
 
-		// record the fact that we actually updated it
-		touchedSecrets[newSecret.Name] = struct{}{}
+	debugf("reading vault secret %s for %s", mapping.VaultPath, mapping.SecretName)
+	secretData, err := reads.Read(readCtx, mapping.VaultPath)
+	if err != nil {
+		return "", readError(mapping.VaultPath, err)
 	}
 
-	// if we're not using the default label value, reconcile any secrets
-	// that are no longer in vault, but might still exist from previous runs
-	// in kubernetes
-	if r.labelValue != DefaultLabelValue {
-		err = r.reconcile(secretsSet, touchedSecrets)
+	if secretData == nil {
+		if mapping.Optional {
+			log.Printf(
+				"optional vault secret %s not found, skipping %s",
+				mapping.VaultPath,
+				mapping.SecretName,
+			)
+			optionalMissingCounter.WithLabelValues(r.metricLabel(mapping.SecretName)).Inc()
+			return "", nil
+		}
+		return "", classify(ErrPathNotFound, fmt.Errorf("secret %s not found", mapping.VaultPath))
+	}
+
+	deletedAt := deletionTime(secretData, mapping.VaultEngineType)
+	r.setSourceDeletedMetric(mapping.SecretName, deletedAt != "")
+	if deletedAt != "" {
+		return r.markSourceDeleted(ctx, p, mapping, current, deletedAt)
+	}
+
+	// mappings sharing a vault path share the converted data, so it must
+	// not be modified.
+	k8sSecretData, err := reads.Data(
+		mapping.VaultPath,
+		mapping.VaultEngineType,
+		secretData,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	readOverride := func(path string) (map[string][]byte, error) {
+		secret, err := reads.Read(readCtx, path)
+		if err != nil {
+			return nil, readError(path, err)
+		}
+		if secret == nil {
+			return nil, nil
+		}
+		return reads.Data(path, mapping.VaultEngineType, secret)
+	}
+	k8sSecretData, err = mappingData(ctx, mapping, k8sSecretData, readOverride)
+	if err != nil {
+		return "", err
+	}
+
+	newSecret := r.newSecret(mapping, k8sSecretData, secretData)
+	canary.annotate(newSecret)
+	r.recordCertificates(mapping.SecretName, k8sSecretData)
+
+	if exists && unchanged(current, newSecret) {
+		infof(
+			"kubernetes secret %s is up to date with vault secret %s",
+			mapping.SecretName,
+			mapping.VaultPath,
+		)
+		atomic.AddInt64(&p.unchanged, 1)
+		return newSecret.Annotations[VersionAnnotation], nil
+	}
+
+	if exists {
+		debugf("kubernetes secret %s differs from vault secret %s", mapping.SecretName, mapping.VaultPath)
+		if err := r.checkDeletionGuard(current, newSecret); err != nil {
+			return "", classify(ErrWriteBlocked, err)
+		}
+	} else {
+		debugf("kubernetes secret %s doesn't exist yet", mapping.SecretName)
+	}
+	err = r.updateSecret(ctx, mapping, current, newSecret)
+	if _, altered := err.(*VerificationError); err == nil || altered {
+		p.recordApplied(mapping, current)
+	}
+	if err != nil {
+		return "", err
+	}
+	atomic.AddInt64(&p.written, 1)
+	if !exists {
+		atomic.AddInt64(&p.created, 1)
+	}
+	if canary != nil && canary.promote {
+		if err := r.promoted(ctx, p, mapping); err != nil {
+			return "", fmt.Errorf("error deleting canary secret %s: %s", mapping.CanaryName(), err)
+		}
+	}
+
+	infof(
+		"reflected vault secret %s to kubernetes %s",
+		mapping.VaultPath,
+		mapping.SecretName,
+	)
+
+	return newSecret.Annotations[VersionAnnotation], nil
+}
+
+// newSecret returns the k8s secret holding data, converted from the vault
+// secret of mapping.
+func (r *Reflector) newSecret(
+	mapping Mapping,
+	data map[string][]byte,
+	vaultSecret *api.Secret,
+) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            mapping.SecretName,
+			Namespace:       r.k8sNamespace,
+			Labels:          r.secretLabels(),
+			OwnerReferences: r.secretOwners(mapping.SecretName),
+		},
+		Data: data,
+		Type: v1.SecretTypeOpaque,
+	}
+
+	// record where the data came from, including the version of key/value
+	// v2 secrets
+	now := time.Now().UTC()
+	secret.Annotations = map[string]string{
+		PathAnnotation:       mapping.VaultPath,
+		OwnerAnnotation:      r.instance,
+		LastSyncedAnnotation: now.Format(time.RFC3339),
+	}
+	if version := secretVersion(vaultSecret, mapping.VaultEngineType); version != "" {
+		secret.Annotations[VersionAnnotation] = version
+	}
+	if mapping.Source != "" {
+		secret.Annotations[SourceAnnotation] = mapping.Source
+	}
+	if vaultSecret.LeaseID != "" {
+		secret.Annotations[LeaseIDAnnotation] = vaultSecret.LeaseID
+		secret.Annotations[LeaseExpiresAnnotation] = now.
+			Add(time.Duration(vaultSecret.LeaseDuration) * time.Second).
+			Format(time.RFC3339)
+	}
+
+	// if the secret has ".dockercfg", use type "kubernetes.io/dockercfg"
+	if data[v1.DockerConfigKey] != nil {
+		secret.Type = v1.SecretTypeDockercfg
+	}
+
+	// same with .dockerconfigson
+	if data[v1.DockerConfigJsonKey] != nil {
+		secret.Type = v1.SecretTypeDockerConfigJson
+	}
+
+	// there are other types as needed. See https://pkg.go.dev/k8s.io/api/core/v1?tab=doc#SecretTypeOpaque
+	if mapping.Type != "" {
+		secret.Type = mapping.Type
+	}
+
+	return secret
+}
+
+// currentVersion returns true if the k8s secret has the current version of
+// the mapping's key/value v2 secret according to its metadata.
+func (r *Reflector) currentVersion(
+	ctx context.Context,
+	reads *readCache,
+	mapping Mapping,
+	secret *v1.Secret,
+) (bool, error) {
+	reflected, ok := secret.Annotations[VersionAnnotation]
+	if !ok || secret.Labels[LabelKey] != r.labelValue ||
+		secret.Annotations[PathAnnotation] != mapping.VaultPath ||
+		secret.Annotations[SourceAnnotation] != mapping.Source {
+		return false, nil
+	}
+	if _, deleted := secret.Annotations[SourceDeletedAnnotation]; deleted {
+		return false, nil
+	}
+
+	metaPath, ok := vault.MetadataPath(mapping.VaultPath)
+	if !ok {
+		return false, nil
+	}
+
+	meta, err := reads.Read(ctx, metaPath)
+	if err != nil {
+		return false, fmt.Errorf(
+			"error reading vault metadata '%s': %s",
+			metaPath,
+			err,
+		)
+	}
+	if meta == nil {
+		return false, nil
+	}
+
+	version, ok := vault.Version(meta.Data["current_version"])
+	if !ok || strconv.FormatInt(version, 10) != reflected {
+		return false, nil
+	}
+
+	// a deleted current version is read to mark the secret as stale.
+	versions, _ := meta.Data["versions"].(map[string]interface{})
+	current, _ := versions[reflected].(map[string]interface{})
+	deletedAt, _ := current["deletion_time"].(string)
+	return deletedAt == "", nil
+}
+
+// updateSecret writes newSecret, the secret of mapping, in place of
+// current, which is nil if the secret doesn't exist.  Writes violating the
+// policies are blocked, the write hooks are called around the write, and
+// the previous data is backed up first when using WithBackups.
+func (r *Reflector) updateSecret(
+	ctx context.Context,
+	mapping Mapping,
+	current *v1.Secret,
+	newSecret *v1.Secret,
+) error {
+	event := WriteEvent{
+		Mapping: mapping,
+		NewHash: DataHash(newSecret.Data),
+	}
+	if current != nil {
+		event.OldHash = DataHash(current.Data)
+	}
+
+	if err := r.checkPolicies(newSecret); err != nil {
+		return classify(ErrWriteBlocked, fmt.Errorf(
+			"write of secret %s was blocked: %w",
+			mapping.SecretName,
+			err,
+		))
+	}
+
+	for _, hook := range r.writeHooks {
+		if err := hook.BeforeWrite(ctx, event); err != nil {
+			return classify(ErrWriteBlocked, fmt.Errorf(
+				"write of secret %s was refused: %w",
+				mapping.SecretName,
+				err,
+			))
+		}
+	}
+
+	if current != nil && r.backups && !dataEqual(current.Data, newSecret.Data) {
+		err := r.backupSecret(ctx, current)
 		if err != nil {
-			return fmt.Errorf("error reconciling: %s", err)
+			return fmt.Errorf(
+				"error backing up secret %s: %s",
+				mapping.SecretName,
+				err,
+			)
 		}
 	}
 
+	err := r.writeSecret(ctx, newSecret, current != nil)
+	for _, hook := range r.writeHooks {
+		hook.AfterWrite(ctx, event, err)
+	}
+	if err == nil {
+		r.auditChange(mapping, current, newSecret)
+		r.recordStateHash(mapping.SecretName, event.NewHash)
+	}
+	if err == nil && r.verifyWrites {
+		err = r.verifyWrite(newSecret)
+	}
+	return err
+}
+
+// writeSecret updates the secret if it exists or creates it otherwise.
+func (r *Reflector) writeSecret(
+	ctx context.Context,
+	secret *v1.Secret,
+	exists bool,
+) error {
+	secrets := r.secrets()
+
+	release, err := r.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if exists {
+		// secret already exists, so we should update it
+		_, err := secrets.Update(secret)
+		if err != nil {
+			return secretError("updating", err)
+		}
+		return nil
+	}
+
+	// secret doesn't exist, so create it.  the informer cache may be
+	// behind, so fall back to updating it if it turns out to exist and
+	// belongs to this reflector.
+	_, err = secrets.Create(secret)
+	if errors.IsAlreadyExists(err) {
+		var current *v1.Secret
+		current, err = secrets.Get(secret.Name, metav1.GetOptions{})
+		if err == nil {
+			err = r.checkOwner(current)
+			if err != nil {
+				return err
+			}
+			_, err = secrets.Update(secret)
+		}
+	}
+	if err != nil {
+		return secretError("creating", err)
+	}
 	return nil
 }
 
+// secretError returns the error of creating or updating a secret, which is
+// an ErrAuthFailed if kubernetes refused the request.
+func secretError(action string, err error) error {
+	wrapped := fmt.Errorf("error %s secret: %w", action, err)
+	if errors.IsForbidden(err) || errors.IsUnauthorized(err) {
+		return classify(ErrAuthFailed, wrapped)
+	}
+	return wrapped
+}
+
 // reconcile delete any secrets that were not part of the mapping (but still
 // present in the secrets with the same label)
 func (r *Reflector) reconcile(
-	allSecrets map[string]struct{},
+	ctx context.Context,
+	allSecrets map[string]*v1.Secret,
 	touchedSecrets map[string]struct{},
 ) error {
-	secretsAPI := r.k8sClient.CoreV1().Secrets(r.k8sNamespace)
+	secretsAPI := r.secrets()
 
+	overlaps := []string{}
 	for secret := range allSecrets {
+		// secrets belonging to other shards are reconciled by those shards
+		if !r.ownsSecret(secret) {
+			continue
+		}
+
 		if _, found := touchedSecrets[secret]; !found {
-			// it was in the list, but we didn't update it (or create it)
-			err := secretsAPI.Delete(secret, &metav1.DeleteOptions{})
+			if ignored(allSecrets[secret]) {
+				log.Printf(
+					"not reconciling %s: it has the %s annotation",
+					secret,
+					IgnoreAnnotation,
+				)
+				continue
+			}
+
+			// it was in the list, but we didn't update it (or create it).
+			// another instance sharing the label must not lose its
+			// secrets.
+			if err := r.checkOwner(allSecrets[secret]); err != nil {
+				log.Printf("not reconciling: %s", err)
+				overlaps = append(overlaps, secret)
+				continue
+			}
+
+			release, err := r.acquireWrite(ctx)
+			if err != nil {
+				return err
+			}
+			err = secretsAPI.Delete(secret, &metav1.DeleteOptions{})
+			release()
 
 			// not found is ok because we're deleting, so only return the
 			// error if it's NOT not found...
 			if err != nil && !errors.IsNotFound(err) {
 				return err
 			}
+			if err == nil {
+				r.auditDelete(allSecrets[secret])
+			}
+			mappingVersionGauge.DeleteLabelValues(secret)
+
+			if r.backups {
+				err = r.deleteBackup(ctx, secret)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 
+	if len(overlaps) > 0 {
+		sort.Strings(overlaps)
+		return classify(ErrSecretConflict, fmt.Errorf(
+			"secrets with label %q are owned by other instances: %s",
+			r.labelValue,
+			strings.Join(overlaps, ", "),
+		))
+	}
+
 	return nil
 }
 
-// castData turns vault map[string]interface{}'s into map[string][]byte's
-func (r *Reflector) castData(
-	innerData map[string]interface{},
+// acquireWrite blocks until a write may be made to kubernetes and returns a
+// function that must be called once the write is done.  The kubernetes
+// client does not accept a context, so ctx is only checked before the
+// write; the client's timeout bounds the write itself.
+func (r *Reflector) acquireWrite(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.writeSem == nil {
+		return func() {}, nil
+	}
+	select {
+	case r.writeSem <- struct{}{}:
+		return func() { <-r.writeSem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// unchanged returns true if updating current to desired would not change
+// anything that pentagon manages.
+func unchanged(current, desired *v1.Secret) bool {
+	return current.Type == desired.Type &&
+		labelsContain(current.Labels, desired.Labels) &&
+		current.Annotations[PathAnnotation] == desired.Annotations[PathAnnotation] &&
+		current.Annotations[VersionAnnotation] == desired.Annotations[VersionAnnotation] &&
+		current.Annotations[OwnerAnnotation] == desired.Annotations[OwnerAnnotation] &&
+		current.Annotations[SourceDeletedAnnotation] == desired.Annotations[SourceDeletedAnnotation] &&
+		current.Annotations[SourceAnnotation] == desired.Annotations[SourceAnnotation] &&
+		current.Annotations[CanaryAnnotation] == desired.Annotations[CanaryAnnotation] &&
+		current.Annotations[CanaryPassesAnnotation] == desired.Annotations[CanaryPassesAnnotation] &&
+		ownersEqual(current.OwnerReferences, desired.OwnerReferences) &&
+		dataEqual(current.Data, desired.Data)
+}
+
+// labelsContain returns true if have has all of the labels of want.
+func labelsContain(have, want map[string]string) bool {
+	for key, value := range want {
+		if actual, ok := have[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// dataEqual compares secret data, treating nil and empty data the same.
+func dataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !bytes.Equal(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkKeys makes sure that the data has the keys that the mapping and its
+// secret type require and that their values follow its validation rules.
+func checkKeys(mapping Mapping, data map[string][]byte) error {
+	if mapping.Strict && len(data) == 0 {
+		return fmt.Errorf("secret has no keys")
+	}
+
+	missing := []string{}
+	for _, key := range mapping.RequiredKeys {
+		if _, ok := data[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required keys: %s", strings.Join(missing, ", "))
+	}
+
+	for _, rule := range mapping.Validation {
+		if err := rule.check(data); err != nil {
+			return err
+		}
+	}
+
+	return checkType(mapping.Type, data)
+}
+
+// secretData unwraps the data of a vault secret according to the engine
+// type it was read from and converts it to k8s secret data.
+func secretData(
+	secret *api.Secret,
+	engineType vault.EngineType,
 ) (map[string][]byte, error) {
+	var data map[string]interface{}
+
+	switch engineType {
+	case vault.EngineTypeKeyValueV1:
+		data = secret.Data
+	case vault.EngineTypeKeyValueV2:
+		// there's an extra level of wrapping with the v2 kv secrets engine
+		unwrapped, ok := secret.Data["data"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key/value v2 interface did not have " +
+				"expected extra wrapping")
+		}
+		data = unwrapped
+	case vault.EngineTypeTOTP, vault.EngineTypeConsul, vault.EngineTypeNomad:
+		// the configuration of TOTP keys and the tokens of the Consul
+		// engine have numbers and booleans.
+		data = make(map[string]interface{}, len(secret.Data))
+		for k, v := range secret.Data {
+			switch v.(type) {
+			case json.Number, bool, int, int64, float64:
+				data[k] = fmt.Sprint(v)
+			default:
+				data[k] = v
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown vault engine type: %q", engineType)
+	}
 
+	k8sSecretData, err := castData(data)
+	if err != nil {
+		return nil, fmt.Errorf("error casting data: %s", err)
+	}
+
+	return k8sSecretData, nil
+}
+
+// castData turns vault map[string]interface{}'s into map[string][]byte's.
+// []byte values are used without copying them.
+func castData(innerData map[string]interface{}) (map[string][]byte, error) {
 	k8sSecretData := make(map[string][]byte, len(innerData))
 
 	for k, v := range innerData {
@@ -210,3 +1223,101 @@ func (r *Reflector) castData(
 
 	return k8sSecretData, nil
 }
+
+// ReadMapping reads the vault secret of mapping and returns it as k8s
+// secret data, checked like reflected secrets are, along with the version
+// of key/value v2 secrets.  A missing optional secret returns nil data and
+// no error.
+func ReadMapping(
+	ctx context.Context,
+	vaultClient vault.Logical,
+	mapping Mapping,
+) (map[string][]byte, string, error) {
+	secret, err := vault.ReadWithContext(ctx, vaultClient, mapping.VaultPath)
+	if err != nil {
+		return nil, "", readError(mapping.VaultPath, err)
+	}
+	if secret == nil {
+		if mapping.Optional {
+			return nil, "", nil
+		}
+		return nil, "", classify(ErrPathNotFound, fmt.Errorf("secret %s not found", mapping.VaultPath))
+	}
+
+	if deletedAt := deletionTime(secret, mapping.VaultEngineType); deletedAt != "" {
+		return nil, "", classify(ErrPathNotFound, fmt.Errorf(
+			"secret %s was deleted at %s",
+			mapping.VaultPath,
+			deletedAt,
+		))
+	}
+
+	data, err := secretData(secret, mapping.VaultEngineType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	readOverride := func(path string) (map[string][]byte, error) {
+		secret, err := vault.ReadWithContext(ctx, vaultClient, path)
+		if err != nil {
+			return nil, readError(path, err)
+		}
+		if secret == nil {
+			return nil, nil
+		}
+		return secretData(secret, mapping.VaultEngineType)
+	}
+	data, err = mappingData(ctx, mapping, data, readOverride)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, secretVersion(secret, mapping.VaultEngineType), nil
+}
+
+// mappingData applies the data overrides and the transform of mapping to
+// data, the converted vault secret of mapping, and checks the keys of the
+// result.  read reads the vault secrets of the overrides, see overlayData.
+func mappingData(
+	ctx context.Context,
+	mapping Mapping,
+	data map[string][]byte,
+	read func(path string) (map[string][]byte, error),
+) (map[string][]byte, error) {
+	data, err := overlayData(mapping, data, read)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = transformData(ctx, mapping, data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkKeys(mapping, data)
+	if err != nil {
+		return nil, classify(ErrInvalidSecret, fmt.Errorf(
+			"invalid vault secret %s: %w",
+			mapping.VaultPath,
+			err,
+		))
+	}
+	return data, nil
+}
+
+// secretVersion returns the version of a key/value v2 secret, or "" for
+// other engines.
+func secretVersion(secret *api.Secret, engineType vault.EngineType) string {
+	if engineType != vault.EngineTypeKeyValueV2 {
+		return ""
+	}
+	meta, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	version, ok := vault.Version(meta["version"])
+	if !ok {
+		return ""
+	}
+	return strconv.FormatInt(version, 10)
+}
@@ -1,8 +1,15 @@
 package pentagon
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/vault/api"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -41,7 +48,7 @@ func TestRefactorSimple(t *testing.T) {
 			DefaultLabelValue,
 		)
 
-		err := r.Reflect([]Mapping{
+		err := r.Reflect(context.Background(), []Mapping{
 			{
 				VaultPath:       "secrets/data/foo",
 				SecretName:      "foo",
@@ -102,7 +109,7 @@ func TestReflectorNoReconcile(t *testing.T) {
 		)
 
 		// reflect both secrets
-		err := r.Reflect([]Mapping{
+		err := r.Reflect(context.Background(), []Mapping{
 			{
 				VaultPath:       "secrets/data/foo1",
 				SecretName:      "foo1",
@@ -133,7 +140,7 @@ func TestReflectorNoReconcile(t *testing.T) {
 
 		// reflect again, this time without foo2 -- it should still be there
 		// and not get reconciled because we're using the default label value.
-		err = r.Reflect([]Mapping{
+		err = r.Reflect(context.Background(), []Mapping{
 			{
 				VaultPath:       "secrets/data/foo1",
 				SecretName:      "foo1",
@@ -194,7 +201,7 @@ func TestReflectorWithReconcile(t *testing.T) {
 
 		r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test")
 
-		err = r.Reflect([]Mapping{
+		err = r.Reflect(context.Background(), []Mapping{
 			{
 				VaultPath:       "secrets/data/foo1",
 				SecretName:      "foo1",
@@ -229,7 +236,7 @@ func TestReflectorWithReconcile(t *testing.T) {
 
 		// reflect again, this time without foo2 -- it should get reconciled
 		// because we're using a non-default label value.
-		err = r.Reflect([]Mapping{
+		err = r.Reflect(context.Background(), []Mapping{
 			{
 				VaultPath:       "secrets/data/foo1",
 				SecretName:      "foo1",
@@ -279,7 +286,7 @@ func TestUnsupportedEngineType(t *testing.T) {
 		DefaultLabelValue,
 	)
 
-	err := r.Reflect([]Mapping{
+	err := r.Reflect(context.Background(), []Mapping{
 		{
 			VaultPath:       "secrets/data/foo",
 			SecretName:      "foo",
@@ -290,3 +297,966 @@ func TestUnsupportedEngineType(t *testing.T) {
 		t.Fatal("expected error from unsupported engine type")
 	}
 }
+
+func TestOptionalMissing(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"foo": "bar",
+		})
+
+		r := NewReflector(
+			vaultClient,
+			k8sClient,
+			DefaultNamespace,
+			DefaultLabelValue,
+		)
+
+		err := r.Reflect(context.Background(), []Mapping{
+			{
+				VaultPath:       "secrets/data/not-there",
+				SecretName:      "not-there",
+				VaultEngineType: engineType,
+				Optional:        true,
+			},
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "foo",
+				VaultEngineType: engineType,
+			},
+		})
+		if err != nil {
+			t.Fatalf("missing optional secret should not fail: %s", err)
+		}
+
+		secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+		_, err = secrets.Get("foo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("foo should be there: %s", err)
+		}
+
+		_, err = secrets.Get("not-there", metav1.GetOptions{})
+		if !errors.IsNotFound(err) {
+			t.Fatalf("not-there should not have been created: %s", err)
+		}
+
+		err = r.Reflect(context.Background(), []Mapping{
+			{
+				VaultPath:       "secrets/data/not-there",
+				SecretName:      "not-there",
+				VaultEngineType: engineType,
+			},
+		})
+		if err == nil {
+			t.Fatal("missing required secret should fail")
+		}
+	})
+}
+
+func TestStrictKeys(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+
+		vaultClient.Write("secrets/data/empty", map[string]interface{}{})
+		vaultClient.Write("secrets/data/foo", map[string]interface{}{
+			"foo": "bar",
+		})
+
+		r := NewReflector(
+			vaultClient,
+			k8sClient,
+			DefaultNamespace,
+			DefaultLabelValue,
+		)
+
+		err := r.Reflect(context.Background(), []Mapping{
+			{
+				VaultPath:       "secrets/data/empty",
+				SecretName:      "empty",
+				VaultEngineType: engineType,
+			},
+		})
+		if err != nil {
+			t.Fatalf("empty secret should be allowed when not strict: %s", err)
+		}
+
+		err = r.Reflect(context.Background(), []Mapping{
+			{
+				VaultPath:       "secrets/data/empty",
+				SecretName:      "empty",
+				VaultEngineType: engineType,
+				Strict:          true,
+			},
+		})
+		if err == nil {
+			t.Fatal("empty secret should fail when strict")
+		}
+
+		err = r.Reflect(context.Background(), []Mapping{
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "foo",
+				VaultEngineType: engineType,
+				RequiredKeys:    []string{"foo"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("foo has all required keys: %s", err)
+		}
+
+		err = r.Reflect(context.Background(), []Mapping{
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "foo",
+				VaultEngineType: engineType,
+				RequiredKeys:    []string{"foo", "bar"},
+			},
+		})
+		if err == nil {
+			t.Fatal("foo is missing required key bar")
+		}
+	})
+}
+
+func TestErrorPolicy(t *testing.T) {
+	for _, policy := range []ErrorPolicy{ErrorPolicyAbort, ErrorPolicyContinue} {
+		p := policy
+		t.Run(string(p), func(t *testing.T) {
+			k8sClient := k8sfake.NewSimpleClientset()
+			vaultClient := vault.NewMock(map[string]vault.EngineType{
+				"secrets": vault.EngineTypeKeyValueV1,
+			})
+
+			vaultClient.Write("secrets/data/foo", map[string]interface{}{
+				"foo": "bar",
+			})
+
+			r := NewReflector(
+				vaultClient,
+				k8sClient,
+				DefaultNamespace,
+				DefaultLabelValue,
+				WithErrorPolicy(p),
+			)
+
+			err := r.Reflect(context.Background(), []Mapping{
+				{
+					VaultPath:       "secrets/data/not-there",
+					SecretName:      "not-there",
+					VaultEngineType: vault.EngineTypeKeyValueV1,
+				},
+				{
+					VaultPath:       "secrets/data/foo",
+					SecretName:      "foo",
+					VaultEngineType: vault.EngineTypeKeyValueV1,
+				},
+			})
+			if err == nil {
+				t.Fatal("pass with a failed mapping should fail")
+			}
+
+			_, err = k8sClient.CoreV1().Secrets(DefaultNamespace).Get(
+				"foo",
+				metav1.GetOptions{},
+			)
+			switch p {
+			case ErrorPolicyAbort:
+				if !errors.IsNotFound(err) {
+					t.Fatalf("foo should not have been reflected: %s", err)
+				}
+			case ErrorPolicyContinue:
+				if err != nil {
+					t.Fatalf("foo should have been reflected: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// flakyVault fails the first failures reads before passing them through.
+type flakyVault struct {
+	*vault.Mock
+	failures int
+}
+
+func (f *flakyVault) Read(path string) (*api.Secret, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, fmt.Errorf("transient error")
+	}
+	return f.Mock.Read(path)
+}
+
+func TestRetries(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	mock.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+	}
+
+	r := NewReflector(
+		&flakyVault{Mock: mock, failures: 2},
+		k8sfake.NewSimpleClientset(),
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithRetries(2, time.Millisecond),
+	)
+	err := r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect should have succeeded after retrying: %s", err)
+	}
+
+	r = NewReflector(
+		&flakyVault{Mock: mock, failures: 3},
+		k8sfake.NewSimpleClientset(),
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithRetries(2, time.Millisecond),
+	)
+	err = r.Reflect(context.Background(), mappings)
+	if err == nil {
+		t.Fatal("reflect should have failed after running out of retries")
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+
+		mappings := []Mapping{}
+		for i := 0; i < 50; i++ {
+			name := fmt.Sprintf("foo%d", i)
+			vaultClient.Write("secrets/data/"+name, map[string]interface{}{
+				"foo": name,
+			})
+			mappings = append(mappings, Mapping{
+				VaultPath:       "secrets/data/" + name,
+				SecretName:      name,
+				VaultEngineType: engineType,
+			})
+		}
+
+		r := NewReflector(
+			vaultClient,
+			k8sClient,
+			DefaultNamespace,
+			"test",
+			WithWorkers(8),
+			WithWriteConcurrency(2),
+		)
+
+		err := r.Reflect(context.Background(), mappings)
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+		for _, m := range mappings {
+			s, err := secrets.Get(m.SecretName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s should be there: %s", m.SecretName, err)
+			}
+			if string(s.Data["foo"]) != m.SecretName {
+				t.Fatalf("unexpected data for %s: %s", m.SecretName, s.Data["foo"])
+			}
+		}
+	})
+}
+
+// countingVault counts the reads of each path.
+type countingVault struct {
+	*vault.Mock
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingVault) Read(path string) (*api.Secret, error) {
+	c.mu.Lock()
+	c.reads[path]++
+	c.mu.Unlock()
+	return c.Mock.Read(path)
+}
+
+func TestDeduplicatedReads(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	mock.Write("secrets/data/shared", map[string]interface{}{
+		"foo": "bar",
+	})
+	vaultClient := &countingVault{Mock: mock, reads: map[string]int{}}
+
+	mappings := []Mapping{}
+	for i := 0; i < 10; i++ {
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/data/shared",
+			SecretName:      fmt.Sprintf("shared%d", i),
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		})
+	}
+
+	r := NewReflector(
+		vaultClient,
+		k8sfake.NewSimpleClientset(),
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithWorkers(4),
+	)
+
+	err := r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	if reads := vaultClient.reads["secrets/data/shared"]; reads != 1 {
+		t.Fatalf("shared secret should have been read once, was read %d times", reads)
+	}
+
+	// a new pass reads it again
+	err = r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+
+	if reads := vaultClient.reads["secrets/data/shared"]; reads != 2 {
+		t.Fatalf("shared secret should have been read twice, was read %d times", reads)
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithInformer(stopCh),
+	)
+
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+	}
+
+	err := r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	// wait for the informer to see the new secret
+	for i := 0; i < 100; i++ {
+		if _, err := r.secretLister.Get("foo"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	k8sClient.ClearActions()
+	err = r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+
+	for _, action := range k8sClient.Actions() {
+		if action.GetVerb() != "list" && action.GetVerb() != "watch" {
+			t.Fatalf("unexpected %s of an unchanged secret", action.GetVerb())
+		}
+	}
+
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "baz",
+	})
+	err = r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work the third time: %s", err)
+	}
+
+	secret, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if string(secret.Data["foo"]) != "baz" {
+		t.Fatalf("foo should have been updated: %s", secret.Data["foo"])
+	}
+}
+
+// slowVault delays every read.
+type slowVault struct {
+	*vault.Mock
+	delay time.Duration
+}
+
+func (s *slowVault) Read(path string) (*api.Secret, error) {
+	time.Sleep(s.delay)
+	return s.Mock.Read(path)
+}
+
+func TestVaultTimeout(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	mock.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	r := NewReflector(
+		&slowVault{Mock: mock, delay: time.Second},
+		k8sfake.NewSimpleClientset(),
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithVaultTimeout(10*time.Millisecond),
+	)
+
+	start := time.Now()
+	err := r.Reflect(context.Background(), []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+	})
+	if err == nil {
+		t.Fatal("slow read should have timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("reflect should have given up quickly, took %s", elapsed)
+	}
+}
+
+func TestMappingTimeout(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	mock.Write("secrets/data/slow", map[string]interface{}{"foo": "bar"})
+	mock.Write("secrets/data/fast", map[string]interface{}{"foo": "baz"})
+
+	k8sClient := k8sfake.NewSimpleClientset()
+	r := NewReflector(
+		&slowVault{Mock: mock, delay: 200 * time.Millisecond},
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithErrorPolicy(ErrorPolicyContinue),
+	)
+
+	err := r.Reflect(context.Background(), []Mapping{
+		{
+			VaultPath:       "secrets/data/slow",
+			SecretName:      "slow",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			Timeout:         10 * time.Millisecond,
+		},
+		{
+			VaultPath:       "secrets/data/fast",
+			SecretName:      "fast",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			Timeout:         time.Second,
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Fatalf("the slow mapping should have timed out: %v", err)
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	if _, err := secrets.Get("slow", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("slow should not have been written: %v", err)
+	}
+	if _, err := secrets.Get("fast", metav1.GetOptions{}); err != nil {
+		t.Errorf("fast should have been written: %s", err)
+	}
+}
+
+func TestCancelledNoReconcile(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test")
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+	}
+
+	err := r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = r.Reflect(ctx, mappings)
+	if err == nil {
+		t.Fatal("cancelled reflect should fail")
+	}
+
+	_, err = k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should not have been reconciled: %s", err)
+	}
+}
+
+func TestPassDeadline(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+
+	mappings := []Mapping{}
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("foo%d", i)
+		mock.Write("secrets/data/"+name, map[string]interface{}{
+			"foo": name,
+		})
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/data/" + name,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		})
+	}
+
+	k8sClient := k8sfake.NewSimpleClientset()
+	r := NewReflector(
+		&slowVault{Mock: mock, delay: 50 * time.Millisecond},
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithErrorPolicy(ErrorPolicyContinue),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 75*time.Millisecond)
+	defer cancel()
+
+	err := r.Reflect(ctx, mappings)
+	if err == nil {
+		t.Fatal("pass should have run out of time")
+	}
+
+	_, err = k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo4", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatalf("foo4 should have been skipped: %s", err)
+	}
+}
+
+// largeSecretVault returns a vault with a large keystore in
+// secrets/data/keystore.
+func largeSecretVault() *vault.Mock {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/keystore", map[string]interface{}{
+		"keystore.jks": strings.Repeat("x", 1<<20),
+	})
+	return vaultClient
+}
+
+// BenchmarkReflectLargeSecret reflects a large vault secret into many
+// secrets.
+func BenchmarkReflectLargeSecret(b *testing.B) {
+	// a large keystore shared by many secrets
+	vaultClient := largeSecretVault()
+
+	mappings := []Mapping{}
+	for i := 0; i < 20; i++ {
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/data/keystore",
+			SecretName:      fmt.Sprintf("keystore%d", i),
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		})
+	}
+
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(NewFakeSecrets()),
+	)
+	if err != nil {
+		b.Fatalf("unable to create reflector: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := r.Reflect(context.Background(), mappings)
+		if err != nil {
+			b.Fatalf("reflect didn't work: %s", err)
+		}
+	}
+}
+
+// BenchmarkLargeSecretData converts a large vault secret for many mappings
+// sharing it, once per pass with the read cache and for every mapping
+// without it, e.g. with "go test -run '^$' -bench LargeSecretData", to show
+// the copies the cache saves.
+func BenchmarkLargeSecretData(b *testing.B) {
+	secret, err := largeSecretVault().Read("secrets/data/keystore")
+	if err != nil {
+		b.Fatalf("unable to read keystore: %s", err)
+	}
+	const mappings = 20
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reads := newReadCache(nil)
+			for m := 0; m < mappings; m++ {
+				_, err := reads.Data("secrets/data/keystore", vault.EngineTypeKeyValueV2, secret)
+				if err != nil {
+					b.Fatalf("conversion didn't work: %s", err)
+				}
+			}
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for m := 0; m < mappings; m++ {
+				_, err := secretData(secret, vault.EngineTypeKeyValueV2)
+				if err != nil {
+					b.Fatalf("conversion didn't work: %s", err)
+				}
+			}
+		}
+	})
+}
+
+func TestVersionCheck(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	mock.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	vaultClient := &countingVault{Mock: mock, reads: map[string]int{}}
+	k8sClient := k8sfake.NewSimpleClientset()
+
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithVersionCheck(),
+	)
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		err := r.Reflect(context.Background(), mappings)
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+	}
+
+	if reads := vaultClient.reads["secrets/data/foo"]; reads != 1 {
+		t.Fatalf("unchanged secret data should have been read once, was read %d times", reads)
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	secret, err := secrets.Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if secret.Annotations[VersionAnnotation] != "1" {
+		t.Fatalf("unexpected version annotation: %q", secret.Annotations[VersionAnnotation])
+	}
+
+	mock.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "baz",
+	})
+	err = r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work after the update: %s", err)
+	}
+
+	secret, err = secrets.Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if string(secret.Data["foo"]) != "baz" || secret.Annotations[VersionAnnotation] != "2" {
+		t.Fatalf("foo should have been updated to version 2: %s %v", secret.Data["foo"], secret.Annotations)
+	}
+}
+
+func TestVersionCheckRestart(t *testing.T) {
+	mock := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	mock.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	mock.Write("secrets/data/bar", map[string]interface{}{
+		"foo": "baz",
+	})
+	k8sClient := k8sfake.NewSimpleClientset()
+
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+		},
+	}
+
+	first := NewReflector(
+		mock,
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+	)
+	err := first.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	// a new reflector picks up the versions recorded by the first one.
+	vaultClient := &countingVault{Mock: mock, reads: map[string]int{}}
+	restarted := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithVersionCheck(),
+	)
+	err = restarted.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work after the restart: %s", err)
+	}
+	if reads := vaultClient.reads["secrets/data/foo"]; reads != 0 {
+		t.Fatalf("unchanged secret data should not have been read, was read %d times", reads)
+	}
+
+	// pointing the mapping at another path with the same version must not
+	// be mistaken for an unchanged secret.
+	mappings[0].VaultPath = "secrets/data/bar"
+	err = restarted.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work after the path change: %s", err)
+	}
+
+	secret, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if string(secret.Data["foo"]) != "baz" {
+		t.Fatalf("foo should have been updated from the new path: %s", secret.Data["foo"])
+	}
+	if secret.Annotations[PathAnnotation] != "secrets/data/bar" {
+		t.Fatalf("unexpected path annotation: %q", secret.Annotations[PathAnnotation])
+	}
+}
+
+func TestSyncNoReconcile(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		vaultClient.Write("secrets/data/foo1", map[string]interface{}{
+			"foo": "bar",
+		})
+		vaultClient.Write("secrets/data/foo2", map[string]interface{}{
+			"foo": "bar",
+		})
+
+		r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test")
+
+		mappings := []Mapping{
+			{
+				VaultPath:       "secrets/data/foo1",
+				SecretName:      "foo1",
+				VaultEngineType: engineType,
+			},
+			{
+				VaultPath:       "secrets/data/foo2",
+				SecretName:      "foo2",
+				VaultEngineType: engineType,
+			},
+		}
+		err := r.Reflect(context.Background(), mappings)
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		vaultClient.Write("secrets/data/foo1", map[string]interface{}{
+			"foo": "baz",
+		})
+
+		// syncing only foo1 must leave foo2 alone.
+		err = r.Sync(context.Background(), mappings[:1])
+		if err != nil {
+			t.Fatalf("sync didn't work: %s", err)
+		}
+
+		secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+		s, err := secrets.Get("foo1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("foo1 should be there: %s", err)
+		}
+		if string(s.Data["foo"]) != "baz" {
+			t.Fatalf("foo1 should have been updated: %s", s.Data["foo"])
+		}
+
+		_, err = secrets.Get("foo2", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("foo2 should still be there: %s", err)
+		}
+	})
+}
+
+func TestRecreateDeleted(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	r := NewReflector(
+		vaultClient,
+		k8sClient,
+		DefaultNamespace,
+		DefaultLabelValue,
+		WithInformer(stopCh),
+		WithRecreateDeleted(100, 10),
+	)
+
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+	}
+
+	err := r.Reflect(context.Background(), mappings)
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	// wait for the informer to see the new secret
+	for i := 0; i < 100; i++ {
+		if _, err := r.secretLister.Get("foo"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.RecreateDeleted(ctx, mappings)
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	err = secrets.Delete("foo", &metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("unable to delete foo: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		s, err := secrets.Get("foo", metav1.GetOptions{})
+		if err == nil {
+			if string(s.Data["foo"]) != "bar" {
+				t.Fatalf("unexpected re-created data: %s", s.Data["foo"])
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("foo should have been re-created")
+}
+
+func TestTOTP(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"totp": vault.EngineTypeTOTP,
+	})
+	vaultClient.Write("totp/code/portal", map[string]interface{}{"code": "123456"})
+	vaultClient.Write("totp/keys/portal", map[string]interface{}{
+		"account_name": "ops@example.com",
+		"algorithm":    "SHA1",
+		"digits":       json.Number("6"),
+		"issuer":       "Vendor",
+		"period":       json.Number("30"),
+	})
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, DefaultLabelValue)
+	err := r.Reflect(context.Background(), []Mapping{
+		{
+			VaultPath:       "totp/code/portal",
+			SecretName:      "portal-code",
+			VaultEngineType: vault.EngineTypeTOTP,
+		},
+		{
+			VaultPath:       "totp/keys/portal",
+			SecretName:      "portal-key",
+			VaultEngineType: vault.EngineTypeTOTP,
+		},
+	})
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	code, err := secrets.Get("portal-code", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("portal-code should be there: %s", err)
+	}
+	if string(code.Data["code"]) != "123456" {
+		t.Errorf("unexpected code: %s", code.Data["code"])
+	}
+
+	key, err := secrets.Get("portal-key", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("portal-key should be there: %s", err)
+	}
+	if string(key.Data["digits"]) != "6" || string(key.Data["period"]) != "30" ||
+		string(key.Data["issuer"]) != "Vendor" {
+		t.Errorf("unexpected key configuration: %v", key.Data)
+	}
+}
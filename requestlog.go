@@ -0,0 +1,95 @@
+package pentagon
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// requestLogging is 1 while requests are logged.
+var requestLogging int32
+
+// SetRequestLogging sets whether the requests made through the round
+// trippers of NewRequestLogger are logged.  It can be called at any time.
+func SetRequestLogging(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&requestLogging, v)
+}
+
+// RequestLogging returns whether requests are logged.
+func RequestLogging() bool {
+	return atomic.LoadInt32(&requestLogging) == 1
+}
+
+// requestLogger logs the requests made through it while request logging is
+// enabled.
+type requestLogger struct {
+	service string
+	next    http.RoundTripper
+}
+
+// NewRequestLogger returns a round tripper making requests to service with
+// next, and logging their method, path, status and latency while
+// RequestLogging is enabled.  Payloads and query parameter values, which
+// may hold secrets, are never logged.
+func NewRequestLogger(service string, next http.RoundTripper) http.RoundTripper {
+	return &requestLogger{service: service, next: next}
+}
+
+// RoundTrip makes the request and logs it.
+func (l *requestLogger) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !RequestLogging() {
+		return l.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := l.next.RoundTrip(req)
+	latency := time.Since(start)
+
+	status := "error"
+	if err == nil {
+		status = resp.Status
+	}
+	log.Printf(
+		"%s request: %s %s%s %s in %s",
+		l.service,
+		req.Method,
+		redactedURL(req.URL),
+		payloadSize(req),
+		status,
+		latency,
+	)
+	return resp, err
+}
+
+// redactedURL returns the path of u followed by its query with the values
+// redacted.
+func redactedURL(u *url.URL) string {
+	query := u.Query()
+	if len(query) == 0 {
+		return u.EscapedPath()
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, url.QueryEscape(key)+"=REDACTED")
+	}
+	sort.Strings(keys)
+	return u.EscapedPath() + "?" + strings.Join(keys, "&")
+}
+
+// payloadSize describes the redacted payload of req, if it has one.
+func payloadSize(req *http.Request) string {
+	if req.ContentLength <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d byte payload redacted)", req.ContentLength)
+}
@@ -0,0 +1,58 @@
+package pentagon
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	client := &http.Client{Transport: NewRequestLogger("vault", http.DefaultTransport)}
+	post := func() {
+		resp, err := client.Post(
+			server.URL+"/v1/secrets/data/foo?version=3",
+			"application/json",
+			strings.NewReader(`{"data":{"password":"hunter2"}}`),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		resp.Body.Close()
+	}
+
+	post()
+	if buf.Len() > 0 {
+		t.Fatalf("requests shouldn't be logged by default: %s", buf)
+	}
+
+	SetRequestLogging(true)
+	defer SetRequestLogging(false)
+	post()
+
+	logged := buf.String()
+	for _, expected := range []string{
+		"vault request: POST /v1/secrets/data/foo?version=REDACTED",
+		"(31 byte payload redacted)",
+		"403 Forbidden",
+	} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("expected %q in %q", expected, logged)
+		}
+	}
+	if strings.Contains(logged, "hunter2") || strings.Contains(logged, "version=3") {
+		t.Errorf("secrets were logged: %s", logged)
+	}
+}
@@ -0,0 +1,136 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// ReverseMapping is a mapping of a k8s secret to a vault secret, for
+// capturing secrets created in kubernetes (e.g. by other controllers) in
+// vault.
+type ReverseMapping struct {
+	// SecretName is the name of the k8s secret to read.  It must not be
+	// managed by pentagon.
+	SecretName string `yaml:"secretName"`
+
+	// VaultPath is the path of the vault secret to write.
+	VaultPath string `yaml:"vaultPath"`
+
+	// VaultEngineType is the type of secrets engine mounted at VaultPath.
+	// Default is the DefaultEngineType of the VaultConfig.
+	VaultEngineType vault.EngineType `yaml:"vaultEngineType"`
+}
+
+// ReverseReflector moves things from k8s secrets to vault.
+type ReverseReflector struct {
+	vaultClient  vault.Logical
+	k8sClient    kubernetes.Interface
+	k8sNamespace string
+}
+
+// NewReverseReflector returns a ReverseReflector reading secrets in
+// k8sNamespace.
+func NewReverseReflector(
+	vaultClient vault.Logical,
+	k8sClient kubernetes.Interface,
+	k8sNamespace string,
+) *ReverseReflector {
+	return &ReverseReflector{
+		vaultClient:  vaultClient,
+		k8sClient:    k8sClient,
+		k8sNamespace: k8sNamespace,
+	}
+}
+
+// Reflect writes the data of each mapping's k8s secret to vault, unless
+// vault already has the same data.  A failed mapping doesn't stop the
+// others.
+func (r *ReverseReflector) Reflect(ctx context.Context, mappings []ReverseMapping) error {
+	failures := []string{}
+	for _, mapping := range mappings {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := r.reflectMapping(ctx, mapping)
+		if err != nil {
+			log.Printf("error reflecting %s to vault: %s", mapping.SecretName, err)
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"%d of %d reverse mappings failed: %s",
+			len(failures),
+			len(mappings),
+			strings.Join(failures, "; "),
+		)
+	}
+	return nil
+}
+
+// reflectMapping writes a single k8s secret to vault.
+func (r *ReverseReflector) reflectMapping(ctx context.Context, mapping ReverseMapping) error {
+	secret, err := r.k8sClient.CoreV1().Secrets(r.k8sNamespace).Get(
+		mapping.SecretName,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("error getting secret %s: %s", mapping.SecretName, err)
+	}
+
+	// writing a secret pentagon reflects from vault back to vault would
+	// make a loop.
+	if _, ok := secret.Labels[LabelKey]; ok {
+		return fmt.Errorf("secret %s is managed by pentagon", mapping.SecretName)
+	}
+
+	current, err := vault.ReadWithContext(ctx, r.vaultClient, mapping.VaultPath)
+	if err != nil {
+		return fmt.Errorf("error reading vault key '%s': %s", mapping.VaultPath, err)
+	}
+	if current != nil {
+		currentData, err := secretData(current, mapping.VaultEngineType)
+		if err == nil && dataEqual(currentData, secret.Data) {
+			log.Printf(
+				"vault secret %s is up to date with kubernetes secret %s",
+				mapping.VaultPath,
+				mapping.SecretName,
+			)
+			return nil
+		}
+	}
+
+	data := make(map[string]interface{}, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+
+	switch mapping.VaultEngineType {
+	case vault.EngineTypeKeyValueV1:
+	case vault.EngineTypeKeyValueV2:
+		data = map[string]interface{}{"data": data}
+	default:
+		return fmt.Errorf("unknown vault engine type: %q", mapping.VaultEngineType)
+	}
+
+	_, err = r.vaultClient.Write(mapping.VaultPath, data)
+	if err != nil {
+		return fmt.Errorf("error writing vault key '%s': %s", mapping.VaultPath, err)
+	}
+
+	log.Printf(
+		"reflected kubernetes secret %s to vault %s",
+		mapping.SecretName,
+		mapping.VaultPath,
+	)
+	return nil
+}
@@ -0,0 +1,84 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestReverseReflect(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset(
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ca",
+					Namespace: DefaultNamespace,
+				},
+				Data: map[string][]byte{
+					"tls.crt": []byte("cert"),
+				},
+			},
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "managed",
+					Namespace: DefaultNamespace,
+					Labels:    map[string]string{LabelKey: DefaultLabelValue},
+				},
+			},
+		)
+		vaultClient := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+
+		r := NewReverseReflector(vaultClient, k8sClient, DefaultNamespace)
+		mappings := []ReverseMapping{
+			{
+				SecretName:      "ca",
+				VaultPath:       "secrets/data/ca",
+				VaultEngineType: engineType,
+			},
+		}
+
+		for i := 0; i < 2; i++ {
+			err := r.Reflect(context.Background(), mappings)
+			if err != nil {
+				t.Fatalf("reverse reflect didn't work: %s", err)
+			}
+		}
+
+		secret, err := vaultClient.Read("secrets/data/ca")
+		if err != nil || secret == nil {
+			t.Fatalf("ca should be in vault: %v", err)
+		}
+		data, err := secretData(secret, engineType)
+		if err != nil {
+			t.Fatalf("unexpected vault data: %s", err)
+		}
+		if string(data["tls.crt"]) != "cert" {
+			t.Fatalf("unexpected vault data: %v", data)
+		}
+
+		// the second pass shouldn't have written a new version.
+		if engineType == vault.EngineTypeKeyValueV2 {
+			if version := secretVersion(secret, engineType); version != "1" {
+				t.Fatalf("unchanged secret should not have been written again: version %s", version)
+			}
+		}
+
+		err = r.Reflect(context.Background(), []ReverseMapping{
+			{
+				SecretName:      "managed",
+				VaultPath:       "secrets/data/managed",
+				VaultEngineType: engineType,
+			},
+		})
+		if err == nil {
+			t.Fatal("secrets managed by pentagon should not be written to vault")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// Rollback reflects version of the key/value v2 secret of mapping into its
+// k8s secret, e.g. to recover quickly from a rotation to a broken
+// credential.  The next pass reflects the current version again unless the
+// vault secret is rolled back too.
+func (r *Reflector) Rollback(ctx context.Context, mapping Mapping, version int64) error {
+	if mapping.VaultEngineType != vault.EngineTypeKeyValueV2 {
+		return fmt.Errorf(
+			"vault secret %s isn't versioned, engine type is %q",
+			mapping.VaultPath,
+			mapping.VaultEngineType,
+		)
+	}
+	defer r.flushAudit(ctx)
+
+	readCtx := ctx
+	if r.vaultTimeout > 0 {
+		var cancel context.CancelFunc
+		readCtx, cancel = context.WithTimeout(ctx, r.vaultTimeout)
+		defer cancel()
+	}
+
+	client, err := r.sourceClient(mapping)
+	if err != nil {
+		return err
+	}
+
+	vaultSecret, err := vault.ReadVersion(readCtx, client, mapping.VaultPath, version)
+	if err != nil {
+		err = fmt.Errorf(
+			"error reading version %d of vault key '%s': %w",
+			version,
+			mapping.VaultPath,
+			err,
+		)
+		if vault.IsPermissionDenied(err) {
+			return classify(ErrAuthFailed, err)
+		}
+		return err
+	}
+
+	// vault still returns the metadata of deleted versions.
+	if vaultSecret == nil || vaultSecret.Data["data"] == nil {
+		return classify(ErrPathNotFound, fmt.Errorf(
+			"version %d of secret %s not found",
+			version,
+			mapping.VaultPath,
+		))
+	}
+
+	data, err := secretData(vaultSecret, mapping.VaultEngineType)
+	if err != nil {
+		return err
+	}
+
+	// the data overrides are read at their current versions.
+	readOverride := func(path string) (map[string][]byte, error) {
+		secret, err := vault.ReadWithContext(readCtx, client, path)
+		if err != nil {
+			return nil, readError(path, err)
+		}
+		if secret == nil {
+			return nil, nil
+		}
+		return secretData(secret, mapping.VaultEngineType)
+	}
+	data, err = mappingData(ctx, mapping, data, readOverride)
+	if err != nil {
+		return fmt.Errorf("version %d: %w", version, err)
+	}
+
+	newSecret := r.newSecret(mapping, data, vaultSecret)
+
+	current, err := r.secrets().Get(
+		mapping.SecretName,
+		metav1.GetOptions{},
+	)
+	switch {
+	case errors.IsNotFound(err):
+		current = nil
+	case err != nil:
+		return fmt.Errorf("error getting secret %s: %s", mapping.SecretName, err)
+	default:
+		err = r.checkOwner(current)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.updateSecret(ctx, mapping, current, newSecret)
+	if err != nil {
+		return err
+	}
+
+	log.Printf(
+		"rolled kubernetes secret %s back to version %d of vault secret %s",
+		mapping.SecretName,
+		version,
+		mapping.VaultPath,
+	)
+	return nil
+}
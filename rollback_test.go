@@ -0,0 +1,103 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestRollback(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+		"v1":      vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	vaultClient.Write("secrets/data/foo", map[string]interface{}{
+		"foo": "baz",
+	})
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, DefaultLabelValue)
+
+	mapping := Mapping{
+		VaultPath:       "secrets/data/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV2,
+	}
+	err := r.Reflect(context.Background(), []Mapping{mapping})
+	if err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	err = r.Rollback(context.Background(), mapping, 1)
+	if err != nil {
+		t.Fatalf("rollback didn't work: %s", err)
+	}
+
+	s, err := k8sClient.CoreV1().Secrets(DefaultNamespace).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("foo should be there: %s", err)
+	}
+	if string(s.Data["foo"]) != "bar" {
+		t.Fatalf("foo should have the first version: %s", s.Data["foo"])
+	}
+	if s.Annotations[VersionAnnotation] != "1" {
+		t.Fatalf("unexpected version annotation: %q", s.Annotations[VersionAnnotation])
+	}
+
+	err = r.Rollback(context.Background(), mapping, 3)
+	if err == nil {
+		t.Fatal("rolling back to a missing version should fail")
+	}
+
+	err = r.Rollback(context.Background(), Mapping{
+		VaultPath:       "v1/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+	}, 1)
+	if err == nil {
+		t.Fatal("rolling back an unversioned secret should fail")
+	}
+}
+
+func TestRollbackDataOverrides(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/db", map[string]interface{}{"user": "app"})
+	vaultClient.Write("secrets/data/db", map[string]interface{}{"user": "app2"})
+	vaultClient.Write("secrets/data/shared", map[string]interface{}{"password": "hunter2"})
+
+	secrets := NewFakeSecrets()
+	r, err := New(context.Background(), WithVault(vaultClient), WithSecretClient(secrets))
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	mapping := Mapping{
+		VaultPath:       "secrets/data/db",
+		SecretName:      "db",
+		VaultEngineType: vault.EngineTypeKeyValueV2,
+		Data: []DataOverride{
+			{Key: "password", VaultPath: "secrets/data/shared"},
+			{Key: "url", Template: "{{.user}}:{{.password}}"},
+		},
+	}
+	if err := r.Rollback(context.Background(), mapping, 1); err != nil {
+		t.Fatalf("rollback didn't work: %s", err)
+	}
+
+	s, err := secrets.Get("db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("db should be there: %s", err)
+	}
+	if string(s.Data["user"]) != "app" || string(s.Data["password"]) != "hunter2" ||
+		string(s.Data["url"]) != "app:hunter2" {
+		t.Errorf("the data overrides weren't applied: %v", s.Data)
+	}
+}
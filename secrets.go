@@ -0,0 +1,34 @@
+package pentagon
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretClient is the subset of the kubernetes secrets client of a
+// namespace that a Reflector uses to manage its secrets.  FakeSecrets
+// implements it in memory.
+type SecretClient interface {
+	Get(name string, options metav1.GetOptions) (*v1.Secret, error)
+	List(options metav1.ListOptions) (*v1.SecretList, error)
+	Create(secret *v1.Secret) (*v1.Secret, error)
+	Update(secret *v1.Secret) (*v1.Secret, error)
+	Delete(name string, options *metav1.DeleteOptions) error
+}
+
+// WithSecretClient makes the reflector manage its secrets with client
+// rather than with the secrets client of its kubernetes client.  The
+// secrets can't be cached without a kubernetes client.
+func WithSecretClient(client SecretClient) Option {
+	return func(r *Reflector) {
+		r.secretClient = client
+	}
+}
+
+// secrets returns the client managing the reflector's secrets.
+func (r *Reflector) secrets() SecretClient {
+	if r.secretClient != nil {
+		return r.secretClient
+	}
+	return r.k8sClient.CoreV1().Secrets(r.k8sNamespace)
+}
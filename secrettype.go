@@ -0,0 +1,103 @@
+package pentagon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// secretTypes are the types a mapping can declare for its secret.  Secrets
+// of the well-known types have their data checked by checkType before they
+// are written.
+var secretTypes = map[v1.SecretType]struct{}{
+	v1.SecretTypeOpaque:    {},
+	v1.SecretTypeTLS:       {},
+	v1.SecretTypeSSHAuth:   {},
+	v1.SecretTypeBasicAuth: {},
+}
+
+// validateSecretType returns an error if a mapping can't declare
+// secretType.  Empty picks the type from the data.
+func validateSecretType(secretType v1.SecretType) error {
+	if secretType == "" {
+		return nil
+	}
+	if _, ok := secretTypes[secretType]; !ok {
+		return fmt.Errorf("unsupported secret type %q", secretType)
+	}
+	return nil
+}
+
+// checkType makes sure that data has the keys that secrets of secretType
+// need and that their values parse, so that e.g. a TLS secret whose key
+// doesn't match its certificate isn't written.
+func checkType(secretType v1.SecretType, data map[string][]byte) error {
+	switch secretType {
+	case v1.SecretTypeTLS:
+		if err := requireTypeKeys(secretType, data, v1.TLSCertKey, v1.TLSPrivateKeyKey); err != nil {
+			return err
+		}
+		if _, err := tls.X509KeyPair(data[v1.TLSCertKey], data[v1.TLSPrivateKeyKey]); err != nil {
+			return fmt.Errorf("invalid %s secret: %s", secretType, err)
+		}
+	case v1.SecretTypeSSHAuth:
+		if err := requireTypeKeys(secretType, data, v1.SSHAuthPrivateKey); err != nil {
+			return err
+		}
+		if err := checkPrivateKey(data[v1.SSHAuthPrivateKey]); err != nil {
+			return fmt.Errorf("invalid %s secret: %s", secretType, err)
+		}
+	case v1.SecretTypeBasicAuth:
+		_, user := data[v1.BasicAuthUsernameKey]
+		_, password := data[v1.BasicAuthPasswordKey]
+		if !user && !password {
+			return fmt.Errorf(
+				"%s secret needs a %s or a %s",
+				secretType,
+				v1.BasicAuthUsernameKey,
+				v1.BasicAuthPasswordKey,
+			)
+		}
+	}
+	return nil
+}
+
+// requireTypeKeys returns an error naming the keys missing from data that
+// secrets of secretType need.
+func requireTypeKeys(secretType v1.SecretType, data map[string][]byte, keys ...string) error {
+	for _, key := range keys {
+		if _, ok := data[key]; !ok {
+			return fmt.Errorf("%s secret needs a %s", secretType, key)
+		}
+	}
+	return nil
+}
+
+// checkPrivateKey returns an error if key isn't a PEM encoded private key.
+// OpenSSH keys are only checked to be PEM encoded.
+func checkPrivateKey(key []byte) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return fmt.Errorf("%s isn't PEM encoded", v1.SSHAuthPrivateKey)
+	}
+
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "OPENSSH PRIVATE KEY":
+	default:
+		return fmt.Errorf("%s has unknown PEM block type %q", v1.SSHAuthPrivateKey, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %s", v1.SSHAuthPrivateKey, err)
+	}
+	return nil
+}
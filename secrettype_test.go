@@ -0,0 +1,175 @@
+package pentagon
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// keyPair returns a new PEM encoded self-signed certificate and its PEM
+// encoded private key.
+func keyPair(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestCheckType(t *testing.T) {
+	cert, key := keyPair(t)
+	_, otherKey := keyPair(t)
+
+	for _, test := range []struct {
+		secretType v1.SecretType
+		data       map[string][]byte
+		err        string
+	}{
+		{
+			secretType: v1.SecretTypeOpaque,
+			data:       map[string][]byte{},
+		},
+		{
+			secretType: v1.SecretTypeTLS,
+			data:       map[string][]byte{"tls.crt": cert, "tls.key": key},
+		},
+		{
+			secretType: v1.SecretTypeTLS,
+			data:       map[string][]byte{"tls.crt": cert},
+			err:        "needs a tls.key",
+		},
+		{
+			secretType: v1.SecretTypeTLS,
+			data:       map[string][]byte{"tls.crt": cert, "tls.key": otherKey},
+			err:        "does not match",
+		},
+		{
+			secretType: v1.SecretTypeTLS,
+			data:       map[string][]byte{"tls.crt": []byte("nope"), "tls.key": key},
+			err:        "invalid kubernetes.io/tls secret",
+		},
+		{
+			secretType: v1.SecretTypeSSHAuth,
+			data:       map[string][]byte{"ssh-privatekey": key},
+		},
+		{
+			secretType: v1.SecretTypeSSHAuth,
+			data:       map[string][]byte{"ssh-privatekey": []byte("nope")},
+			err:        "isn't PEM encoded",
+		},
+		{
+			secretType: v1.SecretTypeSSHAuth,
+			data:       map[string][]byte{"ssh-privatekey": cert},
+			err:        "unknown PEM block type",
+		},
+		{
+			secretType: v1.SecretTypeSSHAuth,
+			data:       map[string][]byte{},
+			err:        "needs a ssh-privatekey",
+		},
+		{
+			secretType: v1.SecretTypeBasicAuth,
+			data:       map[string][]byte{"password": []byte("hunter2")},
+		},
+		{
+			secretType: v1.SecretTypeBasicAuth,
+			data:       map[string][]byte{"token": []byte("hunter2")},
+			err:        "needs a username or a password",
+		},
+	} {
+		err := checkType(test.secretType, test.data)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.secretType, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q, got %v", test.secretType, test.err, err)
+		}
+	}
+
+	if err := validateSecretType("kubernetes.io/service-account-token"); err == nil {
+		t.Error("service account token secrets shouldn't be supported")
+	}
+}
+
+func TestSecretType(t *testing.T) {
+	cert, key := keyPair(t)
+	_, otherKey := keyPair(t)
+
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/good", map[string]interface{}{
+		"tls.crt": string(cert),
+		"tls.key": string(key),
+	})
+	vaultClient.Write("secrets/bad", map[string]interface{}{
+		"tls.crt": string(cert),
+		"tls.key": string(otherKey),
+	})
+	secrets := NewFakeSecrets()
+
+	r, err := New(context.Background(), WithVault(vaultClient), WithSecretClient(secrets))
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	err = r.Reflect(context.Background(), []Mapping{
+		{
+			VaultPath:       "secrets/good",
+			SecretName:      "good",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			Type:            v1.SecretTypeTLS,
+		},
+		{
+			VaultPath:       "secrets/bad",
+			SecretName:      "bad",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			Type:            v1.SecretTypeTLS,
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected the bad key pair to fail, got %v", err)
+	}
+
+	secret, err := secrets.Get("good", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get secret: %s", err)
+	}
+	if secret.Type != v1.SecretTypeTLS {
+		t.Errorf("expected type %s, got %s", v1.SecretTypeTLS, secret.Type)
+	}
+	if _, err := secrets.Get("bad", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("the bad secret shouldn't have been written: %v", err)
+	}
+}
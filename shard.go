@@ -0,0 +1,73 @@
+package pentagon
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// WithShard makes the reflector only reflect (and reconcile) the secrets
+// that belong to shard index out of count shards, so that several replicas
+// can split up the mappings between them.  Secrets are assigned to shards
+// with rendezvous hashing of their names, so changing the number of shards
+// only moves the secrets that have to move.
+func WithShard(index, count int) Option {
+	return func(r *Reflector) {
+		r.shardIndex = index
+		r.shardCount = count
+	}
+}
+
+// ShardOf returns the shard out of count shards that owns the secret name.
+func ShardOf(name string, count int) int {
+	best := 0
+	var bestScore uint64
+	for shard := 0; shard < count; shard++ {
+		if score := shardScore(name, shard); shard == 0 || score > bestScore {
+			best = shard
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// shardScore returns the rendezvous score of name on shard: the FNV-64a
+// hash of both, mixed with the splitmix64 finalizer since FNV alone
+// doesn't spread the scores of nearby inputs enough to balance shards.
+func shardScore(name string, shard int) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(shard)))
+
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// ownsSecret returns true if the secret name belongs to this reflector's
+// shard.
+func (r *Reflector) ownsSecret(name string) bool {
+	if r.shardCount <= 1 {
+		return true
+	}
+	return ShardOf(name, r.shardCount) == r.shardIndex
+}
+
+// shardMappings returns the mappings that belong to this reflector's shard.
+func (r *Reflector) shardMappings(mappings []Mapping) []Mapping {
+	if r.shardCount <= 1 {
+		return mappings
+	}
+
+	owned := make([]Mapping, 0, len(mappings)/r.shardCount+1)
+	for _, m := range mappings {
+		if r.ownsSecret(m.SecretName) {
+			owned = append(owned, m)
+		}
+	}
+	return owned
+}
@@ -0,0 +1,109 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestShardOf(t *testing.T) {
+	counts := make([]int, 4)
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("secret-%d", i)
+		shard := ShardOf(name, 4)
+		if shard < 0 || shard >= 4 {
+			t.Fatalf("shard %d out of range", shard)
+		}
+		if ShardOf(name, 4) != shard {
+			t.Fatalf("shard for %s is not stable", name)
+		}
+		counts[shard]++
+
+		// growing from 4 to 5 shards should only move secrets to the new
+		// shard
+		if newShard := ShardOf(name, 5); newShard != shard {
+			if newShard != 4 {
+				t.Fatalf("%s moved from %d to %d", name, shard, newShard)
+			}
+			moved++
+		}
+	}
+
+	for shard, count := range counts {
+		if count < 150 {
+			t.Fatalf("shard %d is unbalanced with %d secrets: %v", shard, count, counts)
+		}
+	}
+
+	if moved > 300 {
+		t.Fatalf("too many secrets moved: %d", moved)
+	}
+}
+
+func TestShardOfBalance(t *testing.T) {
+	const names = 10000
+	for _, count := range []int{2, 3, 4, 5, 7} {
+		counts := make([]int, count)
+		for i := 0; i < names; i++ {
+			counts[ShardOf(fmt.Sprintf("secret-%d", i), count)]++
+		}
+
+		// every shard should be within 10% of an even split.
+		even := names / count
+		for shard, n := range counts {
+			if n < even*9/10 || n > even*11/10 {
+				t.Errorf("%d shards are unbalanced, shard %d has %d secrets: %v", count, shard, n, counts)
+				break
+			}
+		}
+	}
+}
+
+func TestShardedReflect(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+
+	mappings := []Mapping{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("foo%d", i)
+		vaultClient.Write("secrets/data/"+name, map[string]interface{}{
+			"foo": name,
+		})
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/data/" + name,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		})
+	}
+
+	// each shard reflects its own mappings without reconciling the others'
+	for shard := 0; shard < 3; shard++ {
+		r := NewReflector(
+			vaultClient,
+			k8sClient,
+			DefaultNamespace,
+			"test",
+			WithShard(shard, 3),
+		)
+		err := r.Reflect(context.Background(), mappings)
+		if err != nil {
+			t.Fatalf("shard %d reflect didn't work: %s", shard, err)
+		}
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	for _, m := range mappings {
+		_, err := secrets.Get(m.SecretName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s should be there: %s", m.SecretName, err)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package pentagon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// SinkType is where a reflector writes its secrets.
+type SinkType string
+
+const (
+	// SinkTypeSecret writes k8s secrets.  It is the default.
+	SinkTypeSecret SinkType = "secret"
+
+	// SinkTypeConfigMap writes ConfigMaps with ConfigMapSecrets.
+	SinkTypeConfigMap SinkType = "configMap"
+
+	// SinkTypeFile writes files with FileSecrets.
+	SinkTypeFile SinkType = "file"
+)
+
+// SecretTypeAnnotation holds the type of the secrets that ConfigMapSecrets
+// keeps in ConfigMaps, which have no type of their own.
+const SecretTypeAnnotation = "pentagon.vimeo.com/secret-type"
+
+// ConfigMapSecrets is a SecretClient keeping secrets in the ConfigMaps of a
+// namespace, for consumers that can't read k8s secrets.  The values of a
+// secret go to the BinaryData of its ConfigMap.  Since more can usually read
+// ConfigMaps than secrets, values should be encrypted with EncryptedSecrets.
+type ConfigMapSecrets struct {
+	client corev1.ConfigMapInterface
+}
+
+var _ SecretClient = (*ConfigMapSecrets)(nil)
+
+// NewConfigMapSecrets returns a ConfigMapSecrets managing the ConfigMaps of
+// namespace with client.
+func NewConfigMapSecrets(client kubernetes.Interface, namespace string) *ConfigMapSecrets {
+	return &ConfigMapSecrets{client: client.CoreV1().ConfigMaps(namespace)}
+}
+
+// Get returns the secret kept in the ConfigMap named name.
+func (c *ConfigMapSecrets) Get(name string, options metav1.GetOptions) (*v1.Secret, error) {
+	cm, err := c.client.Get(name, options)
+	if err != nil {
+		return nil, err
+	}
+	return configMapSecret(cm), nil
+}
+
+// List returns the secrets kept in the ConfigMaps matching options.
+func (c *ConfigMapSecrets) List(options metav1.ListOptions) (*v1.SecretList, error) {
+	list, err := c.client.List(options)
+	if err != nil {
+		return nil, err
+	}
+	secrets := &v1.SecretList{Items: make([]v1.Secret, 0, len(list.Items))}
+	for i := range list.Items {
+		secrets.Items = append(secrets.Items, *configMapSecret(&list.Items[i]))
+	}
+	return secrets, nil
+}
+
+// Create creates the ConfigMap keeping secret.
+func (c *ConfigMapSecrets) Create(secret *v1.Secret) (*v1.Secret, error) {
+	cm, err := c.client.Create(secretConfigMap(secret))
+	if err != nil {
+		return nil, err
+	}
+	return configMapSecret(cm), nil
+}
+
+// Update replaces the ConfigMap keeping secret.
+func (c *ConfigMapSecrets) Update(secret *v1.Secret) (*v1.Secret, error) {
+	cm, err := c.client.Update(secretConfigMap(secret))
+	if err != nil {
+		return nil, err
+	}
+	return configMapSecret(cm), nil
+}
+
+// Delete deletes the ConfigMap named name.
+func (c *ConfigMapSecrets) Delete(name string, options *metav1.DeleteOptions) error {
+	return c.client.Delete(name, options)
+}
+
+// secretConfigMap returns the ConfigMap keeping secret.
+func secretConfigMap(secret *v1.Secret) *v1.ConfigMap {
+	cm := &v1.ConfigMap{
+		ObjectMeta: *secret.ObjectMeta.DeepCopy(),
+		BinaryData: secret.Data,
+	}
+	if secret.Type != "" {
+		if cm.Annotations == nil {
+			cm.Annotations = map[string]string{}
+		}
+		cm.Annotations[SecretTypeAnnotation] = string(secret.Type)
+	}
+	return cm
+}
+
+// configMapSecret returns the secret kept in cm.
+func configMapSecret(cm *v1.ConfigMap) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: *cm.ObjectMeta.DeepCopy(),
+		Data:       make(map[string][]byte, len(cm.BinaryData)+len(cm.Data)),
+	}
+	for key, value := range cm.Data {
+		secret.Data[key] = []byte(value)
+	}
+	for key, value := range cm.BinaryData {
+		secret.Data[key] = value
+	}
+	if secretType, ok := secret.Annotations[SecretTypeAnnotation]; ok {
+		secret.Type = v1.SecretType(secretType)
+		delete(secret.Annotations, SecretTypeAnnotation)
+	}
+	return secret
+}
+
+// FileSecrets is a SecretClient keeping every secret in a JSON file of a
+// directory named after the secret, for consumers outside of kubernetes,
+// e.g. a process committing the directory to git.  Files are replaced
+// atomically and only readable by their owner, but values should still be
+// encrypted with EncryptedSecrets when the files are shared.
+type FileSecrets struct {
+	directory string
+
+	mu sync.Mutex
+}
+
+var _ SecretClient = (*FileSecrets)(nil)
+
+// NewFileSecrets returns a FileSecrets keeping secrets in directory, which
+// must exist.
+func NewFileSecrets(directory string) *FileSecrets {
+	return &FileSecrets{directory: directory}
+}
+
+// path returns the path of the file of the secret named name.
+func (f *FileSecrets) path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", errors.NewBadRequest(fmt.Sprintf("invalid secret name %q", name))
+	}
+	return filepath.Join(f.directory, name+".json"), nil
+}
+
+// read returns the secret named name.  f.mu must be held.
+func (f *FileSecrets) read(name string) (*v1.Secret, error) {
+	path, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.NewNotFound(v1.Resource("secrets"), name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", path, err)
+	}
+
+	secret := &v1.Secret{}
+	if err := json.Unmarshal(raw, secret); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %s", path, err)
+	}
+	return secret, nil
+}
+
+// write replaces the file of secret, through a temporary file so that
+// readers never see a partial secret.  f.mu must be held.
+func (f *FileSecrets) write(secret *v1.Secret) (*v1.Secret, error) {
+	path, err := f.path(secret.Name)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.MarshalIndent(secret, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding secret %s: %s", secret.Name, err)
+	}
+
+	tmp, err := ioutil.TempFile(f.directory, "."+secret.Name+".")
+	if err != nil {
+		return nil, fmt.Errorf("error writing secret %s: %s", secret.Name, err)
+	}
+	_, err = tmp.Write(append(raw, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("error writing secret %s: %s", secret.Name, err)
+	}
+	return secret.DeepCopy(), nil
+}
+
+// Get returns the secret named name.
+func (f *FileSecrets) Get(name string, options metav1.GetOptions) (*v1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.read(name)
+}
+
+// List returns the secrets matching the label selector of options, sorted
+// by name.
+func (f *FileSecrets) List(options metav1.ListOptions) (*v1.SecretList, error) {
+	selector, err := labels.Parse(options.LabelSelector)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files, err := ioutil.ReadDir(f.directory)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %s", f.directory, err)
+	}
+	names := []string{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		if file.Mode().IsRegular() && name != file.Name() && !strings.HasPrefix(name, ".") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	list := &v1.SecretList{Items: make([]v1.Secret, 0, len(names))}
+	for _, name := range names {
+		secret, err := f.read(name)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Matches(labels.Set(secret.Labels)) {
+			list.Items = append(list.Items, *secret)
+		}
+	}
+	return list, nil
+}
+
+// Create writes secret unless a secret with the same name exists.
+func (f *FileSecrets) Create(secret *v1.Secret) (*v1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, err := f.read(secret.Name)
+	if err == nil {
+		return nil, errors.NewAlreadyExists(v1.Resource("secrets"), secret.Name)
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	return f.write(secret)
+}
+
+// Update replaces the secret with the same name as secret.
+func (f *FileSecrets) Update(secret *v1.Secret) (*v1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.read(secret.Name); err != nil {
+		return nil, err
+	}
+	return f.write(secret)
+}
+
+// Delete removes the secret named name.
+func (f *FileSecrets) Delete(name string, options *metav1.DeleteOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return errors.NewNotFound(v1.Resource("secrets"), name)
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting secret %s: %s", name, err)
+	}
+	return nil
+}
+
+// Encrypter encrypts the values of secrets, e.g. the Encrypter of the age
+// package.
+type Encrypter interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+}
+
+// EncryptedSecrets is a SecretClient encrypting the values of the secrets
+// it writes with another SecretClient, so that sinks such as ConfigMaps or
+// files never hold plaintext.  The values it reads can't be decrypted, so
+// the secrets it reads have the plaintext of the values it last wrote as
+// long as their ciphertext is unchanged, and secrets are written again
+// once after a restart.
+type EncryptedSecrets struct {
+	client    SecretClient
+	encrypter Encrypter
+
+	mu      sync.Mutex
+	written map[string]encryptedData
+}
+
+var _ SecretClient = (*EncryptedSecrets)(nil)
+
+// encryptedData is the plaintext and ciphertext of the values last written
+// to a secret.
+type encryptedData struct {
+	plaintext  map[string][]byte
+	ciphertext map[string][]byte
+}
+
+// NewEncryptedSecrets returns an EncryptedSecrets writing secrets with
+// client, their values encrypted with encrypter.
+func NewEncryptedSecrets(client SecretClient, encrypter Encrypter) *EncryptedSecrets {
+	return &EncryptedSecrets{
+		client:    client,
+		encrypter: encrypter,
+		written:   map[string]encryptedData{},
+	}
+}
+
+// Get returns the secret named name.
+func (e *EncryptedSecrets) Get(name string, options metav1.GetOptions) (*v1.Secret, error) {
+	secret, err := e.client.Get(name, options)
+	if err != nil {
+		return nil, err
+	}
+	e.decrypt(secret)
+	return secret, nil
+}
+
+// List returns the secrets matching options.
+func (e *EncryptedSecrets) List(options metav1.ListOptions) (*v1.SecretList, error) {
+	list, err := e.client.List(options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		e.decrypt(&list.Items[i])
+	}
+	return list, nil
+}
+
+// Create creates secret with its values encrypted.
+func (e *EncryptedSecrets) Create(secret *v1.Secret) (*v1.Secret, error) {
+	return e.write(secret, e.client.Create)
+}
+
+// Update replaces secret with its values encrypted.
+func (e *EncryptedSecrets) Update(secret *v1.Secret) (*v1.Secret, error) {
+	return e.write(secret, e.client.Update)
+}
+
+// Delete deletes the secret named name.
+func (e *EncryptedSecrets) Delete(name string, options *metav1.DeleteOptions) error {
+	err := e.client.Delete(name, options)
+	if err == nil || errors.IsNotFound(err) {
+		e.mu.Lock()
+		delete(e.written, name)
+		e.mu.Unlock()
+	}
+	return err
+}
+
+// write encrypts the values of secret and writes it with write.
+func (e *EncryptedSecrets) write(
+	secret *v1.Secret,
+	write func(*v1.Secret) (*v1.Secret, error),
+) (*v1.Secret, error) {
+	encrypted := secret.DeepCopy()
+	encrypted.Data = make(map[string][]byte, len(secret.Data))
+	for key, value := range secret.Data {
+		ciphertext, err := e.encrypter.Encrypt(value)
+		if err != nil {
+			return nil, fmt.Errorf("error encrypting %s of secret %s: %s", key, secret.Name, err)
+		}
+		encrypted.Data[key] = ciphertext
+	}
+
+	written, err := write(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.written[secret.Name] = encryptedData{
+		plaintext:  secret.DeepCopy().Data,
+		ciphertext: encrypted.Data,
+	}
+	e.mu.Unlock()
+
+	e.decrypt(written)
+	return written, nil
+}
+
+// decrypt replaces the values of secret with their plaintext if they are
+// the ones last written.
+func (e *EncryptedSecrets) decrypt(secret *v1.Secret) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	data, ok := e.written[secret.Name]
+	if !ok || !dataEqual(secret.Data, data.ciphertext) {
+		return
+	}
+	secret.Data = make(map[string][]byte, len(data.plaintext))
+	for key, value := range data.plaintext {
+		secret.Data[key] = append([]byte(nil), value...)
+	}
+}
@@ -0,0 +1,210 @@
+package pentagon
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/age"
+	"github.com/vimeo/pentagon/vault"
+)
+
+// sinkRecipient is the recipient of an age test identity.
+const sinkRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+
+func sinkVault() *vault.Mock {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/db", map[string]interface{}{
+		"user":     "admin",
+		"password": "hunter2",
+	})
+	return vaultClient
+}
+
+var sinkMappings = []Mapping{{
+	VaultPath:       "secrets/data/db",
+	SecretName:      "db",
+	VaultEngineType: vault.EngineTypeKeyValueV2,
+	Type:            v1.SecretTypeBasicAuth,
+}}
+
+func TestConfigMapSecrets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	k8sClient := k8sfake.NewSimpleClientset()
+	r, err := New(
+		ctx,
+		WithVault(sinkVault()),
+		WithSecretClient(NewConfigMapSecrets(k8sClient, "team")),
+		WithNamespace("team"),
+		WithLabel("sink"),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	if err := r.Reflect(ctx, sinkMappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	cm, err := k8sClient.CoreV1().ConfigMaps("team").Get("db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("db should be a ConfigMap: %s", err)
+	}
+	if string(cm.BinaryData["password"]) != "hunter2" ||
+		cm.Annotations[SecretTypeAnnotation] != string(v1.SecretTypeBasicAuth) ||
+		cm.Labels[LabelKey] != "sink" {
+		t.Fatalf("unexpected ConfigMap: %+v", cm)
+	}
+	if _, err := k8sClient.CoreV1().Secrets("team").Get("db", metav1.GetOptions{}); err == nil {
+		t.Fatal("no secret should have been written")
+	}
+
+	k8sClient.ClearActions()
+	if err := r.Reflect(ctx, sinkMappings); err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+	for _, action := range k8sClient.Actions() {
+		if action.GetVerb() != "list" && action.GetVerb() != "get" {
+			t.Errorf("an unchanged ConfigMap shouldn't be written: %v", action)
+		}
+	}
+
+	if err := r.Reflect(ctx, nil); err != nil {
+		t.Fatalf("reflect didn't work without mappings: %s", err)
+	}
+	if _, err := k8sClient.CoreV1().ConfigMaps("team").Get("db", metav1.GetOptions{}); err == nil {
+		t.Fatal("db should have been reconciled")
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pentagon-sink")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := NewFileSecrets(dir)
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "db",
+			Labels: map[string]string{LabelKey: DefaultLabelValue},
+		},
+		Data: map[string][]byte{"password": []byte("hunter2")},
+	}
+	if _, err := f.Create(secret); err != nil {
+		t.Fatalf("unable to create secret: %s", err)
+	}
+	if _, err := f.Create(secret); !errors.IsAlreadyExists(err) {
+		t.Fatalf("creating an existing secret should fail with AlreadyExists: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "db.json"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("db.json should only be readable by its owner: %v %v", info, err)
+	}
+
+	secret.Data["password"] = []byte("hunter3")
+	if _, err := f.Update(secret); err != nil {
+		t.Fatalf("unable to update secret: %s", err)
+	}
+	got, err := f.Get("db", metav1.GetOptions{})
+	if err != nil || string(got.Data["password"]) != "hunter3" {
+		t.Fatalf("unexpected secret: %+v %v", got, err)
+	}
+
+	list, err := f.List(metav1.ListOptions{LabelSelector: LabelKey + "=" + DefaultLabelValue})
+	if err != nil || len(list.Items) != 1 || list.Items[0].Name != "db" {
+		t.Fatalf("unexpected list: %+v %v", list, err)
+	}
+	list, err = f.List(metav1.ListOptions{LabelSelector: LabelKey + "=other"})
+	if err != nil || len(list.Items) != 0 {
+		t.Fatalf("unexpected list with another label: %+v %v", list, err)
+	}
+
+	if err := f.Delete("db", nil); err != nil {
+		t.Fatalf("unable to delete secret: %s", err)
+	}
+	for name, err := range map[string]error{
+		"get":    func() error { _, err := f.Get("db", metav1.GetOptions{}); return err }(),
+		"update": func() error { _, err := f.Update(secret); return err }(),
+		"delete": f.Delete("db", nil),
+	} {
+		if !errors.IsNotFound(err) {
+			t.Errorf("%s of a missing secret should fail with NotFound: %v", name, err)
+		}
+	}
+
+	if _, err := f.Get("../db", metav1.GetOptions{}); err == nil {
+		t.Error("secret names shouldn't escape the directory")
+	}
+}
+
+func TestEncryptedSecrets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	encrypter, err := age.NewEncrypter(sinkRecipient)
+	if err != nil {
+		t.Fatalf("unable to create encrypter: %s", err)
+	}
+	fake := NewFakeSecrets()
+	newReflector := func() *Reflector {
+		r, err := New(
+			ctx,
+			WithVault(sinkVault()),
+			WithSecretClient(NewEncryptedSecrets(fake, encrypter)),
+		)
+		if err != nil {
+			t.Fatalf("unable to create reflector: %s", err)
+		}
+		return r
+	}
+
+	r := newReflector()
+	if err := r.Reflect(ctx, sinkMappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	written, err := fake.Get("db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("db should have been written: %s", err)
+	}
+	for key, value := range written.Data {
+		if !bytes.HasPrefix(value, []byte(age.ArmorHeader)) || bytes.Contains(value, []byte("hunter2")) {
+			t.Errorf("%s should be encrypted: %s", key, value)
+		}
+	}
+
+	// the values written are known, so unchanged secrets aren't written
+	// again.
+	if err := r.Reflect(ctx, sinkMappings); err != nil {
+		t.Fatalf("reflect didn't work the second time: %s", err)
+	}
+	again, err := fake.Get("db", metav1.GetOptions{})
+	if err != nil || again.ResourceVersion != written.ResourceVersion {
+		t.Fatalf("db shouldn't have been written again: %+v %v", again, err)
+	}
+
+	// after a restart, secrets are written again once.
+	r = newReflector()
+	for i := 0; i < 2; i++ {
+		if err := r.Reflect(ctx, sinkMappings); err != nil {
+			t.Fatalf("reflect didn't work after a restart: %s", err)
+		}
+	}
+	restarted, err := fake.Get("db", metav1.GetOptions{})
+	if err != nil || restarted.ResourceVersion != "2" {
+		t.Fatalf("db should have been written once after a restart: %+v %v", restarted, err)
+	}
+}
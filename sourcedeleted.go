@@ -0,0 +1,92 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/hashicorp/vault/api"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// SourceDeletedAnnotation records when the latest version of the key/value
+// v2 secret reflected into a k8s secret was deleted in vault.  The secret
+// keeps the data it had, so consumers can tell a source that is going away
+// from a sync that is broken.  The annotation is removed once a version
+// that isn't deleted is reflected.
+const SourceDeletedAnnotation = "pentagon.vimeo.com/vault-deleted"
+
+// deletionTime returns the deletion time of a soft-deleted key/value v2
+// secret, or "" if it isn't deleted.
+func deletionTime(secret *api.Secret, engineType vault.EngineType) string {
+	if engineType != vault.EngineTypeKeyValueV2 {
+		return ""
+	}
+	meta, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	deletedAt, _ := meta["deletion_time"].(string)
+	return deletedAt
+}
+
+// setSourceDeletedMetric records whether the vault secret of the mapping of
+// the secret named name is deleted.
+func (r *Reflector) setSourceDeletedMetric(name string, deleted bool) {
+	r.setMappingGauge(sourceDeletedGauge, r.deletedLabels, name, deleted)
+}
+
+// markSourceDeleted annotates current, the secret of mapping, with the
+// time its vault secret was deleted rather than failing the mapping.  A
+// secret that doesn't exist has no data to keep, so the mapping fails
+// unless it is optional.
+func (r *Reflector) markSourceDeleted(
+	ctx context.Context,
+	p *pass,
+	mapping Mapping,
+	current *v1.Secret,
+	deletedAt string,
+) (string, error) {
+	if current == nil {
+		if mapping.Optional {
+			log.Printf(
+				"optional vault secret %s was deleted at %s, skipping %s",
+				mapping.VaultPath,
+				deletedAt,
+				mapping.SecretName,
+			)
+			return "", nil
+		}
+		return "", classify(ErrPathNotFound, fmt.Errorf(
+			"secret %s was deleted at %s",
+			mapping.VaultPath,
+			deletedAt,
+		))
+	}
+
+	version := current.Annotations[VersionAnnotation]
+	if current.Annotations[SourceDeletedAnnotation] == deletedAt {
+		atomic.AddInt64(&p.unchanged, 1)
+		return version, nil
+	}
+
+	log.Printf(
+		"vault secret %s was deleted at %s, marking %s as stale",
+		mapping.VaultPath,
+		deletedAt,
+		mapping.SecretName,
+	)
+	marked := current.DeepCopy()
+	if marked.Annotations == nil {
+		marked.Annotations = map[string]string{}
+	}
+	marked.Annotations[SourceDeletedAnnotation] = deletedAt
+	if err := r.writeSecret(ctx, marked, true); err != nil {
+		return "", err
+	}
+	atomic.AddInt64(&p.written, 1)
+	return version, nil
+}
@@ -0,0 +1,84 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestSourceDeleted(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/deleted", map[string]interface{}{"foo": "bar"})
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test", WithVersionCheck())
+	mappings := []Mapping{{
+		VaultPath:       "secrets/data/deleted",
+		SecretName:      "deleted",
+		VaultEngineType: vault.EngineTypeKeyValueV2,
+	}}
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	// the secret keeps its data and is marked as stale.
+	vaultClient.Delete("secrets/data/deleted")
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect should succeed once the vault secret is deleted: %s", err)
+	}
+
+	secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+	s, err := secrets.Get("deleted", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("deleted should still be there: %s", err)
+	}
+	if string(s.Data["foo"]) != "bar" {
+		t.Fatalf("deleted should have kept its data: %s", s.Data["foo"])
+	}
+	if s.Annotations[SourceDeletedAnnotation] == "" {
+		t.Fatalf("deleted should have been marked as stale: %v", s.Annotations)
+	}
+	if v := testutil.ToFloat64(sourceDeletedGauge.WithLabelValues("deleted")); v != 1 {
+		t.Fatalf("expected the source deleted metric to be 1, got %v", v)
+	}
+
+	// a new version clears the mark.
+	vaultClient.Write("secrets/data/deleted", map[string]interface{}{"foo": "baz"})
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work after a new version: %s", err)
+	}
+
+	s, err = secrets.Get("deleted", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("deleted should still be there: %s", err)
+	}
+	if _, ok := s.Annotations[SourceDeletedAnnotation]; ok || string(s.Data["foo"]) != "baz" {
+		t.Fatalf("deleted should have been updated: %s %v", s.Data["foo"], s.Annotations)
+	}
+}
+
+func TestSourceDeletedMissing(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/gone", map[string]interface{}{"foo": "bar"})
+	vaultClient.Delete("secrets/data/gone")
+
+	r := NewReflector(vaultClient, k8sClient, DefaultNamespace, "test")
+	err := r.Reflect(context.Background(), []Mapping{{
+		VaultPath:       "secrets/data/gone",
+		SecretName:      "gone",
+		VaultEngineType: vault.EngineTypeKeyValueV2,
+	}})
+	if err == nil {
+		t.Fatal("a deleted vault secret without a k8s secret should fail")
+	}
+}
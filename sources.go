@@ -0,0 +1,53 @@
+package pentagon
+
+import (
+	"fmt"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// SourceAnnotation records the name of the source a k8s secret was read
+// from, for mappings that don't read from the default vault.
+const SourceAnnotation = "pentagon.vimeo.com/vault-source"
+
+// WithSources adds vault clients that mappings can read from by setting
+// their Source to the client's name.  Mappings without a Source read from
+// the reflector's vault client.
+func WithSources(sources map[string]vault.Logical) Option {
+	return func(r *Reflector) {
+		r.sources = sources
+	}
+}
+
+// sourceClient returns the vault client that mapping reads from.
+func (r *Reflector) sourceClient(mapping Mapping) (vault.Logical, error) {
+	if mapping.Source == "" {
+		return r.vaultClient, nil
+	}
+	client, ok := r.sources[mapping.Source]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q of %s", mapping.Source, mapping.SecretName)
+	}
+	return client, nil
+}
+
+// newSourceReads returns a read cache for each of the reflector's sources.
+func (r *Reflector) newSourceReads() map[string]*readCache {
+	reads := make(map[string]*readCache, len(r.sources))
+	for name, client := range r.sources {
+		reads[name] = newReadCache(client)
+	}
+	return reads
+}
+
+// readsFor returns the read cache of the source of mapping.
+func (p *pass) readsFor(mapping Mapping) (*readCache, error) {
+	if mapping.Source == "" {
+		return p.reads, nil
+	}
+	reads, ok := p.sourceReads[mapping.Source]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q of %s", mapping.Source, mapping.SecretName)
+	}
+	return reads, nil
+}
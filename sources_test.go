@@ -0,0 +1,70 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestSources(t *testing.T) {
+	allEngineTest(t, func(t testing.TB, engineType vault.EngineType) {
+		k8sClient := k8sfake.NewSimpleClientset()
+		primary := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		other := vault.NewMock(map[string]vault.EngineType{
+			"secrets": engineType,
+		})
+		primary.Write("secrets/data/foo", map[string]interface{}{"foo": "primary"})
+		other.Write("secrets/data/foo", map[string]interface{}{"foo": "other"})
+
+		r := NewReflector(
+			primary,
+			k8sClient,
+			DefaultNamespace,
+			"test",
+			WithSources(map[string]vault.Logical{"other": other}),
+		)
+		err := r.Reflect(context.Background(), []Mapping{
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "primary",
+				VaultEngineType: engineType,
+			},
+			{
+				VaultPath:       "secrets/data/foo",
+				SecretName:      "other",
+				VaultEngineType: engineType,
+				Source:          "other",
+			},
+		})
+		if err != nil {
+			t.Fatalf("reflect didn't work: %s", err)
+		}
+
+		secrets := k8sClient.CoreV1().Secrets(DefaultNamespace)
+		for name, want := range map[string]string{"primary": "primary", "other": "other"} {
+			s, err := secrets.Get(name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s should be there: %s", name, err)
+			}
+			if string(s.Data["foo"]) != want {
+				t.Errorf("%s should have been read from %s: %s", name, want, s.Data["foo"])
+			}
+		}
+
+		err = r.Reflect(context.Background(), []Mapping{{
+			VaultPath:       "secrets/data/foo",
+			SecretName:      "missing",
+			VaultEngineType: engineType,
+			Source:          "missing",
+		}})
+		if err == nil {
+			t.Fatal("reflecting from an unknown source should have failed")
+		}
+	})
+}
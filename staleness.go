@@ -0,0 +1,56 @@
+package pentagon
+
+import (
+	"sort"
+	"time"
+)
+
+// markSynced records that the mapping of the secret named name was just
+// reflected successfully, or skipped because it is paused.
+func (r *Reflector) markSynced(name string) {
+	r.syncedMu.Lock()
+	defer r.syncedMu.Unlock()
+	r.lastSynced[name] = time.Now()
+}
+
+// Stale returns the sorted secret names of the mappings with a MaxAge that
+// haven't been reflected successfully within it, and updates the stale
+// metric.  Mappings that were never reflected are aged from the creation of
+// the reflector.  Mappings of other shards or groups are ignored.
+func (r *Reflector) Stale(mappings []Mapping) []string {
+	return r.staleAt(mappings, time.Now())
+}
+
+// staleAt is Stale as of now.
+func (r *Reflector) staleAt(mappings []Mapping, now time.Time) []string {
+	stale := []string{}
+	counts := map[string]float64{}
+
+	r.syncedMu.Lock()
+	for _, m := range r.selectedMappings(mappings) {
+		if m.MaxAge <= 0 {
+			continue
+		}
+		label := r.metricLabel(m.SecretName)
+		if _, ok := counts[label]; !ok {
+			counts[label] = 0
+		}
+
+		last, ok := r.lastSynced[m.SecretName]
+		if !ok {
+			last = r.started
+		}
+		if now.Sub(last) > m.MaxAge {
+			stale = append(stale, m.SecretName)
+			counts[label]++
+		}
+	}
+	r.syncedMu.Unlock()
+
+	for label, count := range counts {
+		staleMappingsGauge.WithLabelValues(label).Set(count)
+	}
+
+	sort.Strings(stale)
+	return stale
+}
@@ -0,0 +1,49 @@
+package pentagon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStale(t *testing.T) {
+	r := newReflector()
+	mappings := []Mapping{
+		{SecretName: "stale-fresh", MaxAge: time.Hour},
+		{SecretName: "stale-old", MaxAge: time.Minute},
+		{SecretName: "stale-never", MaxAge: time.Minute},
+		{SecretName: "stale-unlimited"},
+	}
+
+	r.markSynced("stale-fresh")
+	r.markSynced("stale-old")
+	r.markSynced("stale-unlimited")
+
+	now := time.Now().Add(10 * time.Minute)
+	stale := r.staleAt(mappings, now)
+	expected := []string{"stale-never", "stale-old"}
+	if !reflect.DeepEqual(stale, expected) {
+		t.Errorf("expected stale mappings %v, got %v", expected, stale)
+	}
+
+	for name, value := range map[string]float64{
+		"stale-fresh": 0,
+		"stale-old":   1,
+		"stale-never": 1,
+	} {
+		if v := testutil.ToFloat64(staleMappingsGauge.WithLabelValues(name)); v != value {
+			t.Errorf("expected %s to have a stale metric of %v, got %v", name, value, v)
+		}
+	}
+
+	r.markSynced("stale-old")
+	r.markSynced("stale-never")
+	if stale := r.staleAt(mappings, time.Now()); len(stale) != 0 {
+		t.Errorf("expected no stale mappings after syncing, got %v", stale)
+	}
+	if v := testutil.ToFloat64(staleMappingsGauge.WithLabelValues("stale-old")); v != 0 {
+		t.Errorf("expected the stale metric to be reset, got %v", v)
+	}
+}
@@ -0,0 +1,333 @@
+package pentagon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// StateKey is the key of the state in the data of the ConfigMap written by
+// a ConfigMapStateStore.
+const StateKey = "state.json"
+
+// maxStateErrors is the number of the latest errors of a mapping that its
+// state keeps.
+const maxStateErrors = 10
+
+// maxStateConflicts is the number of times a ConfigMapStateStore tries to
+// save states that someone else is saving at the same time.
+const maxStateConflicts = 5
+
+// MappingState is what the reflector knows about the secret of a mapping.
+// It never holds the secret's data, only a hash of it.
+type MappingState struct {
+	VaultPath string `json:"vaultPath"`
+
+	// Version is the version of the key/value v2 secret reflected last.
+	Version string `json:"version,omitempty"`
+
+	// Hash is the DataHash of the data of the k8s secret.
+	Hash string `json:"hash,omitempty"`
+
+	// LastSynced is when the mapping was last reflected successfully.
+	LastSynced time.Time `json:"lastSynced,omitempty"`
+
+	// Errors are the latest failures of the mapping, oldest first.  They
+	// are kept after the mapping succeeds again.
+	Errors []StateError `json:"errors,omitempty"`
+}
+
+// StateError is a failure of a mapping.
+type StateError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// StateStore persists the states of the mappings of reflectors, keyed by
+// the namespace and name of their secrets as namespace/name, so that they
+// survive restarts.  The reflectors of every namespace, and of every shard,
+// can share a store: Save merges states into the stored ones, replacing the
+// states of the same secrets and keeping the others.
+type StateStore interface {
+	Load(ctx context.Context) (map[string]MappingState, error)
+	Save(ctx context.Context, states map[string]MappingState) error
+}
+
+// stateKey returns the key of the state of the secret named name in
+// namespace.
+func stateKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+// WithStateStore makes the reflector load the states of its mappings from
+// store before its first pass and save them after every pass.  The last
+// successful syncs loaded count towards the MaxAge of mappings, so a
+// restart doesn't hide stale mappings.  Only the states of the reflector's
+// namespace are loaded, and only the states that changed are saved.
+// Failing to load or save the states is logged without failing the pass,
+// and loading is retried on the next pass.
+func WithStateStore(store StateStore) Option {
+	return func(r *Reflector) {
+		r.stateStore = store
+	}
+}
+
+// State returns the states of the mappings the reflector reflected, keyed
+// by secret name.
+func (r *Reflector) State() map[string]MappingState {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	states := make(map[string]MappingState, len(r.states))
+	for name, state := range r.states {
+		state.Errors = append([]StateError(nil), state.Errors...)
+		states[name] = state
+	}
+	return states
+}
+
+// loadState loads the states from the state store unless they were already
+// loaded.
+func (r *Reflector) loadState(ctx context.Context) {
+	if r.stateStore == nil {
+		return
+	}
+	r.stateMu.Lock()
+	loaded := r.stateLoaded
+	r.stateMu.Unlock()
+	if loaded {
+		return
+	}
+
+	states, err := r.stateStore.Load(ctx)
+	if err != nil {
+		log.Printf("error loading the state of mappings: %s", err)
+		return
+	}
+
+	// the states of other namespaces belong to other reflectors.
+	prefix := stateKey(r.k8sNamespace, "")
+	own := map[string]MappingState{}
+	for key, state := range states {
+		if strings.HasPrefix(key, prefix) {
+			own[strings.TrimPrefix(key, prefix)] = state
+		}
+	}
+
+	r.stateMu.Lock()
+	r.stateLoaded = true
+	for name, state := range own {
+		// states recorded since the reflector started are newer.
+		if _, ok := r.states[name]; !ok {
+			r.states[name] = state
+		}
+	}
+	r.stateMu.Unlock()
+
+	r.syncedMu.Lock()
+	for name, state := range own {
+		if _, ok := r.lastSynced[name]; !ok && !state.LastSynced.IsZero() {
+			r.lastSynced[name] = state.LastSynced
+		}
+	}
+	r.syncedMu.Unlock()
+}
+
+// recordState records the result of reflecting mapping in its state.
+// current is the secret of mapping before the pass, if it existed.
+func (r *Reflector) recordState(mapping Mapping, version string, current *v1.Secret, err error) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	state := r.states[mapping.SecretName]
+	state.VaultPath = mapping.VaultPath
+	now := time.Now().UTC()
+	if err != nil {
+		state.Errors = append(state.Errors, StateError{Time: now, Error: err.Error()})
+		if len(state.Errors) > maxStateErrors {
+			state.Errors = state.Errors[len(state.Errors)-maxStateErrors:]
+		}
+	} else {
+		state.LastSynced = now
+		if version != "" {
+			state.Version = version
+		}
+		if state.Hash == "" && current != nil {
+			state.Hash = DataHash(current.Data)
+		}
+	}
+	r.states[mapping.SecretName] = state
+	r.stateDirty[mapping.SecretName] = true
+}
+
+// recordStateHash records the hash of the data just written to the secret
+// named name.
+func (r *Reflector) recordStateHash(name string, hash string) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	state := r.states[name]
+	state.Hash = hash
+	r.states[name] = state
+	r.stateDirty[name] = true
+}
+
+// saveState saves the states that changed since they were last saved in the
+// state store.  The states loaded for secrets that the reflector didn't
+// reflect since, e.g. those of other shards, aren't saved, so that they
+// don't replace newer states.
+func (r *Reflector) saveState(ctx context.Context) {
+	if r.stateStore == nil {
+		return
+	}
+	r.stateMu.Lock()
+	dirty := r.stateDirty
+	r.stateDirty = map[string]bool{}
+	r.stateMu.Unlock()
+	if len(dirty) == 0 {
+		return
+	}
+
+	all := r.State()
+	states := make(map[string]MappingState, len(dirty))
+	for name := range dirty {
+		states[stateKey(r.k8sNamespace, name)] = all[name]
+	}
+	if err := r.stateStore.Save(ctx, states); err != nil {
+		log.Printf("error saving the state of mappings: %s", err)
+		r.stateMu.Lock()
+		for name := range dirty {
+			r.stateDirty[name] = true
+		}
+		r.stateMu.Unlock()
+	}
+}
+
+// ConfigMapStateStore stores the states of mappings as JSON in the StateKey
+// of a ConfigMap.
+type ConfigMapStateStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapStateStore returns a ConfigMapStateStore using the ConfigMap
+// named name in namespace, which is created if needed.
+func NewConfigMapStateStore(
+	client kubernetes.Interface,
+	namespace string,
+	name string,
+) *ConfigMapStateStore {
+	return &ConfigMapStateStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load reads the states from the ConfigMap.  A missing ConfigMap or key
+// holds no states.
+func (s *ConfigMapStateStore) Load(ctx context.Context) (map[string]MappingState, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return map[string]MappingState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting state ConfigMap: %s", err)
+	}
+	return s.decode(cm)
+}
+
+// decode returns the states in cm.  States saved before they were keyed by
+// namespace are in the namespace of the ConfigMap, where the reflector that
+// saved them ran.
+func (s *ConfigMapStateStore) decode(cm *v1.ConfigMap) (map[string]MappingState, error) {
+	saved := map[string]MappingState{}
+	if raw, ok := cm.Data[StateKey]; ok {
+		if err := json.Unmarshal([]byte(raw), &saved); err != nil {
+			return nil, fmt.Errorf("invalid state in ConfigMap %s: %s", s.name, err)
+		}
+	}
+
+	states := make(map[string]MappingState, len(saved))
+	for key, state := range saved {
+		if !strings.Contains(key, "/") {
+			key = stateKey(s.namespace, key)
+			if _, ok := saved[key]; ok {
+				continue
+			}
+		}
+		states[key] = state
+	}
+	return states, nil
+}
+
+// Save merges states into the states in the ConfigMap, trying again when
+// the ConfigMap was changed since it was read.
+func (s *ConfigMapStateStore) Save(ctx context.Context, states map[string]MappingState) error {
+	var err error
+	for i := 0; i < maxStateConflicts; i++ {
+		err = s.merge(states)
+		if !errors.IsConflict(err) && !errors.IsAlreadyExists(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error saving state ConfigMap: %s", err)
+	}
+	return nil
+}
+
+// merge reads the ConfigMap, creating it if needed, and updates it with
+// states.  The update fails with a conflict if the ConfigMap changed since
+// it was read.
+func (s *ConfigMapStateStore) merge(states map[string]MappingState) error {
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		raw, err := json.Marshal(states)
+		if err != nil {
+			return err
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.name,
+				Namespace: s.namespace,
+			},
+			Data: map[string]string{StateKey: string(raw)},
+		}
+		_, err = configMaps.Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	merged, err := s.decode(cm)
+	if err != nil {
+		return err
+	}
+	for key, state := range states {
+		merged[key] = state
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[StateKey] = string(raw)
+	_, err = configMaps.Update(cm)
+	return err
+}
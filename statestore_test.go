@@ -0,0 +1,284 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// memoryStateStore keeps the states it saves.
+type memoryStateStore struct {
+	states map[string]MappingState
+	saves  int
+}
+
+func (m *memoryStateStore) Load(ctx context.Context) (map[string]MappingState, error) {
+	states := make(map[string]MappingState, len(m.states))
+	for key, state := range m.states {
+		states[key] = state
+	}
+	return states, nil
+}
+
+func (m *memoryStateStore) Save(ctx context.Context, states map[string]MappingState) error {
+	if m.states == nil {
+		m.states = map[string]MappingState{}
+	}
+	for key, state := range states {
+		m.states[key] = state
+	}
+	m.saves++
+	return nil
+}
+
+func TestStateStore(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{"key": "value"})
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/foo",
+			SecretName:      "foo",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		},
+		{
+			VaultPath:       "secrets/missing",
+			SecretName:      "missing",
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			MaxAge:          time.Hour,
+		},
+	}
+
+	// the previous instance last synced the missing mapping long ago.
+	store := &memoryStateStore{states: map[string]MappingState{
+		"default/missing": {
+			VaultPath:  "secrets/missing",
+			LastSynced: time.Now().Add(-2 * time.Hour),
+		},
+		"other/foo": {
+			VaultPath: "secrets/other",
+		},
+	}}
+	secrets := NewFakeSecrets()
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(secrets),
+		WithErrorPolicy(ErrorPolicyContinue),
+		WithStateStore(store),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Reflect(context.Background(), mappings); err == nil {
+			t.Fatal("the missing mapping should have failed")
+		}
+	}
+
+	if store.saves != 2 {
+		t.Errorf("expected the state to be saved after every pass, got %d saves", store.saves)
+	}
+	secret, _ := secrets.Get("foo", metav1.GetOptions{})
+	foo := store.states["default/foo"]
+	if foo.Hash != DataHash(secret.Data) || foo.LastSynced.IsZero() || len(foo.Errors) != 0 {
+		t.Errorf("unexpected state of foo: %+v", foo)
+	}
+	missing := store.states["default/missing"]
+	if len(missing.Errors) != 2 || missing.LastSynced.After(time.Now().Add(-time.Hour)) {
+		t.Errorf("unexpected state of missing: %+v", missing)
+	}
+
+	// the states of other namespaces are neither loaded nor replaced.
+	if _, ok := r.State()["foo"]; !ok || r.State()["foo"].VaultPath != "secrets/foo" {
+		t.Errorf("unexpected state of foo: %+v", r.State()["foo"])
+	}
+	if other := store.states["other/foo"]; other.VaultPath != "secrets/other" || !other.LastSynced.IsZero() {
+		t.Errorf("the state of other/foo was replaced: %+v", other)
+	}
+
+	// the loaded last sync still counts towards maxAge.
+	if stale := r.Stale(mappings); len(stale) != 1 || stale[0] != "missing" {
+		t.Errorf("expected missing to be stale, got %v", stale)
+	}
+}
+
+func TestStateErrorHistory(t *testing.T) {
+	r := newReflector()
+	mapping := Mapping{VaultPath: "secrets/foo", SecretName: "foo"}
+	for i := 0; i < maxStateErrors+2; i++ {
+		r.recordState(mapping, "", nil, fmt.Errorf("failure %d", i))
+	}
+	errs := r.State()["foo"].Errors
+	if len(errs) != maxStateErrors || errs[0].Error != "failure 2" {
+		t.Errorf("expected the %d latest errors, got %v", maxStateErrors, errs)
+	}
+}
+
+func TestStateStoreShards(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	mappings := []Mapping{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("secret-%d", i)
+		vaultClient.Write("secrets/"+name, map[string]interface{}{"key": "value"})
+		mappings = append(mappings, Mapping{
+			VaultPath:       "secrets/" + name,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+		})
+	}
+
+	// the second shard loads the states of the first shard before the
+	// first shard saves newer ones, which it must not replace.
+	store := &memoryStateStore{}
+	reflectors := []*Reflector{}
+	for shard := 0; shard < 2; shard++ {
+		r, err := New(
+			context.Background(),
+			WithVault(vaultClient),
+			WithSecretClient(NewFakeSecrets()),
+			WithShard(shard, 2),
+			WithStateStore(store),
+		)
+		if err != nil {
+			t.Fatalf("unable to create reflector: %s", err)
+		}
+		reflectors = append(reflectors, r)
+	}
+	for i := 0; i < 2; i++ {
+		for _, r := range reflectors {
+			if err := r.Reflect(context.Background(), mappings); err != nil {
+				t.Fatalf("reflect didn't work: %s", err)
+			}
+		}
+	}
+
+	if len(store.states) != len(mappings) {
+		t.Errorf("expected the states of every mapping, got %v", store.states)
+	}
+	for shard, r := range reflectors {
+		for _, m := range mappings {
+			if ShardOf(m.SecretName, 2) != shard {
+				continue
+			}
+			saved := store.states["default/"+m.SecretName]
+			if !saved.LastSynced.Equal(r.State()[m.SecretName].LastSynced) {
+				t.Errorf("the state of %s was replaced: %+v", m.SecretName, saved)
+			}
+		}
+	}
+}
+
+func TestConfigMapStateStoreFanOut(t *testing.T) {
+	objects := []runtime.Object{}
+	for _, name := range []string{"pentagon", "team-a", "team-b"} {
+		objects = append(objects, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	k8sClient := k8sfake.NewSimpleClientset(objects...)
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV2,
+	})
+	vaultClient.Write("secrets/data/registry", map[string]interface{}{"foo": "bar"})
+	store := NewConfigMapStateStore(k8sClient, "pentagon", "state")
+
+	// every namespace has a reflector with a secret of the same name.
+	fanOut := NewFanOut(k8sClient, "pentagon", func(namespace string, opts ...Option) *Reflector {
+		return NewReflector(vaultClient, k8sClient, namespace, "test", WithStateStore(store))
+	})
+	mappings := []Mapping{
+		{
+			VaultPath:       "secrets/data/registry",
+			SecretName:      "registry",
+			VaultEngineType: vault.EngineTypeKeyValueV2,
+			Namespaces:      []string{"team-a", "team-b"},
+		},
+	}
+	if err := fanOut.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	states, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("unable to load states: %s", err)
+	}
+	for _, key := range []string{"team-a/registry", "team-b/registry"} {
+		if state, ok := states[key]; !ok || state.LastSynced.IsZero() {
+			t.Errorf("expected the state of %s, got %v", key, states)
+		}
+	}
+	if len(states) != 2 {
+		t.Errorf("expected 2 states, got %v", states)
+	}
+}
+
+func TestConfigMapStateStore(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+	store := NewConfigMapStateStore(k8sClient, DefaultNamespace, "state")
+
+	states, err := store.Load(context.Background())
+	if err != nil || len(states) != 0 {
+		t.Fatalf("expected no states, got %v and %v", states, err)
+	}
+
+	synced := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	saved := map[string]MappingState{
+		"default/foo": {VaultPath: "secrets/foo", Version: "3", LastSynced: synced},
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Save(context.Background(), saved); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	states, err = store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if foo := states["default/foo"]; len(states) != 1 || foo.Version != "3" || !foo.LastSynced.Equal(synced) {
+		t.Errorf("unexpected states: %v", states)
+	}
+
+	// saving merges states, even when the ConfigMap changes in between,
+	// and states saved before they were keyed by namespace are in the
+	// namespace of the ConfigMap.
+	cm, err := k8sClient.CoreV1().ConfigMaps(DefaultNamespace).Get("state", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get state ConfigMap: %s", err)
+	}
+	cm.Data[StateKey] = `{"legacy": {"vaultPath": "secrets/legacy"}}`
+	if _, err := k8sClient.CoreV1().ConfigMaps(DefaultNamespace).Update(cm); err != nil {
+		t.Fatalf("unable to update state ConfigMap: %s", err)
+	}
+	conflicts := 2
+	k8sClient.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, errors.NewConflict(v1.Resource("configmaps"), "state", fmt.Errorf("changed"))
+	})
+	if err := store.Save(context.Background(), map[string]MappingState{"team-a/bar": {VaultPath: "secrets/bar"}}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	states, err = store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(states) != 2 || states["default/legacy"].VaultPath != "secrets/legacy" ||
+		states["team-a/bar"].VaultPath != "secrets/bar" {
+		t.Errorf("unexpected states: %v", states)
+	}
+}
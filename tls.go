@@ -0,0 +1,120 @@
+package pentagon
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TLSConfig hardens the TLS connections made by the vault client and
+// accepted by the metrics listener and the webhook.
+type TLSConfig struct {
+	// MinVersion is the minimum TLS version: "1.0", "1.1", "1.2" or "1.3".
+	// Default "1.2".
+	MinVersion string `yaml:"minVersion"`
+
+	// CipherSuites lists the names of the cipher suites allowed with TLS
+	// 1.2 and below, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".  Empty
+	// allows Go's default suites.  TLS 1.3 suites can't be configured.
+	CipherSuites []string `yaml:"cipherSuites"`
+
+	// CertFile and KeyFile make the metrics listener serve HTTPS.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// tlsVersions maps the supported values of MinVersion to their versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipherSuites maps the names of the TLS 1.2 and below cipher suites
+// implemented by crypto/tls to their IDs.
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":                      tls.TLS_RSA_WITH_RC4_128_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":                 tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":                  tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":                  tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":               tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":               tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":               tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":              tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":                tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":          tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":        tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// SetDefaults sets the minimum TLS version if it isn't set.
+func (t *TLSConfig) SetDefaults() {
+	if t.MinVersion == "" {
+		t.MinVersion = "1.2"
+	}
+}
+
+// Validate makes sure that the version and cipher suites are known and
+// that HTTPS has both a certificate and a key.
+func (t TLSConfig) Validate() error {
+	if err := t.Apply(&tls.Config{}); err != nil {
+		return err
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("tls needs both a certFile and a keyFile")
+	}
+	return nil
+}
+
+// Apply sets the minimum version and the cipher suites of c.
+func (t TLSConfig) Apply(c *tls.Config) error {
+	if t.MinVersion != "" {
+		version, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			return fmt.Errorf("unknown minimum TLS version: %q", t.MinVersion)
+		}
+		c.MinVersion = version
+	}
+
+	if len(t.CipherSuites) > 0 {
+		suites := make([]uint16, 0, len(t.CipherSuites))
+		for _, name := range t.CipherSuites {
+			id, ok := cipherSuites[name]
+			if !ok {
+				return fmt.Errorf(
+					"unknown cipher suite %q, known suites are %s",
+					name,
+					strings.Join(cipherSuiteNames(), ", "),
+				)
+			}
+			suites = append(suites, id)
+		}
+		c.CipherSuites = suites
+	}
+
+	return nil
+}
+
+// cipherSuiteNames returns the names of the known cipher suites in order.
+func cipherSuiteNames() []string {
+	names := make([]string, 0, len(cipherSuites))
+	for name := range cipherSuites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
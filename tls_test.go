@@ -0,0 +1,33 @@
+package pentagon
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTLSConfigApply(t *testing.T) {
+	c := &tls.Config{}
+	err := TLSConfig{
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	}.Apply(c)
+	if err != nil {
+		t.Fatalf("apply failed: %s", err)
+	}
+	if c.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("unexpected minimum version: %x", c.MinVersion)
+	}
+	if len(c.CipherSuites) != 1 || c.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Fatalf("unexpected cipher suites: %v", c.CipherSuites)
+	}
+
+	for testName, config := range map[string]TLSConfig{
+		"unknown version": {MinVersion: "2.0"},
+		"unknown suite":   {CipherSuites: []string{"TLS_NULL"}},
+		"missing key":     {CertFile: "cert.pem"},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: should be invalid", testName)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WithTransactions makes the mappings of each of groups rotate together,
+// e.g. credential sets that must match.  The vault secrets of a group's
+// mappings are all read before any of its k8s secrets is written, and if
+// any of its mappings fails or isn't reflected, the secrets of the others
+// that were written in the pass are rolled back to the data they had
+// before it, or deleted if they were created.
+func WithTransactions(groups []string) Option {
+	return func(r *Reflector) {
+		r.transactions = groups
+	}
+}
+
+// transaction tracks the mappings of a transactional group within a pass.
+type transaction struct {
+	group   string
+	members []Mapping
+
+	mu sync.Mutex
+
+	// err is the first failure of a member.  Once it's set, the members
+	// that haven't been written yet aren't.
+	err error
+
+	// done holds the secret names of the members reflected successfully.
+	done map[string]struct{}
+
+	// applied are the writes of members, in order.
+	applied []appliedWrite
+}
+
+// appliedWrite is a secret written for a mapping, with the secret it
+// replaced or nil if it was created.
+type appliedWrite struct {
+	mapping  Mapping
+	previous *v1.Secret
+}
+
+// newTransactions returns the transactions of the reflector's groups that
+// have mappings among mappings, keyed by group.
+func (r *Reflector) newTransactions(mappings []Mapping) map[string]*transaction {
+	transactions := map[string]*transaction{}
+	for _, group := range r.transactions {
+		for _, m := range mappings {
+			if !m.InGroups([]string{group}, nil) {
+				continue
+			}
+			t, ok := transactions[group]
+			if !ok {
+				t = &transaction{group: group, done: map[string]struct{}{}}
+				transactions[group] = t
+			}
+			t.members = append(t.members, m)
+		}
+	}
+	return transactions
+}
+
+// transactionsOf returns the transactions mapping is a member of, in the
+// order of their groups.
+func (p *pass) transactionsOf(mapping Mapping) []*transaction {
+	groups := make([]string, 0, len(p.transactions))
+	for group := range p.transactions {
+		if mapping.InGroups([]string{group}, nil) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+
+	transactions := make([]*transaction, 0, len(groups))
+	for _, group := range groups {
+		transactions = append(transactions, p.transactions[group])
+	}
+	return transactions
+}
+
+// transactionErr returns an error if a transaction of mapping already
+// failed, in which case it must not be written.
+func (p *pass) transactionErr(mapping Mapping) error {
+	for _, t := range p.transactionsOf(mapping) {
+		t.mu.Lock()
+		err := t.err
+		t.mu.Unlock()
+		if err != nil {
+			return classify(ErrTransactionFailed, fmt.Errorf(
+				"not writing secret %s, transaction %s failed: %s",
+				mapping.SecretName,
+				t.group,
+				err,
+			))
+		}
+	}
+	return nil
+}
+
+// recordApplied records that the secret of mapping was written, replacing
+// previous, or creating it if previous is nil.
+func (p *pass) recordApplied(mapping Mapping, previous *v1.Secret) {
+	for _, t := range p.transactionsOf(mapping) {
+		t.mu.Lock()
+		t.applied = append(t.applied, appliedWrite{mapping: mapping, previous: previous})
+		t.mu.Unlock()
+	}
+}
+
+// finishTransactions records the outcome of reflecting mapping.
+func (p *pass) finishTransactions(mapping Mapping, err error) {
+	for _, t := range p.transactionsOf(mapping) {
+		t.mu.Lock()
+		if err == nil {
+			t.done[mapping.SecretName] = struct{}{}
+		} else if t.err == nil {
+			t.err = fmt.Errorf("%s: %s", mapping.SecretName, err)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// prepareTransactions reads the vault secrets of the members of every
+// transaction of the pass, so that a transaction whose secrets can't all be
+// read fails before any of them is written.  The reads are cached for the
+// rest of the pass.
+func (r *Reflector) prepareTransactions(ctx context.Context, p *pass) {
+	for _, t := range p.transactions {
+		for _, m := range t.members {
+			if r.isPaused(m) {
+				continue
+			}
+			err := r.prepareRead(ctx, p, m)
+			if err != nil {
+				t.mu.Lock()
+				if t.err == nil {
+					t.err = fmt.Errorf("%s: %s", m.SecretName, err)
+				}
+				t.mu.Unlock()
+				break
+			}
+		}
+	}
+}
+
+// prepareRead reads the vault secret of mapping into the pass's cache.
+func (r *Reflector) prepareRead(ctx context.Context, p *pass, mapping Mapping) error {
+	if r.vaultTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.vaultTimeout)
+		defer cancel()
+	}
+
+	reads, err := p.readsFor(mapping)
+	if err != nil {
+		return err
+	}
+	secret, err := reads.Read(ctx, mapping.VaultPath)
+	if err != nil {
+		return readError(mapping.VaultPath, err)
+	}
+	if secret == nil && !mapping.Optional {
+		return classify(ErrPathNotFound, fmt.Errorf("secret %s not found", mapping.VaultPath))
+	}
+	return nil
+}
+
+// rollbackTransactions rolls back the secrets written by the members of
+// every transaction in which a member wasn't reflected, and returns the
+// errors of the mappings rolled back.  Secrets are rolled back even if the
+// pass was cancelled.
+func (r *Reflector) rollbackTransactions(p *pass) []error {
+	groups := make([]string, 0, len(p.transactions))
+	for group := range p.transactions {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	failures := []error{}
+	rolledBack := map[string]struct{}{}
+	for _, group := range groups {
+		t := p.transactions[group]
+		if len(t.done) == len(t.members) || len(t.applied) == 0 {
+			continue
+		}
+
+		reason := "a mapping wasn't reflected"
+		if t.err != nil {
+			reason = t.err.Error()
+		}
+		for i := len(t.applied) - 1; i >= 0; i-- {
+			w := t.applied[i]
+			if _, ok := rolledBack[w.mapping.SecretName]; ok {
+				continue
+			}
+			rolledBack[w.mapping.SecretName] = struct{}{}
+
+			err := r.restoreSecret(w.mapping, w.previous)
+			if err != nil {
+				failures = append(failures, classify(ErrTransactionFailed, fmt.Errorf(
+					"error rolling back secret %s of transaction %s: %w",
+					w.mapping.SecretName,
+					group,
+					err,
+				)))
+				continue
+			}
+			log.Printf(
+				"rolled back secret %s of transaction %s: %s",
+				w.mapping.SecretName,
+				group,
+				reason,
+			)
+			failures = append(failures, classify(ErrTransactionFailed, fmt.Errorf(
+				"secret %s rolled back with transaction %s",
+				w.mapping.SecretName,
+				group,
+			)))
+		}
+	}
+	return failures
+}
+
+// restoreSecret writes the data, labels and annotations of previous back
+// into the secret of mapping, or deletes it if previous is nil.
+func (r *Reflector) restoreSecret(mapping Mapping, previous *v1.Secret) error {
+	release, err := r.acquireWrite(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	secrets := r.secrets()
+	current, err := secrets.Get(mapping.SecretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if previous == nil {
+		err = secrets.Delete(mapping.SecretName, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		r.auditDelete(current)
+		return nil
+	}
+
+	restored := current.DeepCopy()
+	restored.Data = previous.Data
+	restored.Labels = previous.Labels
+	restored.Annotations = previous.Annotations
+	restored.OwnerReferences = previous.OwnerReferences
+	if _, err := secrets.Update(restored); err != nil {
+		return err
+	}
+	r.auditChange(mapping, current, restored)
+	return nil
+}
@@ -0,0 +1,144 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// failingSecrets fails to create the secret named failing.
+type failingSecrets struct {
+	*FakeSecrets
+	failing string
+}
+
+func (f failingSecrets) Create(secret *v1.Secret) (*v1.Secret, error) {
+	if secret.Name == f.failing {
+		return nil, errors.NewForbidden(v1.Resource("secrets"), secret.Name, fmt.Errorf("denied"))
+	}
+	return f.FakeSecrets.Create(secret)
+}
+
+func TestTransactions(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/db-user", map[string]interface{}{"user": "new"})
+	vaultClient.Write("secrets/db-password", map[string]interface{}{"password": "new"})
+	vaultClient.Write("secrets/other", map[string]interface{}{"foo": "bar"})
+
+	mapping := func(name string, groups ...string) Mapping {
+		return Mapping{
+			VaultPath:       "secrets/" + name,
+			SecretName:      name,
+			VaultEngineType: vault.EngineTypeKeyValueV1,
+			Groups:          groups,
+		}
+	}
+	mappings := []Mapping{
+		mapping("db-user", "db"),
+		mapping("db-password", "db"),
+		mapping("other"),
+	}
+
+	existing := func() *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "db-user",
+				Labels:      map[string]string{LabelKey: DefaultLabelValue},
+				Annotations: map[string]string{PathAnnotation: "secrets/db-user"},
+			},
+			Data: map[string][]byte{"user": []byte("old")},
+		}
+	}
+
+	reflect := func(secrets SecretClient) error {
+		r, err := New(
+			context.Background(),
+			WithVault(vaultClient),
+			WithSecretClient(secrets),
+			WithErrorPolicy(ErrorPolicyContinue),
+			WithTransactions([]string{"db"}),
+		)
+		if err != nil {
+			t.Fatalf("unable to create reflector: %s", err)
+		}
+		return r.Reflect(context.Background(), mappings)
+	}
+
+	// a failed write rolls back the secrets already written, but not those
+	// of other mappings.
+	secrets := NewFakeSecrets(existing())
+	if err := reflect(failingSecrets{secrets, "db-password"}); err == nil {
+		t.Fatal("the pass should have failed")
+	}
+	s, err := secrets.Get("db-user", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("db-user should be there: %s", err)
+	}
+	if string(s.Data["user"]) != "old" {
+		t.Errorf("db-user should have been rolled back, got %s", s.Data["user"])
+	}
+	if _, err := secrets.Get("other", metav1.GetOptions{}); err != nil {
+		t.Errorf("other should have been written: %s", err)
+	}
+
+	// created secrets are deleted.
+	secrets = NewFakeSecrets()
+	if err := reflect(failingSecrets{secrets, "db-password"}); err == nil {
+		t.Fatal("the pass should have failed")
+	}
+	if _, err := secrets.Get("db-user", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("db-user should have been deleted: %v", err)
+	}
+
+	// secrets that can't be read fail the transaction before anything is
+	// written.
+	vaultClient.Delete("secrets/db-password")
+	secrets = NewFakeSecrets(existing())
+	if err := reflect(secrets); err == nil {
+		t.Fatal("the pass should have failed")
+	}
+	s, _ = secrets.Get("db-user", metav1.GetOptions{})
+	if string(s.Data["user"]) != "old" {
+		t.Errorf("db-user shouldn't have been written, got %s", s.Data["user"])
+	}
+
+	// complete transactions are kept.
+	vaultClient.Write("secrets/db-password", map[string]interface{}{"password": "new"})
+	secrets = NewFakeSecrets(existing())
+	if err := reflect(secrets); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+	s, _ = secrets.Get("db-user", metav1.GetOptions{})
+	if string(s.Data["user"]) != "new" {
+		t.Errorf("db-user should have been written, got %s", s.Data["user"])
+	}
+}
+
+func TestValidateTransactions(t *testing.T) {
+	c := &Config{
+		Mappings:     []Mapping{{VaultPath: "foo", SecretName: "foo", Groups: []string{"db"}}},
+		Transactions: []string{"db"},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration should have been valid: %s", err)
+	}
+
+	c.Transactions = []string{"cache"}
+	if err := c.Validate(); err == nil {
+		t.Error("transactions without mappings should have been invalid")
+	}
+
+	c.Transactions = []string{"db"}
+	c.Shards = 2
+	if err := c.Validate(); err == nil {
+		t.Error("transactions with shards should have been invalid")
+	}
+}
@@ -0,0 +1,97 @@
+package pentagon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// maxTransformOutput bounds the size of the output of a transform.
+const maxTransformOutput = 4 << 20
+
+// transformData returns the data of mapping as transformed by its
+// TransformExec, or data itself if it has none.  The command gets the data
+// on its standard input as a JSON object of base64 encoded values, like the
+// data of a k8s secret, and must write the final data in the same format to
+// its standard output.  It only gets the PENTAGON_SECRET_NAME and
+// PENTAGON_VAULT_PATH environment variables, and is killed when ctx is
+// done.
+func transformData(
+	ctx context.Context,
+	mapping Mapping,
+	data map[string][]byte,
+) (map[string][]byte, error) {
+	if len(mapping.TransformExec) == 0 {
+		return data, nil
+	}
+
+	input, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding data to transform: %s", err)
+	}
+
+	cmd := exec.CommandContext(ctx, mapping.TransformExec[0], mapping.TransformExec[1:]...)
+	cmd.Env = []string{
+		"PENTAGON_SECRET_NAME=" + mapping.SecretName,
+		"PENTAGON_VAULT_PATH=" + mapping.VaultPath,
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := &limitedBuffer{limit: maxTransformOutput}
+	stderr := &limitedBuffer{limit: 4096}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"transform %s of secret %s failed: %s: %s",
+			mapping.TransformExec[0],
+			mapping.SecretName,
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf(
+			"transform %s of secret %s wrote more than %d bytes",
+			mapping.TransformExec[0],
+			mapping.SecretName,
+			maxTransformOutput,
+		)
+	}
+
+	transformed := map[string][]byte{}
+	err = json.Unmarshal(stdout.Bytes(), &transformed)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid output of transform %s of secret %s: %s",
+			mapping.TransformExec[0],
+			mapping.SecretName,
+			err,
+		)
+	}
+	return transformed, nil
+}
+
+// limitedBuffer is a bytes.Buffer that drops what is written past limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write appends p up to the limit.  It never fails so that the command
+// isn't killed by a broken pipe.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
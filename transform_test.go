@@ -0,0 +1,70 @@
+package pentagon
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+)
+
+func TestTransformData(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh isn't available")
+	}
+
+	data := map[string][]byte{"foo": []byte("bar")}
+
+	for testName, tbl := range map[string]struct {
+		script   string
+		expected map[string][]byte
+		fail     bool
+	}{
+		"identity": {
+			script:   "cat",
+			expected: data,
+		},
+		"replace": {
+			script:   `echo '{"out": "aGk="}'`,
+			expected: map[string][]byte{"out": []byte("hi")},
+		},
+		"environment": {
+			script:   `test "$PENTAGON_SECRET_NAME" = secret && test "$PENTAGON_VAULT_PATH" = secrets/foo && cat`,
+			expected: data,
+		},
+		"failure": {
+			script: "echo broken >&2; exit 3",
+			fail:   true,
+		},
+		"invalid output": {
+			script: "echo nope",
+			fail:   true,
+		},
+	} {
+		tbl := tbl
+		t.Run(testName, func(t *testing.T) {
+			mapping := Mapping{
+				VaultPath:     "secrets/foo",
+				SecretName:    "secret",
+				TransformExec: []string{sh, "-c", tbl.script},
+			}
+			transformed, err := transformData(context.Background(), mapping, data)
+			if tbl.fail {
+				if err == nil {
+					t.Fatal("transform should have failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transform failed: %s", err)
+			}
+			if len(transformed) != len(tbl.expected) {
+				t.Fatalf("unexpected data: %v", transformed)
+			}
+			for k, v := range tbl.expected {
+				if string(transformed[k]) != string(v) {
+					t.Fatalf("unexpected value of %s: %q", k, transformed[k])
+				}
+			}
+		})
+	}
+}
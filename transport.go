@@ -0,0 +1,64 @@
+package pentagon
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dialTimeout is the time the vault client waits for connections, as in its
+// default transport.
+const dialTimeout = 30 * time.Second
+
+// TransportConfig tunes the connection pool of the vault client, e.g. to
+// keep connections through an egress proxy open across passes.  Zero values
+// keep the client's defaults.
+type TransportConfig struct {
+	// MaxIdleConns is the number of idle connections kept open.  Default
+	// 100.
+	MaxIdleConns int `yaml:"maxIdleConns"`
+
+	// MaxIdleConnsPerHost is the number of idle connections kept open to
+	// each vault server.  Default one more than the number of CPUs.
+	MaxIdleConnsPerHost int `yaml:"maxIdleConnsPerHost"`
+
+	// IdleConnTimeout closes connections that were idle this long.
+	// Default 90s.
+	IdleConnTimeout time.Duration `yaml:"idleConnTimeout"`
+
+	// KeepAlive is the interval of the TCP keep-alive probes of
+	// connections.  Default 30s, and negative disables them.
+	KeepAlive time.Duration `yaml:"keepAlive"`
+}
+
+// Validate checks that the limits aren't negative.
+func (c TransportConfig) Validate() error {
+	if c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("maxIdleConns and maxIdleConnsPerHost must not be negative")
+	}
+	if c.IdleConnTimeout < 0 {
+		return fmt.Errorf("idleConnTimeout must not be negative: %s", c.IdleConnTimeout)
+	}
+	return nil
+}
+
+// Apply sets the configured settings of transport.
+func (c TransportConfig) Apply(transport *http.Transport) {
+	if c.MaxIdleConns > 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.KeepAlive != 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: c.KeepAlive,
+			DualStack: true,
+		}).DialContext
+	}
+}
@@ -0,0 +1,42 @@
+package pentagon
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTransportConfigApply(t *testing.T) {
+	transport := &http.Transport{MaxIdleConns: 100, MaxIdleConnsPerHost: 2, IdleConnTimeout: 90 * time.Second}
+	TransportConfig{}.Apply(transport)
+	if transport.MaxIdleConns != 100 || transport.MaxIdleConnsPerHost != 2 ||
+		transport.IdleConnTimeout != 90*time.Second || transport.DialContext != nil {
+		t.Fatalf("the zero value should keep the defaults: %+v", transport)
+	}
+
+	TransportConfig{
+		MaxIdleConns:        500,
+		MaxIdleConnsPerHost: 50,
+		IdleConnTimeout:     30 * time.Second,
+		KeepAlive:           10 * time.Second,
+	}.Apply(transport)
+	if transport.MaxIdleConns != 500 || transport.MaxIdleConnsPerHost != 50 ||
+		transport.IdleConnTimeout != 30*time.Second || transport.DialContext == nil {
+		t.Fatalf("unexpected transport: %+v", transport)
+	}
+}
+
+func TestTransportConfigValidate(t *testing.T) {
+	for _, c := range []TransportConfig{
+		{MaxIdleConns: -1},
+		{MaxIdleConnsPerHost: -1},
+		{IdleConnTimeout: -time.Second},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v should be invalid", c)
+		}
+	}
+	if err := (TransportConfig{KeepAlive: -1}).Validate(); err != nil {
+		t.Errorf("negative keepAlive disables keep-alives: %s", err)
+	}
+}
@@ -0,0 +1,391 @@
+package pentagon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// TrustBundleAnnotation records the name of the trust bundle a ConfigMap
+// was written for.
+const TrustBundleAnnotation = "pentagon.vimeo.com/trust-bundle"
+
+// DefaultTrustBundleKey is the default key of the certificates of a trust
+// bundle, both in vault and in its ConfigMaps.
+const DefaultTrustBundleKey = "ca.crt"
+
+// ClusterTrustBundleResource is the ClusterTrustBundle resource of
+// kubernetes 1.27+.
+var ClusterTrustBundleResource = schema.GroupVersionResource{
+	Group:    "certificates.k8s.io",
+	Version:  "v1alpha1",
+	Resource: "clustertrustbundles",
+}
+
+// TrustBundle distributes the CA certificates of a vault secret to a
+// ConfigMap in every selected namespace.
+type TrustBundle struct {
+	// Name identifies the trust bundle and is the name of its ConfigMaps.
+	Name string `yaml:"name"`
+
+	// VaultPath is the path to the vault secret holding the certificates.
+	VaultPath string `yaml:"vaultPath"`
+
+	// VaultEngineType is the type of secrets engine mounted at VaultPath.
+	// Default is the DefaultEngineType of the VaultConfig.
+	VaultEngineType vault.EngineType `yaml:"vaultEngineType"`
+
+	// Keys are the keys of the vault secret holding PEM encoded
+	// certificates, which are concatenated in order.  Default
+	// DefaultTrustBundleKey.
+	Keys []string `yaml:"keys"`
+
+	// ConfigMapKey is the key of the certificates in the ConfigMaps.
+	// Default DefaultTrustBundleKey.
+	ConfigMapKey string `yaml:"configMapKey"`
+
+	// Namespaces, AllNamespaces and ExcludeNamespaces select the
+	// namespaces of the ConfigMaps like they do for mappings.  Default is
+	// the configuration's namespace.
+	Namespaces        []string `yaml:"namespaces"`
+	AllNamespaces     bool     `yaml:"allNamespaces"`
+	ExcludeNamespaces []string `yaml:"excludeNamespaces"`
+
+	// ClusterTrustBundle also writes the certificates to the
+	// ClusterTrustBundle of that name.
+	ClusterTrustBundle string `yaml:"clusterTrustBundle"`
+}
+
+// Validate checks that the trust bundle is valid.
+func (b TrustBundle) Validate() error {
+	if errs := validation.IsDNS1123Subdomain(b.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q: %s", b.Name, strings.Join(errs, ", "))
+	}
+	if b.VaultPath == "" {
+		return fmt.Errorf("%s has no vaultPath", b.Name)
+	}
+	if len(b.ExcludeNamespaces) > 0 && !b.AllNamespaces {
+		return fmt.Errorf("excludeNamespaces of %s requires allNamespaces", b.Name)
+	}
+	if b.ClusterTrustBundle != "" {
+		if errs := validation.IsDNS1123Subdomain(b.ClusterTrustBundle); len(errs) > 0 {
+			return fmt.Errorf(
+				"invalid clusterTrustBundle %q: %s",
+				b.ClusterTrustBundle,
+				strings.Join(errs, ", "),
+			)
+		}
+	}
+	return nil
+}
+
+// targetNamespaces returns the sorted namespaces of the ConfigMaps of the
+// trust bundle, given the default namespace and all of the cluster's
+// namespaces.
+func (b TrustBundle) targetNamespaces(defaultNamespace string, all []string) []string {
+	m := Mapping{
+		Namespaces:        b.Namespaces,
+		AllNamespaces:     b.AllNamespaces,
+		ExcludeNamespaces: b.ExcludeNamespaces,
+	}
+	return m.targetNamespaces(defaultNamespace, all)
+}
+
+// TrustBundleReflector writes the certificates of trust bundles from vault
+// to ConfigMaps, and optionally ClusterTrustBundles.
+type TrustBundleReflector struct {
+	vaultClient   vault.Logical
+	k8sClient     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	k8sNamespace  string
+	labelValue    string
+	namespaced    bool
+}
+
+// NewTrustBundleReflector returns a TrustBundleReflector writing the
+// ConfigMaps of trust bundles without namespaces to k8sNamespace, labeled
+// with labelValue.  dynamicClient writes ClusterTrustBundles and may be nil
+// if no trust bundle has one.  If namespaced, only the ConfigMaps in
+// k8sNamespace are listed, and trust bundles must not target other
+// namespaces.
+func NewTrustBundleReflector(
+	vaultClient vault.Logical,
+	k8sClient kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	k8sNamespace string,
+	labelValue string,
+	namespaced bool,
+) *TrustBundleReflector {
+	return &TrustBundleReflector{
+		vaultClient:   vaultClient,
+		k8sClient:     k8sClient,
+		dynamicClient: dynamicClient,
+		k8sNamespace:  k8sNamespace,
+		labelValue:    labelValue,
+		namespaced:    namespaced,
+	}
+}
+
+// Reflect writes the certificates of every trust bundle to its ConfigMaps
+// and deletes the ConfigMaps of trust bundles that no longer target their
+// namespace or were removed.  A failed trust bundle doesn't stop the
+// others, and keeps its ConfigMaps.
+func (r *TrustBundleReflector) Reflect(ctx context.Context, bundles []TrustBundle) error {
+	var all []string
+	for _, b := range bundles {
+		if !b.AllNamespaces {
+			continue
+		}
+		list, err := r.k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing namespaces: %s", err)
+		}
+		for _, namespace := range list.Items {
+			all = append(all, namespace.Name)
+		}
+		break
+	}
+
+	listNamespace := ""
+	if r.namespaced {
+		listNamespace = r.k8sNamespace
+	}
+	existing, err := r.k8sClient.CoreV1().ConfigMaps(listNamespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelKey, r.labelValue),
+	})
+	if err != nil {
+		return fmt.Errorf("error listing trust bundle ConfigMaps: %s", err)
+	}
+
+	// ConfigMaps of failed trust bundles are kept, and so are ConfigMaps
+	// that were written, keyed by namespace and name.
+	keep := map[string]struct{}{}
+	failed := map[string]struct{}{}
+	failures := []string{}
+	for _, b := range bundles {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		namespaces := b.targetNamespaces(r.k8sNamespace, all)
+		for _, namespace := range namespaces {
+			keep[namespace+"/"+b.Name] = struct{}{}
+		}
+
+		err := r.reflectBundle(ctx, b, namespaces)
+		if err != nil {
+			log.Printf("error reflecting trust bundle %s: %s", b.Name, err)
+			failures = append(failures, err.Error())
+			failed[b.Name] = struct{}{}
+		}
+	}
+
+	for i := range existing.Items {
+		cm := &existing.Items[i]
+		name, ok := cm.Annotations[TrustBundleAnnotation]
+		if !ok {
+			continue
+		}
+		if _, ok := failed[name]; ok {
+			continue
+		}
+		if _, ok := keep[cm.Namespace+"/"+cm.Name]; ok {
+			continue
+		}
+
+		log.Printf("deleting ConfigMap %s/%s of trust bundle %s", cm.Namespace, cm.Name, name)
+		err := r.k8sClient.CoreV1().ConfigMaps(cm.Namespace).Delete(cm.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			failures = append(failures, fmt.Sprintf(
+				"error deleting ConfigMap %s/%s: %s",
+				cm.Namespace,
+				cm.Name,
+				err,
+			))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"%d trust bundle errors: %s",
+			len(failures),
+			strings.Join(failures, "; "),
+		)
+	}
+	return nil
+}
+
+// reflectBundle writes the certificates of a trust bundle to its ConfigMap
+// in each of namespaces and to its ClusterTrustBundle.
+func (r *TrustBundleReflector) reflectBundle(
+	ctx context.Context,
+	b TrustBundle,
+	namespaces []string,
+) error {
+	secret, err := vault.ReadWithContext(ctx, r.vaultClient, b.VaultPath)
+	if err != nil {
+		return fmt.Errorf("error reading vault key '%s': %s", b.VaultPath, err)
+	}
+	if secret == nil {
+		return fmt.Errorf("secret %s not found", b.VaultPath)
+	}
+	data, err := secretData(secret, b.VaultEngineType)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := bundleCertificates(b, data)
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		if err := r.writeConfigMap(b, namespace, bundle); err != nil {
+			return err
+		}
+	}
+
+	if b.ClusterTrustBundle != "" {
+		return r.writeClusterTrustBundle(b, bundle)
+	}
+	return nil
+}
+
+// bundleCertificates returns the concatenated certificates of the keys of a
+// trust bundle in data, making sure that each key holds certificates.
+func bundleCertificates(b TrustBundle, data map[string][]byte) (string, error) {
+	var bundle strings.Builder
+	for _, key := range b.Keys {
+		value, ok := data[key]
+		if !ok {
+			return "", fmt.Errorf("vault secret %s has no key %s", b.VaultPath, key)
+		}
+		if _, ok := certificateExpiry(map[string][]byte{key: value}); !ok {
+			return "", fmt.Errorf("key %s of vault secret %s has no PEM certificates", key, b.VaultPath)
+		}
+		bundle.Write(value)
+		if len(value) > 0 && value[len(value)-1] != '\n' {
+			bundle.WriteByte('\n')
+		}
+	}
+	return bundle.String(), nil
+}
+
+// writeConfigMap creates or updates the ConfigMap of a trust bundle in
+// namespace.  ConfigMaps that pentagon didn't write are left alone.
+func (r *TrustBundleReflector) writeConfigMap(b TrustBundle, namespace, bundle string) error {
+	configMaps := r.k8sClient.CoreV1().ConfigMaps(namespace)
+	desired := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      b.Name,
+			Namespace: namespace,
+			Labels:    map[string]string{LabelKey: r.labelValue},
+			Annotations: map[string]string{
+				TrustBundleAnnotation: b.Name,
+				PathAnnotation:        b.VaultPath,
+			},
+		},
+		Data: map[string]string{b.ConfigMapKey: bundle},
+	}
+
+	current, err := configMaps.Get(b.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(desired)
+		if err != nil {
+			return fmt.Errorf("error creating ConfigMap %s/%s: %s", namespace, b.Name, err)
+		}
+		infof("created ConfigMap %s/%s of trust bundle %s", namespace, b.Name, b.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting ConfigMap %s/%s: %s", namespace, b.Name, err)
+	}
+
+	if current.Labels[LabelKey] != r.labelValue ||
+		current.Annotations[TrustBundleAnnotation] != b.Name {
+		return fmt.Errorf("ConfigMap %s/%s exists and isn't managed by pentagon", namespace, b.Name)
+	}
+	if current.Annotations[PathAnnotation] == b.VaultPath &&
+		len(current.Data) == 1 && current.Data[b.ConfigMapKey] == bundle {
+		return nil
+	}
+
+	desired.ResourceVersion = current.ResourceVersion
+	_, err = configMaps.Update(desired)
+	if err != nil {
+		return fmt.Errorf("error updating ConfigMap %s/%s: %s", namespace, b.Name, err)
+	}
+	infof("updated ConfigMap %s/%s of trust bundle %s", namespace, b.Name, b.Name)
+	return nil
+}
+
+// writeClusterTrustBundle creates or updates the ClusterTrustBundle of a
+// trust bundle.  ClusterTrustBundles that pentagon didn't write are left
+// alone.
+func (r *TrustBundleReflector) writeClusterTrustBundle(b TrustBundle, bundle string) error {
+	if r.dynamicClient == nil {
+		return fmt.Errorf("no client for the ClusterTrustBundle of %s", b.Name)
+	}
+	client := r.dynamicClient.Resource(ClusterTrustBundleResource)
+
+	current, err := client.Get(b.ClusterTrustBundle, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		desired := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": ClusterTrustBundleResource.GroupVersion().String(),
+			"kind":       "ClusterTrustBundle",
+			"metadata": map[string]interface{}{
+				"name": b.ClusterTrustBundle,
+				"labels": map[string]interface{}{
+					LabelKey: r.labelValue,
+				},
+				"annotations": map[string]interface{}{
+					TrustBundleAnnotation: b.Name,
+					PathAnnotation:        b.VaultPath,
+				},
+			},
+			"spec": map[string]interface{}{
+				"trustBundle": bundle,
+			},
+		}}
+		_, err = client.Create(desired, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("error creating ClusterTrustBundle %s: %s", b.ClusterTrustBundle, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting ClusterTrustBundle %s: %s", b.ClusterTrustBundle, err)
+	}
+
+	if current.GetLabels()[LabelKey] != r.labelValue {
+		return fmt.Errorf(
+			"ClusterTrustBundle %s exists and isn't managed by pentagon",
+			b.ClusterTrustBundle,
+		)
+	}
+	if have, _, _ := unstructured.NestedString(current.Object, "spec", "trustBundle"); have == bundle {
+		return nil
+	}
+
+	updated := current.DeepCopy()
+	if err := unstructured.SetNestedField(updated.Object, bundle, "spec", "trustBundle"); err != nil {
+		return err
+	}
+	_, err = client.Update(updated, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("error updating ClusterTrustBundle %s: %s", b.ClusterTrustBundle, err)
+	}
+	return nil
+}
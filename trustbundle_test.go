@@ -0,0 +1,102 @@
+package pentagon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestTrustBundles(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+	)
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	ca := string(certificate(t, time.Now().Add(24*time.Hour)))
+	vaultClient.Write("secrets/ca", map[string]interface{}{"ca.crt": ca})
+
+	r := NewTrustBundleReflector(vaultClient, k8sClient, nil, DefaultNamespace, "test", false)
+	bundles := []TrustBundle{{
+		Name:            "internal-ca",
+		VaultPath:       "secrets/ca",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+		Keys:            []string{DefaultTrustBundleKey},
+		ConfigMapKey:    DefaultTrustBundleKey,
+		AllNamespaces:   true,
+	}}
+	if err := r.Reflect(context.Background(), bundles); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	for _, namespace := range []string{"team-a", "team-b"} {
+		cm, err := k8sClient.CoreV1().ConfigMaps(namespace).Get("internal-ca", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("internal-ca should be in %s: %s", namespace, err)
+		}
+		if cm.Data[DefaultTrustBundleKey] != ca {
+			t.Fatalf("unexpected bundle in %s: %q", namespace, cm.Data[DefaultTrustBundleKey])
+		}
+	}
+	if _, err := k8sClient.CoreV1().ConfigMaps("kube-system").Get("internal-ca", metav1.GetOptions{}); err == nil {
+		t.Fatal("system namespaces should have been left out")
+	}
+
+	// rotating the CA updates the ConfigMaps, and namespaces that are no
+	// longer targeted lose theirs.
+	rotated := string(certificate(t, time.Now().Add(48*time.Hour)))
+	vaultClient.Write("secrets/ca", map[string]interface{}{"ca.crt": rotated})
+	bundles[0].ExcludeNamespaces = []string{"team-b"}
+	if err := r.Reflect(context.Background(), bundles); err != nil {
+		t.Fatalf("reflect didn't work after the rotation: %s", err)
+	}
+
+	cm, err := k8sClient.CoreV1().ConfigMaps("team-a").Get("internal-ca", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("internal-ca should still be in team-a: %s", err)
+	}
+	if cm.Data[DefaultTrustBundleKey] != rotated {
+		t.Fatal("the bundle should have been rotated")
+	}
+	if _, err := k8sClient.CoreV1().ConfigMaps("team-b").Get("internal-ca", metav1.GetOptions{}); err == nil {
+		t.Fatal("the bundle of the excluded namespace should have been deleted")
+	}
+}
+
+func TestTrustBundleInvalid(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: DefaultNamespace},
+	})
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	ca := string(certificate(t, time.Now().Add(24*time.Hour)))
+	vaultClient.Write("secrets/ca", map[string]interface{}{"ca.crt": ca, "other": "not a certificate"})
+
+	r := NewTrustBundleReflector(vaultClient, k8sClient, nil, DefaultNamespace, "test", false)
+	for name, bundle := range map[string]TrustBundle{
+		"not a certificate": {Name: "bad", Keys: []string{"other"}},
+		"missing key":       {Name: "bad", Keys: []string{"missing"}},
+		"foreign ConfigMap": {Name: "foreign", Keys: []string{"ca.crt"}},
+	} {
+		bundle.VaultPath = "secrets/ca"
+		bundle.VaultEngineType = vault.EngineTypeKeyValueV1
+		bundle.ConfigMapKey = DefaultTrustBundleKey
+		if err := r.Reflect(context.Background(), []TrustBundle{bundle}); err == nil {
+			t.Errorf("%s: reflect should have failed", name)
+		}
+	}
+
+	cm, err := k8sClient.CoreV1().ConfigMaps(DefaultNamespace).Get("foreign", metav1.GetOptions{})
+	if err != nil || len(cm.Data) > 0 {
+		t.Fatalf("foreign should have been left alone: %v %s", cm, err)
+	}
+}
@@ -0,0 +1,87 @@
+package pentagon
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// ValueRule constrains the value of a key of a mapping's secret, e.g. that
+// DATABASE_URL must look like a URL.  Values that break a rule fail the
+// mapping before anything is written.
+type ValueRule struct {
+	// Key is the key of the secret whose value is checked.
+	Key string `yaml:"key"`
+
+	// Required fails the mapping if the key is missing.  Otherwise a
+	// missing key passes the rule.
+	Required bool `yaml:"required"`
+
+	// Pattern is a regular expression the value must match.  It isn't
+	// anchored, so use ^ and $ to match the whole value.
+	Pattern string `yaml:"pattern"`
+
+	// MinLength and MaxLength bound the length of the value in
+	// characters.  Zero MaxLength means no limit.
+	MinLength int `yaml:"minLength"`
+	MaxLength int `yaml:"maxLength"`
+}
+
+// Validate checks that the rule names a key and has a valid pattern and
+// bounds.
+func (v ValueRule) Validate() error {
+	if v.Key == "" {
+		return fmt.Errorf("validation rules need a key")
+	}
+	if _, err := regexp.Compile(v.Pattern); err != nil {
+		return fmt.Errorf("invalid pattern of %s: %s", v.Key, err)
+	}
+	if v.MinLength < 0 || v.MaxLength < 0 {
+		return fmt.Errorf("lengths of %s can't be negative", v.Key)
+	}
+	if v.MaxLength > 0 && v.MinLength > v.MaxLength {
+		return fmt.Errorf("minLength of %s is more than its maxLength", v.Key)
+	}
+	return nil
+}
+
+// check returns an error describing how the value of the rule's key in
+// data breaks the rule, without the value itself.
+func (v ValueRule) check(data map[string][]byte) error {
+	value, ok := data[v.Key]
+	if !ok {
+		if v.Required {
+			return fmt.Errorf("key %s is missing", v.Key)
+		}
+		return nil
+	}
+
+	length := utf8.RuneCount(value)
+	if length < v.MinLength {
+		return fmt.Errorf(
+			"value of %s is %d characters long, shorter than %d",
+			v.Key,
+			length,
+			v.MinLength,
+		)
+	}
+	if v.MaxLength > 0 && length > v.MaxLength {
+		return fmt.Errorf(
+			"value of %s is %d characters long, longer than %d",
+			v.Key,
+			length,
+			v.MaxLength,
+		)
+	}
+
+	if v.Pattern != "" {
+		pattern, err := regexp.Compile(v.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern of %s: %s", v.Key, err)
+		}
+		if !pattern.Match(value) {
+			return fmt.Errorf("value of %s doesn't match %q", v.Key, v.Pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package pentagon
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+func TestValueRuleValidate(t *testing.T) {
+	for _, rule := range []ValueRule{
+		{},
+		{Key: "a", Pattern: "("},
+		{Key: "a", MinLength: -1},
+		{Key: "a", MinLength: 10, MaxLength: 5},
+	} {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("rule %+v should be invalid", rule)
+		}
+	}
+	if err := (ValueRule{Key: "a", Pattern: "^a+$", MinLength: 1, MaxLength: 5}).Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestCheckKeysValidation(t *testing.T) {
+	mapping := Mapping{Validation: []ValueRule{
+		{Key: "DATABASE_URL", Required: true, Pattern: `^postgres://[^/]+/\w+$`},
+		{Key: "TOKEN", MinLength: 4, MaxLength: 8},
+	}}
+
+	for _, test := range []struct {
+		data map[string][]byte
+		err  string
+	}{
+		{
+			data: map[string][]byte{"DATABASE_URL": []byte("postgres://db/app")},
+		},
+		{
+			data: map[string][]byte{
+				"DATABASE_URL": []byte("postgres://db/app"),
+				"TOKEN":        []byte("héllo"),
+			},
+		},
+		{
+			data: map[string][]byte{},
+			err:  "key DATABASE_URL is missing",
+		},
+		{
+			data: map[string][]byte{"DATABASE_URL": []byte("mysql://db/app")},
+			err:  "value of DATABASE_URL doesn't match",
+		},
+		{
+			data: map[string][]byte{
+				"DATABASE_URL": []byte("postgres://db/app"),
+				"TOKEN":        []byte("abc"),
+			},
+			err: "value of TOKEN is 3 characters long, shorter than 4",
+		},
+		{
+			data: map[string][]byte{
+				"DATABASE_URL": []byte("postgres://db/app"),
+				"TOKEN":        []byte("abcdefghi"),
+			},
+			err: "value of TOKEN is 9 characters long, longer than 8",
+		},
+	} {
+		err := checkKeys(mapping, test.data)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %v: %s", test.data, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error %q for %v, got %v", test.err, test.data, err)
+		}
+		if err != nil && strings.Contains(err.Error(), "mysql") {
+			t.Errorf("error leaks the value: %s", err)
+		}
+	}
+}
+
+func TestValidationFailsMapping(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/db", map[string]interface{}{"DATABASE_URL": "nope"})
+	secrets := NewFakeSecrets()
+
+	r, err := New(context.Background(), WithVault(vaultClient), WithSecretClient(secrets))
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	err = r.Reflect(context.Background(), []Mapping{{
+		VaultPath:       "secrets/db",
+		SecretName:      "db",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+		Validation:      []ValueRule{{Key: "DATABASE_URL", Pattern: "^postgres://"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "value of DATABASE_URL doesn't match") {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if _, err := secrets.Get("db", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("nothing should have been written: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CAPool holds the CA certificates trusted to verify vault's certificate,
+// read from inline PEM and from a file that can be re-read when the CA is
+// rotated.  The vault client only reads its CA when it is created, so
+// connections must be configured with Configure to use the current pool.
+type CAPool struct {
+	file   string
+	inline []byte
+
+	mu      sync.RWMutex
+	pool    *x509.CertPool
+	modTime time.Time
+	size    int64
+}
+
+// NewCAPool returns a CAPool with the certificates of the PEM encoded
+// inline and of file, either of which may be empty.
+func NewCAPool(file string, inline string) (*CAPool, error) {
+	c := &CAPool{
+		file:   file,
+		inline: []byte(inline),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads the certificates into a new pool.
+func (c *CAPool) load() error {
+	pool := x509.NewCertPool()
+	if len(c.inline) > 0 && !pool.AppendCertsFromPEM(c.inline) {
+		return fmt.Errorf("no certificates found in the inline CA")
+	}
+
+	var modTime time.Time
+	var size int64
+	if c.file != "" {
+		info, err := os.Stat(c.file)
+		if err != nil {
+			return fmt.Errorf("error reading CA file: %s", err)
+		}
+		contents, err := ioutil.ReadFile(c.file)
+		if err != nil {
+			return fmt.Errorf("error reading CA file: %s", err)
+		}
+		if !pool.AppendCertsFromPEM(contents) {
+			return fmt.Errorf("no certificates found in %s", c.file)
+		}
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	c.mu.Lock()
+	c.pool, c.modTime, c.size = pool, modTime, size
+	c.mu.Unlock()
+	return nil
+}
+
+// Reload re-reads the CA file if it changed since it was last read.  The
+// current certificates are kept if the file can't be read.
+func (c *CAPool) Reload() error {
+	if c.file == "" {
+		return nil
+	}
+
+	info, err := os.Stat(c.file)
+	if err != nil {
+		return fmt.Errorf("error reading CA file: %s", err)
+	}
+	c.mu.RLock()
+	changed := !info.ModTime().Equal(c.modTime) || info.Size() != c.size
+	c.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	if err := c.load(); err != nil {
+		return err
+	}
+	log.Printf("reloaded vault CA from %s", c.file)
+	return nil
+}
+
+// Run reloads the CA file every interval until ctx is done.
+func (c *CAPool) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Reload(); err != nil {
+				log.Printf("error reloading vault CA, keeping the previous one: %s", err)
+			}
+		}
+	}
+}
+
+// Pool returns the current certificates.
+func (c *CAPool) Pool() *x509.CertPool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pool
+}
+
+// Configure makes connections using config verify the server's certificate
+// against the current certificates of the pool.  The certificate must be
+// valid for one of serverNames.
+func (c *CAPool) Configure(config *tls.Config, serverNames ...string) {
+	// the default verification would use the roots config had when the
+	// connection was made, so it's replaced by one using the current pool.
+	config.InsecureSkipVerify = true
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("vault sent no certificate")
+		}
+
+		intermediates := x509.NewCertPool()
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("invalid certificate from vault: %s", err)
+			}
+			if i > 0 {
+				intermediates.AddCert(cert)
+			}
+			certs = append(certs, cert)
+		}
+
+		// without any names, only the chain is verified.
+		if len(serverNames) == 0 {
+			serverNames = []string{""}
+		}
+
+		var err error
+		for _, serverName := range serverNames {
+			_, err = certs[0].Verify(x509.VerifyOptions{
+				DNSName:       serverName,
+				Roots:         c.Pool(),
+				Intermediates: intermediates,
+			})
+			if err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+}
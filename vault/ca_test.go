@@ -0,0 +1,100 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCAPoolReload(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "pentagon-ca")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// start out trusting another CA.
+	file := filepath.Join(dir, "ca.pem")
+	write := func(contents []byte) {
+		if err := ioutil.WriteFile(file, contents, 0600); err != nil {
+			t.Fatalf("unable to write CA: %s", err)
+		}
+	}
+	write(selfSigned(t))
+
+	ca, err := NewCAPool(file, "")
+	if err != nil {
+		t.Fatalf("unable to load CA: %s", err)
+	}
+
+	config := &tls.Config{}
+	ca.Configure(config, "example.com")
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("the server shouldn't be trusted yet")
+	}
+
+	write(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}))
+	if err := ca.Reload(); err != nil {
+		t.Fatalf("unable to reload CA: %s", err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("the server should be trusted after the reload: %s", err)
+	}
+	resp.Body.Close()
+
+	// a broken file keeps the current CA.
+	write([]byte("not a certificate"))
+	if err := ca.Reload(); err == nil {
+		t.Fatal("reloading an invalid CA should fail")
+	}
+	client.CloseIdleConnections()
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("the server should still be trusted: %s", err)
+	}
+	resp.Body.Close()
+}
+
+// selfSigned returns a new PEM encoded self-signed CA certificate.
+func selfSigned(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// ConcurrencyLimited wraps a Logical and limits the number of reads in
+// flight at once.  Writes are passed through without limiting.
+type ConcurrencyLimited struct {
+	Logical
+	sem chan struct{}
+}
+
+// NewConcurrencyLimited returns a Logical that allows at most limit reads
+// in flight at once.
+func NewConcurrencyLimited(logical Logical, limit int) *ConcurrencyLimited {
+	if limit < 1 {
+		limit = 1
+	}
+	return &ConcurrencyLimited{
+		Logical: logical,
+		sem:     make(chan struct{}, limit),
+	}
+}
+
+// acquire waits for a read to be allowed, giving up when ctx is done, and
+// returns the function ending the read.
+func (c *ConcurrencyLimited) acquire(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case c.sem <- struct{}{}:
+		return func() { <-c.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Read waits for the other reads to leave room before reading.
+func (c *ConcurrencyLimited) Read(path string) (*api.Secret, error) {
+	return c.ReadWithContext(context.Background(), path)
+}
+
+// ReadWithContext waits for the other reads to leave room before reading,
+// giving up when ctx is done.
+func (c *ConcurrencyLimited) ReadWithContext(
+	ctx context.Context,
+	path string,
+) (*api.Secret, error) {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return ReadWithContext(ctx, c.Logical, path)
+}
+
+// ReadVersion waits for the other reads to leave room before reading
+// version of the key/value v2 secret at path.
+func (c *ConcurrencyLimited) ReadVersion(
+	ctx context.Context,
+	path string,
+	version int64,
+) (*api.Secret, error) {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return ReadVersion(ctx, c.Logical, path, version)
+}
@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// concurrentReads records the most reads in flight at once.
+type concurrentReads struct {
+	Logical
+	inFlight int32
+	max      int32
+}
+
+func (c *concurrentReads) Read(path string) (*api.Secret, error) {
+	n := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&c.max)
+		if n <= max || atomic.CompareAndSwapInt32(&c.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return nil, nil
+}
+
+func TestConcurrencyLimited(t *testing.T) {
+	reads := &concurrentReads{}
+	limited := NewConcurrencyLimited(reads, 2)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := limited.ReadWithContext(context.Background(), "secrets/foo"); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reads.max != 2 {
+		t.Errorf("expected at most 2 reads in flight, got %d", reads.max)
+	}
+
+	// a read waiting for room gives up with its context.
+	limited.sem <- struct{}{}
+	limited.sem <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limited.ReadWithContext(ctx, "secrets/foo"); err != context.DeadlineExceeded {
+		t.Errorf("expected the read to time out, got %v", err)
+	}
+}
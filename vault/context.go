@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// ContextReader is implemented by Logicals whose reads can be cancelled.
+type ContextReader interface {
+	ReadWithContext(ctx context.Context, path string) (*api.Secret, error)
+}
+
+// ReadWithContext reads path, giving up when ctx is done.  If logical does
+// not implement ContextReader, the read itself is not cancelled and
+// finishes in the background.
+func ReadWithContext(
+	ctx context.Context,
+	logical Logical,
+	path string,
+) (*api.Secret, error) {
+	if reader, ok := logical.(ContextReader); ok {
+		return reader.ReadWithContext(ctx, path)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		secret *api.Secret
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		secret, err := logical.Read(path)
+		done <- result{secret: secret, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.secret, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Client is a Logical backed by a vault api client whose reads can be
+// cancelled.
+type Client struct {
+	*api.Logical
+	client *api.Client
+}
+
+// NewClient returns a Client using client.
+func NewClient(client *api.Client) *Client {
+	return &Client{
+		Logical: client.Logical(),
+		client:  client,
+	}
+}
+
+// ReadWithContext reads path like api.Logical.Read does, but with a context
+// that cancels the request.
+func (c *Client) ReadWithContext(
+	ctx context.Context,
+	path string,
+) (*api.Secret, error) {
+	return c.read(ctx, path, nil)
+}
+
+// read reads path with the query parameters params.
+func (c *Client) read(
+	ctx context.Context,
+	path string,
+	params url.Values,
+) (*api.Secret, error) {
+	r := c.client.NewRequest("GET", "/v1/"+path)
+	for key, values := range params {
+		for _, value := range values {
+			r.Params.Add(key, value)
+		}
+	}
+
+	resp, err := c.client.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+
+	// vault returns a 404 for secrets that don't exist which the vault
+	// client turns into (nil, nil) unless there are warnings or data.
+	if resp != nil && resp.StatusCode == 404 {
+		secret, parseErr := api.ParseSecret(resp.Body)
+		switch parseErr {
+		case nil:
+		case io.EOF:
+			return nil, nil
+		default:
+			return nil, err
+		}
+		if secret != nil && (len(secret.Warnings) > 0 || len(secret.Data) > 0) {
+			return secret, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return api.ParseSecret(resp.Body)
+}
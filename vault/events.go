@@ -0,0 +1,349 @@
+package vault
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// EventTypeKeyValue matches the events of both versions of the key/value
+// engine, e.g. "kv-v1/write" and "kv-v2/data-write".
+const EventTypeKeyValue = "kv*"
+
+// maxEventSize bounds the size of a single event notification.
+const maxEventSize = 1 << 20
+
+// websocketGUID is appended to the handshake key as described in RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// errClosed is returned once vault closes the websocket.
+var errClosed = errors.New("websocket closed by vault")
+
+// Event is a vault event notification.
+type Event struct {
+	// Type is the type of event, e.g. "kv-v2/data-write".
+	Type string
+
+	// Path is the path of the secret the event is about.  For key/value v2
+	// secrets it is the path used to read the secret's data.
+	Path string
+}
+
+// eventMessage is the JSON form of an event notification.
+type eventMessage struct {
+	Data struct {
+		EventType string `json:"event_type"`
+		Event     struct {
+			Metadata struct {
+				Path     string `json:"path"`
+				DataPath string `json:"data_path"`
+			} `json:"metadata"`
+		} `json:"event"`
+	} `json:"data"`
+}
+
+// Events subscribes to vault's event notifications, which are available
+// over a websocket starting with vault 1.16.
+type Events struct {
+	client    *api.Client
+	tlsConfig *tls.Config
+}
+
+// NewEvents returns an Events using the address and token of client.
+// tlsConfig is used to connect to https addresses and may be nil.
+func NewEvents(client *api.Client, tlsConfig *tls.Config) *Events {
+	return &Events{
+		client:    client,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Subscribe calls handle with every event matching eventType until ctx is
+// done or the connection fails.  It always returns a non-nil error.
+func (e *Events) Subscribe(
+	ctx context.Context,
+	eventType string,
+	handle func(Event),
+) error {
+	u, err := url.Parse(e.client.Address())
+	if err != nil {
+		return fmt.Errorf("error parsing vault address: %s", err)
+	}
+	u.Path = "/v1/sys/events/subscribe/" + eventType
+	u.RawQuery = url.Values{"json": []string{"true"}}.Encode()
+
+	conn, err := e.dial(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// closing the connection unblocks any pending read once ctx is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	ws, err := e.handshake(conn, u)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	for {
+		msg, err := ws.readMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		em := eventMessage{}
+		if err := json.Unmarshal(msg, &em); err != nil {
+			return fmt.Errorf("error decoding event: %s", err)
+		}
+
+		event := Event{
+			Type: em.Data.EventType,
+			Path: em.Data.Event.Metadata.DataPath,
+		}
+		if event.Path == "" {
+			event.Path = em.Data.Event.Metadata.Path
+		}
+		handle(event)
+	}
+}
+
+// dial opens a connection to the host of u.
+func (e *Events) dial(ctx context.Context, u *url.URL) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to vault: %s", err)
+	}
+	if u.Scheme != "https" {
+		return conn, nil
+	}
+
+	config := &tls.Config{}
+	if e.tlsConfig != nil {
+		config = e.tlsConfig.Clone()
+	}
+	// websockets need http/1.1.
+	config.NextProtos = nil
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake with vault failed: %s", err)
+	}
+	return tlsConn, nil
+}
+
+// handshake upgrades conn to a websocket.
+func (e *Events) handshake(conn net.Conn, u *url.URL) (*websocket, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating websocket key: %s", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range e.client.Headers() {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("X-Vault-Token", e.client.Token())
+
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("error subscribing to vault events: %s", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("error subscribing to vault events: %s", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf(
+			"error subscribing to vault events: %s %s",
+			resp.Status,
+			body,
+		)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, fmt.Errorf("vault returned an invalid websocket accept key")
+	}
+
+	return &websocket{conn: conn, r: br}, nil
+}
+
+// acceptKey returns the Sec-WebSocket-Accept header expected for key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// websocket is the client side of a websocket connection.  It only
+// supports what is needed to receive event notifications.
+type websocket struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// readMessage returns the next data message, answering any control frames
+// sent before it.
+func (ws *websocket) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			ws.writeFrame(opClose, payload)
+			return nil, errClosed
+		case opText, opBinary, opContinuation:
+			if len(msg)+len(payload) > maxEventSize {
+				return nil, fmt.Errorf("event is larger than %d bytes", maxEventSize)
+			}
+			msg = append(msg, payload...)
+			if fin {
+				return msg, nil
+			}
+		default:
+			return nil, fmt.Errorf("unexpected websocket opcode %d", opcode)
+		}
+	}
+}
+
+// readFrame reads a single frame.
+func (ws *websocket) readFrame() (bool, byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(ws.r, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(ws.r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(ws.r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if length > maxEventSize {
+		return false, 0, nil, fmt.Errorf("frame is larger than %d bytes", maxEventSize)
+	}
+
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(ws.r, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single masked control frame, which clients are
+// required to mask.
+func (ws *websocket) writeFrame(opcode byte, payload []byte) error {
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	frame := make([]byte, 6, 6+len(payload))
+	frame[0] = 0x80 | opcode
+	frame[1] = 0x80 | byte(len(payload))
+	if _, err := rand.Read(frame[2:6]); err != nil {
+		return err
+	}
+	for i, b := range payload {
+		frame = append(frame, b^frame[2+i%4])
+	}
+
+	_, err := ws.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestEventsSubscribe(t *testing.T) {
+	messages := []string{
+		`{"data":{"event_type":"kv-v2/data-write","event":{"metadata":{"path":"secret/data/foo","data_path":"secret/data/foo"}}}}`,
+		`{"data":{"event_type":"kv-v1/write","event":{"metadata":{"path":"kv/bar"}}}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/events/subscribe/kv*" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if token := r.Header.Get("X-Vault-Token"); token != "root" {
+			t.Errorf("unexpected token: %q", token)
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("unable to hijack connection: %s", err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		buf.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+		buf.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+
+		// a ping before the messages must be answered without being
+		// mistaken for an event.
+		buf.Write([]byte{0x80 | opPing, 0})
+		for _, msg := range messages {
+			buf.Write([]byte{0x80 | opText, byte(len(msg))})
+			buf.WriteString(msg)
+		}
+		buf.Write([]byte{0x80 | opClose, 0})
+		buf.Flush()
+
+		// wait for the pong and close frames.
+		reply := make([]byte, 12)
+		if _, err := buf.Read(reply); err != nil {
+			t.Errorf("no reply from client: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatalf("unable to create vault client: %s", err)
+	}
+	client.SetToken("root")
+
+	events := []Event{}
+	err = NewEvents(client, nil).Subscribe(
+		context.Background(),
+		EventTypeKeyValue,
+		func(e Event) {
+			events = append(events, e)
+		},
+	)
+	if err != errClosed {
+		t.Fatalf("subscription should have ended with the close frame: %v", err)
+	}
+
+	expected := []Event{
+		{Type: "kv-v2/data-write", Path: "secret/data/foo"},
+		{Type: "kv-v1/write", Path: "kv/bar"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %v", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		if events[i] != e {
+			t.Errorf("event %d: expected %v, got %v", i, e, events[i])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Failover moves a vault client between the addresses of several vault
+// servers, using the first one that is reachable and unsealed.  It is a
+// HealthChecker reporting the health of the server in use, so the addresses
+// are checked whenever its health is.
+type Failover struct {
+	client    *api.Client
+	addresses []string
+	checkers  map[string]HealthChecker
+	onSwitch  func(address string) error
+
+	mu     sync.Mutex
+	active string
+}
+
+// NewFailover returns a Failover for client.  The client isn't considered
+// to be using any of addresses until the first health check moves it to one.
+// onSwitch, if set, is called whenever the client is moved to an address,
+// e.g. to log in to that server, and the move is retried on the next check
+// if it fails.
+func NewFailover(
+	client *api.Client,
+	addresses []string,
+	onSwitch func(address string) error,
+) (*Failover, error) {
+	checkers := make(map[string]HealthChecker, len(addresses))
+	for _, address := range addresses {
+		// health checks don't need a token, and clones share the client's
+		// connection settings.
+		clone, err := client.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if err := clone.SetAddress(address); err != nil {
+			return nil, err
+		}
+		checkers[address] = NewClient(clone)
+	}
+
+	return &Failover{
+		client:    client,
+		addresses: addresses,
+		checkers:  checkers,
+		onSwitch:  onSwitch,
+	}, nil
+}
+
+// Active returns the address in use, or "" before the client was moved to
+// any.
+func (f *Failover) Active() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active
+}
+
+// Health checks the addresses in order and moves the client to the first
+// one that is reachable and unsealed, then returns its health.  The client
+// is left where it is when every server is sealed or unreachable, and the
+// health of the server in use is returned.
+func (f *Failover) Health(ctx context.Context) (*api.HealthResponse, error) {
+	active := f.Active()
+	var activeHealth *api.HealthResponse
+	activeErr := fmt.Errorf("no vault server is reachable and unsealed")
+
+	for _, address := range f.addresses {
+		health, err := f.checkers[address].Health(ctx)
+		if address == active {
+			activeHealth, activeErr = health, err
+		}
+		if err != nil {
+			log.Printf("vault at %s is unreachable: %s", address, err)
+			continue
+		}
+		if health.Sealed {
+			log.Printf("vault at %s is sealed", address)
+			continue
+		}
+
+		if address != active {
+			if err := f.use(address); err != nil {
+				return nil, err
+			}
+		}
+		return health, nil
+	}
+
+	return activeHealth, activeErr
+}
+
+// use moves the client to address.
+func (f *Failover) use(address string) error {
+	if err := f.client.SetAddress(address); err != nil {
+		return err
+	}
+
+	if f.onSwitch != nil {
+		if err := f.onSwitch(address); err != nil {
+			return fmt.Errorf("error switching to vault at %s: %s", address, err)
+		}
+	}
+
+	f.mu.Lock()
+	if f.active != "" {
+		log.Printf("vault moved from %s to %s", f.active, address)
+	}
+	f.active = address
+	f.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestFailover(t *testing.T) {
+	sealed := int32(1)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"initialized":true,"sealed":%t}`, atomic.LoadInt32(&sealed) == 1)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"initialized":true,"sealed":false,"standby":true}`))
+	}))
+	defer secondary.Close()
+
+	client, err := api.NewClient(&api.Config{Address: primary.URL})
+	if err != nil {
+		t.Fatalf("unable to create vault client: %s", err)
+	}
+
+	switches := []string{}
+	failover, err := NewFailover(client, []string{primary.URL, secondary.URL}, func(address string) error {
+		switches = append(switches, address)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to create failover: %s", err)
+	}
+
+	// the sealed primary is skipped.
+	health, err := failover.Health(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !health.Standby {
+		t.Errorf("expected the health of the secondary, got %+v", health)
+	}
+	if client.Address() != secondary.URL || failover.Active() != secondary.URL {
+		t.Errorf("expected the client to use %s, got %s", secondary.URL, client.Address())
+	}
+
+	// the primary is used again once it's unsealed.
+	atomic.StoreInt32(&sealed, 0)
+	if _, err := failover.Health(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if client.Address() != primary.URL {
+		t.Errorf("expected the client to use %s, got %s", primary.URL, client.Address())
+	}
+
+	// unreachable servers leave the client where it is.
+	primary.Close()
+	secondary.Close()
+	if _, err := failover.Health(context.Background()); err == nil {
+		t.Errorf("expected an error when vault is unreachable")
+	}
+	if client.Address() != primary.URL {
+		t.Errorf("expected the client to stay on %s, got %s", primary.URL, client.Address())
+	}
+
+	expected := []string{secondary.URL, primary.URL}
+	if fmt.Sprint(switches) != fmt.Sprint(expected) {
+		t.Errorf("expected switches to %v, got %v", expected, switches)
+	}
+}
+
+func TestFailoverSwitchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"initialized":true,"sealed":false}`))
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatalf("unable to create vault client: %s", err)
+	}
+
+	fail := true
+	failover, err := NewFailover(client, []string{server.URL}, func(address string) error {
+		if fail {
+			return fmt.Errorf("login failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to create failover: %s", err)
+	}
+
+	if _, err := failover.Health(context.Background()); err == nil {
+		t.Errorf("expected the failed switch to be reported")
+	}
+	if failover.Active() != "" {
+		t.Errorf("failed switch should not change the active address, got %q", failover.Active())
+	}
+
+	// the switch is retried by the next check.
+	fail = false
+	if _, err := failover.Health(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if failover.Active() != server.URL {
+		t.Errorf("expected %s to be active, got %q", server.URL, failover.Active())
+	}
+}
@@ -0,0 +1,78 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LoadFixtures writes the fixtures in dir to the mock vault.  The vault path
+// of each fixture is its path relative to dir without its extension, e.g.
+// dir/secrets/data/foo.yaml holds the keys of secrets/data/foo.  Fixtures
+// are YAML or JSON objects in .yaml, .yml or .json files, and other files
+// are ignored.
+func (m *Mock) LoadFixtures(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		// JSON fixtures are decoded as YAML, which is a superset of JSON.
+		ext := filepath.Ext(path)
+		switch ext {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		vaultPath := filepath.ToSlash(strings.TrimSuffix(rel, ext))
+
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		data := map[string]interface{}{}
+		if err := yaml.Unmarshal(raw, &data); err != nil {
+			return fmt.Errorf("invalid fixture %s: %s", rel, err)
+		}
+		for key, value := range data {
+			data[key] = stringKeys(value)
+		}
+
+		if _, err := m.Write(vaultPath, data); err != nil {
+			return fmt.Errorf("invalid fixture %s: %s", rel, err)
+		}
+		return nil
+	})
+}
+
+// stringKeys converts the maps decoded from YAML to maps with string keys,
+// like the ones decoded from vault's JSON responses.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = stringKeys(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
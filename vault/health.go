@@ -0,0 +1,46 @@
+package vault
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// HealthChecker reports the health of a vault server.
+type HealthChecker interface {
+	Health(ctx context.Context) (*api.HealthResponse, error)
+}
+
+// Health returns the response of vault's sys/health endpoint like
+// api.Sys.Health does, but with a context that cancels the request.  Sealed,
+// standby and uninitialized servers are reported in the response rather than
+// as errors.
+func (c *Client) Health(ctx context.Context) (*api.HealthResponse, error) {
+	r := c.client.NewRequest("GET", "/v1/sys/health")
+
+	// sys/health answers with a 5xx status when vault isn't active, which
+	// the vault client would turn into an error.
+	for _, param := range []string{
+		"uninitcode",
+		"sealedcode",
+		"standbycode",
+		"drsecondarycode",
+		"performancestandbycode",
+	} {
+		r.Params.Add(param, "299")
+	}
+
+	resp, err := c.client.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	health := &api.HealthResponse{}
+	if err := resp.DecodeJSON(health); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
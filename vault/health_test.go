@@ -0,0 +1,42 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/health" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if code := r.URL.Query().Get("sealedcode"); code != "299" {
+			t.Errorf("unexpected sealedcode: %q", code)
+		}
+		w.WriteHeader(299)
+		w.Write([]byte(`{"initialized":true,"sealed":true,"standby":true}`))
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatalf("unable to create vault client: %s", err)
+	}
+
+	health, err := NewClient(client).Health(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !health.Initialized || !health.Sealed || !health.Standby {
+		t.Errorf("unexpected health: %+v", health)
+	}
+
+	server.Close()
+	if _, err := NewClient(client).Health(context.Background()); err == nil {
+		t.Errorf("expected an error from a stopped server")
+	}
+}
@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/time/rate"
+)
+
+// RateLimited wraps a Logical and limits the rate of reads using a token
+// bucket.  Writes are passed through without limiting.
+type RateLimited struct {
+	Logical
+	limiter *rate.Limiter
+}
+
+// NewRateLimited returns a Logical that allows qps reads per second on
+// average with bursts of up to burst reads.
+func NewRateLimited(logical Logical, qps float32, burst int) *RateLimited {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimited{
+		Logical: logical,
+		limiter: rate.NewLimiter(rate.Limit(qps), burst),
+	}
+}
+
+// Read waits for the rate limiter before reading.
+func (r *RateLimited) Read(path string) (*api.Secret, error) {
+	return r.ReadWithContext(context.Background(), path)
+}
+
+// ReadWithContext waits for the rate limiter before reading, giving up when
+// ctx is done.
+func (r *RateLimited) ReadWithContext(
+	ctx context.Context,
+	path string,
+) (*api.Secret, error) {
+	err := r.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ReadWithContext(ctx, r.Logical, path)
+}
+
+// ReadVersion waits for the rate limiter before reading version of the
+// key/value v2 secret at path.
+func (r *RateLimited) ReadVersion(
+	ctx context.Context,
+	path string,
+	version int64,
+) (*api.Secret, error) {
+	err := r.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ReadVersion(ctx, r.Logical, path, version)
+}
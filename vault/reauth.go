@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// IsPermissionDenied returns true if err is vault refusing a request, e.g.
+// because the token expired or was revoked.
+func IsPermissionDenied(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Code: 403")
+}
+
+// Reauthenticating wraps a Logical and logs in again when vault refuses a
+// request, retrying the request once with the new token.
+type Reauthenticating struct {
+	Logical
+	login func() error
+
+	mu sync.Mutex
+	// logins counts the successful logins, so that concurrent requests
+	// refused with the same token only log in again once.
+	logins int
+}
+
+var (
+	_ ContextReader = (*Reauthenticating)(nil)
+	_ VersionReader = (*Reauthenticating)(nil)
+)
+
+// NewReauthenticating returns a Logical calling login when vault refuses a
+// request.
+func NewReauthenticating(logical Logical, login func() error) *Reauthenticating {
+	return &Reauthenticating{
+		Logical: logical,
+		login:   login,
+	}
+}
+
+// Read reads path, logging in again if vault refuses it.
+func (r *Reauthenticating) Read(path string) (*api.Secret, error) {
+	return r.ReadWithContext(context.Background(), path)
+}
+
+// ReadWithContext reads path, logging in again if vault refuses it, and
+// gives up when ctx is done.
+func (r *Reauthenticating) ReadWithContext(
+	ctx context.Context,
+	path string,
+) (*api.Secret, error) {
+	return r.retry(func() (*api.Secret, error) {
+		return ReadWithContext(ctx, r.Logical, path)
+	})
+}
+
+// ReadVersion reads version of the key/value v2 secret at path, logging in
+// again if vault refuses it.
+func (r *Reauthenticating) ReadVersion(
+	ctx context.Context,
+	path string,
+	version int64,
+) (*api.Secret, error) {
+	return r.retry(func() (*api.Secret, error) {
+		return ReadVersion(ctx, r.Logical, path, version)
+	})
+}
+
+// Write writes data to path, logging in again if vault refuses it.
+func (r *Reauthenticating) Write(
+	path string,
+	data map[string]interface{},
+) (*api.Secret, error) {
+	return r.retry(func() (*api.Secret, error) {
+		return r.Logical.Write(path, data)
+	})
+}
+
+// retry calls request, and calls it again after logging in if vault
+// refused it.
+func (r *Reauthenticating) retry(
+	request func() (*api.Secret, error),
+) (*api.Secret, error) {
+	r.mu.Lock()
+	logins := r.logins
+	r.mu.Unlock()
+
+	secret, err := request()
+	if !IsPermissionDenied(err) {
+		return secret, err
+	}
+
+	if loginErr := r.relogin(logins); loginErr != nil {
+		return nil, fmt.Errorf("%s, and logging in again failed: %s", err, loginErr)
+	}
+	return request()
+}
+
+// relogin logs in again, unless another request already did since logins
+// were counted.
+func (r *Reauthenticating) relogin(logins int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.logins != logins {
+		return nil
+	}
+	if err := r.login(); err != nil {
+		return err
+	}
+	r.logins++
+	return nil
+}
@@ -0,0 +1,55 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// expiringVault refuses reads until its token is replaced.
+type expiringVault struct {
+	*Mock
+	token string
+}
+
+func (e *expiringVault) Read(path string) (*api.Secret, error) {
+	if e.token != "fresh" {
+		return nil, fmt.Errorf("Error making API request.\n\nCode: 403. Errors:\n\n* permission denied")
+	}
+	return e.Mock.Read(path)
+}
+
+func TestReauthenticating(t *testing.T) {
+	mock := NewMock(map[string]EngineType{"secrets": EngineTypeKeyValueV1})
+	mock.Write("secrets/foo", map[string]interface{}{"foo": "bar"})
+	expiring := &expiringVault{Mock: mock, token: "expired"}
+
+	logins := 0
+	r := NewReauthenticating(expiring, func() error {
+		logins++
+		expiring.token = "fresh"
+		return nil
+	})
+
+	secret, err := r.Read("secrets/foo")
+	if err != nil {
+		t.Fatalf("the read should have been retried: %s", err)
+	}
+	if secret.Data["foo"] != "bar" {
+		t.Fatalf("unexpected data: %v", secret.Data)
+	}
+	if _, err := r.Read("secrets/foo"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if logins != 1 {
+		t.Fatalf("expected 1 login, got %d", logins)
+	}
+
+	failing := NewReauthenticating(&expiringVault{Mock: mock}, func() error {
+		return fmt.Errorf("broker unavailable")
+	})
+	if _, err := failing.Read("secrets/foo"); err == nil {
+		t.Fatal("the read should have failed")
+	}
+}
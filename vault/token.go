@@ -0,0 +1,20 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TokenTTL returns the remaining time to live of the client's token, which
+// is zero for tokens that don't expire.
+func (c *Client) TokenTTL(ctx context.Context) (time.Duration, error) {
+	secret, err := c.read(ctx, "auth/token/lookup-self", nil)
+	if err != nil {
+		return 0, err
+	}
+	if secret == nil {
+		return 0, fmt.Errorf("vault returned no token information")
+	}
+	return secret.TokenTTL()
+}
@@ -1,9 +1,13 @@
 package vault
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 )
@@ -17,9 +21,23 @@ const (
 
 	// EngineTypeKeyValueV2 is the identifier for version 2 of the key/value engine.
 	EngineTypeKeyValueV2 EngineType = "kv-v2"
+
+	// EngineTypeTOTP is the identifier for the TOTP engine, whose codes
+	// and key configurations can be read but not written like key/value
+	// secrets.
+	EngineTypeTOTP EngineType = "totp"
+
+	// EngineTypeConsul is the identifier for the Consul engine, whose
+	// reads generate ACL tokens with a lease.
+	EngineTypeConsul EngineType = "consul"
+
+	// EngineTypeNomad is the identifier for the Nomad engine, whose reads
+	// generate ACL tokens with a lease.
+	EngineTypeNomad EngineType = "nomad"
 )
 
-// AllEngineTypes is a slice of all the engine types known to pentagon.
+// AllEngineTypes is a slice of all the key/value engine types known to
+// pentagon.
 var AllEngineTypes []EngineType
 
 // AuthType is a custom type to represent different Vault authentication
@@ -41,6 +59,16 @@ const (
 	// it will default to the pods serviceAccount name. If AutheBackend is not set it will
 	// default to 'kubernetes'
 	AuthTypeKubernetes AuthType = "kubernetes"
+
+	// AuthTypeKubernetesSecret expects the TokenSecret property of the
+	// VaultConfig struct to name a kubernetes secret holding the token to
+	// use, e.g. one managed by a token broker.
+	AuthTypeKubernetesSecret AuthType = "kubernetes-secret"
+
+	// AuthTypeCommand expects the TokenCommand property of the VaultConfig
+	// struct to be a command printing the token to use, like vault's token
+	// helpers.
+	AuthTypeCommand AuthType = "command"
 )
 
 func init() {
@@ -50,6 +78,35 @@ func init() {
 	}
 }
 
+// MetadataPath returns the path of the metadata of a key/value v2 secret
+// given the path used to read its data, e.g. "secret/data/foo" becomes
+// "secret/metadata/foo".  It returns false if dataPath isn't a data path.
+func MetadataPath(dataPath string) (string, bool) {
+	i := strings.Index(dataPath, "/data/")
+	if i < 0 {
+		return "", false
+	}
+	return dataPath[:i] + "/metadata/" + dataPath[i+len("/data/"):], true
+}
+
+// Version returns a version number from a vault response, which may have
+// been decoded as a json.Number.
+func Version(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
 // Logical is a subset of the inner interface that Logical() returns.
 // I'm only implementing two methods because that's all I need.
 type Logical interface {
@@ -57,18 +114,27 @@ type Logical interface {
 	Write(string, map[string]interface{}) (*api.Secret, error)
 }
 
-// Mock is a mock vault of secrets.
+// Mock is a mock vault of secrets.  It implements Logical and VersionReader
+// in memory so that code reading vault can be tested without a vault
+// server.
 type Mock struct {
 	contents     map[string]*api.Secret
+	versions     map[string][]*api.Secret
 	engineMounts map[string]EngineType
 	mu           sync.RWMutex // for synchronizing if anyone cares
 }
 
+var (
+	_ Logical       = (*Mock)(nil)
+	_ VersionReader = (*Mock)(nil)
+)
+
 // NewMock returns a new mock vault client.  engineMounts is a map of the path
 // prefix to the type of secrets engine that is mounted.
 func NewMock(engineMounts map[string]EngineType) *Mock {
 	return &Mock{
 		contents:     map[string]*api.Secret{},
+		versions:     map[string][]*api.Secret{},
 		engineMounts: engineMounts,
 	}
 }
@@ -87,35 +153,118 @@ func (m *Mock) Read(path string) (*api.Secret, error) {
 	return nil, nil
 }
 
+// ReadVersion reads a version of a key/value v2 secret written to the mock
+// vault.
+func (m *Mock) ReadVersion(
+	ctx context.Context,
+	path string,
+	version int64,
+) (*api.Secret, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	versions := m.versions[path]
+	if version < 1 || version > int64(len(versions)) {
+		return nil, nil
+	}
+	return versions[version-1], nil
+}
+
 // Write writes secrets into the mock vault.
 func (m *Mock) Write(
 	path string,
 	data map[string]interface{},
 ) (*api.Secret, error) {
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	var secret *api.Secret
 
 	splitPath := strings.Split(path, "/")
 
 	engineType := m.engineMounts[splitPath[0]]
 	switch engineType {
-	case EngineTypeKeyValueV1:
+	case EngineTypeKeyValueV1, EngineTypeTOTP, EngineTypeConsul, EngineTypeNomad:
+		// the secrets of the other engines are stored as written so that
+		// tests can set what vault generates.
 		secret = &api.Secret{
 			Data: data,
 		}
 	case EngineTypeKeyValueV2:
+		// vault expects the data wrapped like it is returned, but the
+		// mock also accepts it unwrapped.
+		if wrapped, ok := data["data"].(map[string]interface{}); ok && len(data) == 1 {
+			data = wrapped
+		}
+
+		// like vault, keep track of the version and the metadata of each
+		// secret written to a data path.
+		version := 1
+		metaPath, isData := MetadataPath(path)
+		if meta, ok := m.contents[metaPath]; isData && ok {
+			version = meta.Data["current_version"].(int) + 1
+		}
+
 		secret = &api.Secret{
 			Data: map[string]interface{}{
 				"data": data,
+				"metadata": map[string]interface{}{
+					"version": version,
+				},
 			},
 		}
+
+		if isData {
+			m.contents[metaPath] = &api.Secret{
+				Data: map[string]interface{}{
+					"current_version": version,
+				},
+			}
+			m.versions[path] = append(m.versions[path], secret)
+		}
 	default:
 		return nil, fmt.Errorf("unknown engine: %s", engineType)
 	}
 
+	m.contents[path] = secret
+	return secret, nil
+}
+
+// Delete deletes a secret from the mock vault.  Like vault, the latest
+// version of a key/value v2 secret is only soft deleted: reading it returns
+// its metadata with a deletion time and no data.
+func (m *Mock) Delete(path string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.contents[path] = secret
-	return secret, nil
+	metaPath, isData := MetadataPath(path)
+	_, ok := m.contents[path]
+	meta, hasMeta := m.contents[metaPath]
+	if !ok || !isData || !hasMeta {
+		delete(m.contents, path)
+		return
+	}
+
+	deletionTime := time.Now().UTC().Format(time.RFC3339Nano)
+	version := meta.Data["current_version"].(int)
+	m.contents[path] = &api.Secret{
+		Data: map[string]interface{}{
+			"data": nil,
+			"metadata": map[string]interface{}{
+				"version":       version,
+				"deletion_time": deletionTime,
+			},
+		},
+	}
+	m.contents[metaPath] = &api.Secret{
+		Data: map[string]interface{}{
+			"current_version": version,
+			"versions": map[string]interface{}{
+				strconv.Itoa(version): map[string]interface{}{
+					"deletion_time": deletionTime,
+				},
+			},
+		},
+	}
 }
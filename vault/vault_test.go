@@ -2,6 +2,7 @@ package vault
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 )
@@ -79,3 +80,28 @@ func TestReadNotFound(t *testing.T) {
 		t.Fatal("err should be nil")
 	}
 }
+
+func TestRateLimited(t *testing.T) {
+	m := NewMock(map[string]EngineType{
+		"secret": EngineTypeKeyValueV1,
+	})
+	m.Write("secret/foo", map[string]interface{}{"foo": "bar"})
+
+	r := NewRateLimited(m, 20, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		secret, err := r.Read("secret/foo")
+		if err != nil {
+			t.Fatalf("errored: %s", err)
+		}
+		if secret.Data["foo"] != "bar" {
+			t.Fatal("data was not equal!")
+		}
+	}
+
+	// the first read uses the burst, the other two wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("reads were not rate limited, took %s", elapsed)
+	}
+}
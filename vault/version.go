@@ -0,0 +1,44 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// VersionReader is implemented by Logicals that can read old versions of
+// key/value v2 secrets.
+type VersionReader interface {
+	ReadVersion(ctx context.Context, path string, version int64) (*api.Secret, error)
+}
+
+// ReadVersion reads version of the key/value v2 secret whose data is at
+// path.  Like Read, it returns (nil, nil) if there is no such version.  It
+// fails if logical does not implement VersionReader.
+func ReadVersion(
+	ctx context.Context,
+	logical Logical,
+	path string,
+	version int64,
+) (*api.Secret, error) {
+	reader, ok := logical.(VersionReader)
+	if !ok {
+		return nil, fmt.Errorf("reading old versions of secrets isn't supported")
+	}
+	return reader.ReadVersion(ctx, path, version)
+}
+
+// ReadVersion reads version of the key/value v2 secret whose data is at
+// path.
+func (c *Client) ReadVersion(
+	ctx context.Context,
+	path string,
+	version int64,
+) (*api.Secret, error) {
+	return c.read(ctx, path, url.Values{
+		"version": []string{strconv.FormatInt(version, 10)},
+	})
+}
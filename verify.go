@@ -0,0 +1,73 @@
+package pentagon
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WithWriteVerification makes the reflector read every secret back after
+// writing it, and fail its mapping with a *VerificationError if the data
+// isn't what was written, e.g. because a mutating admission webhook or
+// another controller altered it.
+func WithWriteVerification() Option {
+	return func(r *Reflector) {
+		r.verifyWrites = true
+	}
+}
+
+// VerificationError is the error of a mapping whose secret, read back
+// after being written, didn't hold the data written.
+type VerificationError struct {
+	SecretName string
+
+	// Keys are the keys whose values were altered, added or removed.
+	Keys []string
+}
+
+// Error implements error.
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf(
+		"secret %s was altered after being written, keys differ: %s",
+		e.SecretName,
+		strings.Join(e.Keys, ", "),
+	)
+}
+
+// verifyWrite reads the secret written back and checks that it holds the
+// data written.
+func (r *Reflector) verifyWrite(written *v1.Secret) error {
+	secret, err := r.secrets().Get(written.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error reading back secret %s: %s", written.Name, err)
+	}
+
+	keys := differingKeys(written.Data, secret.Data)
+	if len(keys) == 0 {
+		return nil
+	}
+	verificationFailuresCounter.WithLabelValues(r.metricLabel(written.Name)).Inc()
+	return &VerificationError{SecretName: written.Name, Keys: keys}
+}
+
+// differingKeys returns the sorted keys whose values differ between a and
+// b, or that only one of them has.
+func differingKeys(a, b map[string][]byte) []string {
+	keys := []string{}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || !bytes.Equal(value, other) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package pentagon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/vimeo/pentagon/vault"
+)
+
+// mutatingSecrets adds a key to every secret written, like a mutating
+// admission webhook.
+type mutatingSecrets struct {
+	*FakeSecrets
+}
+
+func (m mutatingSecrets) Create(secret *v1.Secret) (*v1.Secret, error) {
+	mutated := secret.DeepCopy()
+	mutated.Data["injected"] = []byte("by a webhook")
+	return m.FakeSecrets.Create(mutated)
+}
+
+func TestWriteVerification(t *testing.T) {
+	vaultClient := vault.NewMock(map[string]vault.EngineType{
+		"secrets": vault.EngineTypeKeyValueV1,
+	})
+	vaultClient.Write("secrets/foo", map[string]interface{}{"foo": "bar"})
+	mappings := []Mapping{{
+		VaultPath:       "secrets/foo",
+		SecretName:      "foo",
+		VaultEngineType: vault.EngineTypeKeyValueV1,
+	}}
+
+	// without verification, the altered secret goes unnoticed.
+	r, err := New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(mutatingSecrets{NewFakeSecrets()}),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+
+	r, err = New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(mutatingSecrets{NewFakeSecrets()}),
+		WithWriteVerification(),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	err = r.Reflect(context.Background(), mappings)
+	verr, ok := err.(*VerificationError)
+	if !ok {
+		t.Fatalf("expected a verification error, got %v", err)
+	}
+	if verr.SecretName != "foo" || !reflect.DeepEqual(verr.Keys, []string{"injected"}) {
+		t.Errorf("unexpected verification error: %s", verr)
+	}
+
+	// secrets that aren't altered pass.
+	r, err = New(
+		context.Background(),
+		WithVault(vaultClient),
+		WithSecretClient(NewFakeSecrets()),
+		WithWriteVerification(),
+	)
+	if err != nil {
+		t.Fatalf("unable to create reflector: %s", err)
+	}
+	if err := r.Reflect(context.Background(), mappings); err != nil {
+		t.Fatalf("reflect didn't work: %s", err)
+	}
+}
+
+func TestDifferingKeys(t *testing.T) {
+	keys := differingKeys(
+		map[string][]byte{"same": []byte("a"), "altered": []byte("b"), "removed": nil},
+		map[string][]byte{"same": []byte("a"), "altered": []byte("c"), "added": nil},
+	)
+	expected := []string{"added", "altered", "removed"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
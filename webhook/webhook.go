@@ -0,0 +1,281 @@
+// Package webhook implements a mutating admission webhook that injects
+// pentagon-managed secrets into pods, so that manifests can refer to a
+// mapping rather than hardcode how its secret is consumed.
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/vimeo/pentagon"
+)
+
+const (
+	// InjectAnnotation lists the comma-separated names of the
+	// pentagon-managed secrets to inject into a pod.
+	InjectAnnotation = "pentagon.vimeo.com/inject"
+
+	// InjectAsAnnotation selects how secrets are injected: "env" (the
+	// default) adds them to every container's envFrom and "volume" mounts
+	// them in every container under MountPath.
+	InjectAsAnnotation = "pentagon.vimeo.com/inject-as"
+
+	// MountPath is the directory under which injected secret volumes are
+	// mounted, each in a directory named after the secret.
+	MountPath = "/var/run/secrets/pentagon"
+)
+
+// maxReviewSize bounds the size of an admission review request.
+const maxReviewSize = 4 << 20
+
+// patchOperation is a single JSON patch operation.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Injector is an http.Handler serving admission reviews of pods.
+type Injector struct {
+	namespace string
+	mappings  map[string][]pentagon.Mapping
+}
+
+// NewInjector returns an Injector for pods that may refer to the secrets
+// of mappings in the namespaces they target, with namespace as the default
+// one.
+func NewInjector(namespace string, mappings []pentagon.Mapping) *Injector {
+	bySecret := make(map[string][]pentagon.Mapping, len(mappings))
+	for _, m := range mappings {
+		bySecret[m.SecretName] = append(bySecret[m.SecretName], m)
+	}
+	return &Injector{
+		namespace: namespace,
+		mappings:  bySecret,
+	}
+}
+
+// managed returns true if one of the mappings of the secret named name
+// targets namespace.
+func (i *Injector) managed(namespace, name string) bool {
+	for _, m := range i.mappings[name] {
+		if m.TargetsNamespace(i.namespace, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP answers an admission review with the patch injecting the
+// secrets requested by the pod's annotations.
+func (i *Injector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReviewSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading review: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	review := v1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	// answer with the version of the review that was sent.
+	response := v1beta1.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: i.review(review.Request),
+	}
+	response.Response.UID = review.Request.UID
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("error writing admission response: %s", err)
+	}
+}
+
+// review returns the response to an admission request for a pod.
+func (i *Injector) review(req *v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse {
+	pod := v1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		return deny(fmt.Sprintf("error decoding pod: %s", err))
+	}
+
+	namespace := pod.Namespace
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+
+	patch, err := i.patch(namespace, &pod)
+	if err != nil {
+		return deny(err.Error())
+	}
+	if len(patch) == 0 {
+		return &v1beta1.AdmissionResponse{Allowed: true}
+	}
+
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return deny(fmt.Sprintf("error encoding patch: %s", err))
+	}
+	patchType := v1beta1.PatchTypeJSONPatch
+	return &v1beta1.AdmissionResponse{
+		Allowed:   true,
+		Patch:     raw,
+		PatchType: &patchType,
+	}
+}
+
+// deny returns a response rejecting a pod because of message.
+func deny(message string) *v1beta1.AdmissionResponse {
+	return &v1beta1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: message,
+		},
+	}
+}
+
+// patch returns the JSON patch injecting the secrets requested by the
+// pod's annotations.  Pods referring to secrets that aren't managed by
+// pentagon in their namespace are rejected.
+func (i *Injector) patch(namespace string, pod *v1.Pod) ([]patchOperation, error) {
+	value, ok := pod.Annotations[InjectAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	secrets := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !i.managed(namespace, name) {
+			return nil, fmt.Errorf(
+				"secret %s is not managed by pentagon in namespace %s",
+				name,
+				namespace,
+			)
+		}
+		secrets = append(secrets, name)
+	}
+
+	switch as := pod.Annotations[InjectAsAnnotation]; as {
+	case "", "env":
+		return envPatch(pod, secrets), nil
+	case "volume":
+		return volumePatch(pod, secrets), nil
+	default:
+		return nil, fmt.Errorf("unknown %s value: %q", InjectAsAnnotation, as)
+	}
+}
+
+// envPatch adds secrets to the envFrom of every container.
+func envPatch(pod *v1.Pod, secrets []string) []patchOperation {
+	patch := []patchOperation{}
+	for c, container := range pod.Spec.Containers {
+		sources := make([]interface{}, 0, len(secrets))
+		for _, name := range secrets {
+			sources = append(sources, v1.EnvFromSource{
+				SecretRef: &v1.SecretEnvSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: name},
+				},
+			})
+		}
+		patch = append(patch, appendOperations(
+			fmt.Sprintf("/spec/containers/%d/envFrom", c),
+			len(container.EnvFrom) == 0,
+			sources,
+		)...)
+	}
+	return patch
+}
+
+// volumePatch adds a projected volume for each secret and mounts it in
+// every container.
+func volumePatch(pod *v1.Pod, secrets []string) []patchOperation {
+	volumes := make([]interface{}, 0, len(secrets))
+	mounts := make([]interface{}, 0, len(secrets))
+	for _, name := range secrets {
+		volumeName := volumeName(name)
+		volumes = append(volumes, v1.Volume{
+			Name: volumeName,
+			VolumeSource: v1.VolumeSource{
+				Projected: &v1.ProjectedVolumeSource{
+					Sources: []v1.VolumeProjection{{
+						Secret: &v1.SecretProjection{
+							LocalObjectReference: v1.LocalObjectReference{Name: name},
+						},
+					}},
+				},
+			},
+		})
+		mounts = append(mounts, v1.VolumeMount{
+			Name:      volumeName,
+			MountPath: path.Join(MountPath, name),
+			ReadOnly:  true,
+		})
+	}
+
+	patch := appendOperations("/spec/volumes", len(pod.Spec.Volumes) == 0, volumes)
+	for c, container := range pod.Spec.Containers {
+		patch = append(patch, appendOperations(
+			fmt.Sprintf("/spec/containers/%d/volumeMounts", c),
+			len(container.VolumeMounts) == 0,
+			mounts,
+		)...)
+	}
+	return patch
+}
+
+// volumeName returns the name of the volume of the secret named secret,
+// which must be a DNS-1123 label while secret names may have dots and be
+// longer.  Such names get their dots replaced and are truncated, with a
+// hash of the secret name so that volumes of different secrets don't
+// collide.
+func volumeName(secret string) string {
+	name := "pentagon-" + secret
+	if !strings.Contains(name, ".") && len(name) <= validation.DNS1123LabelMaxLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	suffix := "-" + hex.EncodeToString(sum[:])[:volumeHashLength]
+	name = strings.Replace(name, ".", "-", -1)
+	if len(name) > validation.DNS1123LabelMaxLength-len(suffix) {
+		name = name[:validation.DNS1123LabelMaxLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// volumeHashLength is the number of hex digits of the secret name hash in
+// the names of volumes.
+const volumeHashLength = 10
+
+// appendOperations returns the operations appending values to the array at
+// arrayPath, creating it if it is empty.
+func appendOperations(arrayPath string, empty bool, values []interface{}) []patchOperation {
+	if empty {
+		return []patchOperation{{Op: "add", Path: arrayPath, Value: values}}
+	}
+
+	patch := make([]patchOperation, 0, len(values))
+	for _, value := range values {
+		patch = append(patch, patchOperation{Op: "add", Path: arrayPath + "/-", Value: value})
+	}
+	return patch
+}
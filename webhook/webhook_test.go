@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/vimeo/pentagon"
+)
+
+func review(t *testing.T, i *Injector, pod *v1.Pod) *v1beta1.AdmissionResponse {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("unable to encode pod: %s", err)
+	}
+	body, err := json.Marshal(v1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "admission.k8s.io/v1",
+			Kind:       "AdmissionReview",
+		},
+		Request: &v1beta1.AdmissionRequest{
+			UID:       "123",
+			Namespace: "default",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to encode review: %s", err)
+	}
+
+	rec := httptest.NewRecorder()
+	i.ServeHTTP(rec, httptest.NewRequest("POST", "/mutate", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+
+	response := v1beta1.AdmissionReview{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if response.APIVersion != "admission.k8s.io/v1" || response.Response.UID != "123" {
+		t.Fatalf("response doesn't match the request: %+v", response)
+	}
+	return response.Response
+}
+
+func TestInjector(t *testing.T) {
+	i := NewInjector("default", []pentagon.Mapping{
+		{VaultPath: "secrets/data/db", SecretName: "db"},
+		{VaultPath: "secrets/data/api", SecretName: "api"},
+	})
+
+	for testName, tbl := range map[string]struct {
+		annotations map[string]string
+		allowed     bool
+		patch       []patchOperation
+	}{
+		"none": {
+			annotations: nil,
+			allowed:     true,
+		},
+		"env": {
+			annotations: map[string]string{InjectAnnotation: "db, api"},
+			allowed:     true,
+			patch: []patchOperation{
+				{Op: "add", Path: "/spec/containers/0/envFrom", Value: []interface{}{
+					map[string]interface{}{"secretRef": map[string]interface{}{"name": "db"}},
+					map[string]interface{}{"secretRef": map[string]interface{}{"name": "api"}},
+				}},
+				{Op: "add", Path: "/spec/containers/1/envFrom/-", Value: map[string]interface{}{
+					"secretRef": map[string]interface{}{"name": "db"},
+				}},
+				{Op: "add", Path: "/spec/containers/1/envFrom/-", Value: map[string]interface{}{
+					"secretRef": map[string]interface{}{"name": "api"},
+				}},
+			},
+		},
+		"volume": {
+			annotations: map[string]string{
+				InjectAnnotation:   "db",
+				InjectAsAnnotation: "volume",
+			},
+			allowed: true,
+			patch: []patchOperation{
+				{Op: "add", Path: "/spec/volumes", Value: []interface{}{
+					map[string]interface{}{
+						"name": "pentagon-db",
+						"projected": map[string]interface{}{
+							"sources": []interface{}{
+								map[string]interface{}{"secret": map[string]interface{}{"name": "db"}},
+							},
+						},
+					},
+				}},
+				{Op: "add", Path: "/spec/containers/0/volumeMounts", Value: []interface{}{
+					map[string]interface{}{
+						"name":      "pentagon-db",
+						"mountPath": "/var/run/secrets/pentagon/db",
+						"readOnly":  true,
+					},
+				}},
+				{Op: "add", Path: "/spec/containers/1/volumeMounts", Value: []interface{}{
+					map[string]interface{}{
+						"name":      "pentagon-db",
+						"mountPath": "/var/run/secrets/pentagon/db",
+						"readOnly":  true,
+					},
+				}},
+			},
+		},
+		"unmanaged": {
+			annotations: map[string]string{InjectAnnotation: "other"},
+			allowed:     false,
+		},
+		"unknown mode": {
+			annotations: map[string]string{
+				InjectAnnotation:   "db",
+				InjectAsAnnotation: "file",
+			},
+			allowed: false,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Annotations: tbl.annotations,
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{Name: "app"},
+						{
+							Name: "sidecar",
+							EnvFrom: []v1.EnvFromSource{
+								{ConfigMapRef: &v1.ConfigMapEnvSource{
+									LocalObjectReference: v1.LocalObjectReference{Name: "config"},
+								}},
+							},
+						},
+					},
+				},
+			}
+
+			resp := review(t, i, pod)
+			if resp.Allowed != tbl.allowed {
+				t.Fatalf("expected allowed %t, got %t: %+v", tbl.allowed, resp.Allowed, resp.Result)
+			}
+			if tbl.patch == nil {
+				if len(resp.Patch) != 0 {
+					t.Fatalf("expected no patch, got %s", resp.Patch)
+				}
+				return
+			}
+
+			expected, err := json.Marshal(tbl.patch)
+			if err != nil {
+				t.Fatalf("unable to encode expected patch: %s", err)
+			}
+			var expectedPatch, actualPatch interface{}
+			json.Unmarshal(expected, &expectedPatch)
+			json.Unmarshal(resp.Patch, &actualPatch)
+			expectedJSON, _ := json.Marshal(expectedPatch)
+			actualJSON, _ := json.Marshal(actualPatch)
+			if !bytes.Equal(expectedJSON, actualJSON) {
+				t.Fatalf("expected patch %s, got %s", expectedJSON, actualJSON)
+			}
+		})
+	}
+}
+
+func TestInjectorNamespaces(t *testing.T) {
+	i := NewInjector("pentagon", []pentagon.Mapping{
+		{VaultPath: "secrets/data/db", SecretName: "db"},
+		{VaultPath: "secrets/data/registry", SecretName: "registry", Namespaces: []string{"team-a"}},
+		{VaultPath: "secrets/data/ca", SecretName: "ca", AllNamespaces: true, ExcludeNamespaces: []string{"team-b"}},
+		{VaultPath: "secrets/data/labeled", SecretName: "labeled", AllNamespaces: true, NamespaceSelector: "team"},
+	})
+
+	for testName, tbl := range map[string]struct {
+		namespace string
+		secret    string
+		allowed   bool
+	}{
+		"default namespace":          {namespace: "pentagon", secret: "db", allowed: true},
+		"not in default namespace":   {namespace: "team-a", secret: "db"},
+		"listed namespace":           {namespace: "team-a", secret: "registry", allowed: true},
+		"not in listed namespaces":   {namespace: "pentagon", secret: "registry"},
+		"all namespaces":             {namespace: "team-a", secret: "ca", allowed: true},
+		"excluded namespace":         {namespace: "team-b", secret: "ca"},
+		"system namespace":           {namespace: "kube-system", secret: "ca"},
+		"unknown namespace selector": {namespace: "team-a", secret: "labeled"},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Annotations: map[string]string{InjectAnnotation: tbl.secret},
+				},
+				Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+			}
+			_, err := i.patch(tbl.namespace, pod)
+			if (err == nil) != tbl.allowed {
+				t.Fatalf("expected allowed %t, got %v", tbl.allowed, err)
+			}
+		})
+	}
+}
+
+func TestVolumeName(t *testing.T) {
+	long := strings.Repeat("a", 250)
+	for _, secret := range []string{"db", "db.example.com", "db-example-com", long, long + "b"} {
+		name := volumeName(secret)
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			t.Errorf("volume name %q of %s isn't a label: %s", name, secret, strings.Join(errs, ", "))
+		}
+	}
+
+	if name := volumeName("db"); name != "pentagon-db" {
+		t.Errorf("expected pentagon-db, got %s", name)
+	}
+	if volumeName("db.example.com") == volumeName("db-example-com") {
+		t.Error("secrets differing by their dots should have different volumes")
+	}
+	if volumeName(long) == volumeName(long+"b") {
+		t.Error("long secrets with the same prefix should have different volumes")
+	}
+}